@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || netbsd
+
+package action
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTimeOf gets access time of a file from its metadata, if available
+func accessTimeOf(fileInfo os.FileInfo) (time.Time, bool) {
+	stat, isStat := fileInfo.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(stat.Atimespec.Sec), int64(stat.Atimespec.Nsec)), true
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package action
+
+import (
+	"os"
+	"time"
+)
+
+// accessTimeOf gets access time of a file from its metadata, if available (it isn't, on this platform)
+func accessTimeOf(os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,16 @@
+package action
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTimeOf gets access time of a file from its metadata, if available
+func accessTimeOf(fileInfo os.FileInfo) (time.Time, bool) {
+	attributes, isAttributes := fileInfo.Sys().(*syscall.Win32FileAttributeData)
+	if !isAttributes {
+		return time.Time{}, false
+	}
+	return time.Unix(0, attributes.LastAccessTime.Nanoseconds()), true
+}
@@ -1,6 +1,16 @@
 package action
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// ErrNotPermitted is why an action changing attributes of a file (its permissions, owner or timestamps) fails when the
+// process isn't privileged enough to change them (e.g. it's not run as root, or doesn't own the file). Such actions are
+// skipped rather than counted as failed.
+var ErrNotPermitted = errors.New("changing attributes of the file isn't permitted")
 
 // SyncAction is implemented by any action that propagates action at source to action at destination
 type SyncAction interface {
@@ -10,14 +20,22 @@ type SyncAction interface {
 	destinationPath() string
 	// UnixCommand must generate a unix command
 	UnixCommand() string
-	// Perform must perform the actual action
-	Perform() error
+	// Perform must perform the actual action, as per settings of the run it's part of (nil meaning default settings)
+	Perform(r *Run) error
 	// Uniqueness should define a string that's unique with an action
 	Uniqueness() string
 }
 
 const cmdSeparator = "\u0001"
 
+// notPermitted wraps an error due to lack of privilege in ErrNotPermitted (leaving other errors as they are)
+func notPermitted(err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w (%+v)", ErrNotPermitted, err)
+	}
+	return err
+}
+
 // escape escapes the path for use in a unix command
 func escape(path string) string {
 	escaped := path
@@ -0,0 +1,45 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// isCaseOnlyRename checks whether a move from one path to another only changes case of the name, on a
+// case-insensitive filesystem (i.e. both paths are the same file)
+func isCaseOnlyRename(fromPath, toPath string) bool {
+	if fromPath == toPath || !strings.EqualFold(fromPath, toPath) {
+		return false
+	}
+	fromInfo, fromErr := os.Lstat(fromPath)
+	if fromErr != nil {
+		return false
+	}
+	toInfo, toErr := os.Lstat(toPath)
+	if toErr != nil {
+		return false
+	}
+	return os.SameFile(fromInfo, toInfo)
+}
+
+// renameCaseOnly changes case of name of a file on a case-insensitive filesystem. This is done in two steps, through
+// a temporary name, since some filesystems consider the new name to already exist.
+func renameCaseOnly(fromPath, toPath string) error {
+	tempPath := fromPath + tempSuffix
+	if _, err := os.Lstat(tempPath); err == nil {
+		return fmt.Errorf(`error: file "%s" already exists`, tempPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(fromPath, tempPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, toPath); err != nil {
+		// Best effort to restore the original name:
+		_ = os.Rename(tempPath, fromPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameCaseOnly(t *testing.T) {
+	dirPath := t.TempDir()
+	fromPath, toPath := filepath.Join(dirPath, "Photo.JPG"), filepath.Join(dirPath, "photo.jpg")
+	assert.NoError(t, os.WriteFile(fromPath, []byte("photo"), 0644))
+	_, err := os.Lstat(toPath)
+	assert.Equal(t, err == nil, isCaseOnlyRename(fromPath, toPath))
+	assert.False(t, isCaseOnlyRename(fromPath, fromPath))
+	assert.NoError(t, renameCaseOnly(fromPath, toPath))
+	names, err := os.ReadDir(dirPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(names))
+	assert.Equal(t, "photo.jpg", names[0].Name())
+	// Temporary name is never clobbered:
+	assert.NoError(t, os.WriteFile(toPath+tempSuffix, []byte("unrelated"), 0644))
+	assert.Error(t, renameCaseOnly(toPath, fromPath))
+	assert.FileExists(t, toPath)
+}
+
+func TestMoveFileActionCaseOnlyUnixCommand(t *testing.T) {
+	a := MoveFileAction{BasePath: "/backup", RelativeFromPath: "Photo.JPG", RelativeToPath: "photo.jpg"}
+	assert.Equal(t, `mv -v -n "/backup/Photo.JPG" "/backup/Photo.JPG`+tempSuffix+`" && `+
+		`mv -v -n "/backup/Photo.JPG`+tempSuffix+`" "/backup/photo.jpg"`, a.UnixCommand())
+}
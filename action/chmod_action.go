@@ -0,0 +1,42 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ChmodAction is a SyncAction for changing permissions of a file to those of its counterpart at source
+type ChmodAction struct {
+	BasePath     string
+	RelativePath string
+	// Mode is permissions the file is to have (only permission bits are used)
+	Mode os.FileMode
+}
+
+func (a ChmodAction) sourcePath() string {
+	return "" // Not Applicable
+}
+
+func (a ChmodAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativePath)
+}
+
+// UnixCommand for changing permissions of a file
+func (a ChmodAction) UnixCommand() string {
+	return fmt.Sprintf(`chmod %03o "%s"`, a.Mode.Perm(), escape(a.destinationPath()))
+}
+
+// Perform the 'change permissions' action (see ErrNotPermitted)
+func (a ChmodAction) Perform(_ *Run) error {
+	return notPermitted(os.Chmod(a.destinationPath(), a.Mode.Perm()))
+}
+
+// Uniqueness generates unique string for change of permissions
+func (a ChmodAction) Uniqueness() string {
+	return "chmod" + cmdSeparator + a.RelativePath
+}
+
+func (a ChmodAction) String() string {
+	return fmt.Sprintf(`change permissions of "%s" to %s`, a.destinationPath(), a.Mode.Perm())
+}
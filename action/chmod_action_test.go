@@ -0,0 +1,26 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestChmodAction(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions other than read-only can't be changed on Windows")
+	}
+	dirPath := t.TempDir()
+	writeFile(t, filepath.Join(dirPath, "a.sh"), "echo a")
+	a := ChmodAction{BasePath: dirPath, RelativePath: "a.sh", Mode: 0750}
+	assert.NoError(t, CheckPreconditions(a, nil))
+	assert.False(t, IsDone(a))
+	assert.NoError(t, a.Perform(nil))
+	info, err := os.Stat(filepath.Join(dirPath, "a.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	assert.True(t, IsDone(a))
+	assert.Error(t, CheckPreconditions(ChmodAction{BasePath: dirPath, RelativePath: "b.sh", Mode: 0750}, nil))
+}
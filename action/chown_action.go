@@ -0,0 +1,87 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// numericIDs, when set, makes commands of ChownAction refer to users and groups by their IDs rather than by names
+var numericIDs = false
+
+// NumericIDsOn makes commands of ChownAction refer to users and groups by their IDs (as by rsync's --numeric-ids)
+func NumericIDsOn() {
+	numericIDs = true
+}
+
+// chown is a variable so that tests can simulate lack of privilege
+var chown = os.Lchown
+
+// ChownAction is a SyncAction for changing user and/or group owning a file to those of its counterpart at source
+type ChownAction struct {
+	BasePath     string
+	RelativePath string
+	// UID is ID of user the file is to be owned by (-1 meaning it's left as it is)
+	UID int
+	// GID is ID of group the file is to be owned by (-1 meaning it's left as it is)
+	GID int
+}
+
+func (a ChownAction) sourcePath() string {
+	return "" // Not Applicable
+}
+
+func (a ChownAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativePath)
+}
+
+// userName gets name of the user with given ID (or the ID itself, if it has no name or numericIDs is set)
+func userName(uid int) string {
+	if !numericIDs {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			return u.Username
+		}
+	}
+	return strconv.Itoa(uid)
+}
+
+// groupName gets name of the group with given ID (or the ID itself, if it has no name or numericIDs is set)
+func groupName(gid int) string {
+	if !numericIDs {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			return g.Name
+		}
+	}
+	return strconv.Itoa(gid)
+}
+
+// owner is the argument to 'chown' command
+func (a ChownAction) owner() string {
+	if a.UID < 0 {
+		return ":" + groupName(a.GID)
+	} else if a.GID < 0 {
+		return userName(a.UID)
+	}
+	return userName(a.UID) + ":" + groupName(a.GID)
+}
+
+// UnixCommand for changing owner of a file
+func (a ChownAction) UnixCommand() string {
+	return fmt.Sprintf(`chown -h %s "%s"`, escape(a.owner()), escape(a.destinationPath()))
+}
+
+// Perform the 'change owner' action (see ErrNotPermitted, which is the usual case when not run as root)
+func (a ChownAction) Perform(_ *Run) error {
+	return notPermitted(chown(a.destinationPath(), a.UID, a.GID))
+}
+
+// Uniqueness generates unique string for change of owner
+func (a ChownAction) Uniqueness() string {
+	return "chown" + cmdSeparator + a.RelativePath
+}
+
+func (a ChownAction) String() string {
+	return fmt.Sprintf(`change owner of "%s" to %s`, a.destinationPath(), a.owner())
+}
@@ -0,0 +1,51 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestChownActionUnixCommand(t *testing.T) {
+	defer func() { numericIDs = false }()
+	numericIDs = true
+	assert.Equal(t, `chown -h 1000:100 "/d/a.txt"`,
+		ChownAction{BasePath: "/d", RelativePath: "a.txt", UID: 1000, GID: 100}.UnixCommand())
+	assert.Equal(t, `chown -h 1000 "/d/a.txt"`,
+		ChownAction{BasePath: "/d", RelativePath: "a.txt", UID: 1000, GID: -1}.UnixCommand())
+	assert.Equal(t, `chown -h :100 "/d/a.txt"`,
+		ChownAction{BasePath: "/d", RelativePath: "a.txt", UID: -1, GID: 100}.UnixCommand())
+	// Users and groups are referred to by names, if they have them:
+	numericIDs = false
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("current user can't be looked up on this platform")
+	}
+	a := ChownAction{BasePath: "/d", RelativePath: "a.txt", UID: os.Getuid(), GID: -1}
+	assert.Equal(t, `chown -h `+current.Username+` "/d/a.txt"`, a.UnixCommand())
+}
+
+func TestChownActionNotPermitted(t *testing.T) {
+	defer func() { chown = os.Lchown }()
+	var chowned []string
+	chown = func(path string, uid int, gid int) error {
+		chowned = append(chowned, path)
+		return &os.PathError{Op: "lchown", Path: path, Err: syscall.EPERM}
+	}
+	dirPath := t.TempDir()
+	writeFile(t, filepath.Join(dirPath, "a.txt"), "a")
+	// Lack of privilege, which is the usual case when not run as root, is told apart (so that it's skipped):
+	err := ChownAction{BasePath: dirPath, RelativePath: "a.txt", UID: 12345, GID: 12345}.Perform(nil)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	assert.Equal(t, []string{filepath.Join(dirPath, "a.txt")}, chowned)
+	// ...unlike others:
+	chown = func(path string, uid int, gid int) error {
+		return &os.PathError{Op: "lchown", Path: path, Err: syscall.ENOENT}
+	}
+	err = ChownAction{BasePath: dirPath, RelativePath: "a.txt", UID: 12345, GID: 12345}.Perform(nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotPermitted)
+}
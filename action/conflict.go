@@ -0,0 +1,53 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Policies on what a file move does when another file is at its new path already (see Settings.ConflictPolicy)
+const (
+	// ConflictSkip leaves the file that's in the way as it is, failing the move (so that rsync takes care of both)
+	ConflictSkip = "skip"
+	// ConflictTrash moves the file that's in the way into a trash directory, keeping its path relative to destination
+	ConflictTrash = "trash"
+	// ConflictOverwrite replaces the file that's in the way
+	ConflictOverwrite = "overwrite"
+)
+
+// ConflictPolicies lists all valid policies on conflicting file moves
+var ConflictPolicies = []string{ConflictSkip, ConflictTrash, ConflictOverwrite}
+
+// conflictPolicy returns conflict policy of the run (ConflictSkip, if it isn't set)
+func (r *Run) conflictPolicy() string {
+	if policy := r.settings().ConflictPolicy; policy != "" {
+		return policy
+	}
+	return ConflictSkip
+}
+
+// makeWay gets the file at given path (relative to basePath) out of the way of a file move, as per conflict policy of
+// the run
+func (r *Run) makeWay(basePath string, relativePath string) error {
+	path := filepath.Join(basePath, relativePath)
+	info, statErr := os.Lstat(path)
+	if statErr != nil {
+		return statErr
+	}
+	if info.IsDir() {
+		return fmt.Errorf("error: \"%s\" is a directory, which is never moved out of the way", path)
+	}
+	if r.conflictPolicy() == ConflictOverwrite {
+		return os.Remove(path)
+	}
+	trashPath := filepath.Join(r.settings().TrashDirPath, relativePath)
+	if err := os.MkdirAll(filepath.Dir(trashPath), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	if err := r.moveNoClobber(path, trashPath, false); err != nil {
+		return fmt.Errorf("couldn't move \"%s\" out of the way into trash directory: %+v", path, err)
+	}
+	r.addTrashedFile(path)
+	return nil
+}
@@ -0,0 +1,47 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFileActionConflict(t *testing.T) {
+	dirPath, trashDir := t.TempDir(), t.TempDir()
+	write := func(name string, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dirPath, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dirPath, name), []byte(content), 0644))
+	}
+	write("a.jpg", "new")
+	write("2021/b.jpg", "old")
+	a := MoveFileAction{BasePath: dirPath, RelativeFromPath: "a.jpg", RelativeToPath: "2021/b.jpg"}
+	// By default, nothing is overwritten:
+	err := a.Perform(nil)
+	assert.ErrorIs(t, err, os.ErrExist)
+	assert.Equal(t, `error: file "`+filepath.Join(dirPath, "2021/b.jpg")+`" already exists`, err.Error())
+	assert.Error(t, CheckPreconditions(a, nil))
+	// File in the way is moved into trash directory:
+	run := NewRun(Settings{ConflictPolicy: ConflictTrash, TrashDirPath: trashDir})
+	assert.NoError(t, CheckPreconditions(a, run))
+	assert.NoError(t, a.Perform(run))
+	assert.Equal(t, "new", readFile(t, filepath.Join(dirPath, "2021/b.jpg")))
+	assert.Equal(t, "old", readFile(t, filepath.Join(trashDir, "2021/b.jpg")))
+	assert.Equal(t, []string{filepath.Join(dirPath, "2021/b.jpg")}, run.TrashedFiles())
+	// ...unless there's a file of that name in trash directory already:
+	write("a.jpg", "newer")
+	assert.Error(t, a.Perform(run))
+	assert.Equal(t, "newer", readFile(t, filepath.Join(dirPath, "a.jpg")))
+	assert.Len(t, run.TrashedFiles(), 1)
+	// File in the way is replaced:
+	run = NewRun(Settings{ConflictPolicy: ConflictOverwrite})
+	assert.NoError(t, a.Perform(run))
+	assert.Equal(t, "newer", readFile(t, filepath.Join(dirPath, "2021/b.jpg")))
+	assert.NoFileExists(t, filepath.Join(dirPath, "a.jpg"))
+	// Directories are never moved out of the way:
+	write("c.jpg", "new")
+	assert.NoError(t, os.Mkdir(filepath.Join(dirPath, "d.jpg"), 0755))
+	assert.Error(t, MoveFileAction{BasePath: dirPath, RelativeFromPath: "c.jpg", RelativeToPath: "d.jpg"}.Perform(run))
+	assert.DirExists(t, filepath.Join(dirPath, "d.jpg"))
+	assert.Empty(t, run.TrashedFiles())
+}
@@ -0,0 +1,105 @@
+package action
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CopyFileAction is a SyncAction for copying a file from outside destination (e.g. from an archive directory) into
+// destination, preserving its modification timestamp
+type CopyFileAction struct {
+	// FromPath is absolute path of the file copied
+	FromPath       string
+	BasePath       string
+	RelativeToPath string
+}
+
+func (a CopyFileAction) sourcePath() string {
+	return a.FromPath
+}
+
+func (a CopyFileAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativeToPath)
+}
+
+// UnixCommand for copying a file
+func (a CopyFileAction) UnixCommand() string {
+	return fmt.Sprintf(`cp -p -n "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
+}
+
+// Perform 'file copy' action (this never overwrites an existing file), at no more than bandwidth limit of the run (see
+// Settings.CopyBandwidthLimit)
+func (a CopyFileAction) Perform(r *Run) error {
+	return copyNoClobber(a.sourcePath(), a.destinationPath(), r.settings().CopyBandwidthLimit)
+}
+
+// Uniqueness generates unique string for file copy
+func (a CopyFileAction) Uniqueness() string {
+	return "cp" + cmdSeparator + a.RelativeToPath
+}
+
+func (a CopyFileAction) String() string {
+	return fmt.Sprintf(`copy file from "%s" to "%s"`, a.sourcePath(), a.destinationPath())
+}
+
+// copyNoClobber copies a file, along with its permissions and modification timestamp, without ever overwriting an
+// existing file (a partially copied file is removed), reading it at no more than given rate (in bytes per second, 0
+// meaning no limit)
+func copyNoClobber(fromPath, toPath string, bandwidthLimit int64) error {
+	fromFile, openErr := os.Open(fromPath)
+	if openErr != nil {
+		return openErr
+	}
+	defer fromFile.Close()
+	info, statErr := fromFile.Stat()
+	if statErr != nil {
+		return statErr
+	}
+	toFile, createErr := os.OpenFile(toPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if os.IsExist(createErr) {
+		return fmt.Errorf(`error: file "%s" already exists`, toPath)
+	} else if createErr != nil {
+		return createErr
+	}
+	var reader io.Reader = fromFile
+	if bandwidthLimit > 0 {
+		reader = &rateLimitedReader{reader: fromFile, bytesPerSecond: bandwidthLimit, start: time.Now()}
+	}
+	_, copyErr := io.Copy(toFile, reader)
+	closeErr := toFile.Close()
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		_ = os.Remove(toPath)
+		return copyErr
+	}
+	return os.Chtimes(toPath, info.ModTime(), info.ModTime())
+}
+
+// rateLimitedReader reads from reader at no more than given rate on average, by sleeping after reads that are ahead of
+// it
+type rateLimitedReader struct {
+	reader         io.Reader
+	bytesPerSecond int64
+	start          time.Time
+	numBytesRead   int64
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// Reads are capped to a tenth of a second's worth of bytes, so that the rate is even (instead of bursts and long
+	// sleeps):
+	if maxLength := r.bytesPerSecond/10 + 1; int64(len(p)) > maxLength {
+		p = p[:maxLength]
+	}
+	n, err := r.reader.Read(p)
+	r.numBytesRead += int64(n)
+	expectedElapsed := time.Duration(float64(r.numBytesRead) / float64(r.bytesPerSecond) * float64(time.Second))
+	if ahead := expectedElapsed - time.Since(r.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyFileAction(t *testing.T) {
+	archiveDir, dir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(archiveDir, "a.txt"), "archived")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(archiveDir, "a.txt"), modTime, modTime))
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	a := CopyFileAction{FromPath: filepath.Join(archiveDir, "a.txt"), BasePath: dir, RelativeToPath: "a.txt"}
+	assert.NoError(t, a.Perform(nil))
+	assert.Equal(t, "archived", readFile(t, filepath.Join(dir, "a.txt")))
+	assert.Equal(t, "archived", readFile(t, filepath.Join(archiveDir, "a.txt")))
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	assert.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+	// Existing files are never overwritten:
+	a = CopyFileAction{FromPath: filepath.Join(archiveDir, "a.txt"), BasePath: dir, RelativeToPath: "b.txt"}
+	assert.Error(t, a.Perform(nil))
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "b.txt")))
+}
+
+func TestCopyFileActionBandwidthLimit(t *testing.T) {
+	archiveDir, dir := t.TempDir(), t.TempDir()
+	// 30 KiB, at 100 KiB per second:
+	writeFile(t, filepath.Join(archiveDir, "a.bin"), strings.Repeat("a", 30*1024))
+	start := time.Now()
+	a := CopyFileAction{FromPath: filepath.Join(archiveDir, "a.bin"), BasePath: dir, RelativeToPath: "a.bin"}
+	assert.NoError(t, a.Perform(NewRun(Settings{CopyBandwidthLimit: 100 * 1024})))
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, 30*1024, len(readFile(t, filepath.Join(dir, "a.bin"))))
+}
@@ -24,7 +24,7 @@ func (a MakeDirectoryAction) UnixCommand() string {
 }
 
 // Perform the 'create directory' action
-func (a MakeDirectoryAction) Perform() error {
+func (a MakeDirectoryAction) Perform(_ *Run) error {
 	return os.MkdirAll(a.destinationPath(), os.ModeDir|os.ModePerm)
 }
 
@@ -0,0 +1,66 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MoveDirectoryAction is a SyncAction for moving or renaming a directory, along with everything inside it
+type MoveDirectoryAction struct {
+	BasePath         string
+	RelativeFromPath string
+	RelativeToPath   string
+}
+
+func (a MoveDirectoryAction) sourcePath() string {
+	return filepath.Join(a.BasePath, a.RelativeFromPath)
+}
+
+func (a MoveDirectoryAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativeToPath)
+}
+
+// UnixCommand for moving or renaming a directory
+func (a MoveDirectoryAction) UnixCommand() string {
+	return fmt.Sprintf(`mv -v -n "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
+}
+
+// errNoReplaceUnsupported is returned by renameNoReplace where it isn't supported
+var errNoReplaceUnsupported = errors.New("rename without replacing isn't supported")
+
+// Perform 'directory move/rename' action. This fails if anything already exists at the new path (a plain rename
+// would replace an empty directory there): atomically where possible (see renameNoReplace), and by checking before
+// renaming otherwise.
+func (a MoveDirectoryAction) Perform(_ *Run) error {
+	err := renameNoReplace(a.sourcePath(), a.destinationPath())
+	if errors.Is(err, errNoReplaceUnsupported) {
+		err = checkAndRename(a.sourcePath(), a.destinationPath())
+	}
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("can't move directory \"%s\", as \"%s\" already exists", a.sourcePath(),
+			a.destinationPath())
+	}
+	return err
+}
+
+// checkAndRename renames a file or directory, unless something exists at the new path (which, unlike with
+// renameNoReplace, may appear between the check and the rename)
+func checkAndRename(fromPath, toPath string) error {
+	if _, err := os.Lstat(toPath); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+// Uniqueness generates unique string for directory renaming/movement
+func (a MoveDirectoryAction) Uniqueness() string {
+	return "mvdir" + cmdSeparator + a.RelativeFromPath
+}
+
+func (a MoveDirectoryAction) String() string {
+	return fmt.Sprintf(`rename/move directory from "%s" to "%s"`, a.sourcePath(), a.destinationPath())
+}
@@ -0,0 +1,25 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveDirectoryAction(t *testing.T) {
+	dirPath := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dirPath, "photos", "2021"), 0755))
+	writeFile(t, filepath.Join(dirPath, "photos", "2021", "a.jpg"), "a")
+	assert.NoError(t, os.Mkdir(filepath.Join(dirPath, "empty"), 0755))
+	// An empty directory at the new path isn't replaced:
+	assert.Error(t, MoveDirectoryAction{BasePath: dirPath, RelativeFromPath: "photos",
+		RelativeToPath: "empty"}.Perform(nil))
+	assert.DirExists(t, filepath.Join(dirPath, "photos"))
+	// ...and neither is it when checking before renaming:
+	assert.ErrorIs(t, checkAndRename(filepath.Join(dirPath, "photos"), filepath.Join(dirPath, "empty")), os.ErrExist)
+	assert.NoError(t, MoveDirectoryAction{BasePath: dirPath, RelativeFromPath: "photos",
+		RelativeToPath: "pictures"}.Perform(nil))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dirPath, "pictures", "2021", "a.jpg")))
+	assert.NoDirExists(t, filepath.Join(dirPath, "photos"))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // MoveFileAction is a SyncAction for moving or renaming a file
@@ -22,20 +23,32 @@ func (a MoveFileAction) destinationPath() string {
 	return filepath.Join(a.BasePath, a.RelativeToPath)
 }
 
-// UnixCommand for moving or renaming a file
+// UnixCommand for moving or renaming a file, creating its new parent directory if needed (through a temporary name,
+// if only case of the name changes, as 'mv -n' would refuse such a rename on case-insensitive filesystems)
 func (a MoveFileAction) UnixCommand() string {
-	return fmt.Sprintf(`mv -v -n "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
+	if strings.EqualFold(a.sourcePath(), a.destinationPath()) {
+		tempPath := a.sourcePath() + tempSuffix
+		return fmt.Sprintf(`mv -v -n "%s" "%s" && mv -v -n "%s" "%s"`, escape(a.sourcePath()), escape(tempPath),
+			escape(tempPath), escape(a.destinationPath()))
+	}
+	return fmt.Sprintf(`mkdir -p "%s" && mv -v -n "%s" "%s"`, escape(filepath.Dir(a.destinationPath())),
+		escape(a.sourcePath()), escape(a.destinationPath()))
 }
 
-// Perform 'file move/rename' action
-func (a MoveFileAction) Perform() error {
-	if _, err := os.Stat(a.destinationPath()); err == nil {
-		return fmt.Errorf(`error: file "%s" already exists`, a.destinationPath())
-	} else if errors.Is(err, os.ErrNotExist) {
-		return os.Rename(a.sourcePath(), a.destinationPath())
-	} else {
+// Perform 'file move/rename' action, creating new parent directory of the file if needed. This never overwrites an
+// existing file (see moveNoClobber), unless conflict policy of the run says otherwise (see Settings.ConflictPolicy).
+func (a MoveFileAction) Perform(r *Run) error {
+	if err := os.MkdirAll(filepath.Dir(a.destinationPath()), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	err := r.moveNoClobber(a.sourcePath(), a.destinationPath(), r.isInterrupted(a))
+	if r.conflictPolicy() == ConflictSkip || !errors.Is(err, os.ErrExist) {
 		return err
 	}
+	if wErr := r.makeWay(a.BasePath, a.RelativeToPath); wErr != nil {
+		return wErr
+	}
+	return r.moveNoClobber(a.sourcePath(), a.destinationPath(), false)
 }
 
 // Uniqueness generates unique string for file renaming/movement
@@ -0,0 +1,24 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFileActionIntoNewDirectory(t *testing.T) {
+	dirPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "a.jpg"), []byte("photo"), 0644))
+	a := MoveFileAction{BasePath: dirPath, RelativeFromPath: "a.jpg",
+		RelativeToPath: filepath.Join("2021", "trip", "a.jpg")}
+	assert.NoError(t, a.Perform(nil))
+	assert.NoFileExists(t, filepath.Join(dirPath, "a.jpg"))
+	assert.FileExists(t, filepath.Join(dirPath, "2021", "trip", "a.jpg"))
+}
+
+func TestMoveFileActionUnixCommand(t *testing.T) {
+	a := MoveFileAction{BasePath: "/backup", RelativeFromPath: "a.jpg", RelativeToPath: "2021/trip/a.jpg"}
+	assert.Equal(t, `mkdir -p "/backup/2021/trip" && mv -v -n "/backup/a.jpg" "/backup/2021/trip/a.jpg"`,
+		a.UnixCommand())
+}
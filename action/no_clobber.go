@@ -0,0 +1,108 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// noClobberMover moves files without overwriting (see moveNoClobber), renaming, linking and removing files through
+// its functions (so that tests can simulate unsupported filesystems, races and failures)
+type noClobberMover struct {
+	rename func(oldPath, newPath string) error
+	link   func(oldPath, newPath string) error
+	remove func(path string) error
+	// strict refuses moves on filesystems where an atomic 'no clobber' move isn't possible (see
+	// Settings.NoClobberVerify)
+	strict bool
+}
+
+// moveNoClobber moves a file from one path to another, without ever overwriting an existing file.
+//
+// The move is a rename that fails if the new path exists (see renameNoReplace), where that's supported. Elsewhere, it's
+// done by creating a hard link at the new path and then removing the old path: creation of a hard link fails
+// atomically if the new path exists too, though the file is at both paths in between. Either way, there is no window
+// in which a file appearing at the new path can be overwritten. If the filesystem doesn't support hard links either,
+// this falls back to checking for existence and renaming (unless Settings.NoClobberVerify is set, in which case an
+// error is returned).
+//
+// If the old path can't be removed once the new path is linked, the new link is removed, so that the file isn't left
+// at both paths.
+//
+// If the move is the one an earlier run was interrupted while performing (see Run.Interrupted) and the new path is a
+// link to the same file already, the move is completed by removing the old path. Otherwise, paths that are links to
+// the same file are left as they are (they may well be so intentionally).
+//
+// On case-insensitive filesystems, a move that only changes case of the name is done through a temporary name (see
+// renameCaseOnly), since the new path refers to the same file.
+func (r *Run) moveNoClobber(fromPath, toPath string, isInterrupted bool) error {
+	m := noClobberMover{rename: renameNoReplace, link: os.Link, remove: os.Remove,
+		strict: r.settings().NoClobberVerify}
+	return m.move(fromPath, toPath, isInterrupted)
+}
+
+func (m noClobberMover) move(fromPath, toPath string, isInterrupted bool) error {
+	if isCaseOnlyRename(fromPath, toPath) {
+		return renameCaseOnly(fromPath, toPath)
+	}
+	err := m.rename(fromPath, toPath)
+	if errors.Is(err, errNoReplaceUnsupported) {
+		err = m.linkAndRemove(fromPath, toPath)
+	}
+	if errors.Is(err, os.ErrExist) {
+		if isInterrupted && isSameFile(fromPath, toPath) {
+			// The earlier run was interrupted after linking, but before removing the old path
+			return m.remove(fromPath)
+		}
+		return fileExistsError{path: toPath}
+	}
+	return err
+}
+
+// linkAndRemove moves a file by linking it at the new path and removing the old path (see moveNoClobber), falling
+// back to checking and renaming where hard links aren't supported
+func (m noClobberMover) linkAndRemove(fromPath, toPath string) error {
+	linkErr := m.link(fromPath, toPath)
+	if linkErr == nil {
+		removeErr := m.remove(fromPath)
+		if removeErr == nil {
+			return nil
+		}
+		if undoErr := m.remove(toPath); undoErr != nil {
+			return fmt.Errorf("error: couldn't remove \"%s\" after linking it at \"%s\" (%+v), nor remove the link: "+
+				"%+v", fromPath, toPath, removeErr, undoErr)
+		}
+		return removeErr
+	}
+	if errors.Is(linkErr, os.ErrExist) {
+		return linkErr
+	}
+	if _, statErr := os.Lstat(fromPath); statErr != nil {
+		return statErr
+	}
+	if m.strict {
+		return fmt.Errorf("error: can't move \"%s\" without risk of overwriting (hard links not supported?): %+v",
+			fromPath, linkErr)
+	}
+	return checkAndRename(fromPath, toPath)
+}
+
+// fileExistsError is returned when a file is in the way of a move (errors.Is tells it apart as os.ErrExist)
+type fileExistsError struct {
+	path string
+}
+
+func (e fileExistsError) Error() string {
+	return fmt.Sprintf(`error: file "%s" already exists`, e.path)
+}
+
+func (e fileExistsError) Is(target error) bool {
+	return target == os.ErrExist
+}
+
+// isSameFile tells whether both paths refer to the same file (e.g. being hard links to it)
+func isSameFile(path1, path2 string) bool {
+	info1, err1 := os.Lstat(path1)
+	info2, err2 := os.Lstat(path2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
@@ -0,0 +1,148 @@
+package action
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("couldn't write file %s: %+v", path, err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read file %s: %+v", path, err)
+	}
+	return string(content)
+}
+
+// renameUnsupported is a rename of a noClobberMover on platforms (or filesystems) where renameNoReplace isn't supported
+func renameUnsupported(string, string) error {
+	return errNoReplaceUnsupported
+}
+
+func TestMoveNoClobber(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	writeFile(t, filepath.Join(dir, "b"), "b")
+	var r *Run
+	assert.NoError(t, r.moveNoClobber(filepath.Join(dir, "a"), filepath.Join(dir, "c"), false))
+	assert.NoFileExists(t, filepath.Join(dir, "a"))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "c")))
+	assert.ErrorIs(t, r.moveNoClobber(filepath.Join(dir, "b"), filepath.Join(dir, "c"), false), os.ErrExist)
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "b")))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "c")))
+}
+
+func TestMoveNoClobberRename(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	writeFile(t, filepath.Join(dir, "b"), "b")
+	// A rename that doesn't replace is used wherever it's supported:
+	m := noClobberMover{
+		rename: func(oldPath, newPath string) error {
+			if _, err := os.Lstat(newPath); err == nil {
+				return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+			}
+			return os.Rename(oldPath, newPath)
+		},
+		link: func(string, string) error {
+			t.Error("file is linked, though it can be renamed")
+			return nil
+		},
+		remove: os.Remove,
+	}
+	assert.NoError(t, m.move(filepath.Join(dir, "a"), filepath.Join(dir, "c"), false))
+	assert.NoFileExists(t, filepath.Join(dir, "a"))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "c")))
+	err := m.move(filepath.Join(dir, "b"), filepath.Join(dir, "c"), false)
+	assert.ErrorIs(t, err, os.ErrExist)
+	assert.Equal(t, `error: file "`+filepath.Join(dir, "c")+`" already exists`, err.Error())
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "b")))
+}
+
+func TestMoveNoClobberRace(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	// Target appears after planning, right before the move:
+	m := noClobberMover{
+		rename: renameUnsupported,
+		link: func(oldPath, newPath string) error {
+			writeFile(t, newPath, "appeared")
+			return os.Link(oldPath, newPath)
+		},
+		remove: os.Remove,
+	}
+	assert.ErrorIs(t, m.move(filepath.Join(dir, "a"), filepath.Join(dir, "b"), false), os.ErrExist)
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "a")))
+	assert.Equal(t, "appeared", readFile(t, filepath.Join(dir, "b")))
+}
+
+func TestMoveNoClobberWithoutLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	m := noClobberMover{
+		rename: renameUnsupported,
+		link: func(string, string) error {
+			return &os.LinkError{Op: "link", Err: errors.New("operation not supported")}
+		},
+		remove: os.Remove,
+	}
+	// Falls back to check and rename:
+	assert.NoError(t, m.move(filepath.Join(dir, "a"), filepath.Join(dir, "b"), false))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "b")))
+	// Strict mode refuses to take the risk:
+	m.strict = true
+	assert.Error(t, m.move(filepath.Join(dir, "b"), filepath.Join(dir, "c"), false))
+	assert.FileExists(t, filepath.Join(dir, "b"))
+	assert.NoFileExists(t, filepath.Join(dir, "c"))
+}
+
+func TestMoveNoClobberInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	// As if an earlier move was stopped right after linking (or the paths were links to the same file all along):
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Skipf("hard links aren't supported here: %+v", err)
+	}
+	a := MoveFileAction{BasePath: dir, RelativeFromPath: "a", RelativeToPath: "b"}
+	// Links are left as they are, unless the move is known to have been interrupted:
+	assert.ErrorIs(t, a.Perform(nil), os.ErrExist)
+	assert.Error(t, CheckPreconditions(a, nil))
+	assert.FileExists(t, filepath.Join(dir, "a"))
+	assert.FileExists(t, filepath.Join(dir, "b"))
+	r := NewRun(Settings{})
+	r.Interrupted = MoveFileAction{BasePath: dir, RelativeFromPath: "b", RelativeToPath: "a"}
+	assert.ErrorIs(t, a.Perform(r), os.ErrExist)
+	r.Interrupted = a
+	assert.NoError(t, CheckPreconditions(a, r))
+	assert.NoError(t, a.Perform(r))
+	assert.NoFileExists(t, filepath.Join(dir, "a"))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "b")))
+}
+
+func TestMoveNoClobberRollback(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "a")
+	removeErr := errors.New("permission denied")
+	m := noClobberMover{
+		rename: renameUnsupported,
+		link:   os.Link,
+		remove: func(path string) error {
+			if path == filepath.Join(dir, "a") {
+				return removeErr
+			}
+			return os.Remove(path)
+		},
+	}
+	assert.ErrorIs(t, m.move(filepath.Join(dir, "a"), filepath.Join(dir, "b"), false), removeErr)
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "a")))
+	assert.NoFileExists(t, filepath.Join(dir, "b"))
+}
@@ -0,0 +1,297 @@
+package action
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempSuffix is appended to path of a file that's temporarily moved aside, to break a cycle of moves
+const tempSuffix = ".rsync-sidekick.tmp"
+
+// tempPathFor computes path (relative to basePath) that n-th move aside of what's at relativePath moves it to: in
+// temporary directory, if one is set (see Settings.TempDirPath), or next to it otherwise. A path that's taken (e.g. by
+// what an interrupted run left behind) is skipped, by numbering the path.
+func tempPathFor(settings Settings, basePath string, relativePath string, n int) string {
+	for k := 0; ; k++ {
+		suffix := tempSuffix
+		if k > 0 {
+			suffix = fmt.Sprintf(".%d%s", k, tempSuffix)
+		}
+		tempPath := relativePath + suffix
+		if settings.TempDirPath != "" {
+			name := fmt.Sprintf("%d_%s%s", n, filepath.Base(relativePath), suffix)
+			if settings.TempPrefix != "" {
+				name = settings.TempPrefix + "_" + name
+			}
+			absoluteTempPath := filepath.Join(settings.TempDirPath, name)
+			// This fails only if temporary directory is on a different volume, on Windows:
+			if relativeTempPath, err := filepath.Rel(basePath, absoluteTempPath); err == nil {
+				tempPath = relativeTempPath
+			}
+		}
+		// Anything but the path being found to be taken means it's free (if it isn't, the no-clobber move fails):
+		if _, err := os.Lstat(filepath.Join(basePath, tempPath)); err != nil {
+			return tempPath
+		}
+	}
+}
+
+// isTempPath tells whether given path is one that something is moved aside to (see tempPathFor)
+func isTempPath(path string) bool {
+	return strings.HasSuffix(path, tempSuffix)
+}
+
+// TempPathsOf returns paths of files that are at temporary paths (see SortByDependencies) and that given actions move
+// back from there, e.g. as they're left unperformed by a run that was interrupted midway
+func TempPathsOf(actions []SyncAction) []string {
+	var paths []string
+	for _, a := range actions {
+		if isTempPath(a.sourcePath()) && exists(a.sourcePath()) {
+			paths = append(paths, a.sourcePath())
+		}
+	}
+	return paths
+}
+
+// SortByDependencies reorders actions such that each action is performed only after actions it depends on: a directory
+// is created (or moved into place) before anything is moved or copied inside it, a path is vacated before something
+// else is moved to it, a file's timestamp (or permissions, or owner) is changed while it's at the path the action
+// refers to, a duplicate file is removed only after the file it's a duplicate of is in place, a directory is removed
+// only after everything inside it is moved away (or removed) and a directory's timestamp is changed only after
+// everything is moved, copied or removed into or out of it (as those change its timestamp).
+// Cycles of moves (e.g. two files swapping their names) are broken by first moving one of the files to a temporary
+// path (as per settings, see Settings.TempDirPath). Otherwise, original order of actions is retained. Sorting actions
+// that are sorted already (e.g. ones loaded from a saved plan) doesn't change them, as cycles of moves are broken by
+// then.
+func SortByDependencies(actions []SyncAction, settings Settings) []SyncAction {
+	actions = breakMoveCycles(actions, settings)
+	creators := make(map[string]int, len(actions))
+	vacators := make(map[string]int, len(actions))
+	for i, a := range actions {
+		switch a.(type) {
+		case MakeDirectoryAction, CopyFileAction:
+			creators[a.destinationPath()] = i
+		case MoveFileAction, MoveDirectoryAction, SymlinkMoveAction:
+			creators[a.destinationPath()] = i
+			// A temporary path is vacated only after it's created (by a move back)
+			if !isTempPath(a.sourcePath()) {
+				vacators[a.sourcePath()] = i
+			}
+		}
+	}
+	removers := make(map[string]int)
+	dirTouchers := make(map[string]int)
+	for i, a := range actions {
+		switch a.(type) {
+		case RemoveDirectoryAction:
+			removers[a.destinationPath()] = i
+		case PropagateDirTimestampAction:
+			dirTouchers[a.destinationPath()] = i
+		}
+	}
+	dependents := make([][]int, len(actions))
+	numDependencies := make([]int, len(actions))
+	addDependency := func(before int, after int) {
+		if before != after {
+			dependents[before] = append(dependents[before], after)
+			numDependencies[after]++
+		}
+	}
+	// changesEntryIn makes timestamp of directory containing path be propagated after i-th action
+	changesEntryIn := func(i int, path string) {
+		if toucher, exists := dirTouchers[filepath.Dir(path)]; exists {
+			addDependency(i, toucher)
+		}
+	}
+	for i, a := range actions {
+		switch a.(type) {
+		case MakeDirectoryAction, MoveFileAction, MoveDirectoryAction, SymlinkMoveAction, CopyFileAction:
+			changesEntryIn(i, a.destinationPath())
+			if isMove(a) {
+				changesEntryIn(i, a.sourcePath())
+			}
+			for _, dir := range parentDirectories(a.destinationPath()) {
+				if creator, exists := creators[dir]; exists {
+					addDependency(creator, i)
+				}
+			}
+			if vacator, exists := vacators[a.destinationPath()]; exists {
+				addDependency(vacator, i)
+			}
+			if isMove(a) {
+				for _, dir := range parentDirectories(a.sourcePath()) {
+					if remover, exists := removers[dir]; exists {
+						addDependency(i, remover)
+					}
+				}
+			}
+		case RemoveFileAction:
+			changesEntryIn(i, a.destinationPath())
+			if creator, exists := creators[a.sourcePath()]; exists {
+				addDependency(creator, i)
+			}
+			for _, dir := range parentDirectories(a.destinationPath()) {
+				if remover, exists := removers[dir]; exists {
+					addDependency(i, remover)
+				}
+			}
+		case RemoveDirectoryAction:
+			changesEntryIn(i, a.destinationPath())
+			for _, dir := range parentDirectories(a.destinationPath()) {
+				if remover, exists := removers[dir]; exists {
+					addDependency(i, remover)
+				}
+			}
+		case PropagateTimestampAction, PropagateDirTimestampAction, ChmodAction, ChownAction:
+			paths := append(parentDirectories(a.destinationPath()), a.destinationPath())
+			for _, path := range paths {
+				if creator, exists := creators[path]; exists {
+					addDependency(creator, i)
+				}
+				if vacator, exists := vacators[path]; exists {
+					addDependency(i, vacator)
+				}
+			}
+		}
+	}
+	// Kahn's algorithm, always picking the earliest (as per original order) of actions that are ready:
+	ready := make(minHeap, 0, len(actions))
+	for i := range actions {
+		if numDependencies[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	heap.Init(&ready)
+	sorted := make([]SyncAction, 0, len(actions))
+	done := make([]bool, len(actions))
+	for ready.Len() > 0 {
+		i := heap.Pop(&ready).(int)
+		sorted = append(sorted, actions[i])
+		done[i] = true
+		for _, j := range dependents[i] {
+			numDependencies[j]--
+			if numDependencies[j] == 0 {
+				heap.Push(&ready, j)
+			}
+		}
+	}
+	// Actions with circular dependencies (which shouldn't remain after breaking cycles of moves) are left in order:
+	for i, a := range actions {
+		if !done[i] {
+			sorted = append(sorted, a)
+		}
+	}
+	return sorted
+}
+
+// minHeap is a min-heap of indices of actions (see container/heap)
+type minHeap []int
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *minHeap) Push(x any) {
+	*h = append(*h, x.(int))
+}
+
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// breakMoveCycles finds cycles of moves, where each move's target is vacated by the next move, and splits first
+// move of each cycle into two: one to a temporary path at the beginning, and one from there (a "move back") at the end.
+// Moves back (of cycles broken earlier) don't vacate anything for this purpose, as they're from temporary paths.
+func breakMoveCycles(actions []SyncAction, settings Settings) []SyncAction {
+	vacators := make(map[string]int, len(actions))
+	for i, a := range actions {
+		if isMove(a) && !isTempPath(a.sourcePath()) {
+			vacators[a.sourcePath()] = i
+		}
+	}
+	// state is 0 for unvisited, 1 for being visited and 2 for visited
+	state := make([]int, len(actions))
+	var moveAside []int
+	for i, a := range actions {
+		if !isMove(a) || state[i] != 0 {
+			continue
+		}
+		var chain []int
+		j, exists := i, true
+		for exists && state[j] == 0 {
+			state[j] = 1
+			chain = append(chain, j)
+			j, exists = vacators[actions[j].destinationPath()]
+		}
+		if exists && state[j] == 1 {
+			moveAside = append(moveAside, j)
+		}
+		for _, k := range chain {
+			state[k] = 2
+		}
+	}
+	if len(moveAside) == 0 {
+		return actions
+	}
+	result := make([]SyncAction, 0, len(actions)+len(moveAside))
+	var movesBack []SyncAction
+	isMovedAside := make(map[int]bool, len(moveAside))
+	for n, i := range moveAside {
+		isMovedAside[i] = true
+		toTemp, fromTemp := splitMove(actions[i], n, settings)
+		result = append(result, toTemp)
+		movesBack = append(movesBack, fromTemp)
+	}
+	for i, a := range actions {
+		if !isMovedAside[i] {
+			result = append(result, a)
+		}
+	}
+	return append(result, movesBack...)
+}
+
+// isMove tells whether the action moves something from one path to another at destination
+func isMove(a SyncAction) bool {
+	switch a.(type) {
+	case MoveFileAction, MoveDirectoryAction, SymlinkMoveAction:
+		return true
+	}
+	return false
+}
+
+// splitMove splits n-th move that's moved aside into a move to a temporary path and a move from there
+func splitMove(a SyncAction, n int, settings Settings) (toTemp SyncAction, fromTemp SyncAction) {
+	switch m := a.(type) {
+	case MoveFileAction:
+		tempPath := tempPathFor(settings, m.BasePath, m.RelativeFromPath, n)
+		return MoveFileAction{BasePath: m.BasePath, RelativeFromPath: m.RelativeFromPath,
+				RelativeToPath: tempPath},
+			MoveFileAction{BasePath: m.BasePath, RelativeFromPath: tempPath, RelativeToPath: m.RelativeToPath}
+	case MoveDirectoryAction:
+		tempPath := tempPathFor(settings, m.BasePath, m.RelativeFromPath, n)
+		return MoveDirectoryAction{BasePath: m.BasePath, RelativeFromPath: m.RelativeFromPath,
+				RelativeToPath: tempPath},
+			MoveDirectoryAction{BasePath: m.BasePath, RelativeFromPath: tempPath, RelativeToPath: m.RelativeToPath}
+	case SymlinkMoveAction:
+		tempPath := tempPathFor(settings, m.BasePath, m.RelativeFromPath, n)
+		return SymlinkMoveAction{BasePath: m.BasePath, RelativeFromPath: m.RelativeFromPath,
+				RelativeToPath: tempPath},
+			SymlinkMoveAction{BasePath: m.BasePath, RelativeFromPath: tempPath, RelativeToPath: m.RelativeToPath}
+	}
+	return a, nil
+}
+
+// parentDirectories lists all ancestors of given absolute path
+func parentDirectories(path string) []string {
+	var dirs []string
+	for dir := filepath.Dir(path); dir != path; path, dir = dir, filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
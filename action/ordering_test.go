@@ -0,0 +1,209 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "photos"), 0755))
+	writeFile(t, filepath.Join(dir, "photos", "1.jpg"), "one")
+	writeFile(t, filepath.Join(dir, "photos", "2.jpg"), "two")
+	writeFile(t, filepath.Join(dir, "photos", "x.jpg"), "x")
+	writeFile(t, filepath.Join(dir, "photos", "y.jpg"), "y")
+	// At source, "1.jpg" was renamed to "2.jpg", "2.jpg" was moved to a new folder "pictures" and "x.jpg" and
+	// "y.jpg" swapped their names:
+	actions := []SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/1.jpg", RelativeToPath: "photos/2.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/2.jpg", RelativeToPath: "pictures/2.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/x.jpg", RelativeToPath: "photos/y.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/y.jpg", RelativeToPath: "photos/x.jpg"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "pictures")},
+	}
+	sorted := SortByDependencies(actions, Settings{})
+	assert.Equal(t, []SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/x.jpg", RelativeToPath: "photos/x.jpg" + tempSuffix},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/y.jpg", RelativeToPath: "photos/x.jpg"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "pictures")},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/2.jpg", RelativeToPath: "pictures/2.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/1.jpg", RelativeToPath: "photos/2.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "photos/x.jpg" + tempSuffix, RelativeToPath: "photos/y.jpg"},
+	}, sorted)
+	for _, a := range sorted {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.Equal(t, "one", readFile(t, filepath.Join(dir, "photos", "2.jpg")))
+	assert.Equal(t, "two", readFile(t, filepath.Join(dir, "pictures", "2.jpg")))
+	assert.Equal(t, "y", readFile(t, filepath.Join(dir, "photos", "x.jpg")))
+	assert.Equal(t, "x", readFile(t, filepath.Join(dir, "photos", "y.jpg")))
+	assert.NoFileExists(t, filepath.Join(dir, "photos", "1.jpg"))
+}
+
+func TestSortByDependenciesPerform(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "old"), 0755))
+	writeFile(t, filepath.Join(dir, "old", "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "old", "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "old", "c.txt"), "c")
+	// Folder "old" was renamed to "new" and, inside it, "a.txt" was renamed to "b.txt", "b.txt" to "c.txt" and
+	// "c.txt" to "a.txt" (i.e. a child's new path is another child's old path):
+	actions := SortByDependencies([]SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/a.txt", RelativeToPath: "new/b.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/b.txt", RelativeToPath: "new/c.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/c.txt", RelativeToPath: "new/a.txt"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "new")},
+	}, Settings{})
+	for _, a := range actions {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "new", "b.txt")))
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "new", "c.txt")))
+	assert.Equal(t, "c", readFile(t, filepath.Join(dir, "new", "a.txt")))
+	// Chains and cycles within the same directory:
+	actions = SortByDependencies([]SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "new/a.txt", RelativeToPath: "new/b.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "new/b.txt", RelativeToPath: "new/a.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "new/c.txt", RelativeToPath: "new/d.txt"},
+	}, Settings{})
+	for i, a := range actions {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+		if move, isMove := a.(MoveFileAction); isMove && isTempPath(move.RelativeToPath) {
+			// A file moved aside is at its temporary path until a later action moves it back:
+			assert.Equal(t, []string{move.destinationPath()}, TempPathsOf(actions[i+1:]))
+		}
+	}
+	assert.Empty(t, TempPathsOf(actions))
+	assert.Equal(t, "c", readFile(t, filepath.Join(dir, "new", "b.txt")))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "new", "a.txt")))
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "new", "d.txt")))
+}
+
+func TestSortByDependenciesResort(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "x.jpg"), "x")
+	writeFile(t, filepath.Join(dir, "y.jpg"), "y")
+	// What an interrupted run left behind is in the way of moving "x.jpg" aside:
+	writeFile(t, filepath.Join(dir, "x.jpg"+tempSuffix), "left behind")
+	sorted := SortByDependencies([]SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "x.jpg", RelativeToPath: "y.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "y.jpg", RelativeToPath: "x.jpg"},
+	}, Settings{})
+	assert.Equal(t, []SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "x.jpg", RelativeToPath: "x.jpg.1" + tempSuffix},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "y.jpg", RelativeToPath: "x.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "x.jpg.1" + tempSuffix, RelativeToPath: "y.jpg"},
+	}, sorted)
+	// Sorting again (as when a saved plan is applied) leaves the actions as they are:
+	assert.Equal(t, sorted, SortByDependencies(sorted, Settings{}))
+	for _, a := range SortByDependencies(sorted, Settings{}) {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.Equal(t, "y", readFile(t, filepath.Join(dir, "x.jpg")))
+	assert.Equal(t, "x", readFile(t, filepath.Join(dir, "y.jpg")))
+	assert.Equal(t, "left behind", readFile(t, filepath.Join(dir, "x.jpg"+tempSuffix)))
+}
+
+func TestSortByDependenciesTempDir(t *testing.T) {
+	dir, tempDir := t.TempDir(), t.TempDir()
+	settings := Settings{TempDirPath: tempDir, TempPrefix: "120000"}
+	writeFile(t, filepath.Join(dir, "x.jpg"), "x")
+	writeFile(t, filepath.Join(dir, "y.jpg"), "y")
+	// "x.jpg" and "y.jpg" swapped their names, so one of them is moved aside into temporary directory:
+	sorted := SortByDependencies([]SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "x.jpg", RelativeToPath: "y.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "y.jpg", RelativeToPath: "x.jpg"},
+	}, settings)
+	tempPath, err := filepath.Rel(dir, filepath.Join(tempDir, "120000_0_x.jpg"+tempSuffix))
+	assert.NoError(t, err)
+	assert.Equal(t, []SyncAction{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "x.jpg", RelativeToPath: tempPath},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "y.jpg", RelativeToPath: "x.jpg"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: tempPath, RelativeToPath: "y.jpg"},
+	}, sorted)
+	for _, a := range sorted {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.Equal(t, "y", readFile(t, filepath.Join(dir, "x.jpg")))
+	assert.Equal(t, "x", readFile(t, filepath.Join(dir, "y.jpg")))
+	for _, d := range []string{dir, tempDir} {
+		entries, readErr := os.ReadDir(d)
+		assert.NoError(t, readErr)
+		assert.Len(t, entries, map[string]int{dir: 2, tempDir: 0}[d], "leftovers in %s", d)
+	}
+}
+
+func TestSortByDependenciesRemoveDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "old", "sub"), 0755))
+	writeFile(t, filepath.Join(dir, "old", "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "old", "sub", "b.txt"), "b")
+	// Directories are removed only after everything inside them is moved away, deepest first:
+	actions := SortByDependencies([]SyncAction{
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "old")},
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "old", "sub")},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/a.txt", RelativeToPath: "a.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/sub/b.txt", RelativeToPath: "b.txt"},
+	}, Settings{})
+	for _, a := range actions {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.NoDirExists(t, filepath.Join(dir, "old"))
+	assert.Equal(t, "b", readFile(t, filepath.Join(dir, "b.txt")))
+	// A directory that isn't empty isn't removed:
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "new"), 0755))
+	writeFile(t, filepath.Join(dir, "new", "c.txt"), "c")
+	assert.Error(t, RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "new")}.Perform(nil))
+	assert.Error(t, RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "a.txt")}.Perform(nil))
+	assert.FileExists(t, filepath.Join(dir, "a.txt"))
+}
+
+func TestSortByDependenciesRemoveFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "old"), 0755))
+	writeFile(t, filepath.Join(dir, "old", "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "old", "copy of a.txt"), "a")
+	// A duplicate is removed only after the file it's a duplicate of is in place, and before its directory is removed:
+	actions := SortByDependencies([]SyncAction{
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "old")},
+		RemoveFileAction{BasePath: dir, RelativePath: "old/copy of a.txt", RelativeDuplicateOfPath: "new/a.txt"},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old/a.txt", RelativeToPath: "new/a.txt"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "new")},
+	}, Settings{})
+	for _, a := range actions {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	assert.NoDirExists(t, filepath.Join(dir, "old"))
+	assert.Equal(t, "a", readFile(t, filepath.Join(dir, "new", "a.txt")))
+}
+
+func TestSortByDependenciesDirTimestamp(t *testing.T) {
+	sourceDir, dir := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "photos", "sub"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "photos", "old"), 0755))
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(sourceDir, "photos"), modTime, modTime))
+	assert.NoError(t, os.Chtimes(filepath.Join(sourceDir, "photos", "sub"), modTime, modTime))
+	// Timestamps of directories are propagated after everything is moved into (or out of) them:
+	actions := SortByDependencies([]SyncAction{
+		PropagateDirTimestampAction{SourceBaseDirPath: sourceDir, DestinationBaseDirPath: dir, RelativePath: "photos"},
+		PropagateDirTimestampAction{SourceBaseDirPath: sourceDir, DestinationBaseDirPath: dir,
+			RelativePath: filepath.Join("photos", "sub")},
+		MoveFileAction{BasePath: dir, RelativeFromPath: "a.txt", RelativeToPath: "photos/sub/a.txt"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "photos", "sub")},
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "photos", "old")},
+	}, Settings{})
+	for _, a := range actions {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	for _, path := range []string{"photos", filepath.Join("photos", "sub")} {
+		info, err := os.Stat(filepath.Join(dir, path))
+		assert.NoError(t, err)
+		assert.Equal(t, modTime.Unix(), info.ModTime().Unix(), path)
+	}
+	assert.True(t, IsDone(actions[len(actions)-1]))
+}
@@ -0,0 +1,116 @@
+package action
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"os"
+)
+
+// CheckPreconditions checks whether the action can still be performed, e.g. when it was computed a while ago and
+// files have changed since: whatever is moved (or copied, or removed) must exist and path it's moved to must be free
+// (unless conflict policy of the run it's part of gets what's in the way out of it, or it's a file move the run
+// completes, see Run.Interrupted) and a duplicate file removed must still have the file it's a duplicate of
+func CheckPreconditions(a SyncAction, r *Run) error {
+	switch a.(type) {
+	case MoveFileAction, MoveDirectoryAction, SymlinkMoveAction:
+		if err := mustExist(a.sourcePath()); err != nil {
+			return err
+		}
+		if isCaseOnlyRename(a.sourcePath(), a.destinationPath()) {
+			return nil
+		}
+		if _, isFileMove := a.(MoveFileAction); isFileMove && r.conflictPolicy() != ConflictSkip {
+			// File that's in the way is moved out of it (see Settings.ConflictPolicy)
+			return nil
+		}
+		if _, isFileMove := a.(MoveFileAction); isFileMove && r.isInterrupted(a) &&
+			isSameFile(a.sourcePath(), a.destinationPath()) {
+			// Move was interrupted midway, and is completed (see moveNoClobber)
+			return nil
+		}
+		if _, err := os.Lstat(a.destinationPath()); err == nil {
+			return fmt.Errorf("\"%s\" already exists", a.destinationPath())
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	case PropagateTimestampAction, PropagateDirTimestampAction:
+		if err := mustExist(a.sourcePath()); err != nil {
+			return err
+		}
+		return mustExist(a.destinationPath())
+	case RemoveDirectoryAction, ChmodAction, ChownAction:
+		return mustExist(a.destinationPath())
+	case RemoveFileAction:
+		if err := mustExist(a.destinationPath()); err != nil {
+			return err
+		}
+		return mustExist(a.sourcePath())
+	case CopyFileAction:
+		if err := mustExist(a.sourcePath()); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(a.destinationPath()); err == nil {
+			return fmt.Errorf("\"%s\" already exists", a.destinationPath())
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsDone tells whether the action seems to have been performed already (e.g. by a run that was interrupted before it
+// could record so): whatever is moved is at its new path and not at the old one, file copied exists with same size and
+// timestamp (which is set only once the copy is complete), directory created exists, directory (or duplicate file)
+// removed doesn't, timestamps of files (or directories) are same or permissions (or owner) of a file are as intended.
+// Performing such an action again would fail (or be redundant).
+func IsDone(a SyncAction) bool {
+	switch syncAction := a.(type) {
+	case MoveFileAction, MoveDirectoryAction, SymlinkMoveAction:
+		if isCaseOnlyRename(a.sourcePath(), a.destinationPath()) {
+			// Both paths refer to the same file, whether it's renamed or not (and renaming it again is harmless)
+			return false
+		}
+		return !exists(a.sourcePath()) && exists(a.destinationPath())
+	case PropagateTimestampAction, PropagateDirTimestampAction:
+		sourceInfo, sourceErr := os.Lstat(a.sourcePath())
+		destinationInfo, destinationErr := os.Lstat(a.destinationPath())
+		return sourceErr == nil && destinationErr == nil && sourceInfo.ModTime().Equal(destinationInfo.ModTime())
+	case MakeDirectoryAction:
+		info, err := os.Stat(a.destinationPath())
+		return err == nil && info.IsDir()
+	case RemoveDirectoryAction:
+		return !exists(a.destinationPath())
+	case RemoveFileAction:
+		return !exists(a.destinationPath()) && exists(a.sourcePath())
+	case ChmodAction:
+		info, err := os.Lstat(a.destinationPath())
+		return err == nil && info.Mode().Perm() == syncAction.Mode.Perm()
+	case ChownAction:
+		info, err := os.Lstat(a.destinationPath())
+		if err != nil {
+			return false
+		}
+		uid, gid := lib.OwnerOf(info)
+		return (syncAction.UID < 0 || uid == syncAction.UID) && (syncAction.GID < 0 || gid == syncAction.GID)
+	case CopyFileAction:
+		sourceInfo, sourceErr := os.Lstat(a.sourcePath())
+		destinationInfo, destinationErr := os.Lstat(a.destinationPath())
+		return sourceErr == nil && destinationErr == nil && sourceInfo.Size() == destinationInfo.Size() &&
+			sourceInfo.ModTime().Equal(destinationInfo.ModTime())
+	}
+	return false
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func mustExist(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return fmt.Errorf("\"%s\" doesn't exist", path)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
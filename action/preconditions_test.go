@@ -0,0 +1,47 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsDone(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "moved"), "moved")
+	writeFile(t, filepath.Join(dir, "not_moved"), "not moved")
+	writeFile(t, filepath.Join(dir, "copied"), "copied")
+	writeFile(t, filepath.Join(dir, "copy"), "copied")
+	// ...as if copying it was interrupted before its timestamp was set:
+	writeFile(t, filepath.Join(dir, "part"), "copied")
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "moved"), modTime, modTime))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "copied"), modTime, modTime))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "copy"), modTime, modTime))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "created"), 0755))
+	timestamp := func(from, to string) SyncAction {
+		return PropagateTimestampAction{SourceBaseDirPath: dir, DestinationBaseDirPath: dir,
+			SourceFileRelativePath: from, DestinationFileRelativePath: to}
+	}
+	for a, expected := range map[SyncAction]bool{
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old", RelativeToPath: "moved"}:               true,
+		MoveFileAction{BasePath: dir, RelativeFromPath: "not_moved", RelativeToPath: "new"}:           false,
+		MoveFileAction{BasePath: dir, RelativeFromPath: "old", RelativeToPath: "new"}:                 false,
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "created")}:                           true,
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "not_created")}:                       false,
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "removed")}:                         true,
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "created")}:                         false,
+		CopyFileAction{FromPath: filepath.Join(dir, "copied"), BasePath: dir, RelativeToPath: "copy"}: true,
+		CopyFileAction{FromPath: filepath.Join(dir, "copied"), BasePath: dir, RelativeToPath: "new"}:  false,
+		CopyFileAction{FromPath: filepath.Join(dir, "copied"), BasePath: dir, RelativeToPath: "part"}: false,
+		RemoveFileAction{BasePath: dir, RelativePath: "removed", RelativeDuplicateOfPath: "copy"}:     true,
+		RemoveFileAction{BasePath: dir, RelativePath: "copied", RelativeDuplicateOfPath: "copy"}:      false,
+		RemoveFileAction{BasePath: dir, RelativePath: "removed", RelativeDuplicateOfPath: "missing"}:  false,
+		timestamp("copy", "moved"): true,
+		timestamp("copy", "part"):  false,
+	} {
+		assert.Equal(t, expected, IsDone(a), "%s", a)
+	}
+}
@@ -0,0 +1,42 @@
+package action
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// PropagateDirTimestampAction is a SyncAction for propagating 'modification timestamp' of a directory at source to the
+// directory at same path at destination. It's performed after everything inside the directory is moved, copied or
+// removed (as those change its timestamp).
+type PropagateDirTimestampAction struct {
+	SourceBaseDirPath      string
+	DestinationBaseDirPath string
+	RelativePath           string
+}
+
+func (a PropagateDirTimestampAction) sourcePath() string {
+	return filepath.Join(a.SourceBaseDirPath, a.RelativePath)
+}
+
+func (a PropagateDirTimestampAction) destinationPath() string {
+	return filepath.Join(a.DestinationBaseDirPath, a.RelativePath)
+}
+
+// UnixCommand for propagating 'directory modification timestamp'
+func (a PropagateDirTimestampAction) UnixCommand() string {
+	return fmt.Sprintf(`touch -r "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
+}
+
+// Perform the 'directory modification timestamp' propagation action (see ErrNotPermitted)
+func (a PropagateDirTimestampAction) Perform(r *Run) error {
+	return r.propagateTimestamp(a.sourcePath(), a.destinationPath())
+}
+
+// Uniqueness generates unique string for 'directory modification timestamp' propagation action
+func (a PropagateDirTimestampAction) Uniqueness() string {
+	return "touchdir" + cmdSeparator + a.RelativePath
+}
+
+func (a PropagateDirTimestampAction) String() string {
+	return fmt.Sprintf(`propagate timestamp of directory "%s" to "%s"`, a.sourcePath(), a.destinationPath())
+}
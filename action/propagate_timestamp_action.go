@@ -27,14 +27,26 @@ func (a PropagateTimestampAction) UnixCommand() string {
 	return fmt.Sprintf(`touch -r "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
 }
 
-// Perform the 'file modification timestamp' propagation action
-func (a PropagateTimestampAction) Perform() error {
-	fileInfo, err := os.Lstat(a.sourcePath())
+// Perform the 'file modification timestamp' propagation action (with nanosecond precision, wherever filesystem
+// supports it, see ErrNotPermitted)
+func (a PropagateTimestampAction) Perform(r *Run) error {
+	return r.propagateTimestamp(a.sourcePath(), a.destinationPath())
+}
+
+// propagateTimestamp sets modification timestamp (and access time, see Settings.PreserveAccessTime) of file/directory
+// at destinationPath to that of file/directory at sourcePath
+func (r *Run) propagateTimestamp(sourcePath string, destinationPath string) error {
+	fileInfo, err := os.Lstat(sourcePath)
 	if err != nil {
 		return err
 	}
-	modTime := fileInfo.ModTime()
-	return os.Chtimes(a.destinationPath(), modTime, modTime)
+	modTime, accessTime := fileInfo.ModTime(), fileInfo.ModTime()
+	if r.settings().PreserveAccessTime {
+		if sourceAccessTime, exists := accessTimeOf(fileInfo); exists {
+			accessTime = sourceAccessTime
+		}
+	}
+	return notPermitted(os.Chtimes(destinationPath, accessTime, modTime))
 }
 
 // Uniqueness generate unique string for 'file modification timestamp' propagation action
@@ -0,0 +1,36 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPropagateTimestampAction(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "same")
+	writeFile(t, filepath.Join(dir, "b.txt"), "same")
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 123456789, time.UTC)
+	accessTime := time.Date(2022, 3, 4, 5, 6, 7, 987654321, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), accessTime, modTime))
+	a := PropagateTimestampAction{SourceBaseDirPath: dir, DestinationBaseDirPath: dir,
+		SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "b.txt"}
+	assert.NoError(t, a.Perform(nil))
+	info, err := os.Stat(filepath.Join(dir, "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, modTime.UnixNano(), info.ModTime().UnixNano())
+	if runtime.GOOS != "linux" {
+		return
+	}
+	atime, _ := accessTimeOf(info)
+	assert.Equal(t, modTime.UnixNano(), atime.UnixNano())
+	assert.NoError(t, a.Perform(NewRun(Settings{PreserveAccessTime: true})))
+	info, err = os.Stat(filepath.Join(dir, "b.txt"))
+	assert.NoError(t, err)
+	atime, _ = accessTimeOf(info)
+	assert.Equal(t, accessTime.UnixNano(), atime.UnixNano())
+	assert.Equal(t, modTime.UnixNano(), info.ModTime().UnixNano())
+}
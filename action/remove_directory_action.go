@@ -0,0 +1,45 @@
+package action
+
+import (
+	"fmt"
+	"os"
+)
+
+// RemoveDirectoryAction is a SyncAction for removing an empty directory (e.g. one left empty by moves)
+type RemoveDirectoryAction struct {
+	AbsoluteDirPath string
+}
+
+func (a RemoveDirectoryAction) sourcePath() string {
+	return "" // Not Applicable
+}
+
+func (a RemoveDirectoryAction) destinationPath() string {
+	return a.AbsoluteDirPath
+}
+
+// UnixCommand for removing an empty directory
+func (a RemoveDirectoryAction) UnixCommand() string {
+	return fmt.Sprintf(`rmdir -v "%s"`, escape(a.destinationPath()))
+}
+
+// Perform the 'remove directory' action. This fails if the directory isn't empty.
+func (a RemoveDirectoryAction) Perform(_ *Run) error {
+	info, err := os.Lstat(a.destinationPath())
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("\"%s\" is not a directory", a.destinationPath())
+	}
+	return os.Remove(a.destinationPath())
+}
+
+// Uniqueness generates unique string for directory removal
+func (a RemoveDirectoryAction) Uniqueness() string {
+	return "rmdir" + cmdSeparator + a.AbsoluteDirPath
+}
+
+func (a RemoveDirectoryAction) String() string {
+	return fmt.Sprintf(`remove empty directory "%s"`, a.destinationPath())
+}
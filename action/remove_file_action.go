@@ -0,0 +1,73 @@
+package action
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"os"
+	"path/filepath"
+)
+
+// RemoveFileAction is a SyncAction for removing a file at destination that's a duplicate of another file there (e.g.
+// a stale copy, at a path that doesn't exist at source, of a file that's moved to its place). Since removal can't be
+// undone, the file is removed only if the file it's a duplicate of is still there, with exactly the same contents.
+type RemoveFileAction struct {
+	BasePath     string
+	RelativePath string
+	// RelativeDuplicateOfPath is path of the file that's kept, having same contents as the one removed
+	RelativeDuplicateOfPath string
+}
+
+func (a RemoveFileAction) sourcePath() string {
+	return filepath.Join(a.BasePath, a.RelativeDuplicateOfPath)
+}
+
+func (a RemoveFileAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativePath)
+}
+
+// UnixCommand for removing a duplicate file (only if it's not the same file as the one kept, e.g. on a
+// case-insensitive filesystem, and contents of both are same)
+func (a RemoveFileAction) UnixCommand() string {
+	kept, removed := escape(a.sourcePath()), escape(a.destinationPath())
+	return fmt.Sprintf(`[ ! "%s" -ef "%s" ] && cmp -s "%s" "%s" && rm -v "%s"`, kept, removed, kept, removed, removed)
+}
+
+// Perform the 'remove file' action, after ensuring that both files are regular files, that they aren't the same file
+// (e.g. hard links, or paths differing only in case on a case-insensitive filesystem) and that their contents are same,
+// byte by byte
+func (a RemoveFileAction) Perform(_ *Run) error {
+	removedInfo, removedErr := os.Lstat(a.destinationPath())
+	if removedErr != nil {
+		return removedErr
+	}
+	keptInfo, keptErr := os.Lstat(a.sourcePath())
+	if keptErr != nil {
+		return fmt.Errorf("not removing \"%s\", as its duplicate can't be found: %+v", a.destinationPath(), keptErr)
+	}
+	if !removedInfo.Mode().IsRegular() || !keptInfo.Mode().IsRegular() {
+		return fmt.Errorf("not removing \"%s\", as it or its duplicate \"%s\" isn't a regular file",
+			a.destinationPath(), a.sourcePath())
+	}
+	if os.SameFile(removedInfo, keptInfo) {
+		return fmt.Errorf("not removing \"%s\", as it's the same file as \"%s\"", a.destinationPath(), a.sourcePath())
+	}
+	same, compareErr := lib.SameContent(a.sourcePath(), a.destinationPath())
+	if compareErr != nil {
+		return fmt.Errorf("not removing \"%s\", as it couldn't be compared with \"%s\": %+v", a.destinationPath(),
+			a.sourcePath(), compareErr)
+	}
+	if !same {
+		return fmt.Errorf("not removing \"%s\", as its contents differ from \"%s\"", a.destinationPath(),
+			a.sourcePath())
+	}
+	return os.Remove(a.destinationPath())
+}
+
+// Uniqueness generates unique string for file removal
+func (a RemoveFileAction) Uniqueness() string {
+	return "rm" + cmdSeparator + a.RelativePath
+}
+
+func (a RemoveFileAction) String() string {
+	return fmt.Sprintf(`remove file "%s" (a duplicate of "%s")`, a.destinationPath(), a.sourcePath())
+}
@@ -0,0 +1,40 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveFileAction(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "kept.txt"), "content")
+	writeFile(t, filepath.Join(dir, "stale.txt"), "content")
+	writeFile(t, filepath.Join(dir, "different.txt"), "contenT")
+	writeFile(t, filepath.Join(dir, "longer.txt"), "content and more")
+	assert.NoError(t, os.Link(filepath.Join(dir, "kept.txt"), filepath.Join(dir, "link.txt")))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0755))
+	// Files that differ from (or are same as) the one kept, and the one kept when it's missing, are never removed:
+	for path, duplicateOf := range map[string]string{
+		"different.txt": "kept.txt",
+		"longer.txt":    "kept.txt",
+		"link.txt":      "kept.txt",
+		"kept.txt":      "kept.txt",
+		"stale.txt":     "missing.txt",
+		"dir":           "kept.txt",
+	} {
+		a := RemoveFileAction{BasePath: dir, RelativePath: path, RelativeDuplicateOfPath: duplicateOf}
+		assert.Error(t, a.Perform(nil), "%s", a)
+		assert.FileExists(t, filepath.Join(dir, "kept.txt"))
+	}
+	for _, name := range []string{"stale.txt", "different.txt", "longer.txt", "link.txt"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+	assert.DirExists(t, filepath.Join(dir, "dir"))
+	a := RemoveFileAction{BasePath: dir, RelativePath: "stale.txt", RelativeDuplicateOfPath: "kept.txt"}
+	assert.NoError(t, a.Perform(nil))
+	assert.NoFileExists(t, filepath.Join(dir, "stale.txt"))
+	assert.Equal(t, "content", readFile(t, filepath.Join(dir, "kept.txt")))
+	assert.Error(t, a.Perform(nil))
+}
@@ -0,0 +1,38 @@
+//go:build amd64 || arm64
+
+package action
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// renameNoReplaceFlag is RENAME_NOREPLACE flag of renameat2 system call
+	renameNoReplaceFlag = 1
+	// atFdCwd is AT_FDCWD, i.e. paths passed to renameat2 are relative to working directory
+	atFdCwd = -100
+)
+
+// renameNoReplace renames a file or directory in a single step that fails (with os.ErrExist) if anything exists at
+// the new path already. It returns errNoReplaceUnsupported if the kernel or the filesystem doesn't support that.
+func renameNoReplace(fromPath, toPath string) error {
+	from, fromErr := syscall.BytePtrFromString(fromPath)
+	if fromErr != nil {
+		return fromErr
+	}
+	to, toErr := syscall.BytePtrFromString(toPath)
+	if toErr != nil {
+		return toErr
+	}
+	fdCwd := atFdCwd
+	_, _, errno := syscall.Syscall6(sysRenameat2, uintptr(fdCwd), uintptr(unsafe.Pointer(from)), uintptr(fdCwd),
+		uintptr(unsafe.Pointer(to)), renameNoReplaceFlag, 0)
+	if errno == 0 {
+		return nil
+	} else if errno == syscall.ENOSYS || errno == syscall.EINVAL {
+		return errNoReplaceUnsupported
+	}
+	return &os.LinkError{Op: "rename", Old: fromPath, New: toPath, Err: errno}
+}
@@ -0,0 +1,4 @@
+package action
+
+// sysRenameat2 is number of renameat2 system call (which syscall package doesn't define on this architecture)
+const sysRenameat2 = 316
@@ -0,0 +1,6 @@
+package action
+
+import "syscall"
+
+// sysRenameat2 is number of renameat2 system call
+const sysRenameat2 = syscall.SYS_RENAMEAT2
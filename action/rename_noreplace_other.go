@@ -0,0 +1,9 @@
+//go:build !linux || !(amd64 || arm64)
+
+package action
+
+// renameNoReplace always returns errNoReplaceUnsupported, as there's no rename that fails if anything exists at the
+// new path on this platform (or it isn't supported here yet)
+func renameNoReplace(_, _ string) error {
+	return errNoReplaceUnsupported
+}
@@ -0,0 +1,94 @@
+package action
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of performing a single SyncAction
+type Result struct {
+	Action  SyncAction
+	Err     error
+	Elapsed time.Duration
+}
+
+// Succeeded tells whether the action was performed without an error
+func (r Result) Succeeded() bool {
+	return r.Err == nil
+}
+
+// Report summarizes the outcome of performing a list of SyncActions
+type Report struct {
+	Results      []Result
+	CountsByType map[string]int
+	Failures     []Result
+	// Skipped are actions that weren't performed, as their preconditions didn't hold (see CheckPreconditions), or
+	// that weren't permitted (see ErrNotPermitted)
+	Skipped      []Result
+	SuccessCount int
+	// SucceededAfterRetry is number of actions that succeeded only after being retried (see PerformWithRetries)
+	SucceededAfterRetry int
+	// Interrupted tells whether performing of actions was stopped midway (e.g. on Ctrl-C), leaving the rest of them
+	// unperformed
+	Interrupted bool
+	// TempPaths are files left at temporary paths by actions that weren't performed, as performing was interrupted
+	// (see TempPathsOf)
+	TempPaths []string
+	// TrashedFiles are paths of files moved into trash directory, out of the way of file moves (see ConflictTrash)
+	TrashedFiles []string
+	Elapsed      time.Duration
+}
+
+// NewReport creates an empty Report with room for given number of actions
+func NewReport(numActions int) Report {
+	return Report{
+		Results:      make([]Result, 0, numActions),
+		CountsByType: map[string]int{},
+		Failures:     []Result{},
+		Skipped:      []Result{},
+	}
+}
+
+// Add records outcome of an action in the report
+func (r *Report) Add(a SyncAction, err error, elapsed time.Duration) {
+	result := Result{Action: a, Err: err, Elapsed: elapsed}
+	r.Results = append(r.Results, result)
+	r.CountsByType[TypeName(a)]++
+	if err == nil {
+		r.SuccessCount++
+	} else {
+		r.Failures = append(r.Failures, result)
+	}
+}
+
+// Skip records an action that wasn't performed, along with the reason
+func (r *Report) Skip(a SyncAction, reason error) {
+	r.Skipped = append(r.Skipped, Result{Action: a, Err: reason})
+}
+
+// FailureCount returns number of actions that failed
+func (r Report) FailureCount() int {
+	return len(r.Failures)
+}
+
+// String returns counts of actions by their type, e.g. "MoveFileAction: 3, PropagateTimestampAction: 1"
+func (r Report) String() string {
+	types := make([]string, 0, len(r.CountsByType))
+	for t := range r.CountsByType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	counts := make([]string, 0, len(types))
+	for _, t := range types {
+		counts = append(counts, fmt.Sprintf("%s: %d", t, r.CountsByType[t]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// TypeName returns name of the concrete type of the action (e.g. "MoveFileAction")
+func TypeName(a SyncAction) string {
+	typeName := fmt.Sprintf("%T", a)
+	return typeName[strings.LastIndex(typeName, ".")+1:]
+}
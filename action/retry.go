@@ -0,0 +1,76 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides how many times an action that fails due to a transient error is performed again, and how long
+// to wait before that (the delay doubles after each retry)
+type RetryPolicy struct {
+	Retries int
+	Delay   time.Duration
+}
+
+// sleep waits for given duration, or until ctx is done (in which case it returns an error). It's a variable so that
+// tests don't have to wait.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// transientErrnos are errors from the operating system after which performing the same action again may succeed
+// (e.g. a hiccup of a network filesystem)
+var transientErrnos = []syscall.Errno{
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+	syscall.ETIMEDOUT,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.ENETDOWN,
+}
+
+// IsTransient checks whether the error is likely transient. Logical errors, such as a file already existing or not
+// existing, are not.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// PerformWithRetries performs the action as part of given run, performing it again (as per the policy) for as long as
+// it fails due to a transient error, unless ctx is done while waiting to. It returns number of retries, along with the
+// error of the last attempt.
+func PerformWithRetries(ctx context.Context, a SyncAction, r *Run, policy RetryPolicy) (numRetries int, err error) {
+	delay := policy.Delay
+	for {
+		err = a.Perform(r)
+		if err == nil || numRetries >= policy.Retries || !IsTransient(err) {
+			return numRetries, err
+		}
+		if sleep(ctx, delay) != nil {
+			return numRetries, err
+		}
+		delay *= 2
+		numRetries++
+	}
+}
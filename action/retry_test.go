@@ -0,0 +1,75 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyAction fails with given error for given number of attempts, and succeeds after that
+type flakyAction struct {
+	MakeDirectoryAction
+	numFailures *int
+	err         error
+}
+
+func (a flakyAction) Perform(_ *Run) error {
+	if *a.numFailures > 0 {
+		*a.numFailures--
+		return a.err
+	}
+	return nil
+}
+
+func TestPerformWithRetries(t *testing.T) {
+	var delays []time.Duration
+	defaultSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() {
+		sleep = defaultSleep
+	}()
+	ctx := context.Background()
+	transientErr := &os.LinkError{Op: "rename", Old: "a", New: "b", Err: syscall.ECONNRESET}
+	policy := RetryPolicy{Retries: 3, Delay: time.Second}
+	// Succeeds after retries:
+	numFailures := 2
+	numRetries, err := PerformWithRetries(ctx, flakyAction{numFailures: &numFailures, err: transientErr}, nil, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, numRetries)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, delays)
+	// Fails even after retries:
+	numFailures, delays = 10, nil
+	numRetries, err = PerformWithRetries(ctx, flakyAction{numFailures: &numFailures, err: transientErr}, nil, policy)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, numRetries)
+	assert.Equal(t, 6, numFailures)
+	// Logical errors aren't retried:
+	numFailures, delays = 2, nil
+	numRetries, err = PerformWithRetries(ctx, flakyAction{numFailures: &numFailures,
+		err: fmt.Errorf(`error: file "b" already exists: %w`, os.ErrExist)}, nil, policy)
+	assert.Error(t, err)
+	assert.Equal(t, 0, numRetries)
+	assert.Empty(t, delays)
+	// Without retries, it's same as Perform:
+	numFailures = 1
+	numRetries, err = PerformWithRetries(ctx, flakyAction{numFailures: &numFailures, err: transientErr}, nil,
+		RetryPolicy{})
+	assert.Error(t, err)
+	assert.Equal(t, 0, numRetries)
+	// Waiting for a retry stops once the run is interrupted:
+	sleep = defaultSleep
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	numFailures = 1
+	numRetries, err = PerformWithRetries(cancelledCtx, flakyAction{numFailures: &numFailures, err: transientErr},
+		nil, RetryPolicy{Retries: 3, Delay: time.Hour})
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 0, numRetries)
+}
@@ -0,0 +1,79 @@
+package action
+
+import "sync"
+
+// Settings decide how actions are performed, beyond what each action says (zero value is the default for each)
+type Settings struct {
+	// ConflictPolicy decides what MoveFileAction does when another file is at its new path already: one of
+	// ConflictPolicies (empty meaning ConflictSkip). Scripts don't follow it.
+	ConflictPolicy string
+	// TrashDirPath is where files in the way are moved into with ConflictTrash. It must be on the same filesystem as
+	// destination, as files are moved into it without copying.
+	TrashDirPath string
+	// TempDirPath, if set, makes cycles of moves be broken by moving one of the files (or directories) aside into it,
+	// instead of next to where it is (see SortByDependencies). It must be on the same filesystem as destination, so
+	// that moves into and out of it are renames (it's best outside destination, so that it isn't scanned).
+	TempDirPath string
+	// TempPrefix is prefixed to names of files in TempDirPath (e.g. ID of the run), so that runs sharing the
+	// directory (or resuming an earlier one) don't pick same names
+	TempPrefix string
+	// CopyBandwidthLimit caps the rate (in bytes per second) at which CopyFileAction copies files, e.g. so that copies
+	// from an archive directory on a network share don't saturate a link shared with other traffic (0 meaning no
+	// limit)
+	CopyBandwidthLimit int64
+	// NoClobberVerify makes file moves fail, rather than fall back to a non-atomic 'check and rename', on filesystems
+	// that support neither a rename that doesn't replace nor hard links (see moveNoClobber)
+	NoClobberVerify bool
+	// PreserveAccessTime makes PropagateTimestampAction copy access time of files too (by default, access time is set
+	// to modification time)
+	PreserveAccessTime bool
+}
+
+// Run is what a list of actions is performed as part of: it decides how they're performed (through its Settings) and
+// records what performing them did besides (see TrashedFiles). Performing an action as part of a nil Run is same as
+// with default Settings.
+type Run struct {
+	Settings
+	// Interrupted is the action an earlier run was performing when it stopped (as recorded in a journal), which may
+	// have been left half-done: a file move that was under way is completed, rather than failed (see moveNoClobber)
+	Interrupted  SyncAction
+	trashedMutex sync.Mutex
+	trashed      []string
+}
+
+// NewRun creates a Run as per given settings
+func NewRun(settings Settings) *Run {
+	return &Run{Settings: settings}
+}
+
+// settings returns settings of the run (default ones for a nil Run)
+func (r *Run) settings() Settings {
+	if r == nil {
+		return Settings{}
+	}
+	return r.Settings
+}
+
+// isInterrupted tells whether the action is the one an earlier run was performing when it stopped (see Interrupted)
+func (r *Run) isInterrupted(a SyncAction) bool {
+	return r != nil && r.Interrupted != nil && r.Interrupted == a
+}
+
+// TrashedFiles returns paths of files moved into trash directory (see ConflictTrash) by actions of the run so far
+func (r *Run) TrashedFiles() []string {
+	if r == nil {
+		return nil
+	}
+	r.trashedMutex.Lock()
+	defer r.trashedMutex.Unlock()
+	return append([]string(nil), r.trashed...)
+}
+
+func (r *Run) addTrashedFile(path string) {
+	if r == nil {
+		return
+	}
+	r.trashedMutex.Lock()
+	defer r.trashedMutex.Unlock()
+	r.trashed = append(r.trashed, path)
+}
@@ -0,0 +1,120 @@
+package action
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Flavors of scripts that actions can be rendered in (see Command)
+const (
+	// ScriptFlavorBash is a shell script for bash (commands are as in UnixCommand)
+	ScriptFlavorBash = "bash"
+	// ScriptFlavorPowerShell is a PowerShell script
+	ScriptFlavorPowerShell = "powershell"
+	// ScriptFlavorCmd is a Windows batch file, for cmd.exe
+	ScriptFlavorCmd = "cmd"
+)
+
+// ScriptFlavors lists all valid script flavors
+var ScriptFlavors = []string{ScriptFlavorBash, ScriptFlavorPowerShell, ScriptFlavorCmd}
+
+// ScriptExtensions are extensions of script files, by flavor
+var ScriptExtensions = map[string]string{
+	ScriptFlavorBash:       ".sh",
+	ScriptFlavorPowerShell: ".ps1",
+	ScriptFlavorCmd:        ".bat",
+}
+
+// Command renders the action as a command of given script flavor. Like UnixCommand, commands never overwrite an
+// existing file.
+func Command(a SyncAction, flavor string) string {
+	switch flavor {
+	case ScriptFlavorPowerShell:
+		return powerShellCommand(a)
+	case ScriptFlavorCmd:
+		return cmdCommand(a)
+	default:
+		return a.UnixCommand()
+	}
+}
+
+// quotePowerShell quotes the path as a literal string for PowerShell (in which only single quote is special)
+func quotePowerShell(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", "''") + "'"
+}
+
+func powerShellCommand(a SyncAction) string {
+	from, to := quotePowerShell(a.sourcePath()), quotePowerShell(a.destinationPath())
+	switch syncAction := a.(type) {
+	case MoveFileAction:
+		if strings.EqualFold(a.sourcePath(), a.destinationPath()) {
+			temp := quotePowerShell(a.sourcePath() + tempSuffix)
+			return fmt.Sprintf(`Move-Item -Verbose -LiteralPath %s -Destination %s; `+
+				`Move-Item -Verbose -LiteralPath %s -Destination %s`, from, temp, temp, to)
+		}
+		return fmt.Sprintf(`New-Item -ItemType Directory -Force -Path %s | Out-Null; `+
+			`Move-Item -Verbose -LiteralPath %s -Destination %s`, quotePowerShell(filepath.Dir(a.destinationPath())),
+			from, to)
+	case MoveDirectoryAction, SymlinkMoveAction:
+		return fmt.Sprintf(`Move-Item -Verbose -LiteralPath %s -Destination %s`, from, to)
+	case PropagateTimestampAction, PropagateDirTimestampAction:
+		return fmt.Sprintf(`(Get-Item -LiteralPath %s).LastWriteTime = (Get-Item -LiteralPath %s).LastWriteTime`,
+			to, from)
+	case MakeDirectoryAction:
+		return fmt.Sprintf(`New-Item -Verbose -ItemType Directory -Force -Path %s`, to)
+	case RemoveDirectoryAction:
+		// Unlike Remove-Item, this fails (instead of prompting) if the directory isn't empty:
+		return fmt.Sprintf(`[System.IO.Directory]::Delete(%s)`, to)
+	case RemoveFileAction:
+		// Comparison of paths (as in -ne) is case-insensitive, as are filesystems on Windows:
+		return fmt.Sprintf(`if ((%s -ne %s) -and ((Get-FileHash -LiteralPath %s).Hash -eq `+
+			`(Get-FileHash -LiteralPath %s).Hash)) { Remove-Item -Verbose -LiteralPath %s }`, from, to, from, to, to)
+	case CopyFileAction:
+		return fmt.Sprintf(`if (-not (Test-Path -LiteralPath %s)) { `+
+			`Copy-Item -Verbose -LiteralPath %s -Destination %s }`, to, from, to)
+	default:
+		return "# " + syncAction.UnixCommand()
+	}
+}
+
+// quoteCmd quotes the path for a batch file (double quotes can't be in names of files on Windows, but percent signs
+// have to be doubled)
+func quoteCmd(path string) string {
+	return `"` + strings.ReplaceAll(path, "%", "%%") + `"`
+}
+
+func cmdCommand(a SyncAction) string {
+	from, to := quoteCmd(a.sourcePath()), quoteCmd(a.destinationPath())
+	switch syncAction := a.(type) {
+	case MoveFileAction:
+		if strings.EqualFold(a.sourcePath(), a.destinationPath()) {
+			temp := quoteCmd(a.sourcePath() + tempSuffix)
+			return fmt.Sprintf(`if not exist %s move %s %s && move %s %s`, temp, from, temp, temp, to)
+		}
+		parent := quoteCmd(filepath.Dir(a.destinationPath()))
+		return fmt.Sprintf(`(if not exist %s mkdir %s) & if not exist %s move %s %s`, parent, parent, to, from, to)
+	case MoveDirectoryAction, SymlinkMoveAction:
+		return fmt.Sprintf(`if not exist %s move %s %s`, to, from, to)
+	case PropagateTimestampAction, PropagateDirTimestampAction:
+		// cmd.exe can't set timestamps of files by itself:
+		return fmt.Sprintf(`powershell -NoProfile -Command "(Get-Item -LiteralPath %s).LastWriteTime = `+
+			`(Get-Item -LiteralPath %s).LastWriteTime"`, quoteCmdPowerShell(a.destinationPath()),
+			quoteCmdPowerShell(a.sourcePath()))
+	case MakeDirectoryAction:
+		return fmt.Sprintf(`if not exist %s mkdir %s`, to, to)
+	case RemoveDirectoryAction:
+		return fmt.Sprintf(`rmdir %s`, to)
+	case RemoveFileAction:
+		return fmt.Sprintf(`if /i not %s==%s (fc /b %s %s >nul && del %s)`, from, to, from, to, to)
+	case CopyFileAction:
+		return fmt.Sprintf(`if not exist %s copy %s %s`, to, from, to)
+	default:
+		return "rem " + syncAction.UnixCommand()
+	}
+}
+
+// quoteCmdPowerShell quotes the path for PowerShell, for a command that's within double quotes in a batch file
+func quoteCmdPowerShell(path string) string {
+	return strings.ReplaceAll(quotePowerShell(path), "%", "%%")
+}
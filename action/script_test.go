@@ -0,0 +1,80 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	actions := []SyncAction{
+		MoveFileAction{BasePath: "/d", RelativeFromPath: "it's 100%.txt", RelativeToPath: "new/a $b.txt"},
+		MoveFileAction{BasePath: "/d", RelativeFromPath: "A.jpg", RelativeToPath: "a.jpg"},
+		MoveDirectoryAction{BasePath: "/d", RelativeFromPath: "x", RelativeToPath: "y"},
+		SymlinkMoveAction{BasePath: "/d", RelativeFromPath: "l1", RelativeToPath: "l2"},
+		PropagateTimestampAction{SourceBaseDirPath: "/s", DestinationBaseDirPath: "/d",
+			SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "b.txt"},
+		MakeDirectoryAction{AbsoluteDirPath: "/d/new"},
+		CopyFileAction{FromPath: "/archive/a.txt", BasePath: "/d", RelativeToPath: "a.txt"},
+		RemoveDirectoryAction{AbsoluteDirPath: "/d/old"},
+		ChmodAction{BasePath: "/d", RelativePath: "a.txt", Mode: 0644},
+		PropagateDirTimestampAction{SourceBaseDirPath: "/s", DestinationBaseDirPath: "/d", RelativePath: "dir"},
+		RemoveFileAction{BasePath: "/d", RelativePath: "old/a.txt", RelativeDuplicateOfPath: "a.txt"},
+	}
+	expected := map[string][]string{
+		ScriptFlavorBash: {
+			`mkdir -p "/d/new" && mv -v -n "/d/it's 100%.txt" "/d/new/a \$b.txt"`,
+			`mv -v -n "/d/A.jpg" "/d/A.jpg` + tempSuffix + `" && mv -v -n "/d/A.jpg` + tempSuffix + `" "/d/a.jpg"`,
+			`mv -v -n "/d/x" "/d/y"`,
+			`mv -v -n "/d/l1" "/d/l2"`,
+			`touch -r "/s/a.txt" "/d/b.txt"`,
+			`mkdir -p -v "/d/new"`,
+			`cp -p -n "/archive/a.txt" "/d/a.txt"`,
+			`rmdir -v "/d/old"`,
+			`chmod 644 "/d/a.txt"`,
+			`touch -r "/s/dir" "/d/dir"`,
+			`[ ! "/d/a.txt" -ef "/d/old/a.txt" ] && cmp -s "/d/a.txt" "/d/old/a.txt" && rm -v "/d/old/a.txt"`,
+		},
+		ScriptFlavorPowerShell: {
+			`New-Item -ItemType Directory -Force -Path '/d/new' | Out-Null; ` +
+				`Move-Item -Verbose -LiteralPath '/d/it''s 100%.txt' -Destination '/d/new/a $b.txt'`,
+			`Move-Item -Verbose -LiteralPath '/d/A.jpg' -Destination '/d/A.jpg` + tempSuffix + `'; ` +
+				`Move-Item -Verbose -LiteralPath '/d/A.jpg` + tempSuffix + `' -Destination '/d/a.jpg'`,
+			`Move-Item -Verbose -LiteralPath '/d/x' -Destination '/d/y'`,
+			`Move-Item -Verbose -LiteralPath '/d/l1' -Destination '/d/l2'`,
+			`(Get-Item -LiteralPath '/d/b.txt').LastWriteTime = (Get-Item -LiteralPath '/s/a.txt').LastWriteTime`,
+			`New-Item -Verbose -ItemType Directory -Force -Path '/d/new'`,
+			`if (-not (Test-Path -LiteralPath '/d/a.txt')) { Copy-Item -Verbose -LiteralPath '/archive/a.txt' ` +
+				`-Destination '/d/a.txt' }`,
+			`[System.IO.Directory]::Delete('/d/old')`,
+			`# chmod 644 "/d/a.txt"`,
+			`(Get-Item -LiteralPath '/d/dir').LastWriteTime = (Get-Item -LiteralPath '/s/dir').LastWriteTime`,
+			`if (('/d/a.txt' -ne '/d/old/a.txt') -and ((Get-FileHash -LiteralPath '/d/a.txt').Hash -eq ` +
+				`(Get-FileHash -LiteralPath '/d/old/a.txt').Hash)) ` +
+				`{ Remove-Item -Verbose -LiteralPath '/d/old/a.txt' }`,
+		},
+		ScriptFlavorCmd: {
+			`(if not exist "/d/new" mkdir "/d/new") & ` +
+				`if not exist "/d/new/a $b.txt" move "/d/it's 100%%.txt" "/d/new/a $b.txt"`,
+			`if not exist "/d/A.jpg` + tempSuffix + `" move "/d/A.jpg" "/d/A.jpg` + tempSuffix + `" && ` +
+				`move "/d/A.jpg` + tempSuffix + `" "/d/a.jpg"`,
+			`if not exist "/d/y" move "/d/x" "/d/y"`,
+			`if not exist "/d/l2" move "/d/l1" "/d/l2"`,
+			`powershell -NoProfile -Command "(Get-Item -LiteralPath '/d/b.txt').LastWriteTime = ` +
+				`(Get-Item -LiteralPath '/s/a.txt').LastWriteTime"`,
+			`if not exist "/d/new" mkdir "/d/new"`,
+			`if not exist "/d/a.txt" copy "/archive/a.txt" "/d/a.txt"`,
+			`rmdir "/d/old"`,
+			`rem chmod 644 "/d/a.txt"`,
+			`powershell -NoProfile -Command "(Get-Item -LiteralPath '/d/dir').LastWriteTime = ` +
+				`(Get-Item -LiteralPath '/s/dir').LastWriteTime"`,
+			`if /i not "/d/a.txt"=="/d/old/a.txt" (fc /b "/d/a.txt" "/d/old/a.txt" >nul && del "/d/old/a.txt")`,
+		},
+	}
+	assert.Equal(t, len(ScriptFlavors), len(expected))
+	for _, flavor := range ScriptFlavors {
+		for i, a := range actions {
+			assert.Equal(t, expected[flavor][i], Command(a, flavor), "%s in flavor %s", TypeName(a), flavor)
+		}
+		assert.Contains(t, ScriptExtensions, flavor)
+	}
+}
@@ -0,0 +1,221 @@
+package action
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+)
+
+// Types of actions, as in Spec
+const (
+	SpecTypeMove          = "move"
+	SpecTypeMoveDirectory = "move_directory"
+	SpecTypeMoveSymlink   = "move_symlink"
+	SpecTypeTimestamp     = "timestamp"
+	SpecTypeDirTimestamp  = "dir_timestamp"
+	SpecTypeMkdir         = "mkdir"
+	SpecTypeCopy          = "copy"
+	SpecTypeRmdir         = "rmdir"
+	SpecTypeRm            = "rm"
+	SpecTypeChmod         = "chmod"
+	SpecTypeChown         = "chown"
+)
+
+// Spec is a machine-readable description of a SyncAction (all paths are as they are in the action)
+type Spec struct {
+	Type string `json:"type"`
+	// From is path of what's moved (for moves), of the file (or directory) whose timestamp is propagated (for
+	// timestamp and dir_timestamp), of the file copied (for copy) or of the file kept (for rm)
+	From string `json:"from,omitempty"`
+	// To is path something is moved or copied to (for moves and copy), timestamp is propagated to (for timestamp and
+	// dir_timestamp), directory created (for mkdir), directory removed (for rmdir), duplicate file removed (for rm) or
+	// file whose permissions or owner are changed (for chmod and chown)
+	To string `json:"to"`
+	// Mode is permissions, in octal, a file's permissions are changed to (for chmod)
+	Mode string `json:"mode,omitempty"`
+	// Owner is IDs of user and group a file's owner is changed to, as "uid:gid" (for chown, -1 meaning unchanged)
+	Owner string `json:"owner,omitempty"`
+	// BytesSaved is an estimate of bytes that would not have to be transferred, thanks to this action
+	BytesSaved int64 `json:"bytes_saved"`
+}
+
+// NewSpec describes the action. Bytes saved are estimated from sizes of files at destination, so this must be called
+// before the action is performed.
+func NewSpec(a SyncAction) Spec {
+	switch syncAction := a.(type) {
+	case MoveFileAction:
+		return Spec{Type: SpecTypeMove, From: a.sourcePath(), To: a.destinationPath(),
+			BytesSaved: sizeOf(a.sourcePath())}
+	case MoveDirectoryAction:
+		return Spec{Type: SpecTypeMoveDirectory, From: a.sourcePath(), To: a.destinationPath(),
+			BytesSaved: sizeOf(a.sourcePath())}
+	case SymlinkMoveAction:
+		return Spec{Type: SpecTypeMoveSymlink, From: a.sourcePath(), To: a.destinationPath()}
+	case PropagateTimestampAction:
+		return Spec{Type: SpecTypeTimestamp, From: a.sourcePath(), To: a.destinationPath(),
+			BytesSaved: sizeOf(a.destinationPath())}
+	case PropagateDirTimestampAction:
+		return Spec{Type: SpecTypeDirTimestamp, From: a.sourcePath(), To: a.destinationPath()}
+	case MakeDirectoryAction:
+		return Spec{Type: SpecTypeMkdir, To: a.destinationPath()}
+	case RemoveDirectoryAction:
+		return Spec{Type: SpecTypeRmdir, To: a.destinationPath()}
+	case RemoveFileAction:
+		return Spec{Type: SpecTypeRm, From: a.sourcePath(), To: a.destinationPath()}
+	case CopyFileAction:
+		return Spec{Type: SpecTypeCopy, From: a.sourcePath(), To: a.destinationPath(),
+			BytesSaved: sizeOf(a.sourcePath())}
+	case ChmodAction:
+		return Spec{Type: SpecTypeChmod, To: a.destinationPath(), Mode: fmt.Sprintf("%03o", syncAction.Mode.Perm())}
+	case ChownAction:
+		return Spec{Type: SpecTypeChown, To: a.destinationPath(), Owner: fmt.Sprintf("%d:%d", syncAction.UID,
+			syncAction.GID)}
+	default:
+		return Spec{Type: TypeName(syncAction), From: a.sourcePath(), To: a.destinationPath()}
+	}
+}
+
+// FromSpec re-creates the action from its description. Paths must be inside given source and destination
+// directories, as in the actions that were described (except path of a file copied, which can be anywhere, and paths
+// that moves move things aside to, which can be in given temporary directory, see Settings.TempDirPath).
+func FromSpec(spec Spec, sourceDirPath string, destinationDirPath string, tempDirPath string) (SyncAction, error) {
+	switch spec.Type {
+	case SpecTypeMove, SpecTypeMoveDirectory, SpecTypeMoveSymlink:
+		from, fromErr := movePathInside(destinationDirPath, tempDirPath, spec.From)
+		if fromErr != nil {
+			return nil, fromErr
+		}
+		to, toErr := movePathInside(destinationDirPath, tempDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		switch spec.Type {
+		case SpecTypeMove:
+			return MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: from, RelativeToPath: to}, nil
+		case SpecTypeMoveDirectory:
+			return MoveDirectoryAction{BasePath: destinationDirPath, RelativeFromPath: from, RelativeToPath: to}, nil
+		default:
+			return SymlinkMoveAction{BasePath: destinationDirPath, RelativeFromPath: from, RelativeToPath: to}, nil
+		}
+	case SpecTypeTimestamp:
+		from, fromErr := relativePathInside(sourceDirPath, spec.From)
+		if fromErr != nil {
+			return nil, fromErr
+		}
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		return PropagateTimestampAction{
+			SourceBaseDirPath:           sourceDirPath,
+			DestinationBaseDirPath:      destinationDirPath,
+			SourceFileRelativePath:      from,
+			DestinationFileRelativePath: to,
+		}, nil
+	case SpecTypeDirTimestamp:
+		from, fromErr := relativePathInside(sourceDirPath, spec.From)
+		if fromErr != nil {
+			return nil, fromErr
+		}
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		if from != to {
+			return nil, fmt.Errorf("directories \"%s\" and \"%s\" aren't at same paths", spec.From, spec.To)
+		}
+		return PropagateDirTimestampAction{SourceBaseDirPath: sourceDirPath, DestinationBaseDirPath: destinationDirPath,
+			RelativePath: to}, nil
+	case SpecTypeMkdir:
+		if _, err := relativePathInside(destinationDirPath, spec.To); err != nil {
+			return nil, err
+		}
+		return MakeDirectoryAction{AbsoluteDirPath: spec.To}, nil
+	case SpecTypeRmdir:
+		if _, err := relativePathInside(destinationDirPath, spec.To); err != nil {
+			return nil, err
+		}
+		return RemoveDirectoryAction{AbsoluteDirPath: spec.To}, nil
+	case SpecTypeRm:
+		from, fromErr := relativePathInside(destinationDirPath, spec.From)
+		if fromErr != nil {
+			return nil, fromErr
+		}
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		return RemoveFileAction{BasePath: destinationDirPath, RelativePath: to, RelativeDuplicateOfPath: from}, nil
+	case SpecTypeCopy:
+		if !filepath.IsAbs(spec.From) {
+			return nil, fmt.Errorf("path \"%s\" isn't absolute", spec.From)
+		}
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		return CopyFileAction{FromPath: spec.From, BasePath: destinationDirPath, RelativeToPath: to}, nil
+	case SpecTypeChmod:
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		mode, modeErr := strconv.ParseUint(spec.Mode, 8, 32)
+		if modeErr != nil || mode > uint64(fs.ModePerm) {
+			return nil, fmt.Errorf("invalid permissions: \"%s\"", spec.Mode)
+		}
+		return ChmodAction{BasePath: destinationDirPath, RelativePath: to, Mode: fs.FileMode(mode)}, nil
+	case SpecTypeChown:
+		to, toErr := relativePathInside(destinationDirPath, spec.To)
+		if toErr != nil {
+			return nil, toErr
+		}
+		var uid, gid int
+		if _, err := fmt.Sscanf(spec.Owner, "%d:%d", &uid, &gid); err != nil || uid < -1 || gid < -1 {
+			return nil, fmt.Errorf("invalid owner: \"%s\"", spec.Owner)
+		}
+		return ChownAction{BasePath: destinationDirPath, RelativePath: to, UID: uid, GID: gid}, nil
+	}
+	return nil, fmt.Errorf("unknown type of action: \"%s\"", spec.Type)
+}
+
+// relativePathInside computes path relative to given directory, ensuring that path is inside it
+func relativePathInside(dirPath string, path string) (string, error) {
+	if !lib.IsInsideDirectory(dirPath, path) {
+		return "", fmt.Errorf("path \"%s\" isn't inside directory \"%s\"", path, dirPath)
+	}
+	return filepath.Rel(dirPath, path)
+}
+
+// movePathInside is same as relativePathInside, except that path can be inside temporary directory too (as with moves
+// that break cycles of moves, see Settings.TempDirPath)
+func movePathInside(dirPath string, tempDirPath string, path string) (string, error) {
+	if tempDirPath != "" && lib.IsInsideDirectory(tempDirPath, path) {
+		return filepath.Rel(dirPath, path)
+	}
+	return relativePathInside(dirPath, path)
+}
+
+// sizeOf computes size of a regular file, or total size of regular files inside a directory (0 if it can't be read)
+func sizeOf(path string) (size int64) {
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, infoErr := d.Info(); infoErr == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Specs describes the actions
+func Specs(actions []SyncAction) []Spec {
+	specs := make([]Spec, 0, len(actions))
+	for _, a := range actions {
+		specs = append(specs, NewSpec(a))
+	}
+	return specs
+}
@@ -0,0 +1,97 @@
+package action
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSpec(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "old", "sub"), 0755))
+	writeFile(t, filepath.Join(dir, "a.txt"), "12345")
+	writeFile(t, filepath.Join(dir, "old", "b.txt"), "123")
+	writeFile(t, filepath.Join(dir, "old", "sub", "c.txt"), "1234")
+	assert.Equal(t, Spec{Type: SpecTypeMove, From: filepath.Join(dir, "a.txt"), To: filepath.Join(dir, "b.txt"),
+		BytesSaved: 5}, NewSpec(MoveFileAction{BasePath: dir, RelativeFromPath: "a.txt", RelativeToPath: "b.txt"}))
+	assert.Equal(t, Spec{Type: SpecTypeMoveDirectory, From: filepath.Join(dir, "old"), To: filepath.Join(dir, "new"),
+		BytesSaved: 7}, NewSpec(MoveDirectoryAction{BasePath: dir, RelativeFromPath: "old", RelativeToPath: "new"}))
+	assert.Equal(t, Spec{Type: SpecTypeTimestamp, From: "/source/a.txt", To: filepath.Join(dir, "a.txt"),
+		BytesSaved: 5}, NewSpec(PropagateTimestampAction{SourceBaseDirPath: "/source", DestinationBaseDirPath: dir,
+		SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "a.txt"}))
+	assert.Equal(t, Spec{Type: SpecTypeMkdir, To: filepath.Join(dir, "new")},
+		NewSpec(MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "new")}))
+	// Sizes of files that don't exist can't be estimated:
+	assert.Equal(t, int64(0), NewSpec(MoveFileAction{BasePath: dir, RelativeFromPath: "x.txt",
+		RelativeToPath: "y.txt"}).BytesSaved)
+}
+
+func TestFromSpec(t *testing.T) {
+	actions := []SyncAction{
+		MoveFileAction{BasePath: "/dst", RelativeFromPath: "a.txt", RelativeToPath: filepath.Join("dir", "a.txt")},
+		MoveDirectoryAction{BasePath: "/dst", RelativeFromPath: "old", RelativeToPath: "new"},
+		SymlinkMoveAction{BasePath: "/dst", RelativeFromPath: "link", RelativeToPath: "latest"},
+		PropagateTimestampAction{SourceBaseDirPath: "/src", DestinationBaseDirPath: "/dst",
+			SourceFileRelativePath: "b.txt", DestinationFileRelativePath: "c.txt"},
+		MakeDirectoryAction{AbsoluteDirPath: filepath.Join("/dst", "dir")},
+		CopyFileAction{FromPath: "/archive/d.txt", BasePath: "/dst", RelativeToPath: filepath.Join("dir", "d.txt")},
+		RemoveDirectoryAction{AbsoluteDirPath: filepath.Join("/dst", "old")},
+		ChmodAction{BasePath: "/dst", RelativePath: "c.txt", Mode: 0640},
+		ChownAction{BasePath: "/dst", RelativePath: "c.txt", UID: 1000, GID: -1},
+		PropagateDirTimestampAction{SourceBaseDirPath: "/src", DestinationBaseDirPath: "/dst", RelativePath: "dir"},
+		RemoveFileAction{BasePath: "/dst", RelativePath: "copy.txt", RelativeDuplicateOfPath: "c.txt"},
+	}
+	for _, a := range actions {
+		recreated, err := FromSpec(NewSpec(a), "/src", "/dst", "")
+		assert.NoError(t, err)
+		assert.Equal(t, a, recreated)
+	}
+	_, err := FromSpec(Spec{Type: SpecTypeMove, From: "/dst/a.txt", To: "/elsewhere/a.txt"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeMkdir, To: "/dst"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeCopy, From: "d.txt", To: "/dst/d.txt"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeChmod, To: "/dst/c.txt", Mode: "rw-r--r--"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeChown, To: "/dst/c.txt", Owner: "alice"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeDirTimestamp, From: "/src/a", To: "/dst/b"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: SpecTypeRm, From: "/src/c.txt", To: "/dst/c.txt"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	_, err = FromSpec(Spec{Type: "delete", To: "/dst/b.txt"}, "/src", "/dst", "")
+	assert.Error(t, err)
+	// Moves aside into temporary directory:
+	moveAside := MoveFileAction{BasePath: "/dst", RelativeFromPath: "a.txt",
+		RelativeToPath: filepath.Join("..", "tmp", "0_a.txt"+tempSuffix)}
+	recreated, err := FromSpec(NewSpec(moveAside), "/src", "/dst", "/tmp")
+	assert.NoError(t, err)
+	assert.Equal(t, moveAside, recreated)
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	assert.NoError(t, CheckPreconditions(MoveFileAction{BasePath: dir, RelativeFromPath: "a.txt",
+		RelativeToPath: "c.txt"}, nil))
+	assert.Error(t, CheckPreconditions(MoveFileAction{BasePath: dir, RelativeFromPath: "a.txt",
+		RelativeToPath: "b.txt"}, nil))
+	assert.Error(t, CheckPreconditions(MoveFileAction{BasePath: dir, RelativeFromPath: "x.txt",
+		RelativeToPath: "c.txt"}, nil))
+	assert.NoError(t, CheckPreconditions(PropagateTimestampAction{SourceBaseDirPath: dir,
+		DestinationBaseDirPath: dir, SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "b.txt"}, nil))
+	assert.Error(t, CheckPreconditions(PropagateTimestampAction{SourceBaseDirPath: dir,
+		DestinationBaseDirPath: dir, SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "x.txt"}, nil))
+	assert.NoError(t, CheckPreconditions(MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "a.txt")}, nil))
+	assert.NoError(t, CheckPreconditions(CopyFileAction{FromPath: filepath.Join(dir, "a.txt"), BasePath: dir,
+		RelativeToPath: "c.txt"}, nil))
+	assert.Error(t, CheckPreconditions(CopyFileAction{FromPath: filepath.Join(dir, "a.txt"), BasePath: dir,
+		RelativeToPath: "b.txt"}, nil))
+	assert.NoError(t, CheckPreconditions(RemoveFileAction{BasePath: dir, RelativePath: "b.txt",
+		RelativeDuplicateOfPath: "a.txt"}, nil))
+	assert.Error(t, CheckPreconditions(RemoveFileAction{BasePath: dir, RelativePath: "b.txt",
+		RelativeDuplicateOfPath: "x.txt"}, nil))
+}
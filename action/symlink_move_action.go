@@ -0,0 +1,65 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// removeSymlink is a variable so that tests can simulate a failure to remove the old link
+var removeSymlink = os.Remove
+
+// SymlinkMoveAction is a SyncAction for moving or renaming a symbolic link
+type SymlinkMoveAction struct {
+	BasePath         string
+	RelativeFromPath string
+	RelativeToPath   string
+}
+
+func (a SymlinkMoveAction) sourcePath() string {
+	return filepath.Join(a.BasePath, a.RelativeFromPath)
+}
+
+func (a SymlinkMoveAction) destinationPath() string {
+	return filepath.Join(a.BasePath, a.RelativeToPath)
+}
+
+// UnixCommand for moving or renaming a symbolic link (mv moves the link itself, not what it points to)
+func (a SymlinkMoveAction) UnixCommand() string {
+	return fmt.Sprintf(`mv -v -n "%s" "%s"`, escape(a.sourcePath()), escape(a.destinationPath()))
+}
+
+// Perform 'symbolic link move/rename' action, creating new parent directory of the link if needed. Link is re-created
+// at new path with the same target (which fails if new path already exists) and only then the old link is removed (if
+// that fails, the new link is removed, so that the link isn't left at both paths). Unlike a rename, this never
+// overwrites anything.
+func (a SymlinkMoveAction) Perform(_ *Run) error {
+	target, err := os.Readlink(a.sourcePath())
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(a.destinationPath()), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	if err = os.Symlink(target, a.destinationPath()); err != nil {
+		return err
+	}
+	removeErr := removeSymlink(a.sourcePath())
+	if removeErr == nil {
+		return nil
+	}
+	if undoErr := os.Remove(a.destinationPath()); undoErr != nil {
+		return fmt.Errorf("error: couldn't remove \"%s\" after re-creating it at \"%s\" (%+v), nor remove the new "+
+			"link: %+v", a.sourcePath(), a.destinationPath(), removeErr, undoErr)
+	}
+	return removeErr
+}
+
+// Uniqueness generates unique string for symbolic link renaming/movement
+func (a SymlinkMoveAction) Uniqueness() string {
+	return "mvlink" + cmdSeparator + a.RelativeFromPath
+}
+
+func (a SymlinkMoveAction) String() string {
+	return fmt.Sprintf(`rename/move symbolic link from "%s" to "%s"`, a.sourcePath(), a.destinationPath())
+}
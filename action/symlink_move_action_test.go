@@ -0,0 +1,52 @@
+package action
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymlinkMoveAction(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "target.txt"), "target")
+	writeFile(t, filepath.Join(dir, "other.txt"), "other")
+	assert.NoError(t, os.Symlink("target.txt", filepath.Join(dir, "old_link")))
+	a := SymlinkMoveAction{BasePath: dir, RelativeFromPath: "old_link", RelativeToPath: "latest"}
+	assert.NoError(t, a.Perform(nil))
+	_, err := os.Lstat(filepath.Join(dir, "old_link"))
+	assert.True(t, os.IsNotExist(err))
+	target, err := os.Readlink(filepath.Join(dir, "latest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "target.txt", target) // target is kept as is (relative targets aren't resolved)
+	// Existing files are never overwritten:
+	assert.NoError(t, os.Symlink("target.txt", filepath.Join(dir, "another_link")))
+	a = SymlinkMoveAction{BasePath: dir, RelativeFromPath: "another_link", RelativeToPath: "other.txt"}
+	assert.Error(t, a.Perform(nil))
+	assert.Equal(t, "other", readFile(t, filepath.Join(dir, "other.txt")))
+	_, err = os.Readlink(filepath.Join(dir, "another_link"))
+	assert.NoError(t, err)
+	// Link is moved into a new directory:
+	a = SymlinkMoveAction{BasePath: dir, RelativeFromPath: "another_link", RelativeToPath: "links/new/link"}
+	assert.NoError(t, a.Perform(nil))
+	target, err = os.Readlink(filepath.Join(dir, "links/new/link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "target.txt", target)
+}
+
+func TestSymlinkMoveActionRollback(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Symlink("target.txt", filepath.Join(dir, "old_link")))
+	removeErr := errors.New("permission denied")
+	defer func() { removeSymlink = os.Remove }()
+	removeSymlink = func(string) error {
+		return removeErr
+	}
+	a := SymlinkMoveAction{BasePath: dir, RelativeFromPath: "old_link", RelativeToPath: "new_link"}
+	assert.ErrorIs(t, a.Perform(nil), removeErr)
+	_, err := os.Readlink(filepath.Join(dir, "old_link"))
+	assert.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(dir, "new_link"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Environment variables passed to the after-sync hook command
+const (
+	envSource      = "RSYNC_SIDEKICK_SOURCE"
+	envDestination = "RSYNC_SIDEKICK_DESTINATION"
+	envSuccess     = "RSYNC_SIDEKICK_SUCCESS"
+)
+
+// afterSyncHookError is returned when the after-sync hook command couldn't be run or exited with non-zero code
+type afterSyncHookError struct {
+	exitCode int
+	err      error
+}
+
+func (e afterSyncHookError) Error() string {
+	return fmt.Sprintf("after-sync hook failed with exit code %d: %+v", e.exitCode, e.err)
+}
+
+// runAfterSyncHook runs given command through the shell, with its standard output and error attached to this
+// process's (standard output goes wherever output of this process goes, see fmte.Out) and with source, destination
+// and success status of the sync passed as environment variables
+func runAfterSyncHook(command string, sourceDirPath string, destinationDirPath string, success bool) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = fmte.Out()
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		envSource+"="+sourceDirPath,
+		envDestination+"="+destinationDirPath,
+		envSuccess+"="+strconv.FormatBool(success),
+	)
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return afterSyncHookError{exitCode: exitErr.ExitCode(), err: err}
+	}
+	return afterSyncHookError{exitCode: -1, err: err}
+}
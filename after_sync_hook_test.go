@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAfterSyncHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook command in this test is for unix shells")
+	}
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "a.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "b.txt"))
+	hookOutput := filepath.Join(outDir, "hook_output.txt")
+	hook := `echo "$RSYNC_SIDEKICK_SOURCE|$RSYNC_SIDEKICK_DESTINATION|$RSYNC_SIDEKICK_SUCCESS" > "` + hookOutput + `"`
+	// Skipped on dry run:
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		outputScriptPath: filepath.Join(outDir, "script.sh"),
+		afterSyncHook:    hook,
+	})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, hookOutput)
+	// Runs after actions are applied:
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		afterSyncHook: hook,
+	})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(destinationDir, "a.txt"))
+	output, readErr := os.ReadFile(hookOutput)
+	stopIfError(t, readErr)
+	assert.Equal(t, sourceDir+"|"+destinationDir+"|true", strings.TrimSpace(string(output)))
+	// Exit code of the hook is reported:
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		afterSyncHook: "exit 3",
+	})
+	var hookErr afterSyncHookError
+	assert.True(t, errors.As(err, &hookErr))
+	assert.Equal(t, 3, hookErr.exitCode)
+	// ...along with error of what ran before it:
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		afterSyncHook: "exit 3",
+		rsyncPath:     filepath.Join(sourceDir, "no_rsync"),
+	})
+	var rsyncErr rsyncError
+	assert.True(t, errors.As(err, &hookErr))
+	assert.True(t, errors.As(err, &rsyncErr))
+}
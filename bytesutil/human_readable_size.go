@@ -22,6 +22,27 @@ const (
 	EXBI       = PEBI * KIBI // 1024 power 6 (2 power 60)
 )
 
+// binaryUnits and decimalUnits are units of byte sizes in binary and decimal formats, in increasing order
+var (
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	decimalUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+)
+
+// formatSize formats a byte size in the largest of units (each being base times the previous one) that it's at least
+// one of, using sprintf
+func formatSize(sprintf func(format string, a ...any) string, size int64, base int64, units []string) string {
+	if size < 0 {
+		return ""
+	} else if size < base {
+		return sprintf("%d %s", size, units[0])
+	}
+	unit, unitSize := 1, base
+	for unit < len(units)-1 && size/unitSize >= base {
+		unit, unitSize = unit+1, unitSize*base
+	}
+	return sprintf("%.2f %s", float64(size)/float64(unitSize), units[unit])
+}
+
 // BinaryFormat formats a byte size to a human-readable string in binary format.
 // Uses binary prefixes. See: https://en.m.wikipedia.org/wiki/Binary_prefix
 //
@@ -33,23 +54,7 @@ const (
 //
 //	2.09 KiB
 func BinaryFormat(size int64) string {
-	if size < 0 {
-		return ""
-	} else if size < KIBI {
-		return fmt.Sprintf("%d B", size)
-	} else if size < MEBI {
-		return fmt.Sprintf("%.2f KiB", float64(size)/float64(KIBI))
-	} else if size < GIBI {
-		return fmt.Sprintf("%.2f MiB", float64(size)/float64(MEBI))
-	} else if size < TEBI {
-		return fmt.Sprintf("%.2f GiB", float64(size)/float64(GIBI))
-	} else if size < PEBI {
-		return fmt.Sprintf("%.2f TiB", float64(size)/float64(TEBI))
-	} else if size < EXBI {
-		return fmt.Sprintf("%.2f PiB", float64(size)/float64(PEBI))
-	} else {
-		return fmt.Sprintf("%.2f EiB", float64(size)/float64(EXBI))
-	}
+	return formatSize(fmt.Sprintf, size, KIBI, binaryUnits)
 }
 
 // DecimalFormat formats a byte size to a human-readable string in decimal format.
@@ -63,21 +68,5 @@ func BinaryFormat(size int64) string {
 //
 //	2.14KB
 func DecimalFormat(size int64) string {
-	if size < 0 {
-		return ""
-	} else if size < KILO {
-		return fmt.Sprintf("%d B", size)
-	} else if size < MEGA {
-		return fmt.Sprintf("%.2f KB", float64(size)/float64(KILO))
-	} else if size < GIGA {
-		return fmt.Sprintf("%.2f MB", float64(size)/float64(MEGA))
-	} else if size < TERA {
-		return fmt.Sprintf("%.2f GB", float64(size)/float64(GIGA))
-	} else if size < PETA {
-		return fmt.Sprintf("%.2f TB", float64(size)/float64(TERA))
-	} else if size < EXA {
-		return fmt.Sprintf("%.2f PB", float64(size)/float64(PETA))
-	} else {
-		return fmt.Sprintf("%.2f EB", float64(size)/float64(EXA))
-	}
+	return formatSize(fmt.Sprintf, size, KILO, decimalUnits)
 }
@@ -2,6 +2,7 @@ package bytesutil
 
 import (
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
 	"testing"
 )
 
@@ -19,3 +20,19 @@ func TestFormats(t *testing.T) {
 		assert.Equal(t, expectedValues[1], DecimalFormat(value))
 	}
 }
+
+func TestFormat(t *testing.T) {
+	defer SetFormat(FormatBinary, language.English)
+	tests := map[string]map[language.Tag]string{
+		FormatBinary:  {language.English: "2.70 MiB", language.German: "2,70 MiB"},
+		FormatDecimal: {language.English: "2.83 MB", language.German: "2,83 MB"},
+		FormatRaw:     {language.English: "2828382 B", language.German: "2828382 B"},
+	}
+	for format, expectedValues := range tests {
+		for locale, expected := range expectedValues {
+			SetFormat(format, locale)
+			assert.Equal(t, expected, Format(2_828_382), "%s in %s", format, locale)
+			assert.Equal(t, "", Format(-1))
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package bytesutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps (lower-cased) unit suffixes to their multipliers. As with rsync, single-letter units
+// (e.g. "K") are binary, units ending with "B" are decimal and units ending with "iB" are binary.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   KIBI,
+	"kb":  KILO,
+	"kib": KIBI,
+	"m":   MEBI,
+	"mb":  MEGA,
+	"mib": MEBI,
+	"g":   GIBI,
+	"gb":  GIGA,
+	"gib": GIBI,
+	"t":   TEBI,
+	"tb":  TERA,
+	"tib": TEBI,
+}
+
+// ParseSize parses a human-readable size, such as "100K", "1.5MB" or "2GiB", to number of bytes
+//
+// For example,
+//
+//	size, _ := bytesutil.ParseSize("100K")
+//	fmt.Println(size)
+//
+// prints
+//
+//	102400
+func ParseSize(size string) (int64, error) {
+	trimmed := strings.TrimSpace(size)
+	numberEnd := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numberEnd == -1 {
+		numberEnd = len(trimmed)
+	}
+	multiplier, validUnit := sizeUnits[strings.ToLower(strings.TrimSpace(trimmed[numberEnd:]))]
+	if !validUnit {
+		return 0, fmt.Errorf("invalid unit in size \"%s\"", size)
+	}
+	number, err := strconv.ParseFloat(trimmed[:numberEnd], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size \"%s\"", size)
+	}
+	return int64(number * float64(multiplier)), nil
+}
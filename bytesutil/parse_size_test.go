@@ -0,0 +1,31 @@
+package bytesutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"0":      0,
+		"100":    100,
+		"100B":   100,
+		"100K":   102_400,
+		"100k":   102_400,
+		"100KB":  100_000,
+		"100KiB": 102_400,
+		"1M":     1_048_576,
+		"1.5MB":  1_500_000,
+		"2 GiB":  2_147_483_648,
+		"1T":     1_099_511_627_776,
+	}
+	for size, expected := range tests {
+		actual, err := ParseSize(size)
+		assert.NoError(t, err, size)
+		assert.Equal(t, expected, actual, size)
+	}
+	for _, invalid := range []string{"", "K", "100X", "1.2.3M", "-1K"} {
+		_, err := ParseSize(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
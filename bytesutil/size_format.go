@@ -0,0 +1,52 @@
+package bytesutil
+
+import (
+	"fmt"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Formats of byte sizes that Format formats in (see SetFormat)
+const (
+	// FormatBinary is as in BinaryFormat (e.g. "2.09 KiB")
+	FormatBinary = "binary"
+	// FormatDecimal is as in DecimalFormat (e.g. "2.14 KB")
+	FormatDecimal = "decimal"
+	// FormatRaw is a plain count of bytes, without any grouping of digits (e.g. "2140 B")
+	FormatRaw = "raw"
+)
+
+// Formats lists all valid formats of byte sizes
+var Formats = []string{FormatBinary, FormatDecimal, FormatRaw}
+
+var (
+	format  = FormatBinary
+	printer = message.NewPrinter(language.English)
+)
+
+// SetFormat decides how Format formats byte sizes: format is one of Formats, and locale decides decimal separator and
+// grouping of digits (e.g. "2,09 KiB" in German)
+func SetFormat(f string, locale language.Tag) {
+	format, printer = f, message.NewPrinter(locale)
+}
+
+// sprintf formats as per locale set by SetFormat
+func sprintf(text string, a ...any) string {
+	return printer.Sprintf(text, a...)
+}
+
+// Format formats a byte size to a human-readable string, in format and locale set by SetFormat (binary format in
+// English, by default)
+func Format(size int64) string {
+	switch format {
+	case FormatDecimal:
+		return formatSize(sprintf, size, KILO, decimalUnits)
+	case FormatRaw:
+		if size < 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d B", size)
+	default:
+		return formatSize(sprintf, size, KIBI, binaryUnits)
+	}
+}
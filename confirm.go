@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/action"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// terminalPath is path of the controlling terminal, from which answers to questions are read (rather than from
+// standard input, which may be redirected)
+func terminalPath() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}
+
+var (
+	terminalOnce sync.Once
+	// terminal is the controlling terminal once it's opened (nil if there isn't one, e.g. when run by cron)
+	terminal *bufio.Reader
+)
+
+// openTerminal opens the controlling terminal on first use
+func openTerminal() *bufio.Reader {
+	terminalOnce.Do(func() {
+		if file, err := os.Open(terminalPath()); err == nil {
+			terminal = bufio.NewReader(file)
+		}
+	})
+	return terminal
+}
+
+// isInteractive tells whether the user can be asked questions, i.e. whether output is to a terminal and there's a
+// controlling terminal to read answers from (it's a variable, so that tests can pretend they can be)
+var isInteractive = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && openTerminal() != nil
+}
+
+// readAnswer reads a line from the controlling terminal (it's a variable, so that tests can answer questions)
+var readAnswer = func() (string, error) {
+	t := openTerminal()
+	if t == nil {
+		return "", fmt.Errorf("there's no terminal to read answer from")
+	}
+	return t.ReadString('\n')
+}
+
+// ask asks the user a question on standard error, and returns the answer in lower case (empty if there's none)
+func ask(question string) string {
+	fmt.Fprintf(os.Stderr, "%s ", question)
+	answer, err := readAnswer()
+	if err != nil {
+		// Input ended before user pressed enter
+		fmt.Fprintln(os.Stderr)
+	}
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+// askYesNo asks the user a question and tells whether the answer is a yes (anything else, including no answer at all,
+// is a no)
+func askYesNo(question string) bool {
+	answer := ask(question + " [y/N]")
+	return answer == "y" || answer == "yes"
+}
+
+// checkMaxActions ensures that number of sync actions to be performed is within options.maxActions (0 meaning no
+// limit), unless the user says otherwise: through --yes or, in an interactive run, by answering a question
+func checkMaxActions(numActions int, options runOptions) error {
+	if options.maxActions <= 0 || numActions <= options.maxActions || options.assumeYes {
+		return nil
+	}
+	if isInteractive() && askYesNo(fmt.Sprintf("About to perform %d sync actions (more than --%s %d), continue?",
+		numActions, maxActionsFlag, options.maxActions)) {
+		return nil
+	}
+	return fmt.Errorf("aborted, as %d sync actions are more than --%s %d (pass --%s to perform them anyway)",
+		numActions, maxActionsFlag, options.maxActions, assumeYesFlag)
+}
+
+// acceptJournal returns an error unless actions left unperformed in journal (see resumeJournal) for given pair are to
+// be resumed: the pair must be one of those this run is for, and the user must say so
+func acceptJournal(journalPair dirPair, numPending int, pairs []dirPair, options runOptions) error {
+	isExpected := false
+	for _, pair := range pairs {
+		isExpected = isExpected || pair == journalPair
+	}
+	if !isExpected {
+		return fmt.Errorf("journal \"%s\" is for syncing \"%s\" to \"%s\", not what this run is for (remove it, or "+
+			"pass another path to --journal)", options.journalPath, journalPair.source, journalPair.destination)
+	}
+	if options.assumeYes || (isInteractive() && askYesNo(fmt.Sprintf(
+		"Journal \"%s\" has %d actions left unperformed by an earlier run of \"%s\" to \"%s\": resume them?",
+		options.journalPath, numPending, journalPair.source, journalPair.destination))) {
+		return nil
+	}
+	return fmt.Errorf("journal \"%s\" has %d actions left unperformed by an earlier run (pass --%s to resume them, "+
+		"or remove it)", options.journalPath, numPending, assumeYesFlag)
+}
+
+// actionClassNames are what actions of each type are called, when asking the user to confirm them
+var actionClassNames = map[string]string{
+	"MoveFileAction":              "file moves/renames",
+	"MoveDirectoryAction":         "directory moves/renames",
+	"SymlinkMoveAction":           "symbolic link moves/renames",
+	"PropagateTimestampAction":    "timestamp updates",
+	"PropagateDirTimestampAction": "directory timestamp updates",
+	"MakeDirectoryAction":         "directory creations",
+	"RemoveDirectoryAction":       "empty directory removals",
+	"RemoveFileAction":            "duplicate file removals",
+	"CopyFileAction":              "file copies from archive directory",
+	"ChmodAction":                 "permission changes",
+	"ChownAction":                 "owner changes",
+}
+
+// Answers to confirmActions' questions
+const (
+	confirmAll  = "y"
+	confirmNone = "n"
+	confirmEach = "each"
+)
+
+// confirmActions asks the user whether to perform sync actions, one class (i.e. type) of them at a time: actions of a
+// class are either all performed, all left out or confirmed one by one. It returns actions that aren't left out, and
+// a function that confirms each of them while they're performed (see sidekick.Options.Confirm).
+func confirmActions(actions []action.SyncAction, destinationDirPath string,
+) ([]action.SyncAction, func(a action.SyncAction) bool) {
+	counts := make(map[string]int)
+	var typeNames []string
+	for _, a := range actions {
+		typeName := action.TypeName(a)
+		if counts[typeName] == 0 {
+			typeNames = append(typeNames, typeName)
+		}
+		counts[typeName]++
+	}
+	decisions := make(map[string]string, len(typeNames))
+	for _, typeName := range typeNames {
+		className, exists := actionClassNames[typeName]
+		if !exists {
+			className = typeName
+		}
+		for decisions[typeName] == "" {
+			switch ask(fmt.Sprintf("Apply all %d %s? [y/n/each]", counts[typeName], className)) {
+			case "y", "yes":
+				decisions[typeName] = confirmAll
+			case "", "n", "no":
+				decisions[typeName] = confirmNone
+			case "e", "each":
+				decisions[typeName] = confirmEach
+			}
+		}
+	}
+	approved := make([]action.SyncAction, 0, len(actions))
+	for _, a := range actions {
+		if decisions[action.TypeName(a)] != confirmNone {
+			approved = append(approved, a)
+		}
+	}
+	if len(approved) < len(actions) {
+		fmt.Fprintf(os.Stderr, "Leaving out %d sync actions\n", len(actions)-len(approved))
+	}
+	return approved, func(a action.SyncAction) bool {
+		if decisions[action.TypeName(a)] != confirmEach {
+			return true
+		}
+		return askYesNo(strings.Replace(fmt.Sprintf("%s?", a), destinationDirPath+string(filepath.Separator), "", -1))
+	}
+}
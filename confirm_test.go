@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// answerWith makes the run interactive, with given lines as answers to questions asked (for the rest of the test)
+func answerWith(t *testing.T, answers string) {
+	wasInteractive, wasReadAnswer := isInteractive, readAnswer
+	t.Cleanup(func() {
+		isInteractive, readAnswer = wasInteractive, wasReadAnswer
+	})
+	reader := bufio.NewReader(strings.NewReader(answers))
+	isInteractive = func() bool { return true }
+	readAnswer = func() (string, error) { return reader.ReadString('\n') }
+}
+
+func TestConfirmActions(t *testing.T) {
+	actions := []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: "/d/new"},
+		action.MoveFileAction{BasePath: "/d", RelativeFromPath: "a.txt", RelativeToPath: "new/a.txt"},
+		action.MoveFileAction{BasePath: "/d", RelativeFromPath: "b.txt", RelativeToPath: "new/b.txt"},
+		action.PropagateTimestampAction{SourceBaseDirPath: "/s", DestinationBaseDirPath: "/d",
+			SourceFileRelativePath: "c.txt", DestinationFileRelativePath: "c.txt"},
+	}
+	// Directory creations are all approved, file moves one by one (after an answer that isn't understood) and
+	// timestamp updates are left out; of file moves, only the second is approved:
+	answerWith(t, "y\nwhat\neach\n\nn\ny\n")
+	approved, confirm := confirmActions(actions, "/d")
+	assert.Equal(t, actions[:3], approved)
+	assert.True(t, confirm(actions[0]))
+	assert.False(t, confirm(actions[1]))
+	assert.True(t, confirm(actions[2]))
+	// No answers leave out everything:
+	answerWith(t, "")
+	approved, _ = confirmActions(actions, "/d")
+	assert.Empty(t, approved)
+}
+
+func TestAcceptJournal(t *testing.T) {
+	pair := dirPair{source: "/s", destination: "/d"}
+	options := runOptions{journalPath: "/j"}
+	// Journal of another pair is never resumed:
+	answerWith(t, "y\n")
+	assert.Error(t, acceptJournal(dirPair{source: "/s", destination: "/e"}, 2, []dirPair{pair}, options))
+	// ...while one of this pair is, if the user says so:
+	answerWith(t, "y\n")
+	assert.NoError(t, acceptJournal(pair, 2, []dirPair{pair}, options))
+	answerWith(t, "n\n")
+	assert.Error(t, acceptJournal(pair, 2, []dirPair{pair}, options))
+	options.assumeYes = true
+	assert.NoError(t, acceptJournal(pair, 2, []dirPair{pair}, options))
+}
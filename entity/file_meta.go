@@ -2,15 +2,68 @@ package entity
 
 import (
 	"fmt"
+	"io/fs"
 	"time"
 )
 
+// Inode identifies a file on its filesystem (by device and inode number): hard links to a file have the same Inode
+type Inode struct {
+	Device uint64
+	Number uint64
+}
+
+// IsKnown tells whether the Inode was found at all (it isn't, on platforms such as Windows)
+func (i Inode) IsKnown() bool {
+	return i != Inode{}
+}
+
 // FileMeta is a combination of file size and its modification timestamp
 type FileMeta struct {
-	Size              int64
+	Size int64
+	// ModifiedTimestamp is modification timestamp in seconds since the Unix epoch (see ModTime for the full one)
 	ModifiedTimestamp int64
+	// ModifiedNanoseconds is the sub-second part of modification timestamp, in nanoseconds (see WithoutNanoseconds)
+	ModifiedNanoseconds int64
+	// Inode identifies the file, so that hard links to it can be recognized (zero if not known)
+	Inode Inode
+	// Permissions are permission bits of the file's mode
+	Permissions fs.FileMode
+	// UID and GID are IDs of user and group owning the file (-1 if not known, as on Windows)
+	UID, GID int
+}
+
+// IsHardLinkOf tells whether both files are hard links to the same file
+func (f FileMeta) IsHardLinkOf(other FileMeta) bool {
+	return f.Inode.IsKnown() && f.Inode == other.Inode
+}
+
+// ModTime is modification timestamp of the file
+func (f FileMeta) ModTime() time.Time {
+	return time.Unix(f.ModifiedTimestamp, f.ModifiedNanoseconds)
+}
+
+// IsModifiedAtSameTime tells whether modification timestamps of files are same
+func (f FileMeta) IsModifiedAtSameTime(other FileMeta) bool {
+	return f.ModifiedTimestamp == other.ModifiedTimestamp && f.ModifiedNanoseconds == other.ModifiedNanoseconds
+}
+
+// IsModifiedWithin tells whether modification timestamps of files differ by no more than given window (like rsync's
+// --modify-window, a zero window meaning they're same)
+func (f FileMeta) IsModifiedWithin(other FileMeta, window time.Duration) bool {
+	if window <= 0 {
+		return f.IsModifiedAtSameTime(other)
+	}
+	difference := f.ModTime().Sub(other.ModTime())
+	return -window <= difference && difference <= window
+}
+
+// WithoutNanoseconds truncates modification timestamp to seconds (which is how most tools, including rsync by
+// default, compare timestamps)
+func (f FileMeta) WithoutNanoseconds() FileMeta {
+	f.ModifiedNanoseconds = 0
+	return f
 }
 
 func (f FileMeta) String() string {
-	return fmt.Sprintf("{size: %d, modified: %v}", f.Size, time.Unix(f.ModifiedTimestamp, 0))
+	return fmt.Sprintf("{size: %d, modified: %v}", f.Size, f.ModTime())
 }
@@ -1,12 +1,16 @@
 package fmte
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 var p *message.Printer
@@ -15,7 +19,54 @@ var mx sync.Mutex // Shared mutex across stdout and stderr to ensure ordering ac
 
 var normalPrint = true
 
-var verbosePrint = false
+var out io.Writer = os.Stdout
+
+var errOut io.Writer = os.Stderr
+
+// Level is severity of a message printed by functions within fmte package
+type Level int
+
+// Levels of messages, from most severe to least
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+// LevelSilent is a level that no message is of, so nothing is printed at that level
+const LevelSilent Level = -1
+
+// LevelNames are names of levels, from LevelSilent to least severe
+var LevelNames = []string{"silent", "error", "warn", "info", "debug"}
+
+func (l Level) String() string {
+	return LevelNames[l-LevelSilent]
+}
+
+// ParseLevel converts name of a level (one of LevelNames) to a Level
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range LevelNames {
+		if levelName == name {
+			return LevelSilent + Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level \"%s\"", name)
+}
+
+var level = LevelInfo
+
+var jsonFormat = false
+
+// pendingKey is where, and at which level, text is printed
+type pendingKey struct {
+	w io.Writer
+	l Level
+}
+
+// pendingLines are texts printed (in JSON format) that aren't terminated by a new line yet, by where and at which level
+// they're printed (see Flush)
+var pendingLines = make(map[pendingKey]*strings.Builder)
 
 func init() {
 	p = message.NewPrinter(language.English)
@@ -26,9 +77,112 @@ func Off() {
 	normalPrint = false
 }
 
-// VerboseOn turns on verbose print functions within fmte package
+// ToStdErr makes normal and verbose print functions within fmte package print to StdErr (keeping StdOut free for
+// machine-readable output)
+func ToStdErr() {
+	out = os.Stderr
+}
+
+// Out returns where normal and verbose print functions within fmte package print to
+func Out() io.Writer {
+	return out
+}
+
+// IsTerminal tells whether normal print functions within fmte package print text to a terminal (and not to a file
+// or a pipe)
+func IsTerminal() bool {
+	f, isFile := out.(*os.File)
+	if !isFile || !normalPrint || jsonFormat || level < LevelInfo {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetLocale makes print functions within fmte package format numbers as per given locale (e.g. grouping digits of
+// 1234567 as "1.234.567" in German), rather than English
+func SetLocale(locale language.Tag) {
+	p = message.NewPrinter(locale)
+}
+
+// SetLevel makes print functions within fmte package print only messages of given level or more severe ones
+func SetLevel(l Level) {
+	level = l
+}
+
+// VerboseOn turns on verbose print functions within fmte package (i.e. sets level to LevelDebug)
 func VerboseOn() {
-	verbosePrint = true
+	level = LevelDebug
+}
+
+// JSONOn makes print functions within fmte package print every line as a JSON object, with its timestamp and level
+func JSONOn() {
+	jsonFormat = true
+}
+
+// IsJSON tells whether print functions within fmte package print every line as a JSON object (see JSONOn)
+func IsJSON() bool {
+	return jsonFormat
+}
+
+// logLine is a line printed in JSON format
+type logLine struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+func fprint(w io.Writer, l Level, text string) {
+	if !jsonFormat {
+		_, _ = io.WriteString(w, text)
+		return
+	}
+	key := pendingKey{w: w, l: l}
+	pendingLine, exists := pendingLines[key]
+	if !exists {
+		pendingLine = &strings.Builder{}
+		pendingLines[key] = pendingLine
+	}
+	pendingLine.WriteString(text)
+	lines := strings.Split(pendingLine.String(), "\n")
+	pendingLine.Reset()
+	pendingLine.WriteString(lines[len(lines)-1])
+	for _, line := range lines[:len(lines)-1] {
+		writeLogLine(w, l, line)
+	}
+}
+
+// writeLogLine writes a line in JSON format (unless it's empty)
+func writeLogLine(w io.Writer, l Level, line string) {
+	if line == "" {
+		return
+	}
+	lineJSON, _ := json.Marshal(logLine{
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Level:   l.String(),
+		Message: line,
+	})
+	_, _ = w.Write(append(lineJSON, '\n'))
+}
+
+// Flush prints text that's printed (in JSON format) but isn't terminated by a new line yet, as lines of their own: it
+// should be called before exiting
+func Flush() {
+	mx.Lock()
+	defer mx.Unlock()
+	for key, pendingLine := range pendingLines {
+		writeLogLine(key.w, key.l, pendingLine.String())
+		delete(pendingLines, key)
+	}
+}
+
+func printAt(w io.Writer, l Level, text func() string) {
+	if l > level {
+		return
+	}
+	mx.Lock()
+	fprint(w, l, text())
+	mx.Unlock()
 }
 
 // Printf is goroutine-safe fmt.Printf for English
@@ -36,45 +190,85 @@ func Printf(format string, a ...any) {
 	if !normalPrint {
 		return
 	}
-	mx.Lock()
-	_, _ = p.Printf(format, a...)
-	mx.Unlock()
+	printAt(out, LevelInfo, func() string {
+		return p.Sprintf(format, a...)
+	})
 }
 
 // PrintfV is goroutine-safe fmt.Printf for English (Verbose mode)
 func PrintfV(format string, a ...any) {
-	if normalPrint && verbosePrint {
-		mx.Lock()
-		_, _ = p.Printf(format, a...)
-		mx.Unlock()
+	if !normalPrint {
+		return
 	}
+	printAt(out, LevelDebug, func() string {
+		return p.Sprintf(format, a...)
+	})
 }
 
 func Println(a ...any) {
 	if !normalPrint {
 		return
 	}
-	mx.Lock()
-	_, _ = p.Println(a...)
-	mx.Unlock()
+	printAt(out, LevelInfo, func() string {
+		return p.Sprintln(a...)
+	})
+}
+
+// Warnf is goroutine-safe fmt.Printf to StdErr for English, for problems that don't stop this tool
+func Warnf(format string, a ...any) {
+	printAt(errOut, LevelWarn, func() string {
+		return p.Sprintf(format, a...)
+	})
 }
 
 // PrintfErr is goroutine-safe fmt.Printf to StdErr for English
 func PrintfErr(format string, a ...any) {
-	mx.Lock()
-	_, _ = p.Fprintf(os.Stderr, format, a...)
-	mx.Unlock()
+	printAt(errOut, LevelError, func() string {
+		return p.Sprintf(format, a...)
+	})
 }
 
-// Errors combines multiple errors into one
+// Errors combines multiple errors into one (errors.Is and errors.As look into each of them)
 func Errors(message string, errs []error) error {
+	return multiError{message: message, errs: errs}
+}
+
+// multiError is an error made of multiple errors (see Errors)
+type multiError struct {
+	message string
+	errs    []error
+}
+
+func (e multiError) Error() string {
 	var sb strings.Builder
-	sb.WriteString(message)
+	sb.WriteString(e.message)
 	sb.WriteString(": ")
-	for _, err := range errs {
+	for _, err := range e.errs {
 		sb.WriteString(err.Error())
 		sb.WriteString(", ")
 	}
-	combinedError := fmt.Errorf(sb.String())
-	return combinedError
+	return sb.String()
+}
+
+// Unwrap returns the errors combined (for errors.Is and errors.As of Go 1.20 onwards)
+func (e multiError) Unwrap() []error {
+	return e.errs
+}
+
+func (e multiError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e multiError) As(target any) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
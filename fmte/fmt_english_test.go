@@ -0,0 +1,139 @@
+package fmte
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capture redirects output of print functions to buffers while f runs, at given level and format
+func capture(l Level, isJSON bool, f func()) (string, string) {
+	var outBuf, errBuf bytes.Buffer
+	savedOut, savedErrOut, savedLevel, savedJSONFormat := out, errOut, level, jsonFormat
+	out, errOut, level, jsonFormat = &outBuf, &errBuf, l, isJSON
+	defer func() {
+		out, errOut, level, jsonFormat = savedOut, savedErrOut, savedLevel, savedJSONFormat
+	}()
+	f()
+	return outBuf.String(), errBuf.String()
+}
+
+func printAtAllLevels() {
+	PrintfErr("failed %d\n", 1)
+	Warnf("skipping %s\n", "a")
+	Printf("found %d files\n", 1234)
+	PrintfV("evaluating %s\n", "b")
+}
+
+func TestLevels(t *testing.T) {
+	stdout, stderr := capture(LevelInfo, false, printAtAllLevels)
+	assert.Equal(t, "found 1,234 files\n", stdout)
+	assert.Equal(t, "failed 1\nskipping a\n", stderr)
+	stdout, stderr = capture(LevelDebug, false, printAtAllLevels)
+	assert.Equal(t, "found 1,234 files\nevaluating b\n", stdout)
+	assert.Equal(t, "failed 1\nskipping a\n", stderr)
+	stdout, stderr = capture(LevelError, false, printAtAllLevels)
+	assert.Equal(t, "", stdout)
+	assert.Equal(t, "failed 1\n", stderr)
+	stdout, stderr = capture(LevelSilent, false, printAtAllLevels)
+	assert.Equal(t, "", stdout)
+	assert.Equal(t, "", stderr)
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range LevelNames {
+		l, err := ParseLevel(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, l.String())
+	}
+	_, err := ParseLevel("trace")
+	assert.Error(t, err)
+	// Levels other than LevelSilent keep their values:
+	assert.Equal(t, Level(0), LevelError)
+	assert.Equal(t, Level(3), LevelDebug)
+}
+
+func TestJSONFormat(t *testing.T) {
+	stdout, stderr := capture(LevelInfo, true, func() {
+		Printf("Applying \"%s\"... ", "x")
+		Printf("done\nFound %d actions\n", 2)
+		Warnf("skipping\n")
+	})
+	var lines []logLine
+	for _, rawLine := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		var line logLine
+		assert.NoError(t, json.Unmarshal([]byte(rawLine), &line))
+		assert.NotEmpty(t, line.Time)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{"Applying \"x\"... done", "Found 2 actions"},
+		[]string{lines[0].Message, lines[1].Message})
+	assert.Equal(t, "info", lines[0].Level)
+	var warnLine logLine
+	assert.NoError(t, json.Unmarshal([]byte(stderr), &warnLine))
+	assert.Equal(t, logLine{Time: warnLine.Time, Level: "warn", Message: "skipping"}, warnLine)
+	// Lines aren't mixed up across streams and levels, and unterminated ones are printed on flushing:
+	stdout, stderr = capture(LevelDebug, true, func() {
+		Printf("Applying \"%s\"... ", "x")
+		Warnf("skipping\n")
+		PrintfV("(after %d retries) ", 2)
+		Printf("done\n")
+		PrintfV("unterminated")
+		Flush()
+	})
+	assert.Equal(t, []string{"info: Applying \"x\"... done", "debug: (after 2 retries) unterminated"},
+		logMessages(t, stdout))
+	assert.Equal(t, []string{"warn: skipping"}, logMessages(t, stderr))
+}
+
+// logMessages parses lines printed in JSON format, as "level: message"
+func logMessages(t *testing.T, output string) []string {
+	var messages []string
+	for _, rawLine := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		var line logLine
+		assert.NoError(t, json.Unmarshal([]byte(rawLine), &line))
+		messages = append(messages, line.Level+": "+line.Message)
+	}
+	return messages
+}
+
+func TestSetLocale(t *testing.T) {
+	defer SetLocale(language.English)
+	SetLocale(language.German)
+	stdout, _ := capture(LevelInfo, false, func() {
+		Printf("found %d files\n", 1234567)
+	})
+	assert.Equal(t, "found 1.234.567 files\n", stdout)
+	SetLocale(language.MustParse("fr"))
+	stdout, _ = capture(LevelInfo, false, func() {
+		Printf("found %d files\n", 1234567)
+	})
+	assert.Equal(t, "found 1 234 567 files\n", stdout)
+}
+
+type codeError struct {
+	code int
+}
+
+func (e codeError) Error() string {
+	return fmt.Sprintf("failed with code %d", e.code)
+}
+
+func TestErrors(t *testing.T) {
+	err := Errors("2 out of 3 failed", []error{
+		fmt.Errorf("first: %w", os.ErrNotExist),
+		fmt.Errorf("second: %w", codeError{code: 23}),
+	})
+	assert.Equal(t, "2 out of 3 failed: first: file does not exist, second: failed with code 23, ", err.Error())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NotErrorIs(t, err, os.ErrExist)
+	var cErr codeError
+	assert.True(t, errors.As(err, &cErr))
+	assert.Equal(t, 23, cErr.code)
+}
@@ -3,6 +3,7 @@ module github.com/m-manu/rsync-sidekick
 go 1.19
 
 require (
+	github.com/cespare/xxhash/v2 v2.2.0
 	github.com/deckarep/golang-set/v2 v2.3.0
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.8.2
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleInterrupts makes the first interrupt (Ctrl-C) or termination signal stop the run cleanly: scanning/indexing
+// of files stops and the sync action in progress is finished, but no more are performed. A second one exits right
+// away.
+func handleInterrupts(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmte.PrintfErr("Interrupted: stopping after the action in progress (press Ctrl-C again to exit right away)\n")
+		cancel()
+		<-signals
+		fmte.PrintfErr("Interrupted again: exiting right away\n")
+		exit(exitCodeInterrupted)
+	}()
+}
+
+// exitIfStopped exits if the run was stopped midway, whether by an interrupt or on timing out (see --timeout)
+func exitIfStopped(ctx context.Context, timeout time.Duration) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmte.PrintfErr("error: run timed out after %s\n", timeout)
+		exit(exitCodeTimedOut)
+	} else if ctx.Err() != nil {
+		fmte.PrintfErr("error: run was interrupted\n")
+		exit(exitCodeInterrupted)
+	}
+}
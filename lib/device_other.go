@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+
+package lib
+
+import (
+	"os"
+)
+
+// DeviceOf gets ID of the device (i.e. filesystem) a file is on from its metadata, if available (it isn't, on this
+// platform)
+func DeviceOf(os.FileInfo) (device uint64, isKnown bool) {
+	return 0, false
+}
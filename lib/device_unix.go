@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package lib
+
+import (
+	"os"
+	"syscall"
+)
+
+// DeviceOf gets ID of the device (i.e. filesystem) a file is on from its metadata, if available
+func DeviceOf(fileInfo os.FileInfo) (device uint64, isKnown bool) {
+	stat, isStat := fileInfo.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
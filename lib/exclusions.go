@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// globMetaChars are characters that make an exclusion a glob pattern. Unlike in filepath.Match, "\" isn't one (it's
+// a path separator on Windows, rather than an escape character).
+const globMetaChars = `*?[`
+
+// ExclusionMatcher matches names of files/directories against exclusions, each of which is either an exact name
+// or a glob pattern such as "*.tmp" (with "*", "?" and character classes such as "[0-9]" or "[!a-z]")
+type ExclusionMatcher struct {
+	names    set.Set[string]
+	patterns []*regexp.Regexp
+}
+
+// NewExclusionMatcher creates an ExclusionMatcher, separating glob patterns from exact names up front (so that
+// exact names can be matched with a set lookup) and compiling the patterns to regular expressions
+func NewExclusionMatcher(exclusions set.Set[string]) (ExclusionMatcher, error) {
+	m := ExclusionMatcher{
+		names:    set.NewThreadUnsafeSetWithSize[string](exclusions.Cardinality()),
+		patterns: []*regexp.Regexp{},
+	}
+	for _, exclusion := range exclusions.ToSlice() {
+		normalized := filepath.ToSlash(exclusion)
+		if !strings.ContainsAny(normalized, globMetaChars) {
+			m.names.Add(normalized)
+			continue
+		}
+		regexStr, err := exclusionGlobToRegex(normalized)
+		if err == nil {
+			var regex *regexp.Regexp
+			regex, err = regexp.Compile("^" + regexStr + "$")
+			m.patterns = append(m.patterns, regex)
+		}
+		if err != nil {
+			return ExclusionMatcher{}, fmt.Errorf("invalid pattern \"%s\": %+v", exclusion, err)
+		}
+	}
+	return m, nil
+}
+
+// Matches checks whether given name of a file/directory is excluded
+func (m ExclusionMatcher) Matches(name string) bool {
+	name = filepath.ToSlash(name)
+	if m.names.Contains(name) {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusionGlobToRegex converts a glob pattern (with "/" as separator) to a regular expression, in which every
+// character other than "*", "?" and character classes is matched literally
+func exclusionGlobToRegex(pattern string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("character class isn't closed")
+			}
+			class := pattern[i+1 : i+1+end]
+			sb.WriteString("[")
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				sb.WriteString("^")
+				class = class[1:]
+			}
+			if class == "" {
+				return "", fmt.Errorf("character class is empty")
+			}
+			for j := 0; j < len(class); j++ {
+				if class[j] == '-' {
+					sb.WriteString("-")
+				} else {
+					sb.WriteString(regexp.QuoteMeta(class[j : j+1]))
+				}
+			}
+			sb.WriteString("]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	return sb.String(), nil
+}
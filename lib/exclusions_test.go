@@ -0,0 +1,36 @@
+package lib
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExclusionMatcher(t *testing.T) {
+	m, err := NewExclusionMatcher(set.NewSet[string]("*.log", "report-??.csv", "Thumbs.db", "~$*", "[!.]*.orig",
+		`backups\*.tmp`))
+	assert.NoError(t, err)
+	for name, expected := range map[string]bool{
+		"app.log":           true,
+		".log":              true,
+		"app.log.1":         false,
+		"report-01.csv":     true,
+		"report-1.csv":      false,
+		"report-001.csv":    false,
+		"Thumbs.db":         true,
+		"Thumbs.db.bak":     false,
+		"thumbs.db":         false,
+		"~$document.docx":   true,
+		"some_document.txt": false,
+		"notes.orig":        true,
+		".notes.orig":       false,
+		`backups\a.tmp`:     true,
+		"backupsa.tmp":      false,
+	} {
+		assert.Equal(t, expected, m.Matches(name), name)
+	}
+	for _, pattern := range []string{"[unclosed", "[]", "[z-a]"} {
+		_, err = NewExclusionMatcher(set.NewSet[string](pattern))
+		assert.Error(t, err, pattern)
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single line of a gitignore-style file, compiled to a regular expression over relative paths
+type ignoreRule struct {
+	pattern  string
+	regex    *regexp.Regexp
+	negated  bool
+	dirsOnly bool
+}
+
+// IgnoreMatcher matches relative paths of files/directories against rules in gitignore syntax:
+//   - blank lines and lines starting with "#" are ignored
+//   - a rule starting with "!" re-includes paths excluded by earlier rules (the last matching rule wins)
+//   - a rule ending with "/" matches directories only
+//   - a rule with a "/" at the beginning or in the middle is anchored (matched against the whole relative path),
+//     otherwise it's matched against the name at any level
+//   - "*" and "?" don't match "/", whereas "**" matches any number of directories (e.g. "a/**/b", "**/b" or "a/**")
+//
+// As in git, a path can't be re-included if a directory containing it is excluded (since the directory isn't read).
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// NewIgnoreMatcher creates an IgnoreMatcher from lines of a gitignore-style file
+func NewIgnoreMatcher(lines []string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{rules: []ignoreRule{}}
+	for _, line := range lines {
+		line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{pattern: line}
+		pattern := line
+		if strings.HasPrefix(pattern, "!") {
+			rule.negated = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirsOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		regexStr := "^" + globToRegex(pattern) + "$"
+		if !anchored {
+			regexStr = "^(?:.*/)?" + globToRegex(pattern) + "$"
+		}
+		regex, err := regexp.Compile(regexStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern \"%s\": %+v", line, err)
+		}
+		rule.regex = regex
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+// Matches checks whether file/directory at given relative path (with "/" as separator) is ignored. A nil
+// IgnoreMatcher matches nothing.
+func (m *IgnoreMatcher) Matches(relativePath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirsOnly && !isDir {
+			continue
+		}
+		if rule.negated == ignored && rule.regex.MatchString(relativePath) {
+			ignored = !rule.negated
+		}
+	}
+	return ignored
+}
+
+// globToRegex converts a gitignore glob (without leading/trailing "/") to a regular expression
+func globToRegex(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	var sb strings.Builder
+	needsSeparator := false
+	for i, segment := range segments {
+		if segment == "**" {
+			if i == 0 {
+				sb.WriteString("(?:.*/)?")
+			} else if i == len(segments)-1 {
+				sb.WriteString("/.*")
+			} else {
+				sb.WriteString("/(?:.*/)?")
+			}
+			needsSeparator = false
+			continue
+		}
+		if needsSeparator {
+			sb.WriteString("/")
+		}
+		sb.WriteString(segmentToRegex(segment))
+		needsSeparator = true
+	}
+	return sb.String()
+}
+
+// segmentToRegex converts a glob for a single path segment to a regular expression
+func segmentToRegex(segment string) string {
+	var sb strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch c {
+		case '\\':
+			if i+1 < len(segment) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(segment[i : i+1]))
+		case '*':
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(segment[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := segment[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(segment[i : i+1]))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := NewIgnoreMatcher([]string{
+		"# comment",
+		"",
+		"*.log",
+		"!important.log",
+		"/build",
+		"cache/",
+		"docs/*.pdf",
+		"**/tmp/**",
+		"a/**/z",
+		`\!bang`,
+		"[!abc]x.txt",
+	})
+	assert.NoError(t, err)
+	type path struct {
+		relativePath string
+		isDir        bool
+	}
+	for p, expected := range map[path]bool{
+		// Floating patterns match at any level:
+		{"app.log", false}:      true,
+		{"logs/app.log", false}: true,
+		{"app.log.1", false}:    false,
+		{"# comment", false}:    false,
+		// Negation overrides an earlier match:
+		{"important.log", false}:      false,
+		{"logs/important.log", false}: false,
+		// Anchored patterns match at top-level only:
+		{"build", true}:         true,
+		{"build", false}:        true,
+		{"src/build", true}:     false,
+		{"src/build.log", true}: true,
+		// Directory-only patterns:
+		{"cache", true}:      true,
+		{"src/cache", true}:  true,
+		{"cache", false}:     false,
+		{"src/cache", false}: false,
+		// Pattern with a "/" in the middle is anchored, and "*" doesn't match "/":
+		{"docs/manual.pdf", false}:     true,
+		{"docs/en/manual.pdf", false}:  false,
+		{"src/docs/manual.pdf", false}: false,
+		// "**" matches any number of directories:
+		{"tmp/file", false}:       true,
+		{"src/tmp/file", false}:   true,
+		{"src/tmp/a/file", false}: true,
+		{"tmp", true}:             false,
+		{"a/z", false}:            true,
+		{"a/b/c/z", false}:        true,
+		{"b/a/z", false}:          false,
+		// Escaped "!" and negated character classes:
+		{"!bang", false}:  true,
+		{"bang", false}:   false,
+		{"dx.txt", false}: true,
+		{"ax.txt", false}: false,
+	} {
+		assert.Equal(t, expected, m.Matches(p.relativePath, p.isDir), "%+v", p)
+	}
+}
+
+func TestIgnoreMatcherNegationOrder(t *testing.T) {
+	// Last matching rule wins, so a negation before a match has no effect:
+	m, err := NewIgnoreMatcher([]string{"!keep.txt", "*.txt"})
+	assert.NoError(t, err)
+	assert.True(t, m.Matches("keep.txt", false))
+	m, err = NewIgnoreMatcher([]string{"*.txt", "!keep.txt", "/keep.txt"})
+	assert.NoError(t, err)
+	assert.True(t, m.Matches("keep.txt", false))
+	assert.False(t, m.Matches("sub/keep.txt", false))
+	var nilMatcher *IgnoreMatcher
+	assert.False(t, nilMatcher.Matches("anything", false))
+}
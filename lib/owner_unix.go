@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package lib
+
+import (
+	"os"
+	"syscall"
+)
+
+// OwnerOf gets IDs of user and group owning a file from its metadata, if available (-1 each, if not)
+func OwnerOf(fileInfo os.FileInfo) (uid int, gid int) {
+	stat, isStat := fileInfo.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return -1, -1
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
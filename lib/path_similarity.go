@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathSimilarity scores how similar two relative file paths are, higher being more similar. Matching file names
+// weigh the most, followed by number of matching trailing directories and then number of matching leading
+// directories. (e.g. "2021/trip/a.jpg" is more similar to "2022/trip/a.jpg" than to "2021/trip/b.jpg")
+func PathSimilarity(path1, path2 string) int {
+	parts1 := strings.Split(filepath.ToSlash(path1), "/")
+	parts2 := strings.Split(filepath.ToSlash(path2), "/")
+	score := 0
+	if parts1[len(parts1)-1] == parts2[len(parts2)-1] {
+		score += 1_000_000
+	}
+	commonSuffix := 0
+	for i, j := len(parts1)-2, len(parts2)-2; i >= 0 && j >= 0 && parts1[i] == parts2[j]; i, j = i-1, j-1 {
+		commonSuffix++
+	}
+	commonPrefix := 0
+	for i := 0; i < len(parts1)-1 && i < len(parts2)-1 && parts1[i] == parts2[i]; i++ {
+		commonPrefix++
+	}
+	return score + 1_000*commonSuffix + commonPrefix
+}
+
+// EditDistance is the Levenshtein distance between two strings: the least number of characters to be inserted,
+// deleted or substituted to turn one into the other
+func EditDistance(s1, s2 string) int {
+	r1, r2 := []rune(s1), []rune(s2)
+	previous, current := make([]int, len(r2)+1), make([]int, len(r2)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		current[0] = i
+		for j := 1; j <= len(r2); j++ {
+			substitution := previous[j-1]
+			if r1[i-1] != r2[j-1] {
+				substitution++
+			}
+			current[j] = substitution
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(r2)]
+}
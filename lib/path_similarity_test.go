@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPathSimilarity(t *testing.T) {
+	assert.Greater(t, PathSimilarity("2021/trip/a.jpg", "2022/trip/a.jpg"),
+		PathSimilarity("2021/trip/a.jpg", "2021/trip/b.jpg"))
+	assert.Greater(t, PathSimilarity("2021/trip/a.jpg", "2021/trip/b.jpg"),
+		PathSimilarity("2021/trip/a.jpg", "2021/misc/b.jpg"))
+	assert.Equal(t, 0, PathSimilarity("a.jpg", "b.jpg"))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, EditDistance("", ""))
+	assert.Equal(t, 3, EditDistance("", "abc"))
+	assert.Equal(t, 3, EditDistance("kitten", "sitting"))
+	assert.Equal(t, 1, EditDistance("IMG_001.jpg", "IMG_0001.jpg"))
+	assert.Equal(t, 1, EditDistance("café", "cafe"))
+}
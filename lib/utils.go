@@ -1,7 +1,10 @@
 package lib
 
 import (
+	"bytes"
+	"fmt"
 	set "github.com/deckarep/golang-set/v2"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -38,17 +41,136 @@ func WriteSliceToFile(slice []string, fileName string) {
 	_ = os.WriteFile(fileName, []byte(sliceAsString), fs.ModePerm)
 }
 
-// LineSeparatedStrToMap converts a line-separated string to a Set of values
+// LineSeparatedStrToMap converts a line-separated string to a Set of values (with spaces around them trimmed), along
+// with first few of them as examples. Blank lines and lines beginning with '#' (comments) are ignored, so a value that
+// begins with '#' is to be written as `\#` instead.
 func LineSeparatedStrToMap(lineSeparatedString string) (entries set.Set[string], firstFew []string) {
 	entries = set.NewThreadUnsafeSetWithSize[string](20)
 	firstFew = []string{}
-	for _, e := range strings.Split(lineSeparatedString, "\n") {
-		entries.Add(strings.TrimSpace(e))
-		firstFew = append(firstFew, e)
+	for _, line := range strings.Split(lineSeparatedString, "\n") {
+		e := strings.TrimSpace(line)
+		if e == "" || strings.HasPrefix(e, "#") {
+			continue
+		}
+		if strings.HasPrefix(e, `\#`) {
+			e = e[1:]
+		}
+		entries.Add(e)
+		if len(firstFew) < 3 {
+			firstFew = append(firstFew, e)
+		}
 	}
-	if len(firstFew) > 3 {
-		firstFew = firstFew[0:3]
+	return
+}
+
+// NulSeparatedStrToMap converts a NUL-separated string (e.g. as output by 'find -print0') to a Set of values. Unlike in
+// LineSeparatedStrToMap, values aren't trimmed, since names of files can begin or end with spaces (or have newlines).
+func NulSeparatedStrToMap(nulSeparatedString string) set.Set[string] {
+	entries := set.NewThreadUnsafeSetWithSize[string](20)
+	for _, e := range strings.Split(nulSeparatedString, "\x00") {
+		entries.Add(e)
 	}
 	entries.Remove("")
-	return
+	return entries
+}
+
+// IsInsideDirectory checks whether path is strictly inside given directory (both paths must be absolute and clean)
+func IsInsideDirectory(dirPath string, path string) bool {
+	relativePath, err := filepath.Rel(dirPath, path)
+	if err != nil {
+		return false
+	}
+	return relativePath != "." && relativePath != ".." &&
+		!strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) && !filepath.IsAbs(relativePath)
+}
+
+// compareBufferSize is how much of each file SameContent reads at a time
+const compareBufferSize = 64 * 1024
+
+// SameContent checks whether two files have exactly the same content, byte by byte
+func SameContent(path1, path2 string) (bool, error) {
+	file1, err1 := os.Open(path1)
+	if err1 != nil {
+		return false, err1
+	}
+	defer file1.Close()
+	file2, err2 := os.Open(path2)
+	if err2 != nil {
+		return false, err2
+	}
+	defer file2.Close()
+	buffer1, buffer2 := make([]byte, compareBufferSize), make([]byte, compareBufferSize)
+	for {
+		n1, rErr1 := io.ReadFull(file1, buffer1)
+		n2, rErr2 := io.ReadFull(file2, buffer2)
+		if n1 != n2 || !bytes.Equal(buffer1[:n1], buffer2[:n2]) {
+			return false, nil
+		}
+		eof1 := rErr1 == io.EOF || rErr1 == io.ErrUnexpectedEOF
+		eof2 := rErr2 == io.EOF || rErr2 == io.ErrUnexpectedEOF
+		if rErr1 != nil && !eof1 {
+			return false, rErr1
+		}
+		if rErr2 != nil && !eof2 {
+			return false, rErr2
+		}
+		if eof1 || eof2 {
+			return eof1 && eof2, nil
+		}
+	}
+}
+
+// SplitArgs splits a command line into arguments, the way a POSIX shell does (without expanding anything): arguments
+// are separated by whitespace, which is kept within single or double quotes, and a backslash escapes the next
+// character (except within single quotes, and within double quotes unless it's one of: $ ` " \ or newline)
+func SplitArgs(commandLine string) ([]string, error) {
+	args := make([]string, 0)
+	var arg strings.Builder
+	isInArg, quote := false, rune(0)
+	runes := []rune(commandLine)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\' && (quote == 0 || (i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]))):
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("command line ends with a backslash")
+			}
+			i++
+			if runes[i] != '\n' {
+				// A backslash before a newline only continues the line
+				arg.WriteRune(runes[i])
+				isInArg = true
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, isInArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if isInArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				isInArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			isInArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("command line has an unterminated %c quote", quote)
+	}
+	if isInArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
 }
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeparatedStrToMap(t *testing.T) {
+	entries, firstFew := LineSeparatedStrToMap("a.txt\n *.tmp \n\nThumbs.db\n")
+	assert.Equal(t, set.NewThreadUnsafeSet[string]("a.txt", "*.tmp", "Thumbs.db"), entries)
+	assert.Equal(t, []string{"a.txt", "*.tmp", "Thumbs.db"}, firstFew)
+	// Comments and blank lines are ignored, and a name beginning with '#' is escaped:
+	entries, firstFew = LineSeparatedStrToMap("# Temporary files\n*.tmp\n\n  # Windows\nThumbs.db # not a comment\n" +
+		"\\#notes.txt\n\t\n")
+	assert.Equal(t, set.NewThreadUnsafeSet[string]("*.tmp", "Thumbs.db # not a comment", "#notes.txt"), entries)
+	assert.Equal(t, []string{"*.tmp", "Thumbs.db # not a comment", "#notes.txt"}, firstFew)
+	assert.Equal(t, set.NewThreadUnsafeSet[string]("a\nb.txt", " *.tmp "),
+		NulSeparatedStrToMap("a\nb.txt\x00 *.tmp \x00\x00"))
+}
+
+func TestSameContent(t *testing.T) {
+	dir := t.TempDir()
+	large := string(make([]byte, 200*1024))
+	for name, content := range map[string]string{
+		"a": "some content", "b": "some content", "c": "some contenT", "d": "some content and more",
+		"large1": large, "large2": large, "large3": large[1:] + "x",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	for pair, expected := range map[[2]string]bool{
+		{"a", "b"}: true, {"a", "c"}: false, {"a", "d"}: false, {"d", "a"}: false,
+		{"large1", "large2"}: true, {"large1", "large3"}: false,
+	} {
+		same, err := SameContent(filepath.Join(dir, pair[0]), filepath.Join(dir, pair[1]))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, same, "%s vs %s", pair[0], pair[1])
+	}
+	_, err := SameContent(filepath.Join(dir, "a"), filepath.Join(dir, "non_existent"))
+	assert.Error(t, err)
+}
+
+func TestSplitArgs(t *testing.T) {
+	for commandLine, expected := range map[string][]string{
+		"":                                   {},
+		"  --delete   -v\t":                  {"--delete", "-v"},
+		`--exclude='*.tmp' --log-file="a b"`: {"--exclude=*.tmp", "--log-file=a b"},
+		`-e "ssh -p 2222" ''`:                {"-e", "ssh -p 2222", ""},
+		`a\ b 'c\d' "e\"f\g"`:                {"a b", `c\d`, `e"f\g`},
+	} {
+		args, err := SplitArgs(commandLine)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, args, "%s", commandLine)
+	}
+	for _, commandLine := range []string{`--exclude='*.tmp`, `-e "ssh`, `a\`} {
+		_, err := SplitArgs(commandLine)
+		assert.Error(t, err, "%s", commandLine)
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
 	"github.com/m-manu/rsync-sidekick/fmte"
 	"github.com/m-manu/rsync-sidekick/lib"
 	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/m-manu/rsync-sidekick/sidekick"
 	flag "github.com/spf13/pflag"
+	"golang.org/x/text/language"
 	"os"
 	"path/filepath"
 	"runtime/debug"
@@ -36,6 +42,43 @@ const (
 	exitCodeExclusionFilesError
 	exitCodeInvalidExclusions
 	exitCodeScriptPathError
+	exitCodeInvalidContentType
+	exitCodeSameSourceAndDestination
+	exitCodeAfterSyncHookError
+	exitCodeInvalidEncoding
+	exitCodeNestedSourceAndDestination
+	exitCodeInvalidHashMode
+	exitCodeInvalidMinSize
+	exitCodeInvalidOutputFormat
+	exitCodeInvalidPlanFlags
+	exitCodeInvalidThreads
+	exitCodeInvalidShowTree
+	exitCodeInvalidCaseInsensitiveFS
+	exitCodeInvalidRetries
+	exitCodeInvalidLogOpts
+	exitCodeInvalidProgressFormat
+	exitCodeArchiveDirError
+	exitCodeDigestCacheError
+	exitCodeInvalidIncludeExt
+	exitCodeInvalidScriptFlavor
+	exitCodeInvalidModifyWindow
+	exitCodeInvalidTimestampFlags
+	exitCodeInvalidPairs
+	exitCodeInvalidPruneEmptyDirs
+	exitCodeInterrupted
+	exitCodeInvalidTimeout
+	exitCodeTimedOut
+	exitCodeInvalidBwLimit
+	exitCodeInvalidMaxSize
+	// exitCodeChanges is returned instead of exitCodeSuccess when sync actions are found, with --exit-code-on-changes
+	exitCodeChanges
+	exitCodeInvalidMaxActions
+	exitCodeInvalidConflict
+	exitCodeInvalidLocaleOpts
+	exitCodeInvalidTmpDir
+	exitCodeInvalidScanOnly
+	exitCodeInvalidByExtension
+	exitCodeInvalidRsyncOpts
 )
 
 //go:embed default_exclusions.txt
@@ -44,11 +87,75 @@ var defaultExclusionsStr string
 var flags struct {
 	isHelp            func() bool
 	getExcludedFiles  func() set.Set[string]
+	getIgnoreRules    func() *lib.IgnoreMatcher
 	isShellScriptMode func() bool
 	scriptOutputPath  func() string
 	getListFilesDir   func() bool
+	isNulSeparated    func() bool
+	isListWithDigest  func() bool
+	isListHeader      func() bool
 	isVerbose         func() bool
 	showVersion       func() bool
+	isNoClobberVerify func() bool
+	summaryThreshold  func() int
+	isRepair          func() bool
+	getContentTypes   func() (included set.Set[string], excluded set.Set[string])
+	afterSyncHook     func() string
+	isRunRsync        func() bool
+	rsyncArgs         func() []string
+	getPathNormalizer func() service.PathNormalizer
+	isAudit           func() bool
+	isScanOnly        func() bool
+	byExtension       func() int
+	isShowTree        func() bool
+	isAllowNested     func() bool
+	summaryJSONPath   func() string
+	isScaledSampling  func() bool
+	hashMode          func() string
+	caseInsensitiveFS func() string
+	isVerify          func() bool
+	isChecksum        func() bool
+	isPerms           func() bool
+	ownership         func() (owner bool, group bool)
+	isNumericIDs      func() bool
+	minSize           func() int64
+	maxSize           func() int64
+	isSymlinks        func() bool
+	isIgnoreExtension func() bool
+	outputFormat      func() string
+	savePlanPath      func() string
+	applyPlanPath     func() string
+	unmatchedReport   func() string
+	reportExtraneous  func() (listed bool, reportPath string)
+	threads           func() int
+	retryPolicy       func() action.RetryPolicy
+	logLevel          func() fmte.Level
+	isLogFormatJSON   func() bool
+	locale            func() language.Tag
+	sizeFormat        func() string
+	progressFormat    func() string
+	archiveDirPath    func() string
+	isNanoseconds     func() bool
+	isPreserveAtime   func() bool
+	digestCachePath   func() string
+	includedExts      func() set.Set[string]
+	scriptFlavor      func() string
+	modifyWindow      func() time.Duration
+	timestampMode     func() (bool, bool)
+	pairs             func() []dirPair
+	pruneEmptyDirs    func() string
+	isRemoveDups      func() bool
+	isDirsTimestamps  func() bool
+	timeout           func() time.Duration
+	bwLimit           func() int64
+	isStats           func() bool
+	isExitOnChanges   func() bool
+	journalPath       func() string
+	maxActions        func() int
+	conflictPolicy    func() (policy string, trashDirPath string)
+	tmpDirPath        func() string
+	isConfirm         func() bool
+	isAssumeYes       func() bool
 }
 
 func setupExclusionsOpt() {
@@ -56,7 +163,9 @@ func setupExclusionsOpt() {
 	const exclusionsDefaultValue = ""
 	defaultExclusions, defaultExclusionsExamples := lib.LineSeparatedStrToMap(defaultExclusionsStr)
 	excludesListFilePathPtr := flag.StringP(exclusionsFlag, "x", exclusionsDefaultValue,
-		fmt.Sprintf("path to file containing newline separated list of file/directory names to be excluded\n"+
+		fmt.Sprintf("path to file containing newline separated list of file/directory names (or glob patterns such "+
+			"as *.tmp)\n"+
+			"to be excluded, lines beginning with # being comments (NUL separated instead, with --null)\n"+
 			"(even if this is not set, files/directories such these will still be ignored: %s etc.)",
 			strings.Join(defaultExclusionsExamples, ", ")))
 	flags.getExcludedFiles = func() set.Set[string] {
@@ -68,21 +177,62 @@ func setupExclusionsOpt() {
 			if !lib.IsReadableFile(excludesListFilePath) {
 				fmte.PrintfErr("error: argument to flag --%s should be a file\n", exclusionsFlag)
 				flag.Usage()
-				os.Exit(exitCodeInvalidExclusions)
+				exit(exitCodeInvalidExclusions)
 			}
 			rawContents, err := os.ReadFile(excludesListFilePath)
 			if err != nil {
 				fmte.PrintfErr("error: argument to flag --%s isn't readable: %+v\n", exclusionsFlag, err)
 				flag.Usage()
-				os.Exit(exitCodeExclusionFilesError)
+				exit(exitCodeExclusionFilesError)
 			}
-			contents := strings.ReplaceAll(string(rawContents), "\r\n", "\n") // Windows
-			exclusions, _ = lib.LineSeparatedStrToMap(contents)
+			if flags.isNulSeparated() {
+				exclusions = lib.NulSeparatedStrToMap(string(rawContents))
+			} else {
+				contents := strings.ReplaceAll(string(rawContents), "\r\n", "\n") // Windows
+				exclusions, _ = lib.LineSeparatedStrToMap(contents)
+			}
+		}
+		if _, err := lib.NewExclusionMatcher(exclusions); err != nil {
+			fmte.PrintfErr("error: file passed to flag --%s has an %+v\n", exclusionsFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidExclusions)
 		}
 		return exclusions
 	}
 }
 
+func setupExcludeFromGitignoreOpt() {
+	const excludeFromGitignoreFlag = "exclude-from-gitignore"
+	ignoreFilePathPtr := flag.String(excludeFromGitignoreFlag, "",
+		"path to file in .gitignore syntax (with negation, anchoring, directory-only rules and ** supported),\n"+
+			"whose rules are matched against paths relative to source/destination directories\n"+
+			"(in addition to exclusions)")
+	flags.getIgnoreRules = func() *lib.IgnoreMatcher {
+		ignoreFilePath := *ignoreFilePathPtr
+		if ignoreFilePath == "" {
+			return nil
+		}
+		if !lib.IsReadableFile(ignoreFilePath) {
+			fmte.PrintfErr("error: argument to flag --%s should be a file\n", excludeFromGitignoreFlag)
+			flag.Usage()
+			exit(exitCodeInvalidExclusions)
+		}
+		rawContents, err := os.ReadFile(ignoreFilePath)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s isn't readable: %+v\n", excludeFromGitignoreFlag, err)
+			flag.Usage()
+			exit(exitCodeExclusionFilesError)
+		}
+		ignoreRules, err := lib.NewIgnoreMatcher(strings.Split(string(rawContents), "\n"))
+		if err != nil {
+			fmte.PrintfErr("error: file passed to flag --%s has an %+v\n", excludeFromGitignoreFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidExclusions)
+		}
+		return ignoreRules
+	}
+}
+
 func handlePanic() {
 	err := recover()
 	if err != nil {
@@ -93,6 +243,12 @@ func handlePanic() {
 	}
 }
 
+// exit prints what's printed but isn't terminated by a new line yet (see fmte.Flush), and exits with given code
+func exit(code int) {
+	fmte.Flush()
+	os.Exit(code)
+}
+
 func setupUsage() {
 	flag.Usage = func() {
 		fmte.PrintfErr("Run \"rsync-sidekick --help\" for usage\n")
@@ -106,6 +262,7 @@ func showHelpAndExit() {
 
 Usage:
 	 rsync-sidekick <flags> [source-dir] [destination-dir]
+	 rsync-sidekick <flags> --pair [source-dir]:[destination-dir] --pair [source-dir]:[destination-dir] ...
 
 where,
 	[source-dir]        Source directory
@@ -114,8 +271,20 @@ where,
 flags: (all optional)
 `)
 	flag.PrintDefaults()
+	fmt.Printf(`
+exit codes:
+	%-3d success (with --%s: no sync actions were needed)
+	%-3d success, with sync actions found (only with --%s): they're performed, unless
+	    --audit, --save-plan or a script is asked for
+	%-3d error while syncing
+	%-3d error while running after-sync hook
+	%-3d interrupted (e.g. by Ctrl-C)
+	%-3d timed out (see --timeout)
+	others: invalid arguments or, with --%s, exit code of rsync if it fails
+`, exitCodeSuccess, exitCodeOnChangesFlag, exitCodeChanges, exitCodeOnChangesFlag, exitCodeSyncError,
+		exitCodeAfterSyncHookError, exitCodeInterrupted, exitCodeTimedOut, runRsyncFlag)
 	fmt.Printf("\nMore details here: https://github.com/m-manu/rsync-sidekick\n")
-	os.Exit(exitCodeSuccess)
+	exit(exitCodeSuccess)
 }
 
 func setupHelpOpt() {
@@ -157,6 +326,24 @@ func setupShellScriptWithNameOpt() {
 	}
 }
 
+func setupScriptFlavorOpt() {
+	const scriptFlavorFlag = "script-flavor"
+	scriptFlavorPtr := flag.String(scriptFlavorFlag, action.ScriptFlavorBash,
+		"kind of script generated with --"+shellScript+" or --"+shellScriptAtPath+": "+
+			strings.Join(action.ScriptFlavors, ", ")+"\n"+
+			"("+action.ScriptFlavorPowerShell+" and "+action.ScriptFlavorCmd+" scripts are for Windows)",
+	)
+	flags.scriptFlavor = func() string {
+		if !set.NewSet[string](action.ScriptFlavors...).Contains(*scriptFlavorPtr) {
+			fmte.PrintfErr("error: argument to flag --%s should be one of: %s\n", scriptFlavorFlag,
+				strings.Join(action.ScriptFlavors, ", "))
+			flag.Usage()
+			exit(exitCodeInvalidScriptFlavor)
+		}
+		return *scriptFlavorPtr
+	}
+}
+
 func setupVerboseOpt() {
 	verbosePtr := flag.BoolP("verbose", "v", false,
 		"generates extra information, even a file dump (caution: makes it slow!)",
@@ -166,93 +353,1322 @@ func setupVerboseOpt() {
 	}
 }
 
+func setupNoClobberVerifyOpt() {
+	noClobberVerifyPtr := flag.Bool("no-clobber-verify", false,
+		"refuse to move files on filesystems where moves can't be guaranteed to never overwrite an existing file\n"+
+			"(by default, on such filesystems, existence of the target is checked just before the move)",
+	)
+	flags.isNoClobberVerify = func() bool {
+		return *noClobberVerifyPtr
+	}
+}
+
+func setupSummaryThresholdOpt() {
+	summaryThresholdPtr := flag.Int("summary-threshold", 1000,
+		"when applying more than these many actions, print only a summary instead of every action\n"+
+			"(all actions are printed if --verbose is specified or if this is set to 0)",
+	)
+	flags.summaryThreshold = func() int {
+		return *summaryThresholdPtr
+	}
+}
+
+func setupRepairOpt() {
+	repairPtr := flag.Bool("repair", false,
+		"also match files whose content is duplicated at source when their paths have nothing in common with paths\n"+
+			"at destination, by pairing them with most similar ones (useful for moving files that earlier runs left "+
+			"behind)",
+	)
+	flags.isRepair = func() bool {
+		return *repairPtr
+	}
+}
+
+const (
+	contentTypeFlag        = "content-type"
+	excludeContentTypeFlag = "exclude-content-type"
+)
+
+func setupContentTypeOpts() {
+	includedPtr := flag.StringSlice(contentTypeFlag, []string{},
+		"comma separated list of content types, as detected from file contents (irrespective of extension),\n"+
+			"to restrict matching to (possible values: "+strings.Join(service.ContentTypes, ", ")+")",
+	)
+	excludedPtr := flag.StringSlice(excludeContentTypeFlag, []string{},
+		"comma separated list of content types to exclude from matching (see --"+contentTypeFlag+")",
+	)
+	flags.getContentTypes = func() (set.Set[string], set.Set[string]) {
+		return set.NewSet[string](*includedPtr...), set.NewSet[string](*excludedPtr...)
+	}
+}
+
+func setupAfterSyncHookOpt() {
+	afterSyncHookPtr := flag.String("after-sync", "",
+		"command to run (through shell) after sync actions are applied (e.g. rsync or a notification), with\n"+
+			"environment variables "+envSource+", "+envDestination+" and "+envSuccess+" set\n"+
+			"(this is skipped when a shell script is generated)",
+	)
+	flags.afterSyncHook = func() string {
+		return *afterSyncHookPtr
+	}
+}
+
+const (
+	runRsyncFlag  = "run-rsync"
+	rsyncArgsFlag = "rsync-args"
+)
+
+func setupRsyncOpts() {
+	runRsyncPtr := flag.Bool(runRsyncFlag, false,
+		"run rsync (as in 'rsync -a <source-dir>/ <destination-dir>') after sync actions are applied, so that it\n"+
+			"transfers the rest (with --audit, it's run with -n, as a dry run); if rsync fails, its exit code\n"+
+			"becomes exit code of this tool (this is skipped, with a warning, if rsync isn't found)",
+	)
+	rsyncArgsPtr := flag.String(rsyncArgsFlag, "",
+		"along with --"+runRsyncFlag+", more arguments to run rsync with, quoted as in a shell (e.g. \"--delete\n"+
+			"--exclude='*.tmp'\")",
+	)
+	flags.isRunRsync = func() bool {
+		return *runRsyncPtr
+	}
+	flags.rsyncArgs = func() []string {
+		if *rsyncArgsPtr != "" && !*runRsyncPtr {
+			fmte.PrintfErr("error: flag --%s can only be used along with --%s\n", rsyncArgsFlag, runRsyncFlag)
+			flag.Usage()
+			exit(exitCodeInvalidRsyncOpts)
+		}
+		rsyncArgs, err := lib.SplitArgs(*rsyncArgsPtr)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s is invalid: %+v\n", rsyncArgsFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidRsyncOpts)
+		}
+		return rsyncArgs
+	}
+}
+
+func setupEncodingOpts() {
+	sourceEncodingPtr := flag.String("source-encoding", "",
+		"encoding of file names at source, if not UTF-8 (e.g. ISO-8859-1 for some old SMB/NFS mounts)")
+	destinationEncodingPtr := flag.String("destination-encoding", "",
+		"encoding of file names at destination, if not UTF-8")
+	normalizeUnicodePtr := flag.Bool("normalize-unicode", false,
+		"treat file names that differ only in Unicode normalization (e.g. NFC vs NFD on macOS) as same")
+	flags.getPathNormalizer = func() service.PathNormalizer {
+		normalizer, err := service.NewPathNormalizer(*sourceEncodingPtr, *destinationEncodingPtr,
+			*normalizeUnicodePtr)
+		if err != nil {
+			fmte.PrintfErr("error: %+v\n", err)
+			flag.Usage()
+			exit(exitCodeInvalidEncoding)
+		}
+		return normalizer
+	}
+}
+
+func setupAuditOpt() {
+	auditPtr := flag.Bool("audit", false,
+		"only report the sync actions that would be performed, guaranteeing nothing is written\n"+
+			"(unlike --"+shellScript+", no script is written either; --after-sync hook is not run)",
+	)
+	flags.isAudit = func() bool {
+		return *auditPtr
+	}
+}
+
+const scanOnlyFlag = "scan-only"
+
+func setupScanOnlyOpt() {
+	scanOnlyPtr := flag.Bool(scanOnlyFlag, false,
+		"only scan source and destination, and report how many files at source may have been renamed/moved\n"+
+			"at destination, and at most how much sync actions can save, without hashing any file (for a quick\n"+
+			"estimate; no sync actions are computed, so nothing is written)",
+	)
+	flags.isScanOnly = func() bool {
+		return *scanOnlyPtr
+	}
+}
+
+const (
+	byExtensionFlag    = "by-extension"
+	byExtensionTopFlag = "by-extension-top"
+)
+
+func setupByExtensionOpt() {
+	byExtensionPtr := flag.Bool(byExtensionFlag, false,
+		"after scanning, report number and total size of files at source, at destination and among files at\n"+
+			"source without counterparts at destination, by extension (see --"+byExtensionTopFlag+"); useful for\n"+
+			"choosing values of --include-ext and --min-size",
+	)
+	byExtensionTopPtr := flag.Int(byExtensionTopFlag, 10,
+		"with --"+byExtensionFlag+", number of extensions reported, the largest ones by total size (with the rest\n"+
+			"summed up as \""+service.OtherExtensions+"\")",
+	)
+	flags.byExtension = func() int {
+		if !*byExtensionPtr {
+			if flag.CommandLine.Changed(byExtensionTopFlag) {
+				fmte.PrintfErr("error: flag --%s can only be used along with --%s\n", byExtensionTopFlag,
+					byExtensionFlag)
+				flag.Usage()
+				exit(exitCodeInvalidByExtension)
+			}
+			return 0
+		}
+		if *byExtensionTopPtr <= 0 {
+			fmte.PrintfErr("error: argument to flag --%s should be positive\n", byExtensionTopFlag)
+			flag.Usage()
+			exit(exitCodeInvalidByExtension)
+		}
+		return *byExtensionTopPtr
+	}
+}
+
+const showTree = "show-tree"
+
+func setupShowTreeOpt() {
+	showTreePtr := flag.Bool(showTree, false,
+		"along with --audit, also show how the tree at destination would change (paths that go away,\n"+
+			"paths that come up and paths whose timestamps are touched)",
+	)
+	flags.isShowTree = func() bool {
+		return *showTreePtr
+	}
+}
+
+const allowNested = "allow-nested"
+
+func setupAllowNestedOpt() {
+	allowNestedPtr := flag.Bool(allowNested, false,
+		"allow destination directory to be inside source directory (or the other way round), with the inner one\n"+
+			"excluded from scanning (without this flag, such nested directories are refused)",
+	)
+	flags.isAllowNested = func() bool {
+		return *allowNestedPtr
+	}
+}
+
+func setupSummaryJSONOpt() {
+	summaryJSONPathPtr := flag.String("summary-json", "",
+		"path of file to which a summary of the run (counts of actions, bytes saved, time taken, errors etc.)\n"+
+			"is written as JSON on completion",
+	)
+	flags.summaryJSONPath = func() string {
+		return *summaryJSONPathPtr
+	}
+}
+
+func setupScaledSamplingOpt() {
+	scaledSamplingPtr := flag.Bool("scaled-sampling", false,
+		"while computing digests, read one extra sample from large files for every GiB of size (up to 16)\n"+
+			"(reduces chances of different large files being considered same, at the cost of speed)",
+	)
+	flags.isScaledSampling = func() bool {
+		return *scaledSamplingPtr
+	}
+}
+
+const hashModeFlag = "hash-mode"
+
+func setupHashModeOpt() {
+	hashModePtr := flag.String(hashModeFlag, service.HashModeFast,
+		"how files are hashed to find matches: "+strings.Join(service.HashModes, ", ")+"\n"+
+			"("+service.HashModeFast+": hashes only a few samples of large files, "+
+			service.HashModeFull+": hashes whole files, "+service.HashModeSHA256+": same, but using SHA-256,\n"+
+			service.HashModeXXHash+": same, but using 64-bit xxHash, which has fewer collisions "+
+			"than "+service.HashModeFull+")",
+	)
+	flags.hashMode = func() string {
+		return *hashModePtr
+	}
+}
+
+const caseInsensitiveFSFlag = "case-insensitive-fs"
+
+func setupCaseInsensitiveFSOpt() {
+	caseInsensitiveFSPtr := flag.String(caseInsensitiveFSFlag, service.CaseInsensitiveFSAuto,
+		"whether filesystem at destination is case-insensitive (as is default on macOS and Windows): "+
+			strings.Join(service.CaseInsensitiveFSModes, ", ")+"\n"+
+			"(on such a filesystem, files aren't moved to names clashing with other files, "+
+			service.CaseInsensitiveFSAuto+": detect it)",
+	)
+	flags.caseInsensitiveFS = func() string {
+		return *caseInsensitiveFSPtr
+	}
+}
+
+func setupVerifyOpt() {
+	verifyPtr := flag.Bool("verify", false,
+		"before acting on a match, compare full contents of the files byte by byte and skip it if they differ\n"+
+			"(safest, but reads whole of every matched file)",
+	)
+	flags.isVerify = func() bool {
+		return *verifyPtr
+	}
+}
+
+func setupChecksumOpt() {
+	checksumPtr := flag.Bool("checksum", false,
+		"consider a file in sync only if the file at same path at destination has same contents (by digest),\n"+
+			"rather than same size and modification timestamp (slower, as such files are hashed at both ends; pair\n"+
+			"it with rsync's --checksum)",
+	)
+	flags.isChecksum = func() bool {
+		return *checksumPtr
+	}
+}
+
+func setupPermsOpt() {
+	permsPtr := flag.Bool("perms", false,
+		"also propagate permissions of files at source to matched files at destination, where they differ (so\n"+
+			"that rsync's --perms doesn't have to transfer them)",
+	)
+	flags.isPerms = func() bool {
+		return *permsPtr
+	}
+}
+
+func setupOwnerOpts() {
+	ownerPtr := flag.Bool("owner", false,
+		"also propagate user owning files at source to matched files at destination, where it differs (this needs\n"+
+			"privilege, e.g. running as root: otherwise, such changes are skipped with a warning)",
+	)
+	groupPtr := flag.Bool("group", false,
+		"also propagate group owning files at source to matched files at destination, where it differs",
+	)
+	numericIDsPtr := flag.Bool("numeric-ids", false,
+		"in generated scripts, refer to users and groups by their IDs rather than by their names",
+	)
+	flags.ownership = func() (bool, bool) {
+		return *ownerPtr, *groupPtr
+	}
+	flags.isNumericIDs = func() bool {
+		return *numericIDsPtr
+	}
+}
+
+const (
+	minSizeFlag = "min-size"
+	maxSizeFlag = "max-size"
+)
+
+func setupMinSizeOpt() {
+	minSizePtr := flag.String(minSizeFlag, "0",
+		"ignore files smaller than this size (e.g. 100K, 1M), leaving them to rsync\n"+
+			"(speeds up runs on directories with lots of tiny files, such as thumbnails)",
+	)
+	flags.minSize = func() int64 {
+		minSize, err := bytesutil.ParseSize(*minSizePtr)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s is invalid: %+v\n", minSizeFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidMinSize)
+		}
+		return minSize
+	}
+}
+
+func setupMaxSizeOpt() {
+	maxSizePtr := flag.String(maxSizeFlag, "0",
+		"ignore files larger than this size (e.g. 4G), leaving them to rsync (e.g. for VM images, which are\n"+
+			"expensive to hash and unlikely to have been moved; 0 means no limit)",
+	)
+	flags.maxSize = func() int64 {
+		maxSize, err := bytesutil.ParseSize(*maxSizePtr)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s is invalid: %+v\n", maxSizeFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidMaxSize)
+		}
+		return maxSize
+	}
+}
+
+const includeExtFlag = "include-ext"
+
+func setupIncludeExtOpt() {
+	includeExtPtr := flag.StringSlice(includeExtFlag, []string{},
+		"comma separated list of file extensions (e.g. jpg,cr2,heic) to restrict matching to, leaving other files\n"+
+			"to rsync (files must satisfy this, --min-size, --max-size and exclusions, all)",
+	)
+	flags.includedExts = func() set.Set[string] {
+		includedExts := set.NewThreadUnsafeSet[string]()
+		for _, ext := range *includeExtPtr {
+			includedExts.Add("." + strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")))
+		}
+		return includedExts
+	}
+}
+
+func setupIgnoreExtensionOpt() {
+	ignoreExtensionPtr := flag.Bool("ignore-extension", false,
+		"match files regardless of their extensions (e.g. \"a.jpeg\" renamed to \"b.jpg\"), by sizes and digests\n"+
+			"alone (this makes wrong matches slightly more likely, as there are more candidates for each file)",
+	)
+	flags.isIgnoreExtension = func() bool {
+		return *ignoreExtensionPtr
+	}
+}
+
+func setupSymlinksOpt() {
+	symlinksPtr := flag.Bool("symlinks", false,
+		"also propagate renames/movements of symbolic links themselves (they aren't followed), "+
+			"matching them by their targets",
+	)
+	flags.isSymlinks = func() bool {
+		return *symlinksPtr
+	}
+}
+
+func setupStatsOpt() {
+	statsPtr := flag.Bool("stats", false,
+		"at the end, write counts of files scanned, orphans, candidates and actions by type, bytes saved and time\n"+
+			"taken to standard error, as key=value lines (or as a JSON object, with --output="+outputFormatJSON+")",
+	)
+	flags.isStats = func() bool {
+		return *statsPtr
+	}
+}
+
+const exitCodeOnChangesFlag = "exit-code-on-changes"
+
+func setupExitCodeOnChangesOpt() {
+	exitCodeOnChangesPtr := flag.Bool(exitCodeOnChangesFlag, false,
+		fmt.Sprintf("exit with code %d (instead of %d) when sync actions are found, so that scripts can tell whether\n"+
+			"anything changed (see exit codes below)", exitCodeChanges, exitCodeSuccess),
+	)
+	flags.isExitOnChanges = func() bool {
+		return *exitCodeOnChangesPtr
+	}
+}
+
+const outputFlag = "output"
+
+func setupOutputOpt() {
+	outputPtr := flag.String(outputFlag, outputFormatText,
+		"format of output: "+strings.Join(outputFormats, ", ")+"\n"+
+			"(in "+outputFormatJSON+", planned actions are written to standard output as a JSON array and everything\n"+
+			"else is written to standard error)",
+	)
+	flags.outputFormat = func() string {
+		outputFormat := *outputPtr
+		if !set.NewSet[string](outputFormats...).Contains(outputFormat) {
+			fmte.PrintfErr("error: argument to flag --%s should be one of: %s\n", outputFlag,
+				strings.Join(outputFormats, ", "))
+			flag.Usage()
+			exit(exitCodeInvalidOutputFormat)
+		}
+		return outputFormat
+	}
+}
+
+const (
+	savePlanFlag  = "save-plan"
+	applyPlanFlag = "apply-plan"
+)
+
+func setupPlanOpts() {
+	savePlanPtr := flag.String(savePlanFlag, "",
+		"save sync actions to a file at this path (as JSON) instead of applying them, so that they can be\n"+
+			"inspected and applied later using --"+applyPlanFlag,
+	)
+	applyPlanPtr := flag.String(applyPlanFlag, "",
+		"apply sync actions saved earlier using --"+savePlanFlag+" to a file at this path, instead of scanning\n"+
+			"directories (source and destination aren't to be passed, and actions that can't be performed anymore\n"+
+			"are skipped)",
+	)
+	flags.savePlanPath = func() string {
+		return *savePlanPtr
+	}
+	flags.applyPlanPath = func() string {
+		return *applyPlanPtr
+	}
+}
+
+func setupJournalOpt() {
+	journalPtr := flag.String("journal", "",
+		"record progress of sync actions being applied in a file at this path: if a run doesn't complete (e.g. due\n"+
+			"to a crash), the next run with same journal first performs actions left unperformed (the journal is\n"+
+			"removed once all actions are performed)",
+	)
+	flags.journalPath = func() string {
+		return *journalPtr
+	}
+}
+
+func setupUnmatchedReportOpt() {
+	unmatchedReportPtr := flag.String("unmatched-report", "",
+		"write list of files at source that have no counterparts at destination (i.e. files rsync would transfer)\n"+
+			"to a file at this path",
+	)
+	flags.unmatchedReport = func() string {
+		return *unmatchedReportPtr
+	}
+}
+
+func setupReportExtraneousOpts() {
+	reportExtraneousPtr := flag.Bool("report-extraneous", false,
+		"list files at destination that don't exist at source, telling apart the ones 'rsync --delete' would delete\n"+
+			"from the ones sync actions move away (as they are files renamed/moved at source)",
+	)
+	extraneousReportPtr := flag.String("extraneous-report", "",
+		"write list of files at destination that don't exist at source (see --report-extraneous) to a file at\n"+
+			"this path",
+	)
+	flags.reportExtraneous = func() (bool, string) {
+		return *reportExtraneousPtr, *extraneousReportPtr
+	}
+}
+
+const (
+	retriesFlag    = "retries"
+	retryDelayFlag = "retry-delay"
+)
+
+func setupRetryOpts() {
+	retriesPtr := flag.Int(retriesFlag, 0,
+		"number of times an action that fails due to a transient error (e.g. a hiccup of a network filesystem)\n"+
+			"is retried (errors such as 'file already exists' are never retried; this doesn't affect scripts)",
+	)
+	retryDelayPtr := flag.Duration(retryDelayFlag, time.Second,
+		"how long to wait before retrying an action (doubles after each retry)",
+	)
+	flags.retryPolicy = func() action.RetryPolicy {
+		return action.RetryPolicy{Retries: *retriesPtr, Delay: *retryDelayPtr}
+	}
+}
+
+const threadsFlag = "threads"
+
+func setupThreadsOpt() {
+	threadsPtr := flag.Int(threadsFlag, 0,
+		"number of files hashed concurrently, split between source and destination (default is based on\n"+
+			"number of CPUs; 1 hashes files one at a time, which suits spinning disks)",
+	)
+	flags.threads = func() int {
+		return *threadsPtr
+	}
+}
+
+const (
+	maxActionsFlag = "max-actions"
+	confirmFlag    = "confirm"
+	assumeYesFlag  = "yes"
+)
+
+func setupConfirmationOpts() {
+	maxActionsPtr := flag.Int(maxActionsFlag, 0,
+		"abort, rather than perform sync actions, if there are more of them than this (e.g. due to a wrong source\n"+
+			"directory), unless --"+assumeYesFlag+" is passed or, in an interactive run, the user confirms (0 means "+
+			"no limit)",
+	)
+	confirmPtr := flag.Bool(confirmFlag, false,
+		"before performing sync actions, ask whether to perform all of them, none or each of them, one type of\n"+
+			"actions (file moves, timestamp updates etc.) at a time (default true when run from a terminal)",
+	)
+	assumeYesPtr := flag.Bool(assumeYesFlag, false,
+		"perform sync actions without asking for confirmation (see --"+confirmFlag+" and --"+maxActionsFlag+")",
+	)
+	flags.maxActions = func() int {
+		if *maxActionsPtr < 0 {
+			fmte.PrintfErr("error: argument to flag --%s can't be negative\n", maxActionsFlag)
+			flag.Usage()
+			exit(exitCodeInvalidMaxActions)
+		}
+		return *maxActionsPtr
+	}
+	flags.isConfirm = func() bool {
+		if flag.CommandLine.Changed(confirmFlag) {
+			return *confirmPtr
+		}
+		return isInteractive()
+	}
+	flags.isAssumeYes = func() bool {
+		return *assumeYesPtr
+	}
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+func setupLogOpts() {
+	const logLevelFlag = "log-level"
+	const logFormatFlag = "log-format"
+	const quietFlag = "quiet"
+	const silentFlag = "silent"
+	logLevelPtr := flag.String(logLevelFlag, fmte.LevelInfo.String(),
+		"print only messages of this level or more severe ones: "+strings.Join(fmte.LevelNames, ", ")+"\n"+
+			"(debug is what --verbose prints, warn is for files that are skipped due to errors)",
+	)
+	quietPtr := flag.BoolP(quietFlag, "q", false,
+		"print only warnings and errors, and not progress or summary (same as --"+logLevelFlag+"="+
+			fmte.LevelWarn.String()+")",
+	)
+	silentPtr := flag.Bool(silentFlag, false,
+		"print nothing at all, not even errors (outcome is then known only from exit code; same as\n"+
+			"--"+logLevelFlag+"="+fmte.LevelSilent.String()+")",
+	)
+	logFormatPtr := flag.String(logFormatFlag, logFormatText,
+		"format of messages: "+logFormatText+", "+logFormatJSON+"\n"+
+			"(in "+logFormatJSON+", every line is printed as a JSON object with its timestamp and level)",
+	)
+	flags.logLevel = func() fmte.Level {
+		if *quietPtr || *silentPtr {
+			if flags.isVerbose() || flag.CommandLine.Changed(logLevelFlag) {
+				fmte.PrintfErr("error: flags --%s and --%s can't be used along with --verbose or --%s\n", quietFlag,
+					silentFlag, logLevelFlag)
+				exit(exitCodeInvalidLogOpts)
+			}
+			if *silentPtr {
+				return fmte.LevelSilent
+			}
+			return fmte.LevelWarn
+		}
+		logLevel, err := fmte.ParseLevel(*logLevelPtr)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s should be one of: %s\n", logLevelFlag,
+				strings.Join(fmte.LevelNames, ", "))
+			flag.Usage()
+			exit(exitCodeInvalidLogOpts)
+		}
+		return logLevel
+	}
+	flags.isLogFormatJSON = func() bool {
+		if *logFormatPtr != logFormatText && *logFormatPtr != logFormatJSON {
+			fmte.PrintfErr("error: argument to flag --%s should be one of: %s, %s\n", logFormatFlag,
+				logFormatText, logFormatJSON)
+			flag.Usage()
+			exit(exitCodeInvalidLogOpts)
+		}
+		return *logFormatPtr == logFormatJSON
+	}
+}
+
+func setupLocaleOpts() {
+	const localeFlag = "locale"
+	const sizeFormatFlag = "size-format"
+	localePtr := flag.String(localeFlag, language.English.String(),
+		"locale (as a BCP 47 tag, e.g. de or fr-CA) in which numbers and sizes are printed, with its digit grouping\n"+
+			"and decimal separator",
+	)
+	sizeFormatPtr := flag.String(sizeFormatFlag, bytesutil.FormatBinary,
+		"how sizes are printed: "+strings.Join(bytesutil.Formats, ", ")+"\n"+
+			"("+bytesutil.FormatBinary+": e.g. 2.09 KiB, "+bytesutil.FormatDecimal+": e.g. 2.14 KB, "+
+			bytesutil.FormatRaw+": byte counts such as 2140 B, for scripts)",
+	)
+	flags.locale = func() language.Tag {
+		locale, err := language.Parse(*localePtr)
+		if err != nil {
+			fmte.PrintfErr("error: argument to flag --%s isn't a valid locale: %+v\n", localeFlag, err)
+			flag.Usage()
+			exit(exitCodeInvalidLocaleOpts)
+		}
+		return locale
+	}
+	flags.sizeFormat = func() string {
+		sizeFormat := *sizeFormatPtr
+		if !set.NewSet[string](bytesutil.Formats...).Contains(sizeFormat) {
+			fmte.PrintfErr("error: argument to flag --%s should be one of: %s\n", sizeFormatFlag,
+				strings.Join(bytesutil.Formats, ", "))
+			flag.Usage()
+			exit(exitCodeInvalidLocaleOpts)
+		}
+		return sizeFormat
+	}
+}
+
+const progressFormatFlag = "progress-format"
+
+func setupProgressFormatOpt() {
+	progressFormatPtr := flag.String(progressFormatFlag, sidekick.ProgressFormatAuto,
+		"how progress of indexing of files is shown: "+strings.Join(sidekick.ProgressFormats, ", ")+"\n"+
+			"("+sidekick.ProgressFormatBar+": a single line updated in place, "+sidekick.ProgressFormatLines+
+			": a new line every 2 seconds, "+sidekick.ProgressFormatAuto+": "+sidekick.ProgressFormatBar+
+			" on a terminal and "+sidekick.ProgressFormatLines+" otherwise)",
+	)
+	flags.progressFormat = func() string {
+		return *progressFormatPtr
+	}
+}
+
+const archiveDirFlag = "archive-dir"
+
+func setupArchiveDirOpt() {
+	const compareDestFlag = "compare-dest"
+	archiveDirPtr := flag.String(archiveDirFlag, "",
+		"directory (e.g. an older backup on the same disk as destination) where files at source that have no\n"+
+			"counterparts at destination are looked for: matching ones are copied from there instead of leaving "+
+			"them to rsync",
+	)
+	compareDestPtr := flag.String(compareDestFlag, "", "same as --"+archiveDirFlag+" (named as in rsync)")
+	flags.archiveDirPath = func() string {
+		argument := *archiveDirPtr
+		if *compareDestPtr != "" {
+			if argument != "" && argument != *compareDestPtr {
+				fmte.PrintfErr("error: flags --%s and --%s can't be given different directories\n", archiveDirFlag,
+					compareDestFlag)
+				flag.Usage()
+				exit(exitCodeArchiveDirError)
+			}
+			argument = *compareDestPtr
+		}
+		if argument == "" {
+			return ""
+		}
+		return resolvePath(argument)
+	}
+}
+
+const bwLimitFlag = "bwlimit"
+
+func setupBwLimitOpt() {
+	bwLimitPtr := flag.Int64(bwLimitFlag, 0,
+		"maximum rate, in KiB per second, at which files are copied from archive directory (0 means no limit)",
+	)
+	flags.bwLimit = func() int64 {
+		return *bwLimitPtr * bytesutil.KIBI
+	}
+}
+
+const (
+	conflictFlag = "conflict"
+	trashDirFlag = "trash-dir"
+)
+
+func setupConflictOpts() {
+	conflictPtr := flag.String(conflictFlag, action.ConflictSkip,
+		"what a file move does when another file is at its new path already: "+action.ConflictSkip+
+			" (leave both to rsync),\n"+action.ConflictTrash+" (move the file in the way into --"+trashDirFlag+
+			") or "+action.ConflictOverwrite+" (replace the file in the way), the latter two not being supported\n"+
+			"in scripts",
+	)
+	trashDirPtr := flag.String(trashDirFlag, "",
+		"with --"+conflictFlag+"="+action.ConflictTrash+", directory into which files in the way of file moves are "+
+			"moved (keeping their paths\nrelative to destination), preferably on the same disk as destination",
+	)
+	flags.conflictPolicy = func() (string, string) {
+		if *trashDirPtr == "" && *conflictPtr == action.ConflictTrash {
+			// Files in the way are moved into temporary directory, if there's one:
+			return *conflictPtr, flags.tmpDirPath()
+		}
+		if *trashDirPtr == "" {
+			return *conflictPtr, ""
+		}
+		return *conflictPtr, resolvePath(*trashDirPtr)
+	}
+}
+
+const tmpDirFlag = "tmp-dir"
+
+func setupTmpDirOpt() {
+	tmpDirPtr := flag.String(tmpDirFlag, "",
+		"directory into which files are temporarily moved aside to break cycles of moves (e.g. two files swapping\n"+
+			"their names), instead of next to them in destination; it must be on the same filesystem as destination,\n"+
+			"and with --conflict=trash, it's where files in the way go by default",
+	)
+	flags.tmpDirPath = func() string {
+		if *tmpDirPtr == "" {
+			return ""
+		}
+		return resolvePath(*tmpDirPtr)
+	}
+}
+
+func setupTimestampOpts() {
+	nanosecondsPtr := flag.Bool("nanoseconds", true,
+		"compare modification timestamps including their sub-second parts, rather than in whole seconds\n"+
+			"(they're always propagated along) (pass --nanoseconds=false, or --modify-window, if destination\n"+
+			"filesystem doesn't store them, as is the case with FAT and some network filesystems)",
+	)
+	preserveAtimePtr := flag.Bool("preserve-atime", false,
+		"while propagating timestamps, copy access time too (by default, it's set to modification time)",
+	)
+	flags.isNanoseconds = func() bool {
+		return *nanosecondsPtr
+	}
+	flags.isPreserveAtime = func() bool {
+		return *preserveAtimePtr
+	}
+}
+
+func setupDigestCacheOpt() {
+	digestCachePtr := flag.String("cache", "",
+		"file where digests of files are cached across runs, so that files whose sizes and modification timestamps\n"+
+			"haven't changed since are not read again (created, if it doesn't exist)",
+	)
+	flags.digestCachePath = func() string {
+		return *digestCachePtr
+	}
+}
+
+const onlyTimestampFlag = "only-timestamp"
+
+func setupTimestampModeOpts() {
+	const noTimestampFlag = "no-timestamp"
+	noTimestampPtr := flag.Bool(noTimestampFlag, false,
+		"propagate only renames/movements of files, leaving their timestamps to rsync (run with -t)",
+	)
+	onlyTimestampPtr := flag.Bool(onlyTimestampFlag, false,
+		"propagate only timestamps of files (at same paths at source and destination), leaving renames/movements\n"+
+			"to rsync (this flag cannot be specified if --"+noTimestampFlag+" is specified)",
+	)
+	flags.timestampMode = func() (bool, bool) {
+		return *noTimestampPtr, *onlyTimestampPtr
+	}
+}
+
+const modifyWindowFlag = "modify-window"
+
+func setupModifyWindowOpt() {
+	modifyWindowPtr := flag.Int(modifyWindowFlag, 0,
+		"consider modification timestamps of files same if they differ by no more than this many seconds, like\n"+
+			"rsync's option of the same name (e.g. 1 for a destination on a FAT filesystem)",
+	)
+	flags.modifyWindow = func() time.Duration {
+		return time.Duration(*modifyWindowPtr) * time.Second
+	}
+}
+
+const (
+	pairFlag      = "pair"
+	pairsFileFlag = "pairs-file"
+)
+
+func setupPairsOpts() {
+	pairPtr := flag.StringArray(pairFlag, []string{},
+		"a source directory and a destination directory to sync, as source:destination (can be repeated, in\n"+
+			"place of the two arguments, to sync many pairs one after another)",
+	)
+	pairsFilePtr := flag.String(pairsFileFlag, "",
+		"file with pairs of directories to sync, one source:destination per line (see --"+pairFlag+")",
+	)
+	flags.pairs = func() []dirPair {
+		pairs := make([]dirPair, 0, len(*pairPtr))
+		for _, text := range *pairPtr {
+			pair, err := parsePair(text)
+			if err != nil {
+				fmte.PrintfErr("error: argument to flag --%s is invalid: %+v\n", pairFlag, err)
+				flag.Usage()
+				exit(exitCodeInvalidPairs)
+			}
+			pairs = append(pairs, pair)
+		}
+		if *pairsFilePtr != "" {
+			pairsFromFile, err := readPairsFile(*pairsFilePtr)
+			if err != nil {
+				fmte.PrintfErr("error: argument to flag --%s is invalid: %+v\n", pairsFileFlag, err)
+				exit(exitCodeInvalidPairs)
+			}
+			pairs = append(pairs, pairsFromFile...)
+		}
+		return pairs
+	}
+}
+
+const pruneEmptyDirsFlag = "prune-empty-dirs"
+
+func setupPruneEmptyDirsOpt() {
+	pruneEmptyDirsPtr := flag.String(pruneEmptyDirsFlag, "",
+		"remove directories at destination that sync actions leave empty (with ="+service.PruneEmptyDirsAll+
+			", remove directories that\nare empty already too)",
+	)
+	flag.Lookup(pruneEmptyDirsFlag).NoOptDefVal = service.PruneEmptyDirsLeft
+	flags.pruneEmptyDirs = func() string {
+		return *pruneEmptyDirsPtr
+	}
+}
+
+func setupRemoveDuplicatesOpt() {
+	removeDuplicatesPtr := flag.Bool("remove-duplicates", false,
+		"remove stale duplicates at destination: files that don't exist at source and have same contents as\n"+
+			"files that are moved to (or are at) their paths at source (each is compared byte by byte just before\n"+
+			"it's removed, and it's left alone if the other file is missing or differs)",
+	)
+	flags.isRemoveDups = func() bool {
+		return *removeDuplicatesPtr
+	}
+}
+
+func setupDirsTimestampsOpt() {
+	dirsTimestampsPtr := flag.Bool("dirs-timestamps", false,
+		"also propagate modification timestamps of directories at source to directories at same paths at\n"+
+			"destination",
+	)
+	flags.isDirsTimestamps = func() bool {
+		return *dirsTimestampsPtr
+	}
+}
+
+func setupTimeoutOpt() {
+	const timeoutFlag = "timeout"
+	timeoutPtr := flag.Duration(timeoutFlag, 0,
+		"stop the run (cleanly, as on Ctrl-C) if it takes longer than this, e.g. 30m (0 means no limit)",
+	)
+	flags.timeout = func() time.Duration {
+		if *timeoutPtr < 0 {
+			fmte.PrintfErr("error: argument to flag --%s can't be negative\n", timeoutFlag)
+			flag.Usage()
+			exit(exitCodeInvalidTimeout)
+		}
+		return *timeoutPtr
+	}
+}
+
+func setupNulSeparatedOpt() {
+	nulSeparatedPtr := flag.BoolP("null", "0", false,
+		"names of files are separated by NUL characters rather than newlines, in file of exclusions and in output of\n"+
+			"--list (whose records are then unquoted, as in \"path,size,timestamp,nanoseconds\"), as with\n"+
+			"'find -print0' and 'xargs -0'",
+	)
+	flags.isNulSeparated = func() bool {
+		return *nulSeparatedPtr
+	}
+}
+
 func setupGetListFilesDir() {
 	listFilesDirPtr := flag.Bool("list", false, "list files along their metadata for given directory")
+	listWithDigestPtr := flag.Bool("list-with-digest", false,
+		"same as --list, but with digest of each file as the last column (as per --hash-mode), so that listings\n"+
+			"taken at different times tell changed files apart even at same size and timestamp (this reads all "+
+			"files,\n"+
+			"and so is far slower)",
+	)
 	flags.getListFilesDir = func() bool {
-		listFilesDir := *listFilesDirPtr
+		listFilesDir := *listFilesDirPtr || *listWithDigestPtr
 		return listFilesDir
 	}
+	flags.isListWithDigest = func() bool {
+		return *listWithDigestPtr
+	}
+	listHeaderPtr := flag.Bool("list-header", false,
+		"with --list (or --list-with-digest), write names of columns as the first record")
+	flags.isListHeader = func() bool {
+		return *listHeaderPtr
+	}
 }
 
-func readSourceAndDestination() (string, string) {
-	sourceDirPath, sourceDirErr := filepath.Abs(flag.Arg(0))
-	if sourceDirErr != nil || !lib.IsReadableDirectory(sourceDirPath) {
-		fmte.PrintfErr("error: source path \"%s\" is not a readable directory\n", flag.Arg(0))
-		flag.Usage()
-		os.Exit(exitCodeSourceDirError)
+// resolvePath converts path of a directory to an absolute path, with any symbolic links resolved (a path that can't be
+// resolved is left for sidekick.Options.Validate to report)
+func resolvePath(path string) string {
+	absolutePath, absErr := filepath.Abs(path)
+	if absErr != nil {
+		return path
 	}
-	destinationDirPath, destinationDirErr := filepath.Abs(flag.Arg(1))
-	if destinationDirErr != nil || !lib.IsReadableDirectory(destinationDirPath) {
-		fmte.PrintfErr("error: destination path \"%s\" is not a readable directory\n", flag.Arg(1))
-		flag.Usage()
-		os.Exit(exitCodeDestinationDirError)
+	resolvedPath, resolveErr := filepath.EvalSymlinks(absolutePath)
+	if resolveErr != nil {
+		return absolutePath
+	}
+	return resolvedPath
+}
+
+// resolvePair resolves paths of source and destination directories (see resolvePath), telling which of them resolve
+// to paths other than the given ones
+func resolvePair(pair dirPair) dirPair {
+	resolved := dirPair{source: resolvePath(pair.source), destination: resolvePath(pair.destination)}
+	for _, p := range [][2]string{{pair.source, resolved.source}, {pair.destination, resolved.destination}} {
+		if givenAbsPath, _ := filepath.Abs(p[0]); givenAbsPath != p[1] {
+			fmte.Printf("Path \"%s\" resolves to \"%s\"\n", p[0], p[1])
+		}
 	}
-	return sourceDirPath, destinationDirPath
+	return resolved
+}
+
+// optionFlags are flags that options of sidekick.Options (named as in sidekick.OptionError) are set through, along
+// with exit codes for when they're invalid
+var optionFlags = map[string]struct {
+	flag     string
+	exitCode int
+}{
+	"SourceDirPath":        {"", exitCodeSourceDirError},
+	"DestinationDirPath":   {"", exitCodeDestinationDirError},
+	"ProgressFormat":       {progressFormatFlag, exitCodeInvalidProgressFormat},
+	"RetryPolicy":          {retriesFlag, exitCodeInvalidRetries},
+	"ByExtension":          {byExtensionTopFlag, exitCodeInvalidByExtension},
+	"ScanOnly":             {scanOnlyFlag, exitCodeInvalidScanOnly},
+	"IncludedContentTypes": {contentTypeFlag, exitCodeInvalidContentType},
+	"ExcludedContentTypes": {excludeContentTypeFlag, exitCodeInvalidContentType},
+	"MinSize":              {minSizeFlag, exitCodeInvalidMinSize},
+	"MaxSize":              {maxSizeFlag, exitCodeInvalidMaxSize},
+	"IncludedExtensions":   {includeExtFlag, exitCodeInvalidIncludeExt},
+	"Digest.HashMode":      {hashModeFlag, exitCodeInvalidHashMode},
+	"Threads":              {threadsFlag, exitCodeInvalidThreads},
+	"CaseInsensitiveFS":    {caseInsensitiveFSFlag, exitCodeInvalidCaseInsensitiveFS},
+	"ArchiveDirPath":       {archiveDirFlag, exitCodeArchiveDirError},
+	"OnlyTimestamp":        {onlyTimestampFlag, exitCodeInvalidTimestampFlags},
+	"PruneEmptyDirs":       {pruneEmptyDirsFlag, exitCodeInvalidPruneEmptyDirs},
+	"ModifyWindow":         {modifyWindowFlag, exitCodeInvalidModifyWindow},
+	"ConflictPolicy":       {conflictFlag, exitCodeInvalidConflict},
+	"TrashDirPath":         {trashDirFlag, exitCodeInvalidConflict},
+	"TempDirPath":          {tmpDirFlag, exitCodeInvalidTmpDir},
+	"CopyBandwidthLimit":   {bwLimitFlag, exitCodeInvalidBwLimit},
+}
+
+// exitIfInvalid exits, with exit code for the option that's invalid, if options that sidekick is run with aren't
+// valid (see sidekick.Options.Validate)
+func exitIfInvalid(opts sidekick.Options) {
+	err := opts.Validate()
+	if err == nil {
+		return
+	}
+	optionErr := sidekick.OptionError{Err: err}
+	errors.As(err, &optionErr)
+	option, isKnown := optionFlags[optionErr.Option]
+	if !isKnown {
+		option.exitCode = exitCodeSyncError
+	}
+	switch {
+	case errors.Is(err, sidekick.ErrSameDirectory):
+		fmte.PrintfErr("error: %+v\n", optionErr.Err)
+		option.exitCode = exitCodeSameSourceAndDestination
+	case errors.Is(err, sidekick.ErrNestedDirectories):
+		fmte.PrintfErr("error: %+v\n(run with --%s to allow this, with the inner directory excluded from scanning)\n",
+			optionErr.Err, allowNested)
+		option.exitCode = exitCodeNestedSourceAndDestination
+	case option.flag != "":
+		fmte.PrintfErr("error: %+v (see --%s)\n", optionErr.Err, option.flag)
+	default:
+		fmte.PrintfErr("error: %+v\n", optionErr.Err)
+	}
+	flag.Usage()
+	exit(option.exitCode)
 }
 
 func setupFlags() {
 	setupHelpOpt()
 	setupExclusionsOpt()
+	setupExcludeFromGitignoreOpt()
 	setupShellScriptOpt()
 	setupShellScriptWithNameOpt()
+	setupScriptFlavorOpt()
 	setupVerboseOpt()
+	setupNoClobberVerifyOpt()
+	setupSummaryThresholdOpt()
+	setupRepairOpt()
+	setupContentTypeOpts()
+	setupAfterSyncHookOpt()
+	setupRsyncOpts()
+	setupEncodingOpts()
+	setupAuditOpt()
+	setupScanOnlyOpt()
+	setupByExtensionOpt()
+	setupShowTreeOpt()
+	setupAllowNestedOpt()
+	setupSummaryJSONOpt()
+	setupScaledSamplingOpt()
+	setupHashModeOpt()
+	setupCaseInsensitiveFSOpt()
+	setupVerifyOpt()
+	setupChecksumOpt()
+	setupPermsOpt()
+	setupOwnerOpts()
+	setupMinSizeOpt()
+	setupMaxSizeOpt()
+	setupIncludeExtOpt()
+	setupIgnoreExtensionOpt()
+	setupSymlinksOpt()
+	setupOutputOpt()
+	setupStatsOpt()
+	setupExitCodeOnChangesOpt()
+	setupPlanOpts()
+	setupJournalOpt()
+	setupUnmatchedReportOpt()
+	setupReportExtraneousOpts()
+	setupThreadsOpt()
+	setupConfirmationOpts()
+	setupRetryOpts()
+	setupLogOpts()
+	setupLocaleOpts()
+	setupProgressFormatOpt()
+	setupArchiveDirOpt()
+	setupBwLimitOpt()
+	setupConflictOpts()
+	setupTmpDirOpt()
+	setupTimestampOpts()
+	setupDigestCacheOpt()
+	setupModifyWindowOpt()
+	setupTimestampModeOpts()
+	setupPairsOpts()
+	setupPruneEmptyDirsOpt()
+	setupRemoveDuplicatesOpt()
+	setupDirsTimestampsOpt()
+	setupTimeoutOpt()
 	setupGetListFilesDir()
+	setupNulSeparatedOpt()
 	setupShowVersion()
 	setupUsage()
 }
 
 func main() {
 	defer handlePanic()
+	defer fmte.Flush()
 	setupFlags()
 	flag.Parse()
+	if flags.isLogFormatJSON() {
+		fmte.JSONOn()
+	}
+	fmte.SetLevel(flags.logLevel())
+	if flags.isVerbose() {
+		fmte.VerboseOn()
+	}
+	locale := flags.locale()
+	fmte.SetLocale(locale)
+	bytesutil.SetFormat(flags.sizeFormat(), locale)
 	if flag.NArg() == 0 && flag.NFlag() == 0 {
 		fmte.Printf("error: no input directories passed\n")
 		flag.Usage()
-		os.Exit(exitCodeInvalidNumArgs)
+		exit(exitCodeInvalidNumArgs)
 	}
 	if flags.isHelp() {
 		showHelpAndExit()
 	}
 	if flags.showVersion() {
 		fmt.Println(applicationVersion)
-		os.Exit(exitCodeSuccess)
+		exit(exitCodeSuccess)
 	}
-	if flag.NArg() != 2 {
-		fmte.PrintfErr("error: two arguments expected: source directory path and destination directory path\n")
-		flag.Usage()
-		os.Exit(exitCodeInvalidNumArgs)
+	if flags.outputFormat() == outputFormatJSON {
+		// Standard output is reserved for the planned actions:
+		fmte.ToStdErr()
 	}
-	sourcePath, destinationPath := readSourceAndDestination()
-	// List
-	listFilesDir := flags.getListFilesDir()
-	if listFilesDir {
-		excludedFiles := flags.getExcludedFiles()
-		err := service.FindDirectoryResultToCsv(sourcePath, excludedFiles, os.Stdout)
-		if err == nil {
-			os.Exit(exitCodeSuccess)
-		} else {
-			fmte.PrintfErr("error while creating list: %+v", err)
-			os.Exit(exitCodeListFilesDirError)
+	applyPlanPath := flags.applyPlanPath()
+	if applyPlanPath != "" && flags.savePlanPath() != "" {
+		fmte.PrintfErr("error: flags --%s and --%s are both specified (you can only specify one of them)\n",
+			savePlanFlag, applyPlanFlag)
+		exit(exitCodeInvalidPlanFlags)
+	}
+	if flags.isScanOnly() && applyPlanPath != "" {
+		fmte.PrintfErr("error: flag --%s can't be used along with --%s (nothing is scanned then)\n", scanOnlyFlag,
+			applyPlanFlag)
+		exit(exitCodeInvalidScanOnly)
+	}
+	if flags.isScanOnly() && (flags.outputFormat() == outputFormatJSON || flags.isExitOnChanges()) {
+		fmte.PrintfErr("error: flag --%s can't be used along with --%s=%s or --%s (no sync actions are computed"+
+			" then)\n", scanOnlyFlag, outputFlag, outputFormatJSON, exitCodeOnChangesFlag)
+		exit(exitCodeInvalidScanOnly)
+	}
+	isNotApplied := flags.isShellScriptMode() || flags.scriptOutputPath() != "" || flags.savePlanPath() != "" ||
+		flags.isScanOnly()
+	if flags.isRunRsync() && isNotApplied {
+		fmte.PrintfErr("error: flag --%s can't be used along with --%s, --%s, --%s or --%s (sync actions aren't"+
+			" applied then)\n", runRsyncFlag, shellScript, shellScriptAtPath, savePlanFlag, scanOnlyFlag)
+		exit(exitCodeInvalidRsyncOpts)
+	}
+	if flags.isShowTree() && (!flags.isAudit() || applyPlanPath != "") {
+		fmte.PrintfErr("error: flag --%s can only be used along with --audit (and not with --%s, as destination isn't"+
+			" scanned then)\n", showTree, applyPlanFlag)
+		exit(exitCodeInvalidShowTree)
+	}
+	pairs := flags.pairs()
+	if len(pairs) > 0 {
+		if flag.NArg() != 0 || applyPlanPath != "" {
+			fmte.PrintfErr("error: no arguments (nor --%s) expected with flags --%s and --%s\n", applyPlanFlag,
+				pairFlag, pairsFileFlag)
+			flag.Usage()
+			exit(exitCodeInvalidNumArgs)
+		}
+		// These write to a single file, which many pairs would overwrite:
+		_, extraneousReportPath := flags.reportExtraneous()
+		if flags.savePlanPath() != "" || flags.outputFormat() == outputFormatJSON || flags.unmatchedReport() != "" ||
+			extraneousReportPath != "" || flags.isShellScriptMode() || flags.scriptOutputPath() != "" ||
+			flags.getListFilesDir() {
+			fmte.PrintfErr("error: flags --%s and --%s can't be used along with flags that write sync actions or "+
+				"lists of files (such as --%s, --%s or --%s)\n", pairFlag, pairsFileFlag, savePlanFlag, shellScript,
+				shellScriptAtPath)
+			exit(exitCodeInvalidPairs)
 		}
+	} else if applyPlanPath != "" && flag.NArg() != 0 {
+		fmte.PrintfErr("error: no arguments expected with flag --%s (source and destination are in the plan)\n",
+			applyPlanFlag)
+		flag.Usage()
+		exit(exitCodeInvalidNumArgs)
+	} else if applyPlanPath == "" && flag.NArg() != 2 {
+		fmte.PrintfErr("error: two arguments expected: source directory path and destination directory path\n")
+		flag.Usage()
+		exit(exitCodeInvalidNumArgs)
 	}
 	if flags.isShellScriptMode() && flags.scriptOutputPath() != "" {
 		fmte.PrintfErr("error: flags --%s and --%s are both specified (you can only specify one of them)", shellScript, shellScriptAtPath)
-		os.Exit(exitCodeScriptPathError)
+		exit(exitCodeScriptPathError)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleInterrupts(cancel)
+	timeout := flags.timeout()
+	if timeout > 0 {
+		var cancelOnTimeout context.CancelFunc
+		ctx, cancelOnTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelOnTimeout()
 	}
 
+	owner, group := flags.ownership()
+	conflictPolicy, trashDirPath := flags.conflictPolicy()
 	runID := time.Now().Format("150405")
-
+	actionSettings := action.Settings{
+		ConflictPolicy:     conflictPolicy,
+		TrashDirPath:       trashDirPath,
+		TempDirPath:        flags.tmpDirPath(),
+		TempPrefix:         runID,
+		CopyBandwidthLimit: flags.bwLimit(),
+		NoClobberVerify:    flags.isNoClobberVerify(),
+		PreserveAccessTime: flags.isPreserveAtime(),
+	}
+	scriptFlavor := flags.scriptFlavor()
 	var scriptOutputPath string
 	if flags.isShellScriptMode() {
-		scriptOutputPath = fmt.Sprintf("./sync_actions_%s.sh", runID)
+		scriptOutputPath = fmt.Sprintf("./sync_actions_%s%s", runID, action.ScriptExtensions[scriptFlavor])
 	} else if flags.scriptOutputPath() != "" {
 		scriptOutputPath = flags.scriptOutputPath()
 	}
+	noTimestamp, onlyTimestamp := flags.timestampMode()
+	includedContentTypes, excludedContentTypes := flags.getContentTypes()
+	reportExtraneous, extraneousReportPath := flags.reportExtraneous()
+	options := runOptions{
+		outputScriptPath: scriptOutputPath,
+		scriptFlavor:     scriptFlavor,
+		verbose:          flags.isVerbose(),
+		progressFormat:   flags.progressFormat(),
+		summaryThreshold: flags.summaryThreshold(),
+		syncOptions: service.SyncOptions{
+			Repair:               flags.isRepair(),
+			IncludedContentTypes: includedContentTypes,
+			ExcludedContentTypes: excludedContentTypes,
+			PathNormalizer:       flags.getPathNormalizer(),
+			Verify:               flags.isVerify(),
+			Checksum:             flags.isChecksum(),
+			Permissions:          flags.isPerms(),
+			Owner:                owner,
+			Group:                group,
+			MinSize:              flags.minSize(),
+			MaxSize:              flags.maxSize(),
+			IncludedExtensions:   flags.includedExts(),
+			IgnoreExtension:      flags.isIgnoreExtension(),
+			Symlinks:             flags.isSymlinks(),
+			IgnoreRules:          flags.getIgnoreRules(),
+			CaseInsensitiveFS:    flags.caseInsensitiveFS(),
+			Threads:              flags.threads(),
+			ArchiveDirPath:       flags.archiveDirPath(),
+			NanosecondPrecision:  flags.isNanoseconds(),
+			ModifyWindow:         flags.modifyWindow(),
+			NoTimestamp:          noTimestamp,
+			OnlyTimestamp:        onlyTimestamp,
+			PruneEmptyDirs:       flags.pruneEmptyDirs(),
+			RemoveDuplicates:     flags.isRemoveDups(),
+			DirTimestamps:        flags.isDirsTimestamps(),
+			Digest: service.DigestOptions{
+				HashMode:       flags.hashMode(),
+				ScaledSampling: flags.isScaledSampling(),
+			},
+		},
+		afterSyncHook:        flags.afterSyncHook(),
+		rsyncArgs:            flags.rsyncArgs(),
+		audit:                flags.isAudit(),
+		scanOnly:             flags.isScanOnly(),
+		byExtension:          flags.byExtension(),
+		allowNested:          flags.isAllowNested(),
+		showTree:             flags.isShowTree(),
+		summaryJSONPath:      flags.summaryJSONPath(),
+		outputFormat:         flags.outputFormat(),
+		savePlanPath:         flags.savePlanPath(),
+		unmatchedReportPath:  flags.unmatchedReport(),
+		reportExtraneous:     reportExtraneous,
+		extraneousReportPath: extraneousReportPath,
+		retryPolicy:          flags.retryPolicy(),
+		actionSettings:       actionSettings,
+		stats:                flags.isStats(),
+		journalPath:          flags.journalPath(),
+		maxActions:           flags.maxActions(),
+		confirm:              flags.isConfirm(),
+		assumeYes:            flags.isAssumeYes(),
+	}
+
+	// Pairs of directories synced by this run (with --apply-plan, the ones in the plan):
+	targets := pairs
+	if applyPlanPath != "" {
+		planSourcePath, planDestinationPath, _, err := loadPlan(applyPlanPath, actionSettings.TempDirPath)
+		if err != nil {
+			fmte.PrintfErr("error: %+v\n", err)
+			exit(exitCodeSyncError)
+		}
+		targets = []dirPair{{source: planSourcePath, destination: planDestinationPath}}
+	} else if len(pairs) == 0 {
+		targets = []dirPair{{source: flag.Arg(0), destination: flag.Arg(1)}}
+	}
+	exclusions := flags.getExcludedFiles()
+	for i := range targets {
+		if applyPlanPath == "" {
+			targets[i] = resolvePair(targets[i])
+		}
+		exitIfInvalid(options.planOptions(ctx, runID, targets[i].source, exclusions, targets[i].destination))
+	}
+	if scriptOutputPath != "" && conflictPolicy != action.ConflictSkip {
+		fmte.PrintfErr("error: scripts never move files that are in the way of file moves (--conflict=%s is only for "+
+			"sync actions performed by this tool)\n", conflictPolicy)
+		exit(exitCodeInvalidConflict)
+	}
+
+	// List
+	if flags.getListFilesDir() && applyPlanPath == "" {
+		err := service.FindDirectoryResultToCsv(ctx, targets[0].source, exclusions, os.Stdout, service.ListOptions{
+			NulSeparated: flags.isNulSeparated(),
+			WithDigest:   flags.isListWithDigest(),
+			Header:       flags.isListHeader(),
+			Digest:       options.syncOptions.Digest,
+			Threads:      options.syncOptions.Threads,
+		})
+		if err == nil {
+			exit(exitCodeSuccess)
+		} else {
+			exitIfStopped(ctx, timeout)
+			fmte.PrintfErr("error while creating list: %+v", err)
+			exit(exitCodeListFilesDirError)
+		}
+	}
 
-	syncErr := rsyncSidekick(runID, sourcePath, flags.getExcludedFiles(), destinationPath,
-		scriptOutputPath, flags.isVerbose())
-	if syncErr != nil {
+	if flags.isNumericIDs() {
+		action.NumericIDsOn()
+	}
+	if digestCachePath := flags.digestCachePath(); digestCachePath != "" {
+		digestCache, cacheErr := service.LoadDigestCache(digestCachePath)
+		if cacheErr != nil {
+			fmte.PrintfErr("error: %+v\n", cacheErr)
+			exit(exitCodeDigestCacheError)
+		}
+		options.syncOptions.DigestCache = digestCache
+	}
+	if flags.isRunRsync() {
+		options.rsyncPath = findRsync()
+	}
+	if err := resumeJournal(ctx, targets, options); err != nil {
+		exitIfStopped(ctx, timeout)
+		fmte.PrintfErr("error while resuming sync actions from journal: %+v\n", err)
+		exit(exitCodeSyncError)
+	}
+	var summary runSummary
+	var syncErr error
+	if applyPlanPath != "" {
+		summary, syncErr = applyPlan(ctx, runID, applyPlanPath, options)
+	} else if len(pairs) > 0 {
+		summary, syncErr = rsyncSidekickPairs(ctx, runID, targets, exclusions, options)
+	} else {
+		summary, syncErr = rsyncSidekick(ctx, runID, targets[0].source, exclusions, targets[0].destination, options)
+	}
+	// A run that completed, even if just as it timed out, exits as such:
+	if summary.Interrupted || syncErr != nil {
+		exitIfStopped(ctx, timeout)
+	}
+	var hookErr afterSyncHookError
+	var rsyncErr rsyncError
+	if errors.As(syncErr, &hookErr) {
+		fmte.PrintfErr("error: %+v\n", syncErr)
+		exit(exitCodeAfterSyncHookError)
+	} else if errors.As(syncErr, &rsyncErr) {
+		fmte.PrintfErr("error: %+v\n", syncErr)
+		exit(rsyncErr.exitCode)
+	} else if syncErr != nil {
 		fmte.PrintfErr("error while syncing: %+v\n", syncErr)
-		os.Exit(exitCodeSyncError)
+		exit(exitCodeSyncError)
+	}
+	if flags.isExitOnChanges() && summary.NumActions > 0 {
+		exit(exitCodeChanges)
 	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/m-manu/rsync-sidekick/sidekick"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	baseDir, resolveErr := filepath.EvalSymlinks(t.TempDir())
+	stopIfError(t, resolveErr)
+	realDir := filepath.Join(baseDir, "real")
+	createDirectory(filepath.Join(realDir, "sub"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(realDir, "sub", "file.txt"))
+	linkToDir := filepath.Join(baseDir, "link")
+	stopIfError(t, os.Symlink(realDir, linkToDir))
+	// Symbolic link to a directory resolves to the directory:
+	resolvedLink := resolvePath(linkToDir)
+	assert.Equal(t, realDir, resolvedLink)
+	assert.Equal(t, resolvePath(realDir), resolvedLink) // i.e. these would be rejected as same source and destination
+	// Relative paths are computed relative to resolved path:
+	files, _, err := service.FindFilesFromDirectory(context.Background(), resolvedLink,
+		set.NewThreadUnsafeSet[string]())
+	assert.NoError(t, err)
+	assert.Contains(t, files, filepath.Join("sub", "file.txt"))
+	// Paths that can't be resolved are left for validation to report:
+	nonExistent := filepath.Join(baseDir, "non_existent")
+	assert.Equal(t, nonExistent, resolvePath(nonExistent))
+	assert.Error(t, sidekick.Options{SourceDirPath: nonExistent, DestinationDirPath: realDir}.Validate())
+}
+
+func TestNestedDirectoriesAreExcluded(t *testing.T) {
+	fmte.Off()
+	version := filepath.Join(runtime.GOROOT(), "VERSION")
+	// Destination inside source:
+	sourceDir := t.TempDir()
+	destinationDir := filepath.Join(sourceDir, "backup")
+	createDirectory(destinationDir)
+	copyFile(version, filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(version, filepath.Join(destinationDir, "original.txt"))
+	actions, _, err := getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{action.MoveFileAction{BasePath: destinationDir,
+		RelativeFromPath: "original.txt", RelativeToPath: "renamed.txt"}}, actions)
+	// Source inside destination:
+	destinationDir = t.TempDir()
+	sourceDir = filepath.Join(destinationDir, "photos")
+	createDirectory(sourceDir)
+	copyFile(version, filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(version, filepath.Join(destinationDir, "original.txt"))
+	actions, _, err = getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{action.MoveFileAction{BasePath: destinationDir,
+		RelativeFromPath: "original.txt", RelativeToPath: "renamed.txt"}}, actions)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+	"strings"
+)
+
+// dirPair is a source directory and a destination directory to be synced, one of many in a run (see --pair)
+type dirPair struct {
+	source      string
+	destination string
+}
+
+// isDriveLetterColon checks whether colon at given index of text follows a drive letter at beginning of a path (as
+// in "C:\photos")
+func isDriveLetterColon(text string, index int) bool {
+	if index < 1 || index+1 >= len(text) || (text[index+1] != '\\' && text[index+1] != '/') {
+		return false
+	}
+	letter := text[index-1]
+	isLetter := ('a' <= letter && letter <= 'z') || ('A' <= letter && letter <= 'Z')
+	return isLetter && (index == 1 || text[index-2] == ':')
+}
+
+// parsePair parses a pair of directories written as "source:destination" (a colon after a drive letter isn't a
+// separator, so "C:\photos:D:\photos" is a valid pair too)
+func parsePair(text string) (dirPair, error) {
+	separatorIndex := -1
+	for i := 0; i < len(text); i++ {
+		if text[i] != ':' || isDriveLetterColon(text, i) {
+			continue
+		}
+		if separatorIndex >= 0 {
+			return dirPair{}, fmt.Errorf("pair \"%s\" has more than one ':' separating source and destination", text)
+		}
+		separatorIndex = i
+	}
+	if separatorIndex <= 0 || separatorIndex == len(text)-1 {
+		return dirPair{}, fmt.Errorf("pair \"%s\" is not of the form source:destination", text)
+	}
+	return dirPair{source: text[:separatorIndex], destination: text[separatorIndex+1:]}, nil
+}
+
+// readPairsFile reads pairs of directories from a file, one pair per line as in parsePair (blank lines and lines
+// starting with '#' are ignored)
+func readPairsFile(path string) ([]dirPair, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return nil, fmt.Errorf("couldn't open file \"%s\": %+v", path, openErr)
+	}
+	defer file.Close()
+	var pairs []dirPair
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pair, pErr := parsePair(line)
+		if pErr != nil {
+			return nil, fmt.Errorf("line %d of file \"%s\": %+v", lineNumber, path, pErr)
+		}
+		pairs = append(pairs, pair)
+	}
+	if sErr := scanner.Err(); sErr != nil {
+		return nil, fmt.Errorf("couldn't read file \"%s\": %+v", path, sErr)
+	}
+	return pairs, nil
+}
+
+// rsyncSidekickPairs syncs each pair of directories, one after another (a failure with one pair doesn't stop the
+// others, though an interruption does), and summarizes all of them together
+func rsyncSidekickPairs(ctx context.Context, runID string, pairs []dirPair, exclusions set.Set[string],
+	options runOptions) (runSummary, error) {
+	summaries := make([]runSummary, 0, len(pairs))
+	var errs []error
+	for i, pair := range pairs {
+		if ctx.Err() != nil {
+			fmte.Printf("Skipping remaining %d pairs, as the run was interrupted\n", len(pairs)-i)
+			break
+		}
+		fmte.Printf("Syncing pair %d of %d: \"%s\" to \"%s\"...\n", i+1, len(pairs), pair.source, pair.destination)
+		summary, err := syncDirectories(ctx, runID, pair.source, exclusions, pair.destination, options)
+		if err != nil {
+			fmte.PrintfErr("error while syncing \"%s\" to \"%s\": %+v\n", pair.source, pair.destination, err)
+			summary.Errors = append(summary.Errors, err.Error())
+			errs = append(errs, fmt.Errorf("\"%s\" to \"%s\": %w", pair.source, pair.destination, err))
+		}
+		summaries = append(summaries, summary)
+	}
+	total := combineSummaries(summaries)
+	total.Interrupted = ctx.Err() != nil
+	fmte.Printf("Across %d pairs: %d actions, saving %s of files transfer (rsync will still transfer %s)\n",
+		len(pairs), total.NumActions, bytesutil.Format(total.BytesSaved+total.BytesCopiedLocally),
+		bytesutil.Format(total.ResidualBytes))
+	var err error
+	if len(errs) > 0 {
+		err = fmte.Errors(fmt.Sprintf("%d out of %d pairs failed", len(errs), len(pairs)), errs)
+	}
+	return total, finishRun(total, err, options)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParsePair(t *testing.T) {
+	for text, expected := range map[string]dirPair{
+		"/photos:/backup/photos":    {source: "/photos", destination: "/backup/photos"},
+		"photos:backup":             {source: "photos", destination: "backup"},
+		`C:\photos:D:\photos`:       {source: `C:\photos`, destination: `D:\photos`},
+		`C:\photos:/mnt/d/photos`:   {source: `C:\photos`, destination: "/mnt/d/photos"},
+		"/photos:C:/backup/photos":  {source: "/photos", destination: "C:/backup/photos"},
+		"/photos":                   {},
+		"/photos:":                  {},
+		":/photos":                  {},
+		`C:\photos`:                 {},
+		"/photos:/backup:/archives": {},
+	} {
+		pair, err := parsePair(text)
+		if expected == (dirPair{}) {
+			assert.Error(t, err, text)
+		} else {
+			assert.NoError(t, err, text)
+			assert.Equal(t, expected, pair, text)
+		}
+	}
+}
+
+func TestReadPairsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pairs.txt")
+	stopIfError(t, os.WriteFile(path, []byte("# photos and music\n/photos:/backup/photos\n\n  /music:/backup/music\n"),
+		0644))
+	pairs, err := readPairsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []dirPair{{source: "/photos", destination: "/backup/photos"},
+		{source: "/music", destination: "/backup/music"}}, pairs)
+	stopIfError(t, os.WriteFile(path, []byte("/photos:/backup/photos\n/music\n"), 0644))
+	_, err = readPairsFile(path)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestRsyncSidekickPairs(t *testing.T) {
+	fmte.Off()
+	outDir := t.TempDir()
+	pairs := []dirPair{{source: t.TempDir(), destination: t.TempDir()}, {source: t.TempDir(), destination: t.TempDir()}}
+	for _, pair := range pairs {
+		copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(pair.source, "renamed.txt"))
+		copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(pair.destination, "original.txt"))
+	}
+	summaryPath := filepath.Join(outDir, "summary.json")
+	_, err := rsyncSidekickPairs(context.Background(), runID, pairs, exclusionsForTests,
+		runOptions{summaryJSONPath: summaryPath})
+	assert.NoError(t, err)
+	for _, pair := range pairs {
+		assert.FileExists(t, filepath.Join(pair.destination, "renamed.txt"))
+	}
+	summary := readSummaryJSON(t, summaryPath)
+	assert.Equal(t, modeApply, summary.Mode)
+	assert.Equal(t, 2, summary.NumActions)
+	assert.Equal(t, 2, summary.NumSucceeded)
+	assert.Equal(t, map[string]int{"MoveFileAction": 2}, summary.ActionCountsByType)
+	assert.Equal(t, 2, len(summary.Pairs))
+	assert.Equal(t, pairs[1].source, summary.Pairs[1].SourceDirPath)
+	assert.Equal(t, summary.Pairs[0].BytesSaved+summary.Pairs[1].BytesSaved, summary.BytesSaved)
+	// A failure with one pair doesn't stop the others:
+	failing := []dirPair{{source: filepath.Join(outDir, "non_existent"), destination: t.TempDir()}, pairs[0]}
+	_, err = rsyncSidekickPairs(context.Background(), runID, failing, exclusionsForTests,
+		runOptions{summaryJSONPath: summaryPath})
+	assert.ErrorContains(t, err, "1 out of 2 pairs failed")
+	summary = readSummaryJSON(t, summaryPath)
+	assert.Equal(t, 1, len(summary.Pairs[0].Errors))
+	assert.Equal(t, 0, len(summary.Pairs[1].Errors))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/action"
+	"io"
+	"os"
+)
+
+// Output formats of planned sync actions (see --output)
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var outputFormats = []string{outputFormatText, outputFormatJSON}
+
+// writePlanJSON writes sync actions, in the order they'd be performed (as per given settings), as a JSON array of
+// action.Spec
+func writePlanJSON(actions []action.SyncAction, settings action.Settings, w io.Writer) error {
+	data, mErr := json.MarshalIndent(action.Specs(action.SortByDependencies(actions, settings)), "", "  ")
+	if mErr != nil {
+		return fmt.Errorf("couldn't convert actions to JSON: %+v", mErr)
+	}
+	if _, wErr := w.Write(append(data, '\n')); wErr != nil {
+		return fmt.Errorf("couldn't write actions as JSON: %+v", wErr)
+	}
+	return nil
+}
+
+// plan is a list of sync actions between a source and a destination, saved to be performed later (see --save-plan)
+type plan struct {
+	SourceDirPath      string        `json:"source"`
+	DestinationDirPath string        `json:"destination"`
+	Actions            []action.Spec `json:"actions"`
+}
+
+// savePlan writes sync actions, in the order they'd be performed (as per given settings), to a file
+func savePlan(actions []action.SyncAction, sourceDirPath string, destinationDirPath string, path string,
+	settings action.Settings) error {
+	data, mErr := json.MarshalIndent(plan{
+		SourceDirPath:      sourceDirPath,
+		DestinationDirPath: destinationDirPath,
+		Actions:            action.Specs(action.SortByDependencies(actions, settings)),
+	}, "", "  ")
+	if mErr != nil {
+		return fmt.Errorf("couldn't convert plan to JSON: %+v", mErr)
+	}
+	if wErr := os.WriteFile(path, append(data, '\n'), 0644); wErr != nil {
+		return fmt.Errorf("couldn't write plan to file '%s': %+v", path, wErr)
+	}
+	return nil
+}
+
+// loadPlan reads a plan saved by savePlan and re-creates its sync actions (moves aside into temporary directory are
+// re-created as long as they're into given one)
+func loadPlan(path string, tempDirPath string) (sourceDirPath string, destinationDirPath string,
+	actions []action.SyncAction, err error) {
+	data, rErr := os.ReadFile(path)
+	if rErr != nil {
+		return "", "", nil, fmt.Errorf("couldn't read plan from file '%s': %+v", path, rErr)
+	}
+	var p plan
+	if uErr := json.Unmarshal(data, &p); uErr != nil {
+		return "", "", nil, fmt.Errorf("couldn't parse plan in file '%s': %+v", path, uErr)
+	}
+	if p.SourceDirPath == "" || p.DestinationDirPath == "" {
+		return "", "", nil, fmt.Errorf("plan in file '%s' doesn't have source and destination", path)
+	}
+	actions = make([]action.SyncAction, 0, len(p.Actions))
+	for i, spec := range p.Actions {
+		a, sErr := action.FromSpec(spec, p.SourceDirPath, p.DestinationDirPath, tempDirPath)
+		if sErr != nil {
+			return "", "", nil, fmt.Errorf("invalid action #%d in plan in file '%s': %+v", i+1, path, sErr)
+		}
+		actions = append(actions, a)
+	}
+	return p.SourceDirPath, p.DestinationDirPath, actions, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWritePlanJSON(t *testing.T) {
+	baseDir := t.TempDir()
+	var buffer bytes.Buffer
+	stopIfError(t, writePlanJSON([]action.SyncAction{
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "dir/a.txt"},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(baseDir, "dir")},
+	}, action.Settings{}, &buffer))
+	var specs []map[string]any
+	stopIfError(t, json.Unmarshal(buffer.Bytes(), &specs))
+	// Actions are in the order they'd be performed:
+	assert.Equal(t, []map[string]any{
+		{"type": "mkdir", "to": filepath.Join(baseDir, "dir"), "bytes_saved": 0.0},
+		{"type": "move", "from": filepath.Join(baseDir, "a.txt"), "to": filepath.Join(baseDir, "dir", "a.txt"),
+			"bytes_saved": 0.0},
+	}, specs)
+	buffer.Reset()
+	stopIfError(t, writePlanJSON([]action.SyncAction{}, action.Settings{}, &buffer))
+	assert.Equal(t, "[]\n", buffer.String())
+}
+
+func TestSaveAndApplyPlan(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	version, io := filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(runtime.GOROOT(), "src/io/io.go")
+	copyFile(version, filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(version, filepath.Join(destinationDir, "original.txt"))
+	copyFile(io, filepath.Join(sourceDir, "renamed.go"))
+	copyFile(io, filepath.Join(destinationDir, "original.go"))
+	planPath := filepath.Join(outDir, "plan.json")
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		savePlanPath: planPath,
+	})
+	stopIfError(t, err)
+	// Nothing is changed while saving a plan:
+	assert.FileExists(t, filepath.Join(destinationDir, "original.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "original.go"))
+	// Something changes at destination, before the plan is applied:
+	copyFile(version, filepath.Join(destinationDir, "renamed.go"))
+	summaryPath := filepath.Join(outDir, "summary.json")
+	_, err = applyPlan(context.Background(), runID, planPath, runOptions{summaryJSONPath: summaryPath})
+	stopIfError(t, err)
+	assert.FileExists(t, filepath.Join(destinationDir, "renamed.txt"))
+	assert.NoFileExists(t, filepath.Join(destinationDir, "original.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "original.go")) // skipped, as target exists
+	summary := readSummaryJSON(t, summaryPath)
+	assert.Equal(t, 1, summary.NumSucceeded)
+	assert.Equal(t, 1, summary.NumSkipped)
+	assert.Equal(t, 0, summary.NumFailed)
+	// Invalid plans are rejected:
+	_, _, _, err = loadPlan(filepath.Join(outDir, "non_existent.json"), "")
+	assert.Error(t, err)
+	stopIfError(t, os.WriteFile(planPath, []byte(`{"source": "/src", "destination": "/dst", "actions": [
+		{"type": "move", "from": "/etc/passwd", "to": "/dst/passwd"}]}`), 0644))
+	_, _, _, err = loadPlan(planPath, "")
+	assert.Error(t, err)
+}
@@ -1,155 +1,354 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/rsync-sidekick/action"
-	"github.com/m-manu/rsync-sidekick/bytesutil"
-	"github.com/m-manu/rsync-sidekick/entity"
 	"github.com/m-manu/rsync-sidekick/fmte"
 	"github.com/m-manu/rsync-sidekick/lib"
 	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/m-manu/rsync-sidekick/sidekick"
 	"os"
-	"sort"
 	"strings"
-	"sync"
-	"sync/atomic"
-	"time"
 )
 
 const unixCommandLengthGuess = 200
 
-func getSyncActionsWithProgress(runID string, sourceDirPath string, exclusions set.Set[string],
-	destinationDirPath string, verbose bool) ([]action.SyncAction, error) {
-	if verbose {
-		fmte.VerboseOn()
-	}
-	var start, end time.Time
-	fmte.Printf("Scanning source (%s) and destination (%s) directories...\n", sourceDirPath, destinationDirPath)
-	start = time.Now()
-	var sourceFiles, destinationFiles map[string]entity.FileMeta
-	var sourceSize, destinationSize int64
-	var sourceFilesErr, destinationFilesErr error
-	var wgDirScan sync.WaitGroup
-	wgDirScan.Add(2)
-	go func() {
-		defer wgDirScan.Done()
-		sourceFiles, sourceSize, sourceFilesErr = service.FindFilesFromDirectory(sourceDirPath, exclusions)
-	}()
-	go func() {
-		defer wgDirScan.Done()
-		destinationFiles, destinationSize, destinationFilesErr = service.FindFilesFromDirectory(destinationDirPath, exclusions)
-	}()
-	wgDirScan.Wait()
-	end = time.Now()
-	if sourceFilesErr != nil {
-		return nil, fmt.Errorf("error scanning source directory: %+v", sourceFilesErr)
-	}
-	if destinationFilesErr != nil {
-		return nil, fmt.Errorf("error scanning destination directory: %+v", destinationFilesErr)
-	}
-	fmte.Printf("Found %d files (total size %s) at source and %d files (total size %s) at destination in %.1fs\n",
-		len(sourceFiles), bytesutil.BinaryFormat(sourceSize), len(destinationFiles),
-		bytesutil.BinaryFormat(destinationSize), end.Sub(start).Seconds())
-	fmte.Printf("Finding files at source that don't have counterparts at destination...\n")
-	orphansAtSource := service.FindOrphans(sourceFiles, destinationFiles)
-	if len(orphansAtSource) == 0 {
-		fmte.Printf("All files at source directory have counterparts. So, no action needed 🙂!\n")
-		return []action.SyncAction{}, nil
-	}
-	sort.Strings(orphansAtSource)
-	fmte.Printf("Found %d files\n", len(orphansAtSource))
-	if verbose {
-		lib.WriteSliceToFile(orphansAtSource, fmt.Sprintf("./info_%s_orphans_at_source.txt", runID))
-	}
-	fmte.Printf("Finding candidates at destination...\n")
-	candidatesAtDestination := findCandidatesAtDestination(sourceFiles, destinationFiles, orphansAtSource)
-	if len(candidatesAtDestination) == 0 {
-		fmte.Printf("No candidates found. Looks like all %d files are new. rsync will do the rest.\n", len(orphansAtSource))
-		return []action.SyncAction{}, nil
-	}
-	sort.Strings(candidatesAtDestination)
-	if verbose {
-		lib.WriteSliceToFile(candidatesAtDestination,
-			fmt.Sprintf("./info_%s_candidates_at_destination.txt", runID),
-		)
-	}
-	fmte.Printf("Found %d candidates.\n", len(candidatesAtDestination))
-	fmte.Printf("Identifying file renames/movements and timestamp changes...\n")
-	start = time.Now()
-	var actions []action.SyncAction
-	var savings int64
-	var syncErr error
-	var sourceCounter, destinationCounter int32
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		actions, savings, syncErr = service.ComputeSyncActions(sourceDirPath, sourceFiles, orphansAtSource,
-			destinationDirPath, destinationFiles, candidatesAtDestination, &sourceCounter, &destinationCounter)
-	}()
-	go func() {
-		defer wg.Done()
-		reportProgress(&sourceCounter, int32(len(orphansAtSource)),
-			&destinationCounter, int32(len(candidatesAtDestination)),
-		)
-	}()
-	wg.Wait()
-	end = time.Now()
-	if syncErr != nil {
-		return nil, fmt.Errorf("error while computing sync actions: %+v", syncErr)
-	}
-	fmte.Printf("Completed in %.1fs\n", end.Sub(start).Seconds())
-	if len(actions) == 0 {
-		fmte.Printf("No sync actions found. You may run rsync.\n")
-		return []action.SyncAction{}, nil
-	}
-	fmte.Printf("Found %d actions that can save you %s of files transfer!\n",
-		len(actions), bytesutil.BinaryFormat(savings))
-	return actions, nil
+// getSyncActionsWithProgress computes sync actions (see sidekick.Plan), while reporting progress and, as per options,
+// composition of files by extension (this stops early, with an error, once ctx is done)
+func getSyncActionsWithProgress(ctx context.Context, runID string, sourceDirPath string,
+	exclusions set.Set[string], destinationDirPath string, options runOptions,
+) ([]action.SyncAction, runSummary, error) {
+	actions, stats, err := sidekick.PlanWithStats(options.planOptions(ctx, runID, sourceDirPath, exclusions,
+		destinationDirPath))
+	summary := newRunSummary(sourceDirPath, destinationDirPath)
+	summary.setStats(stats)
+	if cache := options.syncOptions.DigestCache; cache != nil {
+		fmte.Printf("Digests of %d files were served from cache (%d computed afresh)\n", cache.NumHits,
+			cache.NumMisses)
+		if saveErr := cache.Save(); saveErr != nil {
+			fmte.Warnf("%+v\n", saveErr)
+		}
+	}
+	if err != nil {
+		return nil, summary, err
+	}
+	summary.NumActions = len(actions)
+	for _, a := range actions {
+		summary.ActionCountsByType[action.TypeName(a)]++
+	}
+	return actions, summary, nil
+}
+
+// runOptions decide what rsyncSidekick does, once sync actions are found
+type runOptions struct {
+	// outputScriptPath, if set, is where a shell script of sync actions is written instead of applying them
+	outputScriptPath string
+	// scriptFlavor is what kind of script is written to outputScriptPath (one of action.ScriptFlavors)
+	scriptFlavor string
+	verbose      bool
+	// progressFormat is how progress of indexing of files is shown (one of sidekick.ProgressFormats)
+	progressFormat string
+	// byExtension, if positive, is number of extensions (the largest ones by total size) for which number and total
+	// size of files are reported
+	byExtension int
+	// allowNested allows destination directory to be inside source directory, or the other way round (see
+	// sidekick.Options.AllowNested)
+	allowNested bool
+	// summaryThreshold is number of actions beyond which only a summary is printed while applying them
+	summaryThreshold int
+	syncOptions      service.SyncOptions
+	// afterSyncHook is a command to run after sync actions are applied
+	afterSyncHook string
+	// rsyncPath, if set, is path of rsync, which is run after sync actions are applied (see runRsync)
+	rsyncPath string
+	// rsyncArgs are arguments rsync is run with, besides the default ones (see rsyncCommandArgs)
+	rsyncArgs []string
+	// audit, if set, only reports sync actions, guaranteeing nothing is written
+	audit bool
+	// scanOnly, if set, only scans directories and estimates what sync actions would save, without computing them
+	// (see scanDirectories)
+	scanOnly bool
+	// summaryJSONPath, if set, is where summary of the run is written as JSON
+	summaryJSONPath string
+	// outputFormat is one of outputFormats: in outputFormatJSON, planned actions are written to stdout as JSON
+	outputFormat string
+	// savePlanPath, if set, is where sync actions are saved (to be applied later) instead of applying them
+	savePlanPath string
+	// unmatchedReportPath, if set, is where list of files at source that no sync action takes care of is written
+	unmatchedReportPath string
+	// showTree, in audit mode, also shows how the destination tree would change (see treeDiff)
+	showTree bool
+	// reportExtraneous lists files at destination that don't exist at source (see reportExtraneous)
+	reportExtraneous bool
+	// extraneousReportPath, if set, is where list of files at destination that don't exist at source is written
+	extraneousReportPath string
+	// retryPolicy decides how actions that fail due to transient errors are retried
+	retryPolicy action.RetryPolicy
+	// checkPreconditions skips actions whose preconditions don't hold anymore, instead of attempting them
+	checkPreconditions bool
+	// actionSettings decide how sync actions are performed, e.g. what a file move does when another file is in its
+	// way (see sidekick.Options.Settings)
+	actionSettings action.Settings
+	// journalPath, if set, is where progress of sync actions being applied is recorded, so that a run that doesn't
+	// complete is resumed by the next one (see resumeJournal)
+	journalPath string
+	// maxActions, if positive, is the number of sync actions beyond which they're performed only if the user says so
+	// (see checkMaxActions)
+	maxActions int
+	// confirm asks the user to confirm sync actions before they're performed (see confirmActions)
+	confirm bool
+	// assumeYes performs sync actions without asking
+	assumeYes bool
+	// stats, if set, writes discrete counts of the run to standard error at the end (see writeStats)
+	stats bool
+}
+
+// planOptions returns options that sync actions from source directory to destination directory are computed with
+// (see sidekick.Plan), which are also what are checked before the run (see sidekick.Options.Validate)
+func (options runOptions) planOptions(ctx context.Context, runID string, sourceDirPath string,
+	exclusions set.Set[string], destinationDirPath string) sidekick.Options {
+	return sidekick.Options{
+		SourceDirPath:      sourceDirPath,
+		DestinationDirPath: destinationDirPath,
+		Exclusions:         exclusions,
+		Verbose:            options.verbose,
+		RunID:              runID,
+		ProgressFormat:     options.progressFormat,
+		ByExtension:        options.byExtension,
+		ScanOnly:           options.scanOnly,
+		AllowNested:        options.allowNested,
+		Context:            ctx,
+		SyncOptions:        options.syncOptions,
+		Settings:           options.actionSettings,
+	}
+}
+
+// rsyncSidekick syncs source directory to destination directory and returns summary of the run
+func rsyncSidekick(ctx context.Context, runID string, sourceDirPath string, exclusions set.Set[string],
+	destinationDirPath string, options runOptions) (runSummary, error) {
+	summary, err := syncDirectories(ctx, runID, sourceDirPath, exclusions, destinationDirPath, options)
+	return summary, finishRun(summary, err, options)
+}
+
+// syncDirectories computes sync actions from source to destination and performs (or reports, as per options) them
+func syncDirectories(ctx context.Context, runID string, sourceDirPath string, exclusions set.Set[string],
+	destinationDirPath string, options runOptions) (runSummary, error) {
+	if options.scanOnly {
+		return scanDirectories(ctx, runID, sourceDirPath, exclusions, destinationDirPath, options)
+	}
+	actions, summary, err := getSyncActionsWithProgress(ctx, runID, sourceDirPath, exclusions, destinationDirPath,
+		options)
+	if err == nil && options.outputFormat == outputFormatJSON {
+		err = writePlanJSON(actions, options.actionSettings, os.Stdout)
+	}
+	isComputed := err == nil
+	err = performOrReportActions(ctx, runID, actions, err, &summary, sourceDirPath, destinationDirPath, options)
+	if isComputed {
+		if rErr := reportUnmatchedOrphans(summary, options.unmatchedReportPath); rErr != nil && err == nil {
+			err = rErr
+		}
+		if options.reportExtraneous || options.extraneousReportPath != "" {
+			rErr := reportExtraneous(summary, actions, options.reportExtraneous, options.extraneousReportPath)
+			if rErr != nil && err == nil {
+				err = rErr
+			}
+		}
+	}
+	return summary, err
 }
 
-func rsyncSidekick(runID string, sourceDirPath string, exclusions set.Set[string], destinationDirPath string,
-	outputScriptPath string, verbose bool) error {
-	actions, err := getSyncActionsWithProgress(runID, sourceDirPath, exclusions, destinationDirPath, verbose)
+// scanDirectories scans source and destination and reports how many files at source may have been renamed/moved at
+// destination (and at most how much sync actions would save), without hashing any file: it's everything that
+// syncDirectories does before files are indexed
+func scanDirectories(ctx context.Context, runID string, sourceDirPath string, exclusions set.Set[string],
+	destinationDirPath string, options runOptions) (runSummary, error) {
+	planOptions := options.planOptions(ctx, runID, sourceDirPath, exclusions, destinationDirPath)
+	planOptions.ScanOnly = true
+	_, stats, err := sidekick.PlanWithStats(planOptions)
+	summary := newRunSummary(sourceDirPath, destinationDirPath)
+	summary.Mode = modeScanOnly
+	summary.setStats(stats)
+	summary.Interrupted = ctx.Err() != nil
+	return summary, err
+}
+
+// applyPlan performs (or reports, as per options) sync actions saved earlier to a file, instead of computing them, and
+// returns summary of the run
+func applyPlan(ctx context.Context, runID string, planPath string, options runOptions) (runSummary, error) {
+	sourceDirPath, destinationDirPath, actions, err := loadPlan(planPath, options.actionSettings.TempDirPath)
 	if err != nil {
-		return err // no extra info needed
+		return runSummary{}, err
+	}
+	fmte.Printf("Loaded %d actions from plan \"%s\" (source: %s, destination: %s)\n", len(actions), planPath,
+		sourceDirPath, destinationDirPath)
+	summary := newRunSummary(sourceDirPath, destinationDirPath)
+	summary.NumActions = len(actions)
+	for _, a := range actions {
+		summary.ActionCountsByType[action.TypeName(a)]++
 	}
-	if len(actions) == 0 {
+	// Files may have changed since the plan was saved:
+	options.checkPreconditions = true
+	err = performOrReportActions(ctx, runID, actions, nil, &summary, sourceDirPath, destinationDirPath, options)
+	return summary, finishRun(summary, err, options)
+}
+
+// resumeJournal performs sync actions left unperformed by an earlier run that didn't complete (as recorded in journal
+// at options.journalPath), if there was one, its source and destination are one of given pairs and the user says so
+// (through --yes or, in an interactive run, by answering a question). This is done before a fresh plan is computed,
+// since what's left unperformed changes what's planned. Runs that don't perform sync actions leave the journal alone.
+func resumeJournal(ctx context.Context, pairs []dirPair, options runOptions) error {
+	if options.journalPath == "" || options.audit || options.scanOnly || options.savePlanPath != "" ||
+		options.outputScriptPath != "" {
 		return nil
 	}
-	if outputScriptPath != "" {
-		return generateScript(actions, outputScriptPath)
-	} else {
-		return performActions(actions, destinationDirPath)
+	report, isResumed, err := sidekick.Resume(sidekick.Options{
+		SummaryThreshold: options.summaryThreshold,
+		RetryPolicy:      options.retryPolicy,
+		JournalPath:      options.journalPath,
+		Context:          ctx,
+		Settings:         options.actionSettings,
+	}, func(sourceDirPath string, destinationDirPath string, numPending int) error {
+		return acceptJournal(dirPair{source: sourceDirPath, destination: destinationDirPath}, numPending, pairs,
+			options)
+	})
+	if isResumed && err == nil {
+		fmte.Printf("Resumed actions performed by type: %s\n", report)
 	}
+	return err
 }
 
-func performActions(actions []action.SyncAction, destinationDirPath string) error {
-	var start, end time.Time
-	fmte.Printf("Applying sync actions at destination...\n")
-	successCount := 0
-	start = time.Now()
-	for i, syncAction := range actions {
-		fmte.Println(strings.Replace(
-			fmt.Sprintf("%4d/%d %s: ", i+1, len(actions), syncAction),
-			destinationDirPath+"/", "", -1,
-		))
-		aErr := syncAction.Perform()
-		if aErr == nil {
-			fmte.Printf("done\n")
-			successCount++
+// finishRun writes summary of the run, if configured to
+func finishRun(summary runSummary, err error, options runOptions) error {
+	if options.summaryJSONPath != "" {
+		if err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+		}
+		if sErr := writeSummaryJSON(summary, options.summaryJSONPath); sErr != nil {
+			fmte.PrintfErr("%+v\n", sErr)
+		}
+	}
+	if options.stats {
+		if sErr := writeStats(os.Stderr, summary, options.outputFormat); sErr != nil {
+			fmte.PrintfErr("couldn't write stats: %+v\n", sErr)
+		}
+	}
+	return err
+}
+
+// performOrReportActions performs sync actions (or reports them, as per options) and runs after-sync hook, unless the
+// run is interrupted (i.e. ctx is done)
+func performOrReportActions(ctx context.Context, runID string, actions []action.SyncAction, err error,
+	summary *runSummary, sourceDirPath string, destinationDirPath string, options runOptions) error {
+	summary.Interrupted = ctx.Err() != nil
+	if err == nil && len(actions) > 0 && options.verbose {
+		actionsAsStrings := make([]string, 0, len(actions))
+		for _, a := range actions {
+			actionsAsStrings = append(actionsAsStrings, fmt.Sprintf("%s", a))
+		}
+		lib.WriteSliceToFile(actionsAsStrings, fmt.Sprintf("./info_%s_actions.txt", runID))
+	}
+	if options.audit {
+		summary.Mode = modeAudit
+		if err != nil {
+			return err
+		}
+		if _, aErr := sidekick.Apply(actions, sidekick.Options{DestinationDirPath: destinationDirPath,
+			DryRun: true, Settings: options.actionSettings}); aErr != nil {
+			return aErr
+		}
+		if options.showTree {
+			printTreeDiff(summary.destinationFiles, actions, destinationDirPath)
+		}
+		if options.rsyncPath != "" {
+			return runRsync(ctx, options.rsyncPath, sourceDirPath, destinationDirPath, options.rsyncArgs, true)
+		}
+		return nil
+	}
+	if options.savePlanPath != "" {
+		summary.Mode = modeSavePlan
+		if err != nil {
+			return err
+		}
+		fmte.Printf("Saving %d sync actions to plan \"%s\"...\n", len(actions), options.savePlanPath)
+		return savePlan(actions, sourceDirPath, destinationDirPath, options.savePlanPath, options.actionSettings)
+	}
+	if options.outputScriptPath != "" {
+		summary.Mode = modeScript
+		if err != nil || len(actions) == 0 {
+			return err
+		}
+		// after-sync hook is skipped, as this is a dry run:
+		return generateScript(actions, options.outputScriptPath, options.scriptFlavor, options.actionSettings)
+	}
+	summary.Mode = modeApply
+	summary.BwLimit = options.actionSettings.CopyBandwidthLimit
+	if err == nil {
+		err = checkMaxActions(len(actions), options)
+	}
+	var confirm func(a action.SyncAction) bool
+	if err == nil && len(actions) > 0 && options.confirm && !options.assumeYes {
+		if !isInteractive() {
+			err = fmt.Errorf("there's no terminal to confirm sync actions on (pass --%s to perform them without "+
+				"confirmation)", assumeYesFlag)
 		} else {
-			fmte.Printf("failed due to: %+v\n", aErr)
+			actions, confirm = confirmActions(actions, destinationDirPath)
 		}
 	}
-	end = time.Now()
-	fmte.Printf("Sync completed in %.1fs: %d out of %d actions succeeded\n",
-		end.Sub(start).Seconds(), successCount, len(actions))
-	return nil
+	success := err == nil
+	if err == nil && len(actions) > 0 {
+		report, aErr := sidekick.Apply(actions, sidekick.Options{
+			DestinationDirPath: destinationDirPath,
+			SummaryThreshold:   options.summaryThreshold,
+			CheckPreconditions: options.checkPreconditions,
+			RetryPolicy:        options.retryPolicy,
+			JournalPath:        options.journalPath,
+			SourceDirPath:      sourceDirPath,
+			Confirm:            confirm,
+			Context:            ctx,
+			Settings:           options.actionSettings,
+		})
+		fmte.Printf("Actions performed by type: %s\n", report)
+		err = aErr
+		success = aErr == nil && report.FailureCount() == 0
+		summary.NumSucceeded, summary.NumFailed = report.SuccessCount, report.FailureCount()
+		summary.NumSkipped = len(report.Skipped)
+		summary.NumSucceededAfterRetry = report.SucceededAfterRetry
+		summary.Interrupted = report.Interrupted
+		summary.TempFiles = report.TempPaths
+		summary.ElapsedSeconds["apply"] = report.Elapsed.Seconds()
+		summary.TrashedFiles = report.TrashedFiles
+		if len(summary.TrashedFiles) > 0 {
+			fmte.Printf("%d files that were in the way of file moves were moved into trash directory\n",
+				len(summary.TrashedFiles))
+		}
+		for _, failure := range report.Failures {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %+v", failure.Action, failure.Err))
+		}
+	}
+	if options.rsyncPath != "" && err == nil && ctx.Err() == nil {
+		// rsync transfers whatever sync actions didn't take care of, including files whose actions failed:
+		err = runRsync(ctx, options.rsyncPath, sourceDirPath, destinationDirPath, options.rsyncArgs, false)
+		success = success && err == nil
+	}
+	if options.afterSyncHook != "" && ctx.Err() != nil {
+		fmte.Printf("Skipping after-sync hook, as the run was interrupted\n")
+	} else if options.afterSyncHook != "" {
+		fmte.Printf("Running after-sync hook...\n")
+		hookErr := runAfterSyncHook(options.afterSyncHook, sourceDirPath, destinationDirPath, success)
+		if hookErr != nil {
+			if err != nil {
+				return fmte.Errors("sync and after-sync hook failed", []error{err, hookErr})
+			}
+			return hookErr
+		}
+	}
+	return err
 }
 
-func generateScript(actions []action.SyncAction, shellScriptFileName string) error {
+func generateScript(actions []action.SyncAction, shellScriptFileName string, flavor string,
+	settings action.Settings) error {
 	fmte.Printf("Writing sync actions to shell script \"%s\"...\n", shellScriptFileName)
 	shellScriptFile, shellScriptCreateErr := os.Create(shellScriptFileName)
 	if shellScriptCreateErr != nil {
@@ -162,39 +361,15 @@ func generateScript(actions []action.SyncAction, shellScriptFileName string) err
 	defer shellScriptFile.Close()
 	var sb strings.Builder
 	sb.Grow(unixCommandLengthGuess * len(actions))
-	for _, a := range actions {
-		sb.WriteString(a.UnixCommand())
-		sb.WriteString("\n")
+	lineSeparator := "\n"
+	if flavor == action.ScriptFlavorCmd {
+		lineSeparator = "\r\n"
+	}
+	for _, a := range action.SortByDependencies(actions, settings) {
+		sb.WriteString(action.Command(a, flavor))
+		sb.WriteString(lineSeparator)
 	}
 	shellScriptFile.WriteString(sb.String())
 	fmte.Printf("Done. You may run it now.\n")
 	return nil
 }
-
-func reportProgress(sourceActual *int32, sourceExpected int32, destinationActual *int32, destinationExpected int32) {
-	var sourceProgress, destinationProgress float64
-	time.Sleep(100 * time.Millisecond)
-	for atomic.LoadInt32(sourceActual) < sourceExpected || atomic.LoadInt32(destinationActual) < destinationExpected {
-		time.Sleep(2 * time.Second)
-		sourceProgress = 100.0 * float64(atomic.LoadInt32(sourceActual)) / float64(sourceExpected)
-		destinationProgress = 100.0 * float64(*destinationActual) / float64(destinationExpected)
-		fmte.Printf("%.0f%% done at source and %.0f%% done at destination\n", sourceProgress, destinationProgress)
-	}
-}
-
-func findCandidatesAtDestination(sourceFiles, destinationFiles map[string]entity.FileMeta, orphansAtSource []string) []string {
-	orphansFileExtAndSizeMap := set.NewThreadUnsafeSetWithSize[entity.FileExtAndSize](len(orphansAtSource))
-	for _, path := range orphansAtSource {
-		fileMeta := sourceFiles[path]
-		key := entity.FileExtAndSize{FileExtension: lib.GetFileExt(path), FileSize: fileMeta.Size}
-		orphansFileExtAndSizeMap.Add(key)
-	}
-	candidatesAtDestination := make([]string, 0, len(orphansAtSource))
-	for path, fileMeta := range destinationFiles {
-		key := entity.FileExtAndSize{FileExtension: lib.GetFileExt(path), FileSize: fileMeta.Size}
-		if orphansFileExtAndSizeMap.Contains(key) {
-			candidatesAtDestination = append(candidatesAtDestination, path)
-		}
-	}
-	return candidatesAtDestination
-}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/rsync-sidekick/action"
 	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/m-manu/rsync-sidekick/sidekick"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
 	"os"
@@ -102,6 +105,17 @@ func copyFromGoRootAs(pathInsideGoRoot string, relativePath string, place Where)
 	if place == Destination || place == Both {
 		copyFile(p, atDst(relativePath))
 	}
+	if place == Both {
+		// So that both copies are in sync, even at sub-second precision of their modification timestamps:
+		info, err := os.Stat(atSrc(relativePath))
+		if err == nil {
+			err = os.Chtimes(atDst(relativePath), info.ModTime(), info.ModTime())
+		}
+		if err != nil {
+			// This shouldn't happen, unless there is a bug in test case
+			panic(fmt.Errorf("error: Unable to set timestamp of file %s due to: %+v", relativePath, err))
+		}
+	}
 }
 
 func atSrc(relativePath string) string {
@@ -134,7 +148,8 @@ func TestRSyncSidekick(t *testing.T) {
 	defer tearDown(t)
 	fmte.Off()
 	// Source and destination are in sync (base case)
-	actions1, syncErr1 := getSyncActionsWithProgress(runID, srcPath, exclusionsForTests, dstPath, true)
+	actions1, _, syncErr1 := getSyncActionsWithProgress(context.Background(), runID, srcPath, exclusionsForTests,
+		dstPath, runOptions{verbose: true, progressFormat: sidekick.ProgressFormatNone})
 	stopIfError(t, syncErr1)
 	assert.Equal(t, []action.SyncAction{}, actions1)
 	// Do series of changes at source:
@@ -157,7 +172,7 @@ func TestRSyncSidekick(t *testing.T) {
 	// Case 6: Rename file inside ignored directory
 	moveFile(atSrc(".Trashes/go.sum"), atSrc(".Trashes/go1.sum"))
 	// Propagate these changes to destination and verify:
-	rsErr1 := rsyncSidekick(runID, srcPath, exclusionsForTests, dstPath, "", false)
+	_, rsErr1 := rsyncSidekick(context.Background(), runID, srcPath, exclusionsForTests, dstPath, runOptions{})
 	stopIfError(t, rsErr1)
 	// Assert at destination:
 	assert.FileExists(t, atDst("/go1_renamed"))
@@ -169,15 +184,103 @@ func TestRSyncSidekick(t *testing.T) {
 	assert.NoFileExists(t, atDst("map1.go.txt"))
 	assert.NoFileExists(t, atDst(".Trashes/go1.sum"))
 	// Source and destination are back in sync
-	actions2, syncErr2 := getSyncActionsWithProgress(runID, srcPath, exclusionsForTests, dstPath, false)
+	actions2, _, syncErr2 := getSyncActionsWithProgress(context.Background(), runID, srcPath, exclusionsForTests,
+		dstPath, runOptions{progressFormat: sidekick.ProgressFormatNone})
 	stopIfError(t, syncErr2)
 	assert.Equal(t, []action.SyncAction{}, actions2)
 	deleteFile(atSrc("/another_code/sort.go.txt"))
-	actions3, syncErr3 := getSyncActionsWithProgress(runID, srcPath, exclusionsForTests, dstPath, true)
+	actions3, _, syncErr3 := getSyncActionsWithProgress(context.Background(), runID, srcPath, exclusionsForTests,
+		dstPath, runOptions{verbose: true, progressFormat: sidekick.ProgressFormatNone})
 	stopIfError(t, syncErr3)
 	assert.Equal(t, []action.SyncAction{}, actions3)
 }
 
+func TestAudit(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "original.txt"))
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		audit:         true,
+		afterSyncHook: "exit 1",
+	})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(destinationDir, "original.txt"))
+	assert.NoFileExists(t, filepath.Join(destinationDir, "renamed.txt"))
+}
+
+func TestMaxActions(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "original.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(sourceDir, "renamed.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(destinationDir, "original.go"))
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir,
+		runOptions{maxActions: 1})
+	assert.ErrorContains(t, err, "2 sync actions are more than --max-actions 1")
+	assert.FileExists(t, filepath.Join(destinationDir, "original.txt"))
+	// User declines:
+	answerWith(t, "n\n")
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir,
+		runOptions{maxActions: 1})
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(destinationDir, "original.txt"))
+	// User agrees:
+	answerWith(t, "y\n")
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir,
+		runOptions{maxActions: 1})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(destinationDir, "renamed.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "renamed.go"))
+}
+
+func TestMinSize(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "small_renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "small.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(sourceDir, "large_renamed.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(destinationDir, "large.go"))
+	actions, _, err := getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone,
+			syncOptions: service.SyncOptions{MinSize: 1024}})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{action.MoveFileAction{BasePath: destinationDir,
+		RelativeFromPath: "large.go", RelativeToPath: "large_renamed.go"}}, actions)
+	// Same, the other way round:
+	actions, _, err = getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone,
+			syncOptions: service.SyncOptions{MaxSize: 1024}})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{action.MoveFileAction{BasePath: destinationDir,
+		RelativeFromPath: "small.txt", RelativeToPath: "small_renamed.txt"}}, actions)
+}
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links can't be created on this platform without special privileges")
+	}
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "VERSION"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "VERSION"))
+	stopIfError(t, os.Symlink("VERSION", filepath.Join(sourceDir, "latest")))
+	stopIfError(t, os.Symlink("VERSION", filepath.Join(destinationDir, "current")))
+	// Symbolic links are left to rsync by default:
+	actions, _, err := getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone})
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	actions, summary, err := getSyncActionsWithProgress(context.Background(), runID, sourceDir, exclusionsForTests,
+		destinationDir, runOptions{progressFormat: sidekick.ProgressFormatNone,
+			syncOptions: service.SyncOptions{Symlinks: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{action.SymlinkMoveAction{BasePath: destinationDir,
+		RelativeFromPath: "current", RelativeToPath: "latest"}}, actions)
+	assert.Equal(t, 1, summary.NumActions)
+}
+
 func deleteFile(path string) {
 	err := os.Remove(path)
 	if err != nil {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// rsyncError is returned when rsync couldn't be run or exited with non-zero code (which becomes exit code of this
+// tool, see --run-rsync)
+type rsyncError struct {
+	exitCode int
+	err      error
+}
+
+func (e rsyncError) Error() string {
+	return fmt.Sprintf("rsync failed with exit code %d: %+v", e.exitCode, e.err)
+}
+
+// findRsync finds path of rsync executable (empty if it isn't found, with a warning)
+func findRsync() string {
+	rsyncPath, err := exec.LookPath("rsync")
+	if err != nil {
+		fmte.Warnf("rsync isn't found, so it won't be run (%+v)\n", err)
+		return ""
+	}
+	return rsyncPath
+}
+
+// rsyncCommandArgs are arguments that rsync is run with: archive mode (and, on dry run, no changes), followed by given
+// extra arguments, source directory (with a trailing slash, so that its contents are synced rather than itself) and
+// destination directory
+func rsyncCommandArgs(sourceDirPath string, destinationDirPath string, extraArgs []string, dryRun bool) []string {
+	args := []string{"-a"}
+	if dryRun {
+		args = append(args, "-n")
+	}
+	args = append(args, extraArgs...)
+	return append(args, strings.TrimSuffix(sourceDirPath, "/")+"/", destinationDirPath)
+}
+
+// runRsync runs rsync at given path from source directory to destination directory (see rsyncCommandArgs), with its
+// standard output and error attached to this process's (standard output goes wherever output of this process goes,
+// see fmte.Out, unless that's in JSON format, which rsync's isn't). It's stopped once ctx is done.
+func runRsync(ctx context.Context, rsyncPath string, sourceDirPath string, destinationDirPath string,
+	extraArgs []string, dryRun bool) error {
+	args := rsyncCommandArgs(sourceDirPath, destinationDirPath, extraArgs, dryRun)
+	fmte.Printf("Running rsync: %s %s\n", rsyncPath, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, rsyncPath, args...)
+	cmd.Stdout = fmte.Out()
+	if fmte.IsJSON() {
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return rsyncError{exitCode: exitErr.ExitCode(), err: err}
+	}
+	return rsyncError{exitCode: exitCodeSyncError, err: err}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRsyncCommandArgs(t *testing.T) {
+	assert.Equal(t, []string{"-a", "/data/photos/", "/backup/photos"},
+		rsyncCommandArgs("/data/photos", "/backup/photos", nil, false))
+	assert.Equal(t, []string{"-a", "-n", "--delete", "--exclude=*.tmp", "/data/photos/", "/backup/photos"},
+		rsyncCommandArgs("/data/photos/", "/backup/photos", []string{"--delete", "--exclude=*.tmp"}, true))
+}
+
+func TestRunRsync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake rsync in this test is a unix shell script")
+	}
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "a.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "b.txt"))
+	// A fake rsync, that records its arguments and whether the file was moved before it ran:
+	argsPath := filepath.Join(outDir, "args.txt")
+	rsyncPath := filepath.Join(outDir, "rsync")
+	stopIfError(t, os.WriteFile(rsyncPath, []byte(`#!/bin/sh
+echo "$@" > "`+argsPath+`"
+[ -f "`+filepath.Join(destinationDir, "a.txt")+`" ] || exit 23
+`), 0755))
+	// Run as a dry run, in audit mode (where nothing is moved):
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		audit:     true,
+		rsyncPath: rsyncPath,
+	})
+	var rsyncErr rsyncError
+	assert.True(t, errors.As(err, &rsyncErr))
+	assert.Equal(t, 23, rsyncErr.exitCode)
+	args, readErr := os.ReadFile(argsPath)
+	stopIfError(t, readErr)
+	assert.Equal(t, "-a -n "+sourceDir+"/ "+destinationDir, strings.TrimSpace(string(args)))
+	// Run after actions are applied:
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		rsyncPath: rsyncPath,
+		rsyncArgs: []string{"--delete"},
+	})
+	assert.NoError(t, err)
+	args, readErr = os.ReadFile(argsPath)
+	stopIfError(t, readErr)
+	assert.Equal(t, "-a --delete "+sourceDir+"/ "+destinationDir, strings.TrimSpace(string(args)))
+}
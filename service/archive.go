@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"path/filepath"
+	"sort"
+)
+
+// ComputeArchiveCopies finds files in an archive directory (see SyncOptions.ArchiveDirPath) having same contents as
+// orphans at source, and computes actions that copy them into destination, so that rsync doesn't have to transfer
+// them. Orphans that exist at destination (with different contents) are left to rsync, and so are empty files.
+// Existing actions are the ones already computed by ComputeSyncActions (directories they create aren't created again).
+// As with ComputeSyncActions, indexing stops if ctx is done.
+func ComputeArchiveCopies(ctx context.Context, sourceDirPath string, sourceFiles map[string]entity.FileMeta,
+	orphansAtSource []string, archiveDirPath string, archiveFiles map[string]entity.FileMeta,
+	candidatesInArchive []string, destinationDirPath string, destinationFiles map[string]entity.FileMeta,
+	existingActions []action.SyncAction, options SyncOptions,
+) (actions []action.SyncAction, copiedBytes int64, err error) {
+	orphansToCopy := make([]string, 0, len(orphansAtSource))
+	for _, orphan := range orphansAtSource {
+		if _, existsAtDestination := destinationFiles[orphan]; !existsAtDestination && sourceFiles[orphan].Size > 0 {
+			orphansToCopy = append(orphansToCopy, orphan)
+		}
+	}
+	orphanFilesToDigests := lib.NewSafeMap[string, entity.FileDigest]()
+	archiveFilesToDigests := lib.NewSafeMap[string, entity.FileDigest]()
+	orphanDigestsToFiles := lib.NewMultiMap[entity.FileDigest, string]()
+	archiveDigestsToFiles := lib.NewMultiMap[entity.FileDigest, string]()
+	var sourceProgress, archiveProgress IndexProgress
+	if indexErr := buildIndex(ctx, sourceDirPath, sourceFiles, orphansToCopy, options.Threads, &sourceProgress,
+		orphanFilesToDigests, orphanDigestsToFiles, options); indexErr != nil {
+		return nil, 0, fmt.Errorf("error while building index on source directory: %+v", indexErr)
+	}
+	if indexErr := buildIndex(ctx, archiveDirPath, archiveFiles, candidatesInArchive, options.Threads,
+		&archiveProgress, archiveFilesToDigests, archiveDigestsToFiles, options); indexErr != nil {
+		return nil, 0, fmt.Errorf("error while building index on archive directory: %+v", indexErr)
+	}
+	// Unlike a move, a copy leaves the file in archive as it is, so one file can be copied to many paths:
+	matches := make(map[string]string, len(orphansToCopy))
+	for orphan, digest := range orphanFilesToDigests.Data {
+		if inArchive := archiveDigestsToFiles.Get(digest); len(inArchive) > 0 {
+			sort.Strings(inArchive)
+			matches[orphan] = inArchive[0]
+		}
+	}
+	if options.Verify {
+		matches, _, _ = verifyMatches(sourceDirPath, archiveDirPath, matches)
+	}
+	orphansWithMatches := make([]string, 0, len(matches))
+	for orphan := range matches {
+		orphansWithMatches = append(orphansWithMatches, orphan)
+	}
+	sort.Strings(orphansWithMatches)
+	uniqueness := set.NewThreadUnsafeSetWithSize[string](len(existingActions) + len(matches))
+	for _, a := range existingActions {
+		uniqueness.Add(a.Uniqueness())
+	}
+	actions = make([]action.SyncAction, 0, len(matches))
+	for _, orphan := range orphansWithMatches {
+		inArchive := matches[orphan]
+		parentDir := filepath.Dir(filepath.Join(destinationDirPath, orphan))
+		if !lib.IsReadableDirectory(parentDir) {
+			directoryAction := action.MakeDirectoryAction{
+				AbsoluteDirPath: parentDir,
+			}
+			if !uniqueness.Contains(directoryAction.Uniqueness()) {
+				actions = append(actions, directoryAction)
+				uniqueness.Add(directoryAction.Uniqueness())
+			}
+		}
+		actions = append(actions, action.CopyFileAction{
+			FromPath:       filepath.Join(archiveDirPath, inArchive),
+			BasePath:       destinationDirPath,
+			RelativeToPath: orphan,
+		})
+		copiedBytes += sourceFiles[orphan].Size
+		if !options.NoTimestamp && !archiveFiles[inArchive].IsModifiedWithin(sourceFiles[orphan],
+			options.ModifyWindow) {
+			actions = append(actions, action.PropagateTimestampAction{
+				SourceBaseDirPath:           sourceDirPath,
+				DestinationBaseDirPath:      destinationDirPath,
+				SourceFileRelativePath:      orphan,
+				DestinationFileRelativePath: orphan,
+			})
+		}
+	}
+	return actions, copiedBytes, nil
+}
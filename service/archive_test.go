@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeArchiveCopies(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, archiveDirPath, destinationDirPath := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"2020/a.txt":   "in archive",
+		"2021/b.txt":   "in archive",
+		"c.txt":        "not in archive",
+		"changed.txt":  "changed at source",
+		"archived.txt": "archived with another timestamp",
+	})
+	writeTestFiles(t, archiveDirPath, map[string]string{
+		"old/a.txt":    "in archive",
+		"changed.txt":  "changed in archiv",
+		"archived.txt": "archived with another timestamp",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"changed.txt": "changed in archive",
+	})
+	archivedModTime := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(archiveDirPath, "archived.txt"), archivedModTime, archivedModTime))
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	sourceFiles, _, _ := FindFilesFromDirectory(context.Background(), sourceDirPath, noExclusions)
+	archiveFiles, _, _ := FindFilesFromDirectory(context.Background(), archiveDirPath, noExclusions)
+	destinationFiles, _, _ := FindFilesFromDirectory(context.Background(), destinationDirPath, noExclusions)
+	for _, files := range []map[string]entity.FileMeta{sourceFiles, archiveFiles, destinationFiles} {
+		WithoutNanoseconds(files)
+	}
+	orphans := []string{"2020/a.txt", "2021/b.txt", "c.txt", "changed.txt", "archived.txt"}
+	existingActions := []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "2021")},
+	}
+	actions, copiedBytes, err := ComputeArchiveCopies(context.Background(), sourceDirPath, sourceFiles, orphans,
+		archiveDirPath, archiveFiles, []string{"old/a.txt", "changed.txt", "archived.txt"},
+		destinationDirPath, destinationFiles, existingActions, SyncOptions{})
+	assert.NoError(t, err)
+	// A file in archive can be copied to many paths, but files existing at destination are left to rsync:
+	assert.Equal(t, []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "2020")},
+		action.CopyFileAction{FromPath: filepath.Join(archiveDirPath, "old/a.txt"), BasePath: destinationDirPath,
+			RelativeToPath: "2020/a.txt"},
+		action.CopyFileAction{FromPath: filepath.Join(archiveDirPath, "old/a.txt"), BasePath: destinationDirPath,
+			RelativeToPath: "2021/b.txt"},
+		action.CopyFileAction{FromPath: filepath.Join(archiveDirPath, "archived.txt"), BasePath: destinationDirPath,
+			RelativeToPath: "archived.txt"},
+		action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath, DestinationBaseDirPath: destinationDirPath,
+			SourceFileRelativePath: "archived.txt", DestinationFileRelativePath: "archived.txt"},
+	}, actions)
+	assert.Equal(t, int64(2*len("in archive")+len("archived with another timestamp")), copiedBytes)
+	assert.Equal(t, []string{"c.txt", "changed.txt"}, FindUnmatchedOrphans(orphans, actions))
+}
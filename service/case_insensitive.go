@@ -0,0 +1,79 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Ways of deciding whether filesystem at destination is case-insensitive (see SyncOptions.CaseInsensitiveFS)
+const (
+	CaseInsensitiveFSAuto = "auto"
+	CaseInsensitiveFSYes  = "yes"
+	CaseInsensitiveFSNo   = "no"
+)
+
+// CaseInsensitiveFSModes are all valid values of SyncOptions.CaseInsensitiveFS
+var CaseInsensitiveFSModes = []string{CaseInsensitiveFSAuto, CaseInsensitiveFSYes, CaseInsensitiveFSNo}
+
+// maxCaseProbes is maximum number of files looked up while detecting whether a filesystem is case-insensitive
+const maxCaseProbes = 10
+
+// IsCaseInsensitive detects whether filesystem of given directory is case-insensitive, by looking up the directory or
+// one of given files inside it with case of its name swapped (nothing is written). If no such lookup is conclusive,
+// e.g. when names don't have letters, the filesystem is assumed to be case-sensitive.
+func IsCaseInsensitive(dirPath string, files map[string]entity.FileMeta) bool {
+	paths := []string{dirPath}
+	for relativePath := range files {
+		if len(paths) == maxCaseProbes {
+			break
+		}
+		paths = append(paths, filepath.Join(dirPath, relativePath))
+	}
+	for _, path := range paths {
+		swappedName := swapCase(filepath.Base(path))
+		if swappedName == filepath.Base(path) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		swappedInfo, swappedErr := os.Lstat(filepath.Join(filepath.Dir(path), swappedName))
+		if os.IsNotExist(swappedErr) {
+			return false
+		} else if swappedErr == nil {
+			return os.SameFile(info, swappedInfo)
+		}
+	}
+	return false
+}
+
+// isCaseInsensitiveDestination decides whether filesystem at destination is case-insensitive, as per given mode
+func isCaseInsensitiveDestination(destinationDirPath string, destinationFiles map[string]entity.FileMeta,
+	mode string,
+) bool {
+	switch mode {
+	case CaseInsensitiveFSYes:
+		return true
+	case CaseInsensitiveFSNo:
+		return false
+	}
+	if IsCaseInsensitive(destinationDirPath, destinationFiles) {
+		fmte.Printf("Destination is on a case-insensitive filesystem\n")
+		return true
+	}
+	return false
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsCaseInsensitive(t *testing.T) {
+	dirPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "Photo.JPG"), []byte("photo"), 0644))
+	_, err := os.Lstat(filepath.Join(dirPath, "pHOTO.jpg"))
+	files, _, findErr := FindFilesFromDirectory(context.Background(), dirPath, set.NewThreadUnsafeSet[string]())
+	assert.NoError(t, findErr)
+	assert.Equal(t, err == nil, IsCaseInsensitive(dirPath, files))
+}
+
+func TestComputeSyncActionsCaseInsensitive(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	if IsCaseInsensitive(destinationDirPath, nil) {
+		t.Skip("names differing only in case can't co-exist on this filesystem")
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDirPath, "photo.jpg"), []byte("photo"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(destinationDirPath, "Photo.JPG"), []byte("photo"), 0644))
+	caseOnlyRename := action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "Photo.JPG",
+		RelativeToPath: "photo.jpg"}
+	for _, mode := range CaseInsensitiveFSModes {
+		assert.Contains(t, computeSyncActions(t, sourceDirPath, destinationDirPath,
+			SyncOptions{CaseInsensitiveFS: mode}), caseOnlyRename, mode)
+	}
+	// Another file at destination has the same name in a case-insensitive sense, so the rename would clash with it:
+	assert.NoError(t, os.WriteFile(filepath.Join(destinationDirPath, "PHOTO.JPG"), []byte("another photo"), 0644))
+	assert.NotContains(t, computeSyncActions(t, sourceDirPath, destinationDirPath,
+		SyncOptions{CaseInsensitiveFS: CaseInsensitiveFSYes}), caseOnlyRename)
+	assert.Contains(t, computeSyncActions(t, sourceDirPath, destinationDirPath,
+		SyncOptions{CaseInsensitiveFS: CaseInsensitiveFSNo}), caseOnlyRename)
+}
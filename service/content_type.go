@@ -0,0 +1,29 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+// sniffLen is the number of bytes at the beginning of a file that are needed to detect its content type
+const sniffLen = 512
+
+// ContentTypes are all content types files are classified into (see contentTypeOf), i.e. valid values of
+// SyncOptions.IncludedContentTypes and SyncOptions.ExcludedContentTypes
+var ContentTypes = []string{"image", "video", "audio", "text", "font", "application"}
+
+// contentTypeOf classifies a file by sniffing its first bytes (i.e. irrespective of its extension) into one of
+// "image", "video", "audio", "text", "font" or "application" (the last one being the fallback)
+func contentTypeOf(firstBytes []byte) string {
+	mimeType := http.DetectContentType(firstBytes)
+	return mimeType[:strings.Index(mimeType, "/")]
+}
+
+// isContentTypeAllowed tells whether a file of given content type is to be considered for matching
+func isContentTypeAllowed(contentType string, options SyncOptions) bool {
+	if options.IncludedContentTypes != nil && options.IncludedContentTypes.Cardinality() > 0 &&
+		!options.IncludedContentTypes.Contains(contentType) {
+		return false
+	}
+	return options.ExcludedContentTypes == nil || !options.ExcludedContentTypes.Contains(contentType)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// digestCacheVersion is bumped whenever format of the cache file or the way digests are computed changes (so that
+// stale digests are never served)
+const digestCacheVersion = 1
+
+// DigestCache is a persistent cache of digests of files, so that files unchanged (in size and modification timestamp)
+// since an earlier run aren't hashed again. It's goroutine-safe.
+type DigestCache struct {
+	mx      sync.Mutex
+	path    string
+	entries map[string]digestCacheEntry
+	// NumHits and NumMisses are numbers of digests served from the cache and computed afresh, respectively
+	NumHits, NumMisses int32
+}
+
+// digestCacheEntry is a digest of a file (identified by its absolute path), valid as long as the file is unchanged
+type digestCacheEntry struct {
+	Size        int64
+	ModTimeNano int64
+	Options     DigestOptions
+	Digest      entity.FileDigest
+	ContentType string
+}
+
+// digestCacheFile is what's stored in the cache file
+type digestCacheFile struct {
+	Version int
+	Entries map[string]digestCacheEntry
+}
+
+// LoadDigestCache loads the cache from a file at given path (which is written to by Save). A missing file means an
+// empty cache, and so does a file of an older version.
+func LoadDigestCache(path string) (*DigestCache, error) {
+	cache := &DigestCache{path: path, entries: map[string]digestCacheEntry{}}
+	file, openErr := os.Open(path)
+	if errors.Is(openErr, os.ErrNotExist) {
+		return cache, nil
+	} else if openErr != nil {
+		return nil, fmt.Errorf("couldn't open cache file \"%s\": %+v", path, openErr)
+	}
+	defer file.Close()
+	var contents digestCacheFile
+	if decodeErr := gob.NewDecoder(file).Decode(&contents); decodeErr != nil {
+		return nil, fmt.Errorf("couldn't read cache file \"%s\" (delete it, if it's corrupted): %+v", path,
+			decodeErr)
+	}
+	if contents.Version == digestCacheVersion && contents.Entries != nil {
+		cache.entries = contents.Entries
+	}
+	return cache, nil
+}
+
+// Save writes the cache to the file it was loaded from (replacing it as a whole, so that a crash while writing doesn't
+// corrupt it)
+func (c *DigestCache) Save() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	tempFile, createErr := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if createErr != nil {
+		return fmt.Errorf("couldn't write cache file \"%s\": %+v", c.path, createErr)
+	}
+	encodeErr := gob.NewEncoder(tempFile).Encode(digestCacheFile{Version: digestCacheVersion, Entries: c.entries})
+	closeErr := tempFile.Close()
+	if encodeErr == nil {
+		encodeErr = closeErr
+	}
+	if encodeErr == nil {
+		encodeErr = os.Rename(tempFile.Name(), c.path)
+	}
+	if encodeErr != nil {
+		_ = os.Remove(tempFile.Name())
+		return fmt.Errorf("couldn't write cache file \"%s\": %+v", c.path, encodeErr)
+	}
+	return nil
+}
+
+// Len is number of digests in the cache
+func (c *DigestCache) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.entries)
+}
+
+// getDigestCached is same as getDigest, except that digest is served from given cache (if not nil) when the file is
+// unchanged since it was cached
+func getDigestCached(path string, cache *DigestCache, options DigestOptions) (entity.FileDigest, string, error) {
+	digest, contentType, _, err := lookUpDigest(path, cache, options)
+	return digest, contentType, err
+}
+
+// lookUpDigest is same as getDigestCached, except that it also tells whether the digest was served from cache
+func lookUpDigest(path string, cache *DigestCache, options DigestOptions) (
+	digest entity.FileDigest, contentType string, isCached bool, err error,
+) {
+	if cache == nil {
+		digest, contentType, err = getDigest(path, options)
+		return digest, contentType, false, err
+	}
+	info, statErr := os.Lstat(path)
+	if statErr != nil {
+		return entity.FileDigest{}, "", false, statErr
+	}
+	cache.mx.Lock()
+	entry, exists := cache.entries[path]
+	cache.mx.Unlock()
+	if exists && entry.Size == info.Size() && entry.ModTimeNano == info.ModTime().UnixNano() &&
+		entry.Options == options {
+		atomic.AddInt32(&cache.NumHits, 1)
+		return entry.Digest, entry.ContentType, true, nil
+	}
+	atomic.AddInt32(&cache.NumMisses, 1)
+	digest, contentType, err = digestOf(path, info, options)
+	if err != nil {
+		return digest, contentType, false, err
+	}
+	cache.mx.Lock()
+	cache.entries[path] = digestCacheEntry{
+		Size:        info.Size(),
+		ModTimeNano: info.ModTime().UnixNano(),
+		Options:     options,
+		Digest:      digest,
+		ContentType: contentType,
+	}
+	cache.mx.Unlock()
+	return digest, contentType, false, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDigestCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "digests.cache")
+	untouched, touched := filepath.Join(dir, "untouched.txt"), filepath.Join(dir, "touched.txt")
+	modTime := time.Now().Add(-time.Hour)
+	for _, path := range []string{untouched, touched} {
+		assert.NoError(t, os.WriteFile(path, []byte("contents of "+path), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	options := DigestOptions{HashMode: HashModeFull}
+
+	cache, loadErr := LoadDigestCache(cachePath)
+	assert.NoError(t, loadErr)
+	assert.Equal(t, 0, cache.Len())
+	digestsBefore := map[string]string{}
+	for _, path := range []string{untouched, touched} {
+		digest, _, err := getDigestCached(path, cache, options)
+		assert.NoError(t, err)
+		digestsBefore[path] = digest.FileFuzzyHash
+	}
+	assert.Equal(t, int32(0), cache.NumHits)
+	assert.Equal(t, int32(2), cache.NumMisses)
+	assert.NoError(t, cache.Save())
+
+	// Same size, but a different modification timestamp (and different contents):
+	assert.NoError(t, os.WriteFile(touched, []byte("CONTENTS OF "+touched), 0644))
+
+	cache, loadErr = LoadDigestCache(cachePath)
+	assert.NoError(t, loadErr)
+	assert.Equal(t, 2, cache.Len())
+	untouchedDigest, _, err := getDigestCached(untouched, cache, options)
+	assert.NoError(t, err)
+	assert.Equal(t, digestsBefore[untouched], untouchedDigest.FileFuzzyHash)
+	assert.Equal(t, int32(1), cache.NumHits)
+	touchedDigest, _, err := getDigestCached(touched, cache, options)
+	assert.NoError(t, err)
+	assert.NotEqual(t, digestsBefore[touched], touchedDigest.FileFuzzyHash)
+	assert.Equal(t, int32(1), cache.NumMisses)
+
+	// Digests computed in a different hash mode aren't served:
+	_, _, err = getDigestCached(untouched, cache, DigestOptions{HashMode: HashModeSHA256})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), cache.NumMisses)
+}
+
+func TestLoadDigestCacheCorrupt(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "digests.cache")
+	assert.NoError(t, os.WriteFile(cachePath, []byte("not a cache"), 0644))
+	_, err := LoadDigestCache(cachePath)
+	assert.Error(t, err)
+}
+
+func BenchmarkDigestCache(b *testing.B) {
+	const numFiles = 100
+	dir := b.TempDir()
+	paths := make([]string, numFiles)
+	contents := make([]byte, 4*bytesutil.MEBI)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("file%03d.bin", i))
+		contents[0] = byte(i)
+		if err := os.WriteFile(paths[i], contents, 0644); err != nil {
+			b.Fatalf("couldn't create %s: %+v", paths[i], err)
+		}
+	}
+	options := DigestOptions{HashMode: HashModeFull}
+	cache, _ := LoadDigestCache(filepath.Join(dir, "digests.cache"))
+	for _, c := range []struct {
+		name  string
+		cache *DigestCache
+	}{{"uncached", nil}, {"cached", cache}} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, path := range paths {
+					if _, _, err := getDigestCached(path, c.cache, options); err != nil {
+						b.Fatalf("couldn't hash %s: %+v", path, err)
+					}
+				}
+			}
+		})
+	}
+}
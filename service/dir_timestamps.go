@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FindDirsFromDirectory finds all directories in a given directory (except itself), along with their modification
+// timestamps (in nanoseconds since epoch). Exclusions (and ctx) work same as in FindFilesFromDirectoryExcludingDirs.
+func FindDirsFromDirectory(ctx context.Context, dirPath string, excludedFiles set.Set[string],
+	excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher,
+) (map[string]int64, error) {
+	dirs := map[string]int64{}
+	var mx sync.Mutex
+	visit := func(path string, d fs.DirEntry) {
+		if !d.IsDir() || path == dirPath {
+			return
+		}
+		info, infoErr := d.Info()
+		if infoErr != nil {
+			fmte.Warnf("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
+			return
+		}
+		relativePath, relErr := filepath.Rel(dirPath, path)
+		if relErr != nil {
+			fmte.Warnf("couldn't comprehend path \"%s\": %+v\n", path, relErr)
+			return
+		}
+		mx.Lock()
+		dirs[relativePath] = info.ModTime().UnixNano()
+		mx.Unlock()
+	}
+	err := walkDirectoryConcurrently(ctx, dirPath, excludedFiles, excludedDirPaths, ignoreRules, visit)
+	if err != nil {
+		return map[string]int64{}, fmt.Errorf("couldn't scan directory %s: %v", dirPath, err)
+	}
+	return dirs, nil
+}
+
+// ComputeDirTimestampActions computes actions that propagate modification timestamps of directories at source to
+// directories at same paths at destination, once given actions are performed: for directories whose timestamps
+// differ (as per options.ModifyWindow and options.NanosecondPrecision), and for directories that given actions create,
+// move into place or move something into or out of (as those change their timestamps).
+func ComputeDirTimestampActions(sourceDirPath string, sourceDirs map[string]int64, destinationDirPath string,
+	destinationDirs map[string]int64, actions []action.SyncAction, options SyncOptions,
+) []action.SyncAction {
+	// Timestamps that directories at destination will have once actions are performed (if they're known):
+	dirsAfter := make(map[string]int64, len(destinationDirs))
+	for path, modTime := range destinationDirs {
+		dirsAfter[path] = modTime
+	}
+	const unknown = -1
+	changed := set.NewThreadUnsafeSet[string]()
+	relativePath := func(path string) string {
+		if relPath, err := filepath.Rel(destinationDirPath, path); err == nil {
+			return relPath
+		}
+		return path
+	}
+	for _, a := range actions {
+		switch syncAction := a.(type) {
+		case action.MoveFileAction:
+			changed.Append(filepath.Dir(syncAction.RelativeFromPath), filepath.Dir(syncAction.RelativeToPath))
+		case action.SymlinkMoveAction:
+			changed.Append(filepath.Dir(syncAction.RelativeFromPath), filepath.Dir(syncAction.RelativeToPath))
+		case action.CopyFileAction:
+			changed.Add(filepath.Dir(syncAction.RelativeToPath))
+		case action.RemoveFileAction:
+			changed.Add(filepath.Dir(syncAction.RelativePath))
+		case action.MoveDirectoryAction:
+			changed.Append(filepath.Dir(syncAction.RelativeFromPath), filepath.Dir(syncAction.RelativeToPath))
+			prefix := syncAction.RelativeFromPath + string(filepath.Separator)
+			for path, modTime := range dirsAfter {
+				if path == syncAction.RelativeFromPath || strings.HasPrefix(path, prefix) {
+					delete(dirsAfter, path)
+					dirsAfter[syncAction.RelativeToPath+strings.TrimPrefix(path, syncAction.RelativeFromPath)] = modTime
+				}
+			}
+		case action.MakeDirectoryAction:
+			path := relativePath(syncAction.AbsoluteDirPath)
+			changed.Add(filepath.Dir(path))
+			if _, exists := dirsAfter[path]; !exists {
+				dirsAfter[path] = unknown
+			}
+		case action.RemoveDirectoryAction:
+			path := relativePath(syncAction.AbsoluteDirPath)
+			changed.Add(filepath.Dir(path))
+			delete(dirsAfter, path)
+		}
+	}
+	var paths []string
+	for path, sourceModTime := range sourceDirs {
+		destinationModTime, exists := dirsAfter[path]
+		if !exists {
+			continue
+		}
+		if changed.Contains(path) || destinationModTime == unknown ||
+			!isSameModTime(sourceModTime, destinationModTime, options) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	timestampActions := make([]action.SyncAction, 0, len(paths))
+	for _, path := range paths {
+		timestampActions = append(timestampActions, action.PropagateDirTimestampAction{
+			SourceBaseDirPath:      sourceDirPath,
+			DestinationBaseDirPath: destinationDirPath,
+			RelativePath:           path,
+		})
+	}
+	return timestampActions
+}
+
+// isSameModTime tells whether modification timestamps (in nanoseconds since epoch) are same, as per options
+func isSameModTime(modTime1 int64, modTime2 int64, options SyncOptions) bool {
+	if !options.NanosecondPrecision {
+		modTime1, modTime2 = modTime1-modTime1%int64(time.Second), modTime2-modTime2%int64(time.Second)
+	}
+	difference := time.Duration(modTime1 - modTime2)
+	return -options.ModifyWindow <= difference && difference <= options.ModifyWindow
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindDirsFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		filepath.Join("photos", "2021", "trip"),
+		filepath.Join("photos", "tmp_cache", "sub"),
+		filepath.Join("photos", "._resource"),
+		filepath.Join("photos", "build"),
+		filepath.Join("nested", "sub"),
+		"empty",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, path), 0755))
+	}
+	writeTestFiles(t, dir, map[string]string{filepath.Join("photos", "2021", "a.jpg"): "a"})
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 7, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "photos", "2021"), modTime, modTime))
+	ignoreRules, ignoreErr := lib.NewIgnoreMatcher([]string{"build/"})
+	assert.NoError(t, ignoreErr)
+	// Directories are excluded by name (or pattern), by path (e.g. a directory nested in the other one) and by
+	// ignore rules, and so is everything inside them (as are Mac dot files):
+	dirs, err := FindDirsFromDirectory(context.Background(), dir, set.NewThreadUnsafeSet("tmp_*"),
+		set.NewThreadUnsafeSet(filepath.Join(dir, "nested")), ignoreRules)
+	assert.NoError(t, err)
+	paths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		paths = append(paths, path)
+	}
+	assert.ElementsMatch(t, []string{"photos", filepath.Join("photos", "2021"),
+		filepath.Join("photos", "2021", "trip"), "empty"}, paths)
+	assert.Equal(t, modTime.UnixNano(), dirs[filepath.Join("photos", "2021")])
+	_, err = FindDirsFromDirectory(context.Background(), filepath.Join(dir, "missing"),
+		set.NewThreadUnsafeSet[string](), set.NewThreadUnsafeSet[string](), nil)
+	assert.Error(t, err)
+}
+
+func TestComputeDirTimestampActions(t *testing.T) {
+	const second = int64(time.Second)
+	sourceDirs := map[string]int64{
+		"same":                                   100 * second,
+		"differs":                                100 * second,
+		"differs_in_nanoseconds":                 100*second + 5,
+		"changed_inside":                         100 * second,
+		"created":                                100 * second,
+		"moved_into_place":                       100 * second,
+		filepath.Join("moved_into_place", "sub"): 100 * second,
+		"only_at_source":                         100 * second,
+	}
+	destinationDirs := map[string]int64{
+		"same":                        100 * second,
+		"differs":                     200 * second,
+		"differs_in_nanoseconds":      100 * second,
+		"changed_inside":              100 * second,
+		"moved":                       300 * second,
+		filepath.Join("moved", "sub"): 100 * second,
+		"only_at_destination":         200 * second,
+	}
+	actions := []action.SyncAction{
+		action.MoveFileAction{BasePath: "/dst", RelativeFromPath: filepath.Join("changed_inside", "a.txt"),
+			RelativeToPath: "a.txt"},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join("/dst", "created")},
+		action.MoveDirectoryAction{BasePath: "/dst", RelativeFromPath: "moved", RelativeToPath: "moved_into_place"},
+	}
+	touch := func(relativePath string) action.SyncAction {
+		return action.PropagateDirTimestampAction{SourceBaseDirPath: "/src", DestinationBaseDirPath: "/dst",
+			RelativePath: relativePath}
+	}
+	assert.Equal(t, []action.SyncAction{
+		touch("changed_inside"),
+		touch("created"),
+		touch("differs"),
+		touch("moved_into_place"),
+	}, ComputeDirTimestampActions("/src", sourceDirs, "/dst", destinationDirs, actions, SyncOptions{}))
+	// Sub-second differences count only with nanosecond precision, and differences within window don't count:
+	assert.Contains(t, ComputeDirTimestampActions("/src", sourceDirs, "/dst", destinationDirs, actions,
+		SyncOptions{NanosecondPrecision: true}), touch("differs_in_nanoseconds"))
+	assert.NotContains(t, ComputeDirTimestampActions("/src", sourceDirs, "/dst", destinationDirs, actions,
+		SyncOptions{ModifyWindow: 100 * time.Second}), touch("differs"))
+}
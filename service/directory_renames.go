@@ -0,0 +1,114 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directoryRename is a directory at destination that was renamed/moved, as a whole, to a directory at source
+type directoryRename struct {
+	// from is path of directory at destination
+	from string
+	// to is path of directory at source
+	to string
+}
+
+// findDirectoryRenames finds directories at destination that were renamed/moved as a whole at source: every file
+// under the directory at destination is matched with the file at the same sub-path under the directory at source,
+// and vice versa. Only the outermost of such directories are returned.
+func findDirectoryRenames(sourceDirPath string, sourceFiles map[string]entity.FileMeta,
+	destinationDirPath string, destinationFiles map[string]entity.FileMeta, matches map[string]string,
+) []directoryRename {
+	numMatches := map[directoryRename]int{}
+	for orphanAtSource, candidateAtDestination := range matches {
+		for _, rename := range commonParentDirectories(orphanAtSource, candidateAtDestination) {
+			numMatches[rename]++
+		}
+	}
+	if len(numMatches) == 0 {
+		return nil
+	}
+	numSourceFiles, numDestinationFiles := countFilesInDirectories(sourceFiles),
+		countFilesInDirectories(destinationFiles)
+	renames := make([]directoryRename, 0, len(numMatches))
+	for rename, n := range numMatches {
+		if n != numSourceFiles[rename.to] || n != numDestinationFiles[rename.from] {
+			// only some of the files were moved
+			continue
+		}
+		if numSourceFiles[rename.from] > 0 || numDestinationFiles[rename.to] > 0 {
+			// directory is still needed at source or already exists at destination
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(destinationDirPath, rename.to)); !os.IsNotExist(err) {
+			continue
+		}
+		// If source is nested inside destination, it must not be moved along:
+		if lib.IsInsideDirectory(filepath.Join(destinationDirPath, rename.from), sourceDirPath) {
+			continue
+		}
+		renames = append(renames, rename)
+	}
+	// Outermost directories first:
+	sort.Slice(renames, func(i, j int) bool {
+		di, dj := strings.Count(renames[i].from, string(filepath.Separator)),
+			strings.Count(renames[j].from, string(filepath.Separator))
+		if di != dj {
+			return di < dj
+		}
+		if renames[i].from != renames[j].from {
+			return renames[i].from < renames[j].from
+		}
+		return renames[i].to < renames[j].to
+	})
+	outermost := make([]directoryRename, 0, len(renames))
+	for _, rename := range renames {
+		isCovered := false
+		for _, o := range outermost {
+			if isSameOrInside(o.from, rename.from) || isSameOrInside(o.to, rename.to) {
+				isCovered = true
+				break
+			}
+		}
+		if !isCovered {
+			outermost = append(outermost, rename)
+		}
+	}
+	return outermost
+}
+
+// commonParentDirectories lists pairs of parent directories of given paths, under which the paths are same. For
+// example, for "b/x/y/f.txt" and "a/x/y/f.txt", these would be "b/x/y" & "a/x/y", "b/x" & "a/x" and "b" & "a".
+func commonParentDirectories(sourcePath string, destinationPath string) []directoryRename {
+	sourceParts := strings.Split(sourcePath, string(filepath.Separator))
+	destinationParts := strings.Split(destinationPath, string(filepath.Separator))
+	var renames []directoryRename
+	i, j := len(sourceParts)-1, len(destinationParts)-1
+	for ; i > 0 && j > 0 && sourceParts[i] == destinationParts[j]; i, j = i-1, j-1 {
+		renames = append(renames, directoryRename{
+			from: filepath.Join(destinationParts[:j]...),
+			to:   filepath.Join(sourceParts[:i]...),
+		})
+	}
+	return renames
+}
+
+// countFilesInDirectories counts files under each directory (at any depth)
+func countFilesInDirectories(files map[string]entity.FileMeta) map[string]int {
+	counts := map[string]int{}
+	for path := range files {
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			counts[dir]++
+		}
+	}
+	return counts
+}
+
+// isSameOrInside checks whether relative path is same as given directory or is inside it
+func isSameOrInside(dirPath string, path string) bool {
+	return path == dirPath || strings.HasPrefix(path, dirPath+string(filepath.Separator))
+}
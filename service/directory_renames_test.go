@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeSyncActionsDirectoryRename(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// "photos" was renamed to "archive/pictures" and "docs" was renamed to "documents" (but one file inside it was
+	// deleted and one was modified):
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"archive/pictures/a.jpg":        "a",
+		"archive/pictures/2023/b.jpg":   "b",
+		"archive/pictures/2023/c/d.jpg": "d",
+		"documents/e.txt":               "e",
+		"documents/f.txt":               "modified f",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"photos/a.jpg":        "a",
+		"photos/2023/b.jpg":   "b",
+		"photos/2023/c/d.jpg": "d",
+		"docs/e.txt":          "e",
+		"docs/f.txt":          "f",
+		"docs/g.txt":          "g",
+	})
+	modTime := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(destinationDirPath, "photos", "a.jpg"), modTime, modTime))
+	actions, savings := computeSyncActionsAndSavings(t, sourceDirPath, destinationDirPath, SyncOptions{})
+	assert.Equal(t, []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "archive")},
+		action.MoveDirectoryAction{BasePath: destinationDirPath, RelativeFromPath: "photos",
+			RelativeToPath: filepath.Join("archive", "pictures")},
+		action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath, DestinationBaseDirPath: destinationDirPath,
+			SourceFileRelativePath:      filepath.Join("archive", "pictures", "a.jpg"),
+			DestinationFileRelativePath: filepath.Join("archive", "pictures", "a.jpg")},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "documents")},
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: filepath.Join("docs", "e.txt"),
+			RelativeToPath: filepath.Join("documents", "e.txt")},
+	}, actions)
+	// Each file whose transfer is saved (all but "f.txt", of 1 byte each) is counted once:
+	assert.Equal(t, int64(4), savings)
+	assert.Equal(t, []string{filepath.Join("documents", "f.txt")}, FindUnmatchedOrphans([]string{
+		filepath.Join("archive", "pictures", "a.jpg"),
+		filepath.Join("archive", "pictures", "2023", "b.jpg"),
+		filepath.Join("documents", "e.txt"),
+		filepath.Join("documents", "f.txt"),
+	}, actions))
+	for _, a := range actions {
+		assert.NoError(t, a.Perform(nil))
+	}
+	destinationFiles, _, err := FindFilesFromDirectory(context.Background(), destinationDirPath,
+		set.NewThreadUnsafeSet[string]())
+	assert.NoError(t, err)
+	assert.Contains(t, destinationFiles, filepath.Join("archive", "pictures", "2023", "c", "d.jpg"))
+	assert.NotContains(t, destinationFiles, filepath.Join("photos", "a.jpg"))
+}
+
+func TestCommonParentDirectories(t *testing.T) {
+	assert.Equal(t, []directoryRename{
+		{from: filepath.Join("a", "x", "y"), to: filepath.Join("b", "x", "y")},
+		{from: filepath.Join("a", "x"), to: filepath.Join("b", "x")},
+		{from: "a", to: "b"},
+	}, commonParentDirectories(filepath.Join("b", "x", "y", "f.txt"), filepath.Join("a", "x", "y", "f.txt")))
+	assert.Empty(t, commonParentDirectories("f.txt", filepath.Join("a", "f.txt")))
+	assert.Empty(t, commonParentDirectories(filepath.Join("a", "f.txt"), filepath.Join("a", "g.txt")))
+}
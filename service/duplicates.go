@@ -0,0 +1,55 @@
+package service
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"sort"
+)
+
+// matchedFile is an orphan at source along with the candidate at destination it's matched with
+type matchedFile struct {
+	orphan, candidate string
+}
+
+// computeDuplicateRemovals computes actions that remove stale duplicates at destination: candidates that don't exist
+// at source, aren't matched with any orphan (nor moved along with a directory) and have same digest as a file that's
+// in place, i.e. is (or is moved) at path of the orphan it's matched with (see inPlace). As `rsync --delete` would
+// delete such files anyway, nothing is lost, since their contents remain at destination. Empty files, files whose
+// digests couldn't be computed and hard links to the file in place are never removed (and, while performing the
+// actions, contents of both files are compared byte by byte, see action.RemoveFileAction).
+func computeDuplicateRemovals(destinationDirPath string, destinationFiles map[string]entity.FileMeta,
+	candidateFilesToDigests lib.SafeMap[string, entity.FileDigest], matches map[string]string,
+	directoryRenames []directoryRename, inPlace map[entity.FileDigest]matchedFile,
+	existsAtSource func(destinationPath string) bool,
+) []action.SyncAction {
+	matched := set.NewThreadUnsafeSetWithSize[string](len(matches))
+	for _, candidate := range matches {
+		matched.Add(candidate)
+	}
+	movedDirectories := make([]string, 0, len(directoryRenames))
+	for _, rename := range directoryRenames {
+		movedDirectories = append(movedDirectories, rename.from)
+	}
+	var duplicates []string
+	for candidate, digest := range candidateFilesToDigests.Data {
+		kept, isInPlace := inPlace[digest]
+		if !isInPlace || digest == (entity.FileDigest{}) || destinationFiles[candidate].Size <= 0 ||
+			existsAtSource(candidate) || matched.Contains(candidate) || isInsideAnyOf(movedDirectories, candidate) ||
+			destinationFiles[candidate].IsHardLinkOf(destinationFiles[kept.candidate]) {
+			continue
+		}
+		duplicates = append(duplicates, candidate)
+	}
+	sort.Strings(duplicates)
+	removals := make([]action.SyncAction, 0, len(duplicates))
+	for _, duplicate := range duplicates {
+		removals = append(removals, action.RemoveFileAction{
+			BasePath:                destinationDirPath,
+			RelativePath:            duplicate,
+			RelativeDuplicateOfPath: inPlace[candidateFilesToDigests.Get(duplicate)].orphan,
+		})
+	}
+	return removals
+}
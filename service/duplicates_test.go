@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// removalsIn returns only the file removals among actions
+func removalsIn(actions []action.SyncAction) []action.SyncAction {
+	var removals []action.SyncAction
+	for _, a := range actions {
+		if _, isRemoval := a.(action.RemoveFileAction); isRemoval {
+			removals = append(removals, a)
+		}
+	}
+	return removals
+}
+
+func TestComputeSyncActionsRemoveDuplicates(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"new/a.jpg":  "photo a",
+		"keep/a.jpg": "photo a",
+		"empty.txt":  "",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"old/a.jpg":      "photo a",
+		"old/a copy.jpg": "photo a",
+		// Exists at source (with same contents as the file moved), so it's never removed:
+		"keep/a.jpg": "photo a",
+		// One of these is moved, and the other is left alone, as empty files are never removed:
+		"empty1.txt": "",
+		"empty2.txt": "",
+		// Not at source, but with contents not at destination otherwise:
+		"unrelated.txt": "unrelated",
+	})
+	assert.NoError(t, os.Link(filepath.Join(destinationDirPath, "old", "a.jpg"),
+		filepath.Join(destinationDirPath, "old", "a link.jpg")))
+	assert.Empty(t, removalsIn(computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{})))
+	assert.Empty(t, removalsIn(computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{
+		RemoveDuplicates: true, OnlyTimestamp: true,
+	})))
+	actions := computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{RemoveDuplicates: true})
+	assert.Contains(t, actions, action.MoveFileAction{BasePath: destinationDirPath,
+		RelativeFromPath: filepath.Join("old", "a.jpg"), RelativeToPath: filepath.Join("new", "a.jpg")})
+	// Hard link to the file moved is left alone, as removing it would free no space:
+	assert.Equal(t, []action.SyncAction{
+		action.RemoveFileAction{BasePath: destinationDirPath, RelativePath: filepath.Join("old", "a copy.jpg"),
+			RelativeDuplicateOfPath: filepath.Join("new", "a.jpg")},
+	}, removalsIn(actions))
+	for _, a := range action.SortByDependencies(actions, action.Settings{}) {
+		assert.NoError(t, a.Perform(nil), "%s", a)
+	}
+	for _, path := range []string{"new/a.jpg", "old/a link.jpg", "keep/a.jpg", "empty.txt", "unrelated.txt"} {
+		assert.FileExists(t, filepath.Join(destinationDirPath, path))
+	}
+	assert.NoFileExists(t, filepath.Join(destinationDirPath, "old", "a copy.jpg"))
+}
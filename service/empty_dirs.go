@@ -0,0 +1,109 @@
+package service
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"os"
+	"path/filepath"
+)
+
+// Modes of pruning of empty directories at destination (see ComputeEmptyDirRemovals)
+const (
+	// PruneEmptyDirsLeft removes directories that sync actions leave empty
+	PruneEmptyDirsLeft = "left"
+	// PruneEmptyDirsAll removes directories that were empty already too
+	PruneEmptyDirsAll = "all"
+)
+
+// PruneEmptyDirsModes lists all valid modes of pruning of empty directories
+var PruneEmptyDirsModes = []string{PruneEmptyDirsLeft, PruneEmptyDirsAll}
+
+// ComputeEmptyDirRemovals computes actions that remove directories at destination that would be empty once given
+// actions are performed, since everything inside them is moved away (or removed). In PruneEmptyDirsAll mode,
+// directories that are empty already are removed too. Directories that are excluded (as while scanning) and whatever's
+// inside them are left as they are, and so is destination directory itself. Directories are removed deepest first.
+func ComputeEmptyDirRemovals(destinationDirPath string, exclusions set.Set[string], excludedDirPaths set.Set[string],
+	ignoreRules *lib.IgnoreMatcher, actions []action.SyncAction, mode string,
+) ([]action.SyncAction, error) {
+	exclusionMatcher, exclusionsErr := lib.NewExclusionMatcher(exclusions)
+	if exclusionsErr != nil {
+		return nil, exclusionsErr
+	}
+	movedAway := set.NewThreadUnsafeSet[string]()
+	// Directories that something is moved, copied or created into (these can't be left empty):
+	arrivedInto := set.NewThreadUnsafeSet[string]()
+	// Directories that something is moved away from (only these can be left empty):
+	departedFrom := set.NewThreadUnsafeSet[string]()
+	addParents := func(dirs set.Set[string], path string) {
+		for dir := filepath.Dir(path); lib.IsInsideDirectory(destinationDirPath, dir); dir = filepath.Dir(dir) {
+			dirs.Add(dir)
+		}
+	}
+	for _, a := range actions {
+		var from, to string
+		switch syncAction := a.(type) {
+		case action.MoveFileAction:
+			from = filepath.Join(syncAction.BasePath, syncAction.RelativeFromPath)
+			to = filepath.Join(syncAction.BasePath, syncAction.RelativeToPath)
+		case action.MoveDirectoryAction:
+			from = filepath.Join(syncAction.BasePath, syncAction.RelativeFromPath)
+			to = filepath.Join(syncAction.BasePath, syncAction.RelativeToPath)
+		case action.SymlinkMoveAction:
+			from = filepath.Join(syncAction.BasePath, syncAction.RelativeFromPath)
+			to = filepath.Join(syncAction.BasePath, syncAction.RelativeToPath)
+		case action.RemoveFileAction:
+			from = filepath.Join(syncAction.BasePath, syncAction.RelativePath)
+		case action.CopyFileAction:
+			to = filepath.Join(syncAction.BasePath, syncAction.RelativeToPath)
+		case action.MakeDirectoryAction:
+			arrivedInto.Add(syncAction.AbsoluteDirPath)
+			to = syncAction.AbsoluteDirPath
+		default:
+			continue
+		}
+		if from != "" {
+			movedAway.Add(from)
+			addParents(departedFrom, from)
+		}
+		if to != "" {
+			addParents(arrivedInto, to)
+		}
+	}
+	var removals []action.SyncAction
+	// prune lists directory at given path, adds removals of its subdirectories that can be removed (and of itself, if
+	// it can be) and tells whether it was empty before the actions and whether it's removed
+	var prune func(dirPath string) (wasEmpty bool, isRemoved bool)
+	prune = func(dirPath string) (wasEmpty bool, isRemoved bool) {
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			return false, false
+		}
+		wasEmpty, isLeftEmpty := true, true
+		for _, entry := range entries {
+			path := filepath.Join(dirPath, entry.Name())
+			if movedAway.Contains(path) {
+				wasEmpty = false
+				continue
+			}
+			isDescended := entry.IsDir() && !exclusionMatcher.Matches(entry.Name()) &&
+				!excludedDirPaths.Contains(path) && !isIgnored(ignoreRules, destinationDirPath, path, entry) &&
+				(mode == PruneEmptyDirsAll || departedFrom.Contains(path))
+			if !isDescended {
+				wasEmpty, isLeftEmpty = false, false
+				continue
+			}
+			subDirWasEmpty, subDirIsRemoved := prune(path)
+			wasEmpty = wasEmpty && subDirWasEmpty
+			isLeftEmpty = isLeftEmpty && subDirIsRemoved
+		}
+		isRemoved = isLeftEmpty && !arrivedInto.Contains(dirPath) && dirPath != destinationDirPath &&
+			(!wasEmpty || mode == PruneEmptyDirsAll)
+		if isRemoved {
+			removals = append(removals, action.RemoveDirectoryAction{AbsoluteDirPath: dirPath})
+		}
+		return wasEmpty, isRemoved
+	}
+	prune(destinationDirPath)
+	return removals, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeEmptyDirRemovals(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		filepath.Join("old", "a.txt"):               "a",
+		filepath.Join("old2", "sub", "b.txt"):       "b",
+		filepath.Join("kept", "c.txt"):              "c",
+		filepath.Join("kept", "d.txt"):              "d",
+		filepath.Join("old3", "e.txt"):              "e",
+		filepath.Join("old4", "f.txt"):              "f",
+		filepath.Join("old4", "Thumbs.db"):          "thumbnails",
+		filepath.Join("old5", "g.txt"):              "g",
+		filepath.Join("refilled", "h.txt"):          "h",
+		filepath.Join("pictures", "2021", "i.jpg"):  "i",
+		filepath.Join("pictures", "2021", "j.jpeg"): "j",
+		filepath.Join("old6", "k.txt"):              "i",
+	})
+	for _, emptyDir := range []string{"empty", filepath.Join("old3", "empty")} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, emptyDir), 0755))
+	}
+	move := func(from, to string) action.SyncAction {
+		return action.MoveFileAction{BasePath: dir, RelativeFromPath: from, RelativeToPath: to}
+	}
+	actions := []action.SyncAction{
+		move(filepath.Join("old", "a.txt"), "a.txt"),
+		move(filepath.Join("old2", "sub", "b.txt"), "b.txt"),
+		move(filepath.Join("kept", "c.txt"), "c.txt"),
+		move(filepath.Join("old3", "e.txt"), "e.txt"),
+		move(filepath.Join("old4", "f.txt"), "f.txt"),
+		action.MoveDirectoryAction{BasePath: dir, RelativeFromPath: "old5", RelativeToPath: "new5"},
+		move(filepath.Join("refilled", "h.txt"), "h.txt"),
+		move("c.txt", filepath.Join("refilled", "c.txt")),
+		move(filepath.Join("pictures", "2021", "i.jpg"), filepath.Join("pictures", "i.jpg")),
+		move(filepath.Join("pictures", "2021", "j.jpeg"), filepath.Join("pictures", "j.jpeg")),
+		action.RemoveFileAction{BasePath: dir, RelativePath: filepath.Join("old6", "k.txt"),
+			RelativeDuplicateOfPath: filepath.Join("pictures", "i.jpg")},
+	}
+	exclusions := set.NewThreadUnsafeSet[string]("Thumbs.db")
+	noDirs := set.NewThreadUnsafeSet[string]()
+	removals, err := ComputeEmptyDirRemovals(dir, exclusions, noDirs, nil, actions, PruneEmptyDirsLeft)
+	assert.NoError(t, err)
+	remove := func(relativePath string) action.SyncAction {
+		return action.RemoveDirectoryAction{AbsoluteDirPath: filepath.Join(dir, relativePath)}
+	}
+	assert.ElementsMatch(t, []action.SyncAction{remove("old"), remove(filepath.Join("old2", "sub")), remove("old2"),
+		remove(filepath.Join("pictures", "2021")), remove("old6")}, removals)
+	// Directories are removed deepest first:
+	assert.Less(t, indexOf(removals, remove(filepath.Join("old2", "sub"))), indexOf(removals, remove("old2")))
+	removals, err = ComputeEmptyDirRemovals(dir, exclusions, noDirs, nil, actions, PruneEmptyDirsAll)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []action.SyncAction{remove("old"), remove(filepath.Join("old2", "sub")), remove("old2"),
+		remove(filepath.Join("pictures", "2021")), remove("empty"), remove(filepath.Join("old3", "empty")),
+		remove("old3"), remove("old6")}, removals)
+	// Excluded directories are left as they are:
+	removals, err = ComputeEmptyDirRemovals(dir, exclusions, set.NewThreadUnsafeSet[string](filepath.Join(dir, "old2")),
+		nil, actions, PruneEmptyDirsLeft)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []action.SyncAction{remove("old"), remove(filepath.Join("pictures", "2021")),
+		remove("old6")}, removals)
+}
+
+func indexOf(actions []action.SyncAction, a action.SyncAction) int {
+	for i, other := range actions {
+		if other == a {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"sort"
+)
+
+// OtherExtensions is what ExtensionStats of files with extensions beyond the top ones are called (see
+// StatsByExtension)
+const OtherExtensions = "(other)"
+
+// ExtensionStats is the number and total size of files with an extension (as in lib.GetFileExt, empty for files
+// without one)
+type ExtensionStats struct {
+	Extension string
+	NumFiles  int
+	Size      int64
+}
+
+// StatsByExtension groups files by their extensions, sorted by total size (largest first): only top extensions are
+// listed, with the rest summed up in a last entry for OtherExtensions (top being 0 meaning all extensions are listed)
+func StatsByExtension(files map[string]entity.FileMeta, top int) []ExtensionStats {
+	statsMap := make(map[string]*ExtensionStats)
+	for path, fileMeta := range files {
+		ext := lib.GetFileExt(path)
+		stats, exists := statsMap[ext]
+		if !exists {
+			stats = &ExtensionStats{Extension: ext}
+			statsMap[ext] = stats
+		}
+		stats.NumFiles++
+		stats.Size += fileMeta.Size
+	}
+	statsList := make([]ExtensionStats, 0, len(statsMap))
+	for _, stats := range statsMap {
+		statsList = append(statsList, *stats)
+	}
+	sort.Slice(statsList, func(i, j int) bool {
+		if statsList[i].Size != statsList[j].Size {
+			return statsList[i].Size > statsList[j].Size
+		}
+		return statsList[i].Extension < statsList[j].Extension
+	})
+	if top <= 0 || len(statsList) <= top {
+		return statsList
+	}
+	other := ExtensionStats{Extension: OtherExtensions}
+	for _, stats := range statsList[top:] {
+		other.NumFiles += stats.NumFiles
+		other.Size += stats.Size
+	}
+	return append(statsList[:top], other)
+}
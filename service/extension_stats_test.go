@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStatsByExtension(t *testing.T) {
+	files := map[string]entity.FileMeta{
+		"photos/1.JPG":  {Size: 300},
+		"photos/2.jpg":  {Size: 200},
+		"videos/1.mp4":  {Size: 400},
+		"notes.txt":     {Size: 20},
+		"README":        {Size: 10},
+		"docs/plan.pdf": {Size: 20},
+	}
+	assert.Equal(t, []ExtensionStats{
+		{Extension: ".jpg", NumFiles: 2, Size: 500},
+		{Extension: ".mp4", NumFiles: 1, Size: 400},
+		{Extension: ".pdf", NumFiles: 1, Size: 20},
+		{Extension: ".txt", NumFiles: 1, Size: 20},
+		{Extension: "", NumFiles: 1, Size: 10},
+	}, StatsByExtension(files, 0))
+	assert.Equal(t, []ExtensionStats{
+		{Extension: ".jpg", NumFiles: 2, Size: 500},
+		{Extension: ".mp4", NumFiles: 1, Size: 400},
+		{Extension: OtherExtensions, NumFiles: 3, Size: 50},
+	}, StatsByExtension(files, 2))
+	assert.Len(t, StatsByExtension(files, 5), 5)
+	assert.Empty(t, StatsByExtension(map[string]entity.FileMeta{}, 2))
+}
@@ -1,88 +1,196 @@
 package service
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"github.com/cespare/xxhash/v2"
 	"github.com/m-manu/rsync-sidekick/bytesutil"
 	"github.com/m-manu/rsync-sidekick/entity"
 	"github.com/m-manu/rsync-sidekick/lib"
+	"hash"
 	"hash/crc32"
+	"io"
 	"os"
 )
 
 const (
 	thresholdFileSize = 16 * bytesutil.KIBI
+	// fileSizePerExtraSample is the file size beyond which one extra sample is read, in scaled sampling
+	fileSizePerExtraSample = bytesutil.GIBI
+	// maxExtraSamples caps number of extra samples read, in scaled sampling (so that bytes read stay bounded)
+	maxExtraSamples = 16
 )
 
+// Hash modes, i.e. how much of a file goes into its digest and through which hash function
+const (
+	// HashModeFast hashes, using CRC32, whole of small files and only a few samples of large files
+	HashModeFast = "fast"
+	// HashModeFull hashes whole file using CRC32
+	HashModeFull = "full"
+	// HashModeSHA256 hashes whole file using SHA-256
+	HashModeSHA256 = "sha256"
+	// HashModeXXHash hashes whole file using xxHash (64-bit), which has fewer collisions than CRC32 (though, on CPUs
+	// with hardware support for CRC32, it can be slower than HashModeFull, see BenchmarkFullFileHash)
+	HashModeXXHash = "xxhash"
+)
+
+// HashModes lists all valid hash modes
+var HashModes = []string{HashModeFast, HashModeFull, HashModeSHA256, HashModeXXHash}
+
+// DigestOptions decide how digests of files are computed
+type DigestOptions struct {
+	// HashMode is one of HashModes (empty meaning HashModeFast)
+	HashMode string
+	// ScaledSampling makes the number of samples read from large files grow with their size (in HashModeFast)
+	ScaledSampling bool
+}
+
 // getDigest generates entity.FileDigest of the file provided in an extremely fast manner
-// without compromising the quality of uniqueness
-func getDigest(path string) (entity.FileDigest, error) {
+// without compromising the quality of uniqueness. It also returns content type of the file (see contentTypeOf).
+func getDigest(path string, options DigestOptions) (entity.FileDigest, string, error) {
 	info, statErr := os.Lstat(path)
 	if statErr != nil {
-		return entity.FileDigest{}, statErr
+		return entity.FileDigest{}, "", statErr
 	}
-	hash, hashErr := fileHash(path)
+	return digestOf(path, info, options)
+}
+
+// digestOf is getDigest for a file whose metadata is known already (so that it's not looked up again)
+func digestOf(path string, info os.FileInfo, options DigestOptions) (entity.FileDigest, string, error) {
+	hash, contentType, hashErr := fileHash(path, info, options)
 	if hashErr != nil {
-		return entity.FileDigest{}, hashErr
+		return entity.FileDigest{}, "", hashErr
 	}
 	return entity.FileDigest{
 		FileExtension: lib.GetFileExt(path),
 		FileSize:      info.Size(),
 		FileFuzzyHash: hash,
-	}, nil
+	}, contentType, nil
 }
 
-func fileHash(path string) (string, error) {
-	fileInfo, statErr := os.Lstat(path)
-	if statErr != nil {
-		return "", fmt.Errorf("couldn't stat: %+v", statErr)
-	}
+// fileHash computes hash of the file at given path, whose metadata is fileInfo
+func fileHash(path string, fileInfo os.FileInfo, options DigestOptions) (string, string, error) {
 	if !fileInfo.Mode().IsRegular() {
-		return "", fmt.Errorf("can't compute hash of non-regular file")
+		return "", "", fmt.Errorf("can't compute hash of non-regular file")
+	}
+	switch options.HashMode {
+	case HashModeFull:
+		// Prefix encodes the hash mode, so that digests from different modes never match
+		return fullFileHash(path, "F", crc32.NewIEEE())
+	case HashModeSHA256:
+		return fullFileHash(path, "sha256:", sha256.New())
+	case HashModeXXHash:
+		return fullFileHash(path, "xxh64:", xxhash.New())
 	}
 	var prefix string
 	var bytes []byte
 	var fileReadErr error
-	if fileInfo.Size() <= thresholdFileSize {
+	numMiddleSamples := 1
+	if options.ScaledSampling {
+		numMiddleSamples += numExtraSamples(fileInfo.Size())
+	}
+	windows, canSample := crucialWindows(fileInfo.Size(), numMiddleSamples)
+	if fileInfo.Size() <= thresholdFileSize || !canSample {
 		prefix = "f"
 		bytes, fileReadErr = os.ReadFile(path)
 	} else {
+		// Sampling scheme is part of the prefix, so that digests from different schemes never match
 		prefix = "s"
-		bytes, fileReadErr = readCrucialBytes(path, fileInfo.Size())
+		if numMiddleSamples > 1 {
+			prefix = fmt.Sprintf("s%d:", numMiddleSamples)
+		}
+		bytes, fileReadErr = readCrucialBytes(path, windows)
 	}
 	if fileReadErr != nil {
-		return "", fmt.Errorf("couldn't calculate hash: %+v", fileReadErr)
+		return "", "", fmt.Errorf("couldn't calculate hash: %+v", fileReadErr)
 	}
 	h := crc32.NewIEEE()
 	_, hashErr := h.Write(bytes)
 	if hashErr != nil {
-		return "", fmt.Errorf("error while computing hash: %+v", hashErr)
+		return "", "", fmt.Errorf("error while computing hash: %+v", hashErr)
 	}
 	hash := h.Sum(nil)
-	return prefix + hex.EncodeToString(hash), nil
+	// Both in full and sampled reads, bytes start with the beginning of the file
+	return prefix + hex.EncodeToString(hash), contentTypeOf(bytes), nil
+}
+
+// fullFileHash hashes whole of the file using given hash function
+func fullFileHash(path string, prefix string, h hash.Hash) (string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't open file: %+v", err)
+	}
+	defer file.Close()
+	firstBytes := make([]byte, sniffLen)
+	n, fErr := io.ReadFull(file, firstBytes)
+	if fErr != nil && fErr != io.EOF && fErr != io.ErrUnexpectedEOF {
+		return "", "", fmt.Errorf("couldn't read file: %+v", fErr)
+	}
+	firstBytes = firstBytes[:n]
+	h.Write(firstBytes)
+	if _, cErr := io.Copy(h, file); cErr != nil {
+		return "", "", fmt.Errorf("couldn't calculate hash: %+v", cErr)
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil)), contentTypeOf(firstBytes), nil
 }
 
-func readCrucialBytes(filePath string, fileSize int64) ([]byte, error) {
+// numExtraSamples computes number of samples to be read, in addition to the usual ones, for a file of given size
+func numExtraSamples(fileSize int64) int {
+	extra := fileSize / fileSizePerExtraSample
+	if extra > maxExtraSamples {
+		return maxExtraSamples
+	}
+	return int(extra)
+}
+
+// window is a region of a file
+type window struct {
+	offset int64
+	length int64
+}
+
+// crucialWindows computes regions of a file that are read for computing its digest: one at the beginning, one at the
+// end and numMiddleSamples regions evenly spread in between. If the file isn't large enough for these regions to not
+// overlap, canSample is false (and the whole file should be read instead).
+func crucialWindows(fileSize int64, numMiddleSamples int) (windows []window, canSample bool) {
+	windows = make([]window, 0, numMiddleSamples+2)
+	windows = append(windows, window{offset: 0, length: thresholdFileSize / 2})
+	for i := 1; i <= numMiddleSamples; i++ {
+		windows = append(windows, window{
+			offset: fileSize * int64(i) / int64(numMiddleSamples+1),
+			length: thresholdFileSize / 4,
+		})
+	}
+	windows = append(windows, window{offset: fileSize - thresholdFileSize/4, length: thresholdFileSize / 4})
+	for i := 1; i < len(windows); i++ {
+		if windows[i-1].offset+windows[i-1].length > windows[i].offset {
+			return nil, false
+		}
+	}
+	return windows, true
+}
+
+// readCrucialBytes reads given regions of the file
+func readCrucialBytes(filePath string, windows []window) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	firstBytes := make([]byte, thresholdFileSize/2)
-	_, fErr := file.ReadAt(firstBytes, 0)
-	if fErr != nil {
-		return nil, fmt.Errorf("couldn't read first few bytes (maybe file is corrupted?): %+v", fErr)
-	}
-	middleBytes := make([]byte, thresholdFileSize/4)
-	_, mErr := file.ReadAt(middleBytes, fileSize/2)
-	if mErr != nil {
-		return nil, fmt.Errorf("couldn't read middle bytes (maybe file is corrupted?): %+v", mErr)
-	}
-	lastBytes := make([]byte, thresholdFileSize/4)
-	_, lErr := file.ReadAt(lastBytes, fileSize-thresholdFileSize/4)
-	if lErr != nil {
-		return nil, fmt.Errorf("couldn't read end bytes (maybe file is corrupted?): %+v", lErr)
-	}
-	bytes := append(append(firstBytes, middleBytes...), lastBytes...)
+	var totalLength int64
+	for _, w := range windows {
+		totalLength += w.length
+	}
+	bytes := make([]byte, 0, totalLength)
+	for _, w := range windows {
+		windowBytes := make([]byte, w.length)
+		_, rErr := file.ReadAt(windowBytes, w.offset)
+		if rErr != nil {
+			return nil, fmt.Errorf("couldn't read %d bytes at offset %d (maybe file is corrupted?): %+v",
+				w.length, w.offset, rErr)
+		}
+		bytes = append(bytes, windowBytes...)
+	}
 	return bytes, nil
 }
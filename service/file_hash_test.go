@@ -3,7 +3,11 @@ package service
 import (
 	"github.com/m-manu/rsync-sidekick/bytesutil"
 	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -16,11 +20,198 @@ func TestGetDigest(t *testing.T) {
 		runtime.GOROOT() + "/src/io/io.go",
 		runtime.GOROOT() + "/src/io/pipe.go",
 	}
+	// Digest is a prefix (that identifies the hash mode) followed by hash in hex:
+	patterns := map[string]string{
+		HashModeFast:   "^[fs][0-9a-f]{8}$",
+		HashModeFull:   "^F[0-9a-f]{8}$",
+		HashModeSHA256: "^sha256:[0-9a-f]{64}$",
+		HashModeXXHash: "^xxh64:[0-9a-f]{16}$",
+	}
+	assert.Equal(t, len(HashModes), len(patterns))
 	for _, path := range paths {
-		digest, err := getDigest(path)
-		assert.Equal(t, nil, err)
-		assert.Greater(t, digest.FileSize, int64(0))
-		assert.Equal(t, 9, len(digest.FileFuzzyHash))
-		assert.Greater(t, len(digest.FileExtension), 0)
+		for mode, pattern := range patterns {
+			digest, _, err := getDigest(path, DigestOptions{HashMode: mode})
+			assert.Equal(t, nil, err)
+			assert.Greater(t, digest.FileSize, int64(0))
+			assert.Regexp(t, pattern, digest.FileFuzzyHash, "mode %s", mode)
+			assert.Greater(t, len(digest.FileExtension), 0)
+		}
+	}
+}
+
+// hashOf computes hash of the file at given path
+func hashOf(tb testing.TB, path string, options DigestOptions) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		tb.Fatalf("couldn't stat %s: %+v", path, err)
+	}
+	hash, _, err := fileHash(path, info, options)
+	return hash, err
+}
+
+func TestNonRegularFile(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link")
+	assert.NoError(t, os.Symlink(runtime.GOROOT()+"/src/io/io.go", link))
+	_, _, err := getDigest(link, DigestOptions{})
+	assert.Error(t, err)
+	_, _, err = getDigest(dir, DigestOptions{})
+	assert.Error(t, err)
+}
+
+func TestNumExtraSamples(t *testing.T) {
+	assert.Equal(t, 0, numExtraSamples(100*bytesutil.KIBI))
+	assert.Equal(t, 0, numExtraSamples(bytesutil.GIBI-1))
+	assert.Equal(t, 1, numExtraSamples(bytesutil.GIBI))
+	assert.Equal(t, 3, numExtraSamples(3*bytesutil.GIBI+1))
+	assert.Equal(t, maxExtraSamples, numExtraSamples(50*bytesutil.TEBI))
+}
+
+func createSparseFile(t *testing.T, path string, size int64, contentAt int64, content string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("couldn't create %s: %+v", path, err)
+	}
+	defer file.Close()
+	if err = file.Truncate(size); err != nil {
+		t.Fatalf("couldn't truncate %s: %+v", path, err)
+	}
+	if _, err = file.WriteAt([]byte(content), contentAt); err != nil {
+		t.Fatalf("couldn't write to %s: %+v", path, err)
+	}
+}
+
+func TestScaledSampling(t *testing.T) {
+	const size = 3 * bytesutil.GIBI // 3 extra samples, so 4 middle samples at 1/5, 2/5, 3/5 and 4/5 of size
+	dir := t.TempDir()
+	path1, path2 := filepath.Join(dir, "1.bin"), filepath.Join(dir, "2.bin")
+	createSparseFile(t, path1, size, size/5, "some content")
+	createSparseFile(t, path2, size, size/5, "different content")
+	scaled := DigestOptions{ScaledSampling: true}
+	// Default sampling doesn't see the difference:
+	hash1, err1 := hashOf(t, path1, DigestOptions{})
+	hash2, err2 := hashOf(t, path2, DigestOptions{})
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, hash1, hash2)
+	// Scaled sampling does, and its digests are different from those of default sampling:
+	scaledHash1, err1 := hashOf(t, path1, scaled)
+	scaledHash2, err2 := hashOf(t, path2, scaled)
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NotEqual(t, scaledHash1, scaledHash2)
+	assert.NotEqual(t, hash1, scaledHash1)
+	assert.True(t, strings.HasPrefix(scaledHash1, "s4:"))
+	// Digests are stable across runs:
+	scaledHash1Again, _ := hashOf(t, path1, scaled)
+	assert.Equal(t, scaledHash1, scaledHash1Again)
+}
+
+func TestHashModes(t *testing.T) {
+	dir := t.TempDir()
+	// Same size, same first, middle and last bytes, but different content elsewhere:
+	content1 := make([]byte, 100*bytesutil.KIBI)
+	content2 := make([]byte, 100*bytesutil.KIBI)
+	content2[30*bytesutil.KIBI] = 1
+	path1, path2 := filepath.Join(dir, "1.raw"), filepath.Join(dir, "2.raw")
+	assert.NoError(t, os.WriteFile(path1, content1, 0644))
+	assert.NoError(t, os.WriteFile(path2, content2, 0644))
+	digests := map[string][2]string{}
+	for _, mode := range HashModes {
+		digest1, _, err1 := getDigest(path1, DigestOptions{HashMode: mode})
+		digest2, _, err2 := getDigest(path2, DigestOptions{HashMode: mode})
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		digests[mode] = [2]string{digest1.FileFuzzyHash, digest2.FileFuzzyHash}
+	}
+	assert.Equal(t, digests[HashModeFast][0], digests[HashModeFast][1])
+	assert.NotEqual(t, digests[HashModeFull][0], digests[HashModeFull][1])
+	assert.NotEqual(t, digests[HashModeSHA256][0], digests[HashModeSHA256][1])
+	assert.NotEqual(t, digests[HashModeXXHash][0], digests[HashModeXXHash][1])
+	// Digests from different modes never match:
+	assert.NotEqual(t, digests[HashModeFast][0], digests[HashModeFull][0])
+	assert.NotEqual(t, digests[HashModeFull][0], digests[HashModeSHA256][0])
+	assert.NotEqual(t, digests[HashModeFull][0], digests[HashModeXXHash][0])
+	assert.True(t, strings.HasPrefix(digests[HashModeSHA256][0], "sha256:"))
+}
+
+func TestCrucialBytesBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[int64]string{
+		16 * bytesutil.KIBI:     "f",
+		16*bytesutil.KIBI + 1:   "s",
+		20 * bytesutil.KIBI:     "s",
+		24 * bytesutil.KIBI:     "s",
+		24*bytesutil.KIBI + 100: "s",
+	}
+	for size, expectedPrefix := range tests {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(i % 251)
+		}
+		path := filepath.Join(dir, "file.bin")
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+		hash, err := hashOf(t, path, DigestOptions{})
+		assert.NoError(t, err, "size %d", size)
+		assert.Equal(t, expectedPrefix, hash[:1], "size %d", size)
+		if expectedPrefix == "s" {
+			windows, canSample := crucialWindows(size, 1)
+			assert.True(t, canSample)
+			for i := 1; i < len(windows); i++ {
+				assert.LessOrEqual(t, windows[i-1].offset+windows[i-1].length, windows[i].offset, "size %d", size)
+			}
+			assert.Equal(t, size, windows[len(windows)-1].offset+windows[len(windows)-1].length)
+		}
+	}
+	// Windows that would overlap mean the whole file is to be read:
+	_, canSample := crucialWindows(20*bytesutil.KIBI, 4)
+	assert.False(t, canSample)
+}
+
+// BenchmarkGetDigest computes digests of all files in Go's source tree
+func BenchmarkGetDigest(b *testing.B) {
+	var paths []string
+	visit := func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	}
+	walkErr := filepath.WalkDir(filepath.Join(runtime.GOROOT(), "src"), visit)
+	if walkErr != nil {
+		b.Fatalf("couldn't walk Go's source tree: %+v", walkErr)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			if _, _, err := getDigest(path, DigestOptions{}); err != nil {
+				b.Fatalf("couldn't hash %s: %+v", path, err)
+			}
+		}
+	}
+}
+
+// BenchmarkFullFileHash compares speeds of HashModeFull and HashModeXXHash on a 1 GiB file
+func BenchmarkFullFileHash(b *testing.B) {
+	const size = bytesutil.GIBI
+	path := filepath.Join(b.TempDir(), "1GiB.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatalf("couldn't create %s: %+v", path, err)
+	}
+	// Sparse file, so that it doesn't take up 1 GiB of storage:
+	if err = file.Truncate(size); err != nil {
+		b.Fatalf("couldn't truncate %s: %+v", path, err)
+	}
+	file.Close()
+	for _, mode := range []string{HashModeFull, HashModeXXHash} {
+		b.Run(mode, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, hashErr := hashOf(b, path, DigestOptions{HashMode: mode}); hashErr != nil {
+					b.Fatalf("couldn't hash %s: %+v", path, hashErr)
+				}
+			}
+		})
 	}
 }
@@ -1,31 +1,140 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/rsync-sidekick/entity"
 	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const numFilesGuess = 10_000
 
 // FindFilesFromDirectory finds all regular files in a given directory
-// (Very similar to `find` command on unix-like operating systems)
-func FindFilesFromDirectory(dirPath string, excludedFiles set.Set[string]) (
+// (Very similar to `find` command on unix-like operating systems). Scanning stops, with ctx's error, if ctx is done.
+func FindFilesFromDirectory(ctx context.Context, dirPath string, excludedFiles set.Set[string]) (
 	files map[string]entity.FileMeta,
 	totalSizeOfFiles int64,
 	findFilesErr error,
+) {
+	return FindFilesFromDirectoryExcludingDirs(ctx, dirPath, excludedFiles, set.NewThreadUnsafeSet[string](), nil)
+}
+
+// FindFilesFromDirectoryExcludingDirs is same as FindFilesFromDirectory, except that directories at given paths
+// (which must be of the same form as dirPath, e.g. absolute) are skipped entirely, and so are files/directories
+// matching ignoreRules (which may be nil)
+func FindFilesFromDirectoryExcludingDirs(ctx context.Context, dirPath string, excludedFiles set.Set[string],
+	excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher) (
+	files map[string]entity.FileMeta,
+	totalSizeOfFiles int64,
+	findFilesErr error,
+) {
+	files, totalSizeOfFiles, _, findFilesErr = findFilesAndSymlinks(ctx, dirPath, excludedFiles, excludedDirPaths,
+		ignoreRules, false)
+	return
+}
+
+// FindFilesAndSymlinksFromDirectory is same as FindFilesFromDirectoryExcludingDirs, except that symbolic links in the
+// directory are found too, along with their targets (links are not followed), in the same walk
+func FindFilesAndSymlinksFromDirectory(ctx context.Context, dirPath string, excludedFiles set.Set[string],
+	excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher) (
+	files map[string]entity.FileMeta,
+	totalSizeOfFiles int64,
+	links map[string]string,
+	findFilesErr error,
+) {
+	return findFilesAndSymlinks(ctx, dirPath, excludedFiles, excludedDirPaths, ignoreRules, true)
+}
+
+// findFilesAndSymlinks finds regular files in a given directory and, if withSymlinks is set, symbolic links too (see
+// FindFilesAndSymlinksFromDirectory)
+func findFilesAndSymlinks(ctx context.Context, dirPath string, excludedFiles set.Set[string],
+	excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher, withSymlinks bool) (
+	files map[string]entity.FileMeta,
+	totalSizeOfFiles int64,
+	links map[string]string,
+	findFilesErr error,
 ) {
 	allFiles := make(map[string]entity.FileMeta, numFilesGuess)
-	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+	allLinks := map[string]string{}
+	var mx sync.Mutex
+	visit := func(path string, d fs.DirEntry) {
+		if withSymlinks && d.Type()&fs.ModeSymlink != 0 {
+			target, readErr := os.Readlink(path)
+			if readErr != nil {
+				fmte.Warnf("couldn't read symbolic link \"%s\": %+v\n", path, readErr)
+				return
+			}
+			relativePath, relErr := filepath.Rel(dirPath, path)
+			if relErr != nil {
+				fmte.Warnf("couldn't comprehend path \"%s\": %+v\n", path, relErr)
+				return
+			}
+			mx.Lock()
+			allLinks[relativePath] = target
+			mx.Unlock()
+		} else if d.Type().IsRegular() {
+			info, infoErr := d.Info()
+			if infoErr != nil {
+				fmte.Warnf("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
+				return
+			}
+			relativePath, relErr := filepath.Rel(dirPath, path)
+			if relErr != nil {
+				fmte.Warnf("couldn't comprehend path \"%s\": %+v\n", path, relErr)
+				return
+			}
+			uid, gid := lib.OwnerOf(info)
+			mx.Lock()
+			allFiles[relativePath] = entity.FileMeta{
+				Size:                info.Size(),
+				ModifiedTimestamp:   info.ModTime().Unix(),
+				ModifiedNanoseconds: int64(info.ModTime().Nanosecond()),
+				Inode:               inodeOf(info),
+				Permissions:         info.Mode().Perm(),
+				UID:                 uid,
+				GID:                 gid,
+			}
+			totalSizeOfFiles += info.Size()
+			mx.Unlock()
+		}
+	}
+	err := walkDirectoryConcurrently(ctx, dirPath, excludedFiles, excludedDirPaths, ignoreRules, visit)
+	if err != nil {
+		return map[string]entity.FileMeta{}, 0, map[string]string{}, fmt.Errorf("couldn't scan directory %s: %v",
+			dirPath, err)
+	}
+	return allFiles, totalSizeOfFiles, allLinks, nil
+}
+
+// walkDirectory walks the directory tree, calling visit for every file/directory that isn't excluded
+// (whether by name, by path of directory, by ignoreRules or for being a Mac dot file), until ctx is done (in which case
+// ctx's error is returned). See walkDirectoryConcurrently too.
+func walkDirectory(ctx context.Context, dirPath string, excludedFiles set.Set[string], excludedDirPaths set.Set[string],
+	ignoreRules *lib.IgnoreMatcher, visit func(path string, d fs.DirEntry),
+) error {
+	exclusionMatcher, exclusionsErr := lib.NewExclusionMatcher(excludedFiles)
+	if exclusionsErr != nil {
+		return exclusionsErr
+	}
+	return filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			fmte.PrintfErr("skipping \"%s\": %+v\n", path, err)
+			fmte.Warnf("skipping \"%s\": %+v\n", path, err)
+		}
+		if d.IsDir() && excludedDirPaths.Contains(path) {
+			return filepath.SkipDir
 		}
 		// If the file/directory is in excluded files list, ignore it
-		if excludedFiles.Contains(d.Name()) {
+		if exclusionMatcher.Matches(d.Name()) {
 			if d.IsDir() {
 				return filepath.SkipDir
 			}
@@ -35,27 +144,25 @@ func FindFilesFromDirectory(dirPath string, excludedFiles set.Set[string]) (
 		if strings.HasPrefix(d.Name(), "._") {
 			return nil
 		}
-		if d.Type().IsRegular() {
-			info, infoErr := d.Info()
-			if infoErr != nil {
-				fmte.PrintfErr("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
-				return nil
-			}
-			relativePath, relErr := filepath.Rel(dirPath, path)
-			if relErr != nil {
-				fmte.PrintfErr("couldn't comprehend path \"%s\": %+v\n", path, relErr)
-				return nil
-			}
-			allFiles[relativePath] = entity.FileMeta{
-				Size:              info.Size(),
-				ModifiedTimestamp: info.ModTime().Unix(),
+		if path != dirPath && isIgnored(ignoreRules, dirPath, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
-			totalSizeOfFiles += info.Size()
+			return nil
 		}
+		visit(path, d)
 		return nil
 	})
-	if err != nil {
-		return map[string]entity.FileMeta{}, 0, fmt.Errorf("couldn't scan directory %s: %v", dirPath, err)
+}
+
+// isIgnored checks whether file/directory at given path (inside dirPath) matches ignoreRules
+func isIgnored(ignoreRules *lib.IgnoreMatcher, dirPath string, path string, d fs.DirEntry) bool {
+	if ignoreRules == nil {
+		return false
+	}
+	relativePath, relErr := filepath.Rel(dirPath, path)
+	if relErr != nil {
+		return false
 	}
-	return allFiles, totalSizeOfFiles, nil
+	return ignoreRules.Matches(filepath.ToSlash(relativePath), d.IsDir())
 }
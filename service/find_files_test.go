@@ -1,15 +1,41 @@
 package service
 
 import (
+	"context"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"runtime"
 	"testing"
 )
 
 func TestFindFilesFromDirectories(t *testing.T) {
-	files, size, err := FindFilesFromDirectory(runtime.GOROOT(), set.NewThreadUnsafeSet(".gitignore", ".hidden"))
+	files, size, err := FindFilesFromDirectory(context.Background(), runtime.GOROOT(),
+		set.NewThreadUnsafeSet(".gitignore", ".hidden"))
 	assert.Equal(t, nil, err)
 	assert.Greater(t, len(files), 0)
 	assert.Greater(t, size, int64(0))
 }
+
+func TestFindFilesFromDirectoryWithPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"app.log":            "excluded by pattern",
+		"logs/old/app.log":   "excluded by pattern",
+		"report-01.csv":      "excluded by pattern",
+		"report-001.csv":     "included",
+		"Thumbs.db":          "excluded by name",
+		"Thumbs.db.bak":      "included",
+		"tmp_dir/file.txt":   "excluded, as directory is excluded by pattern",
+		"photos/holiday.jpg": "included",
+	})
+	files, _, err := FindFilesFromDirectory(context.Background(), dir, set.NewThreadUnsafeSet("*.log", "report-??.csv",
+		"Thumbs.db", "tmp_*"))
+	assert.NoError(t, err)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	assert.ElementsMatch(t, []string{"report-001.csv", "Thumbs.db.bak", filepath.Join("photos", "holiday.jpg")},
+		paths)
+}
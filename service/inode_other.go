@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"os"
+)
+
+// inodeOf gets device and inode number of a file from its metadata, if available (it isn't, on this platform)
+func inodeOf(os.FileInfo) entity.Inode {
+	return entity.Inode{}
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"os"
+	"syscall"
+)
+
+// inodeOf gets device and inode number of a file from its metadata, if available
+func inodeOf(fileInfo os.FileInfo) entity.Inode {
+	stat, isStat := fileInfo.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return entity.Inode{}
+	}
+	return entity.Inode{Device: uint64(stat.Dev), Number: uint64(stat.Ino)}
+}
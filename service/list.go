@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ListOptions decide what FindDirectoryResultToCsv writes
+type ListOptions struct {
+	// NulSeparated terminates each record by a NUL instead of a newline (as with 'find -print0'), with fields left
+	// unquoted: the path is whatever is before the last three commas (or four, WithDigest). This suits names of files
+	// that have newlines in them.
+	NulSeparated bool
+	// WithDigest adds digest of each file (as in its entity.FileDigest) as the last column, so that listings taken at
+	// different times tell files whose contents changed apart, even at same size and timestamp. This reads contents
+	// of all files (whole of them, unless Digest.HashMode is HashModeFast) and hence is far slower than listing.
+	WithDigest bool
+	// Header writes names of columns (see ListColumns) as the first record
+	Header bool
+	// Digest decides how digests of files are computed, WithDigest
+	Digest DigestOptions
+	// Threads is number of files hashed concurrently, WithDigest (0 meaning as per number of CPUs)
+	Threads int
+}
+
+// ListColumns are names of columns of records written by FindDirectoryResultToCsv: modification timestamp is in seconds
+// since the Unix epoch, followed by its sub-second part in nanoseconds (the last column being there only with
+// ListOptions.WithDigest)
+var ListColumns = []string{"path", "size", "modified_timestamp", "modified_nanoseconds", "digest"}
+
+// FindDirectoryResultToCsv writes files in given directory, along with their sizes and modification timestamps (and
+// digests, as per options), as CSV records sorted by path (after a header, as per options)
+func FindDirectoryResultToCsv(ctx context.Context, dirPath string, excludedFiles set.Set[string], writer io.Writer,
+	options ListOptions,
+) error {
+	files, _, fErr := FindFilesFromDirectory(ctx, dirPath, excludedFiles)
+	if fErr != nil {
+		return fErr
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var digests map[string]string
+	if options.WithDigest {
+		var dErr error
+		digests, dErr = computeDigests(ctx, dirPath, paths, options)
+		if dErr != nil {
+			return dErr
+		}
+	}
+	var bw *bufio.Writer
+	var cw *csv.Writer
+	if options.NulSeparated {
+		bw = bufio.NewWriter(writer)
+	} else {
+		cw = csv.NewWriter(writer)
+	}
+	write := func(record []string) error {
+		var wErr error
+		if options.NulSeparated {
+			_, wErr = fmt.Fprintf(bw, "%s\x00", strings.Join(record, ","))
+		} else {
+			wErr = cw.Write(record)
+		}
+		if wErr != nil {
+			return fmt.Errorf("error while writing record %+v: %+v", record, wErr)
+		}
+		return nil
+	}
+	if options.Header {
+		numColumns := len(ListColumns) - 1
+		if options.WithDigest {
+			numColumns++
+		}
+		if wErr := write(ListColumns[:numColumns]); wErr != nil {
+			return wErr
+		}
+	}
+	for _, path := range paths {
+		fileMeta := files[path]
+		record := []string{path, strconv.FormatInt(fileMeta.Size, 10),
+			strconv.FormatInt(fileMeta.ModifiedTimestamp, 10), strconv.FormatInt(fileMeta.ModifiedNanoseconds, 10)}
+		if options.WithDigest {
+			record = append(record, digests[path])
+		}
+		if wErr := write(record); wErr != nil {
+			return wErr
+		}
+	}
+	if options.NulSeparated {
+		return bw.Flush()
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// computeDigests computes digests of given files in parallel, stopping early (with ctx's error) if ctx is done. Files
+// that can't be hashed are warned about, and are left out.
+func computeDigests(ctx context.Context, dirPath string, paths []string, options ListOptions,
+) (map[string]string, error) {
+	digests := make(map[string]string, len(paths))
+	var mx sync.Mutex
+	err := forEachInParallel(ctx, paths, options.Threads, func(path string) error {
+		digest, _, dErr := getDigest(filepath.Join(dirPath, path), options.Digest)
+		if dErr != nil {
+			fmte.Warnf("couldn't compute digest of file \"%s\" (leaving it blank): %+v\n", path, dErr)
+			return nil
+		}
+		mx.Lock()
+		digests[path] = digest.FileFuzzyHash
+		mx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFindDirectoryResultToCsv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("names of files can't have newlines on this platform")
+	}
+	dirPath := t.TempDir()
+	writeTestFiles(t, dirPath, map[string]string{"a\nb.txt": "text"})
+	info, err := os.Stat(filepath.Join(dirPath, "a\nb.txt"))
+	assert.NoError(t, err)
+	timestamp := strconv.FormatInt(info.ModTime().Unix(), 10) + "," + strconv.Itoa(info.ModTime().Nanosecond())
+	var csvOutput, nulOutput bytes.Buffer
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	assert.NoError(t, FindDirectoryResultToCsv(context.Background(), dirPath, noExclusions, &csvOutput,
+		ListOptions{}))
+	assert.Equal(t, "\"a\nb.txt\",4,"+timestamp+"\n", csvOutput.String())
+	assert.NoError(t, FindDirectoryResultToCsv(context.Background(), dirPath, noExclusions, &nulOutput,
+		ListOptions{NulSeparated: true}))
+	assert.Equal(t, "a\nb.txt,4,"+timestamp+"\x00", nulOutput.String())
+}
+
+func TestFindDirectoryResultToCsvWithDigest(t *testing.T) {
+	dirPath := t.TempDir()
+	writeTestFiles(t, dirPath, map[string]string{"a.txt": "text"})
+	info, err := os.Stat(filepath.Join(dirPath, "a.txt"))
+	assert.NoError(t, err)
+	options := ListOptions{WithDigest: true, Digest: DigestOptions{HashMode: HashModeFull}}
+	digest, _, err := getDigest(filepath.Join(dirPath, "a.txt"), options.Digest)
+	assert.NoError(t, err)
+	var output bytes.Buffer
+	assert.NoError(t, FindDirectoryResultToCsv(context.Background(), dirPath, set.NewThreadUnsafeSet[string](),
+		&output, options))
+	before := output.String()
+	assert.Equal(t, "a.txt,4,"+strconv.FormatInt(info.ModTime().Unix(), 10)+","+
+		strconv.Itoa(info.ModTime().Nanosecond())+","+digest.FileFuzzyHash+"\n", before)
+	// Same size and same timestamp, but different contents:
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "a.txt"), []byte("TEXT"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(dirPath, "a.txt"), info.ModTime(), info.ModTime()))
+	output.Reset()
+	assert.NoError(t, FindDirectoryResultToCsv(context.Background(), dirPath, set.NewThreadUnsafeSet[string](),
+		&output, options))
+	assert.NotEqual(t, before, output.String())
+}
+
+func TestFindDirectoryResultToCsvSorted(t *testing.T) {
+	dirPath := t.TempDir()
+	writeTestFiles(t, dirPath, map[string]string{"b.txt": "b", "a.txt": "a", filepath.Join("c", "d.txt"): "d",
+		"c.txt": "c", filepath.Join("a", "e.txt"): "e"})
+	list := func() string {
+		var output bytes.Buffer
+		assert.NoError(t, FindDirectoryResultToCsv(context.Background(), dirPath, set.NewThreadUnsafeSet[string](),
+			&output, ListOptions{Header: true}))
+		return output.String()
+	}
+	output := list()
+	var paths []string
+	for i, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if i == 0 {
+			assert.Equal(t, "path,size,modified_timestamp,modified_nanoseconds", line)
+			continue
+		}
+		paths = append(paths, line[:strings.Index(line, ",")])
+	}
+	assert.Equal(t, []string{"a.txt", filepath.Join("a", "e.txt"), "b.txt", "c.txt", filepath.Join("c", "d.txt")},
+		paths)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, output, list())
+	}
+}
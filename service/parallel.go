@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// forEachInParallel calls f for each of given items, in up to parallelism goroutines at a time (as many as there are
+// CPUs, if it's not positive). Once ctx is done or f returns an error, the rest of items are left out: ctx's error is
+// returned in the former case, and f's error in the latter.
+func forEachInParallel[T any](ctx context.Context, items []T, parallelism int, f func(item T) error) error {
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	if parallelism > len(items) {
+		parallelism = len(items)
+	}
+	itemsToHandle := make(chan T, len(items))
+	for _, item := range items {
+		itemsToHandle <- item
+	}
+	close(itemsToHandle)
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for item := range itemsToHandle {
+				if workCtx.Err() != nil {
+					continue
+				}
+				if err := f(item); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return firstErr
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// numWalkWorkersPerCPU is number of goroutines per CPU that read directories concurrently (reading directories is
+// mostly waiting on storage, so this is more than one)
+const numWalkWorkersPerCPU = 2
+
+// walkDirectoryConcurrently is same as walkDirectory, except that subdirectories are read concurrently by a bounded
+// pool of goroutines. So, visit may be called concurrently (and in no particular order).
+func walkDirectoryConcurrently(ctx context.Context, dirPath string, excludedFiles set.Set[string],
+	excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher, visit func(path string, d fs.DirEntry),
+) error {
+	exclusionMatcher, exclusionsErr := lib.NewExclusionMatcher(excludedFiles)
+	if exclusionsErr != nil {
+		return exclusionsErr
+	}
+	rootInfo, statErr := os.Lstat(dirPath)
+	if statErr != nil {
+		return statErr
+	}
+	root := fs.FileInfoToDirEntry(rootInfo)
+	if !root.IsDir() || excludedDirPaths.Contains(dirPath) || exclusionMatcher.Matches(root.Name()) ||
+		strings.HasPrefix(root.Name(), "._") {
+		// Nothing to do concurrently
+		return walkDirectory(ctx, dirPath, excludedFiles, excludedDirPaths, ignoreRules, visit)
+	}
+	visit(dirPath, root)
+	queue := newDirQueue(dirPath)
+	var wg sync.WaitGroup
+	numWorkers := numWalkWorkersPerCPU * runtime.NumCPU()
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := queue.pop()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					// Directories still in queue are drained, without being read
+					queue.done()
+					continue
+				}
+				entries, readErr := os.ReadDir(dir)
+				if readErr != nil {
+					fmte.Warnf("skipping \"%s\": %+v\n", dir, readErr)
+				}
+				for _, d := range entries {
+					path := filepath.Join(dir, d.Name())
+					// Same rules as in walkDirectory:
+					if d.IsDir() && excludedDirPaths.Contains(path) {
+						continue
+					}
+					if exclusionMatcher.Matches(d.Name()) {
+						continue
+					}
+					if strings.HasPrefix(d.Name(), "._") {
+						continue
+					}
+					if isIgnored(ignoreRules, dirPath, path, d) {
+						continue
+					}
+					visit(path, d)
+					if d.IsDir() {
+						queue.push(path)
+					}
+				}
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// dirQueue is a goroutine-safe queue of directories to be read, that keeps track of directories being read
+type dirQueue struct {
+	mx   sync.Mutex
+	cond *sync.Cond
+	dirs []string
+	// numPending is number of directories that are either in queue or being read
+	numPending int
+}
+
+func newDirQueue(dirPath string) *dirQueue {
+	q := &dirQueue{dirs: []string{dirPath}, numPending: 1}
+	q.cond = sync.NewCond(&q.mx)
+	return q
+}
+
+func (q *dirQueue) push(dirPath string) {
+	q.mx.Lock()
+	q.dirs = append(q.dirs, dirPath)
+	q.numPending++
+	q.mx.Unlock()
+	q.cond.Signal()
+}
+
+// pop takes a directory out of queue, waiting if needed. It returns false once all directories have been read.
+func (q *dirQueue) pop() (string, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	for len(q.dirs) == 0 && q.numPending > 0 {
+		q.cond.Wait()
+	}
+	if q.numPending == 0 {
+		return "", false
+	}
+	dirPath := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dirPath, true
+}
+
+// done marks a directory taken out of queue as read
+func (q *dirQueue) done() {
+	q.mx.Lock()
+	q.numPending--
+	isFinished := q.numPending == 0
+	q.mx.Unlock()
+	if isFinished {
+		q.cond.Broadcast()
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// walkedPaths collects paths visited by given walker
+func walkedPaths(t testing.TB,
+	walk func(context.Context, string, set.Set[string], set.Set[string], *lib.IgnoreMatcher,
+		func(string, fs.DirEntry)) error,
+	dirPath string, excludedFiles set.Set[string], excludedDirPaths set.Set[string], ignoreRules *lib.IgnoreMatcher,
+) set.Set[string] {
+	paths := set.NewSet[string]()
+	var mx sync.Mutex
+	visit := func(path string, d fs.DirEntry) {
+		if _, infoErr := d.Info(); infoErr != nil {
+			t.Fatalf("couldn't get metadata of %s: %+v", path, infoErr)
+		}
+		mx.Lock()
+		paths.Add(path)
+		mx.Unlock()
+	}
+	err := walk(context.Background(), dirPath, excludedFiles, excludedDirPaths, ignoreRules, visit)
+	if err != nil {
+		t.Fatalf("couldn't walk %s: %+v", dirPath, err)
+	}
+	return paths
+}
+
+func TestWalkDirectoryConcurrently(t *testing.T) {
+	goRootSrc := filepath.Join(runtime.GOROOT(), "src")
+	excludedFiles := set.NewThreadUnsafeSet[string]("testdata", "*.s", "._*")
+	excludedDirPaths := set.NewThreadUnsafeSet[string](filepath.Join(goRootSrc, "cmd"))
+	ignoreRules, err := lib.NewIgnoreMatcher([]string{"*_test.go", "!/io/*_test.go", "internal/"})
+	assert.NoError(t, err)
+	serial := walkedPaths(t, walkDirectory, goRootSrc, excludedFiles, excludedDirPaths, ignoreRules)
+	concurrent := walkedPaths(t, walkDirectoryConcurrently, goRootSrc, excludedFiles, excludedDirPaths, ignoreRules)
+	assert.Greater(t, serial.Cardinality(), 1000)
+	assert.True(t, serial.Equal(concurrent))
+	assert.False(t, concurrent.Contains(filepath.Join(goRootSrc, "cmd", "go", "main.go")))
+	assert.False(t, concurrent.Contains(filepath.Join(goRootSrc, "os", "os_test.go")))
+	assert.True(t, concurrent.Contains(filepath.Join(goRootSrc, "io", "io_test.go")))
+	assert.False(t, concurrent.Contains(filepath.Join(goRootSrc, "internal")))
+	// Same, when given path isn't a directory to be walked:
+	filePath := filepath.Join(goRootSrc, "io", "io.go")
+	assert.Equal(t, set.NewSet[string](filePath), walkedPaths(t, walkDirectoryConcurrently, filePath,
+		excludedFiles, excludedDirPaths, nil))
+	assert.Equal(t, 0, walkedPaths(t, walkDirectoryConcurrently, goRootSrc, excludedFiles,
+		set.NewThreadUnsafeSet[string](goRootSrc), nil).Cardinality())
+	assert.Error(t, walkDirectoryConcurrently(context.Background(), filepath.Join(goRootSrc, "non_existent"),
+		excludedFiles, excludedDirPaths, nil, func(string, fs.DirEntry) {}))
+}
+
+func TestWalkDirectoryCanceled(t *testing.T) {
+	goRootSrc := filepath.Join(runtime.GOROOT(), "src")
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, walk := range []func(context.Context, string, set.Set[string], set.Set[string], *lib.IgnoreMatcher,
+		func(string, fs.DirEntry)) error{walkDirectory, walkDirectoryConcurrently} {
+		numVisited := 0
+		err := walk(ctx, goRootSrc, noExclusions, noExclusions, nil, func(string, fs.DirEntry) {
+			numVisited++
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		// At most, the directory itself is visited:
+		assert.LessOrEqual(t, numVisited, 1)
+	}
+	_, _, err := FindFilesFromDirectory(ctx, goRootSrc, noExclusions)
+	assert.ErrorContains(t, err, context.Canceled.Error())
+}
+
+// createDeepTree creates a tree of directories of given depth, with each directory having given number of
+// subdirectories and files
+func createDeepTree(b *testing.B, dirPath string, depth int, fanOut int) {
+	for i := 0; i < fanOut; i++ {
+		filePath := filepath.Join(dirPath, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(filePath, []byte("content"), 0644); err != nil {
+			b.Fatalf("couldn't create file: %+v", err)
+		}
+	}
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < fanOut; i++ {
+		subDirPath := filepath.Join(dirPath, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(subDirPath, 0755); err != nil {
+			b.Fatalf("couldn't create directory: %+v", err)
+		}
+		createDeepTree(b, subDirPath, depth-1, fanOut)
+	}
+}
+
+func BenchmarkWalkDirectory(b *testing.B) {
+	dirPath := b.TempDir()
+	createDeepTree(b, dirPath, 5, 5)
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			walkedPaths(b, walkDirectory, dirPath, noExclusions, noExclusions, nil)
+		}
+	})
+	b.Run("concurrent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			walkedPaths(b, walkDirectoryConcurrently, dirPath, noExclusions, noExclusions, nil)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+)
+
+// PathNormalizer converts relative paths at source and at destination to a canonical form, so that paths that
+// differ only in encoding of file names are recognized as same. Zero value of this does no conversion.
+type PathNormalizer struct {
+	sourceDecoder      *encoding.Decoder
+	destinationDecoder *encoding.Decoder
+	unicodeNormalize   bool
+}
+
+// NewPathNormalizer creates a PathNormalizer that decodes file names at source and at destination from given
+// encodings (IANA names such as "ISO-8859-1", empty meaning UTF-8) and, if unicodeNormalize is set, converts them
+// to Unicode normalization form C (so that, for example, macOS-style decomposed names match composed ones)
+func NewPathNormalizer(sourceEncoding, destinationEncoding string, unicodeNormalize bool) (PathNormalizer, error) {
+	sourceDecoder, sErr := decoderFor(sourceEncoding)
+	if sErr != nil {
+		return PathNormalizer{}, fmt.Errorf("invalid source encoding: %+v", sErr)
+	}
+	destinationDecoder, dErr := decoderFor(destinationEncoding)
+	if dErr != nil {
+		return PathNormalizer{}, fmt.Errorf("invalid destination encoding: %+v", dErr)
+	}
+	return PathNormalizer{
+		sourceDecoder:      sourceDecoder,
+		destinationDecoder: destinationDecoder,
+		unicodeNormalize:   unicodeNormalize,
+	}, nil
+}
+
+func decoderFor(encodingName string) (*encoding.Decoder, error) {
+	if encodingName == "" || strings.EqualFold(encodingName, "utf-8") || strings.EqualFold(encodingName, "utf8") {
+		return nil, nil
+	}
+	e, err := ianaindex.IANA.Encoding(encodingName)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, fmt.Errorf("encoding %s is not supported", encodingName)
+	}
+	return e.NewDecoder(), nil
+}
+
+// IsNoOp tells whether this normalizer leaves all paths unchanged
+func (n PathNormalizer) IsNoOp() bool {
+	return n.sourceDecoder == nil && n.destinationDecoder == nil && !n.unicodeNormalize
+}
+
+// Source converts a relative path at source to its canonical form
+func (n PathNormalizer) Source(path string) string {
+	return n.normalize(n.sourceDecoder, path)
+}
+
+// Destination converts a relative path at destination to its canonical form
+func (n PathNormalizer) Destination(path string) string {
+	return n.normalize(n.destinationDecoder, path)
+}
+
+func (n PathNormalizer) normalize(decoder *encoding.Decoder, path string) string {
+	if decoder != nil {
+		if decoded, err := decoder.String(path); err == nil {
+			path = decoded
+		}
+	}
+	if n.unicodeNormalize {
+		path = norm.NFC.String(path)
+	}
+	return path
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const (
+	nameNFC    = "caf\u00e9/r\u00e9sum\u00e9.txt"    // 'é' as a single code point
+	nameNFD    = "cafe\u0301/re\u0301sume\u0301.txt" // 'e' followed by combining acute accent
+	nameLatin1 = "caf\xe9/r\xe9sum\xe9.txt"          // 'é' as a single ISO-8859-1 byte
+)
+
+func TestPathNormalizer(t *testing.T) {
+	var noOp PathNormalizer
+	assert.True(t, noOp.IsNoOp())
+	assert.NotEqual(t, noOp.Source(nameNFD), noOp.Destination(nameNFC))
+	unicodeNormalizer, err := NewPathNormalizer("", "UTF-8", true)
+	assert.NoError(t, err)
+	assert.Equal(t, unicodeNormalizer.Source(nameNFD), unicodeNormalizer.Destination(nameNFC))
+	latin1Normalizer, err := NewPathNormalizer("", "ISO-8859-1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, nameNFC, latin1Normalizer.Destination(nameLatin1))
+	assert.Equal(t, latin1Normalizer.Source(nameNFC), latin1Normalizer.Destination(nameLatin1))
+	_, err = NewPathNormalizer("no-such-encoding", "", false)
+	assert.Error(t, err)
+}
+
+func TestFindOrphansNormalized(t *testing.T) {
+	meta := entity.FileMeta{Size: 10, ModifiedTimestamp: 1_600_000_000}
+	sourceFiles := map[string]entity.FileMeta{nameNFD: meta, "other.txt": meta}
+	destinationFiles := map[string]entity.FileMeta{nameLatin1: meta, "other.txt": meta}
+	assert.Equal(t, []string{nameNFD}, FindOrphans(sourceFiles, destinationFiles))
+	normalizer, err := NewPathNormalizer("", "ISO-8859-1", true)
+	assert.NoError(t, err)
+	assert.Empty(t, FindOrphansNormalized(sourceFiles, destinationFiles, normalizer))
+	existsAtSource := existsAtSourceFunc(sourceFiles, normalizer)
+	assert.True(t, existsAtSource(nameLatin1))
+	assert.False(t, existsAtSource("something_else.txt"))
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"path/filepath"
+	"sort"
+)
+
+// ComputeSymlinkActions identifies symbolic links at destination that were renamed/moved at source. Target of a
+// symbolic link is its "content": a link at source that doesn't exist at destination is matched with a link at
+// destination that doesn't exist at source, when both have the same target and no other such links do.
+func ComputeSymlinkActions(sourceLinks map[string]string, destinationDirPath string,
+	destinationLinks map[string]string,
+) []action.SyncAction {
+	orphansByTarget := map[string][]string{}
+	for sourcePath, target := range sourceLinks {
+		if _, existsAtDestination := destinationLinks[sourcePath]; !existsAtDestination {
+			orphansByTarget[target] = append(orphansByTarget[target], sourcePath)
+		}
+	}
+	candidatesByTarget := map[string][]string{}
+	for destinationPath, target := range destinationLinks {
+		if _, existsAtSource := sourceLinks[destinationPath]; !existsAtSource {
+			candidatesByTarget[target] = append(candidatesByTarget[target], destinationPath)
+		}
+	}
+	matches := map[string]string{}
+	for target, orphans := range orphansByTarget {
+		candidates := candidatesByTarget[target]
+		if len(orphans) == 1 && len(candidates) == 1 {
+			matches[orphans[0]] = candidates[0]
+		}
+	}
+	orphansWithMatches := make([]string, 0, len(matches))
+	for orphanAtSource := range matches {
+		orphansWithMatches = append(orphansWithMatches, orphanAtSource)
+	}
+	sort.Strings(orphansWithMatches)
+	actions := make([]action.SyncAction, 0, len(matches))
+	uniqueness := set.NewThreadUnsafeSetWithSize[string](len(matches))
+	for _, orphanAtSource := range orphansWithMatches {
+		parentDir := filepath.Dir(filepath.Join(destinationDirPath, orphanAtSource))
+		if !lib.IsReadableDirectory(parentDir) {
+			directoryAction := action.MakeDirectoryAction{
+				AbsoluteDirPath: parentDir,
+			}
+			if !uniqueness.Contains(directoryAction.Uniqueness()) {
+				actions = append(actions, directoryAction)
+				uniqueness.Add(directoryAction.Uniqueness())
+			}
+		}
+		actions = append(actions, action.SymlinkMoveAction{
+			BasePath:         destinationDirPath,
+			RelativeFromPath: matches[orphanAtSource],
+			RelativeToPath:   orphanAtSource,
+		})
+	}
+	return actions
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFindFilesAndSymlinksFromDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links can't be created on this platform without special privileges")
+	}
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"backups/2024-01-01/data.txt": "data",
+		"tmp/file.txt":                "file",
+	})
+	assert.NoError(t, os.Symlink(filepath.Join("backups", "2024-01-01"), filepath.Join(dir, "latest")))
+	assert.NoError(t, os.Symlink("file.txt", filepath.Join(dir, "tmp", "link")))
+	files, _, links, err := FindFilesAndSymlinksFromDirectory(context.Background(), dir,
+		set.NewThreadUnsafeSet[string]("tmp"), set.NewThreadUnsafeSet[string](), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"latest": filepath.Join("backups", "2024-01-01")}, links)
+	// Symbolic links aren't regular files:
+	assert.Len(t, files, 1)
+	assert.Contains(t, files, filepath.Join("backups", "2024-01-01", "data.txt"))
+}
+
+func TestComputeSymlinkActions(t *testing.T) {
+	dir := t.TempDir()
+	sourceLinks := map[string]string{
+		"latest":        "backups/2024-02-01",
+		"links/docs":    "/home/user/docs",
+		"unchanged":     "a",
+		"retargeted":    "b",
+		"ambiguous_one": "c",
+		"ambiguous_two": "c",
+		"new":           "d",
+	}
+	destinationLinks := map[string]string{
+		"current":       "backups/2024-02-01",
+		"docs":          "/home/user/docs",
+		"unchanged":     "a",
+		"retargeted":    "old_b",
+		"ambiguous_old": "c",
+	}
+	actions := ComputeSymlinkActions(sourceLinks, dir, destinationLinks)
+	assert.Equal(t, []action.SyncAction{
+		action.SymlinkMoveAction{BasePath: dir, RelativeFromPath: "current", RelativeToPath: "latest"},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(dir, "links")},
+		action.SymlinkMoveAction{BasePath: dir, RelativeFromPath: "docs",
+			RelativeToPath: filepath.Join("links", "docs")},
+	}, actions)
+}
@@ -1,152 +1,423 @@
 package service
 
 import (
-	"encoding/csv"
+	"context"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/rsync-sidekick/action"
 	"github.com/m-manu/rsync-sidekick/entity"
 	"github.com/m-manu/rsync-sidekick/fmte"
 	"github.com/m-manu/rsync-sidekick/lib"
-	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	indexBuildErrorCountTolerance = 20
 )
 
+// SyncOptions tweaks how ComputeSyncActions matches files at source with files at destination
+type SyncOptions struct {
+	// Repair matches files even when many orphans at source have the same digest and paths of files at destination
+	// with that digest aren't related to theirs (see areRelatedPaths), by assigning them to files at destination with
+	// the most similar paths (this fixes files left behind by earlier runs)
+	Repair bool
+	// IncludedContentTypes, if non-empty, restricts matching to files of these content types (see contentTypeOf)
+	IncludedContentTypes set.Set[string]
+	// ExcludedContentTypes excludes files of these content types from matching
+	ExcludedContentTypes set.Set[string]
+	// MinSize is the size below which files are not matched at all (and are left to rsync)
+	MinSize int64
+	// MaxSize, if non-zero, is the size above which files are not matched at all (e.g. VM images, which are expensive
+	// to hash and are unlikely to have been moved)
+	MaxSize int64
+	// IncludedExtensions, if non-empty, restricts matching to files with these extensions (lower case, with leading
+	// dot, as returned by lib.GetFileExt). Files must satisfy this, MinSize, MaxSize and exclusions, all.
+	IncludedExtensions set.Set[string]
+	// IgnoreExtension matches files regardless of their extensions, by sizes and digests alone (e.g. "a.jpeg" renamed
+	// to "b.jpg" at source). Since there are more candidates for each orphan, chances of a wrong match (of files
+	// with same sizes and digests, but different contents) are slightly higher.
+	IgnoreExtension bool
+	// Verify compares full contents of each matched pair of files, and drops the match if they differ
+	Verify bool
+	// Checksum considers a file at source to have a counterpart at destination only if the file at same path there has
+	// same digest, regardless of modification timestamps (see FindOrphansByChecksum)
+	Checksum bool
+	// Digest decides how digests of files are computed
+	Digest DigestOptions
+	// DigestCache, if not nil, serves digests of files that haven't changed since they were cached (and caches the
+	// ones computed)
+	DigestCache *DigestCache
+	// Threads is number of files hashed concurrently while building indexes (0 meaning as per number of CPUs, and 1
+	// meaning files are hashed one at a time)
+	Threads int
+	// Symlinks also matches symbolic links at source with those at destination, by their targets, so that the links
+	// themselves are moved (they're never followed, see ComputeSymlinkActions)
+	Symlinks bool
+	// CaseInsensitiveFS tells whether filesystem at destination is case-insensitive: one of CaseInsensitiveFSModes
+	// (empty meaning CaseInsensitiveFSAuto). On such a filesystem, files aren't moved to paths taken by other files
+	// with names differing only in case.
+	CaseInsensitiveFS string
+	// IgnoreRules, if not nil, leaves out matching files/directories while scanning source and destination (in
+	// addition to exclusions)
+	IgnoreRules *lib.IgnoreMatcher
+	// ArchiveDirPath, if set, is a directory where files with same contents as orphans at source are looked for, so
+	// that they are copied into destination instead of being transferred by rsync (see ComputeArchiveCopies)
+	ArchiveDirPath string
+	// NoTimestamp suppresses propagation of timestamps (for when rsync is run with -t, which fixes them anyway), so
+	// that only renames/movements of files are propagated
+	NoTimestamp bool
+	// Permissions propagates permissions of files at source to matched files at destination, where they differ (see
+	// action.ChmodAction)
+	Permissions bool
+	// Owner and Group propagate user and group (respectively) owning files at source to matched files at destination,
+	// where they differ (see action.ChownAction)
+	Owner, Group bool
+	// OnlyTimestamp suppresses propagation of renames/movements (and copies from archive directory), so that only
+	// timestamps of files that are at same paths at source and destination are propagated (this can't be set along
+	// with NoTimestamp)
+	OnlyTimestamp bool
+	// DirTimestamps also propagates modification timestamps of directories at source to directories at same paths at
+	// destination (see ComputeDirTimestampActions)
+	DirTimestamps bool
+	// RemoveDuplicates also removes stale duplicates at destination: files that don't exist at source, having same
+	// contents as files that are matched with orphans at source and are (or are moved) at their paths (see
+	// computeDuplicateRemovals). This is ignored along with OnlyTimestamp.
+	RemoveDuplicates bool
+	// PruneEmptyDirs, if set, also removes directories at destination left empty by sync actions: one of
+	// PruneEmptyDirsModes (see ComputeEmptyDirRemovals)
+	PruneEmptyDirs string
+	// ModifyWindow is how much modification timestamps of files can differ by, while still being considered same (e.g.
+	// 1s for FAT filesystems, which store them with a 2-second granularity)
+	ModifyWindow time.Duration
+	// NanosecondPrecision compares modification timestamps of files including their sub-second parts, as the command
+	// line tool does by default (without it, files are expected to be scanned with timestamps truncated to seconds,
+	// see WithoutNanoseconds)
+	NanosecondPrecision bool
+	// PathNormalizer is used to recognize files at destination that are same as files at source, except for
+	// encoding of their names (such files are never moved)
+	PathNormalizer PathNormalizer
+}
+
 // FindOrphans finds files at source that do not have corresponding files at destination.
 // File at destination must exist and have same size and same modified timestamp.
 func FindOrphans(sourceFiles, destinationFiles map[string]entity.FileMeta) []string {
+	return FindOrphansNormalized(sourceFiles, destinationFiles, PathNormalizer{})
+}
+
+// FindOrphansNormalized is same as FindOrphans, except that paths are compared after converting them to their
+// canonical forms using given PathNormalizer
+func FindOrphansNormalized(sourceFiles, destinationFiles map[string]entity.FileMeta, normalizer PathNormalizer,
+) []string {
+	return FindOrphansWithin(sourceFiles, destinationFiles, normalizer, 0)
+}
+
+// FindOrphansWithin is same as FindOrphansNormalized, except that modification timestamps of files are considered
+// same if they differ by no more than given window (see SyncOptions.ModifyWindow)
+func FindOrphansWithin(sourceFiles, destinationFiles map[string]entity.FileMeta, normalizer PathNormalizer,
+	modifyWindow time.Duration,
+) []string {
+	if !normalizer.IsNoOp() {
+		normalizedDestinationFiles := make(map[string]entity.FileMeta, len(destinationFiles))
+		for destinationPath, destinationFileMeta := range destinationFiles {
+			normalizedDestinationFiles[normalizer.Destination(destinationPath)] = destinationFileMeta
+		}
+		destinationFiles = normalizedDestinationFiles
+	}
 	orphansAtSource := make([]string, 0, len(sourceFiles)/10)
 	for sourcePath, sourceFileMeta := range sourceFiles {
-		destinationFileMeta, existsAtDestination := destinationFiles[sourcePath]
-		if !existsAtDestination || sourceFileMeta != destinationFileMeta {
+		destinationFileMeta, existsAtDestination := destinationFiles[normalizer.Source(sourcePath)]
+		if !existsAtDestination || sourceFileMeta.Size != destinationFileMeta.Size ||
+			!sourceFileMeta.IsModifiedWithin(destinationFileMeta, modifyWindow) {
 			orphansAtSource = append(orphansAtSource, sourcePath)
 		}
 	}
 	return orphansAtSource
 }
 
-func buildIndex(baseDirPath string, filesToScan []string, counter *int32,
+// FindOrphansByChecksum is same as FindOrphansWithin, except that a file at source has a counterpart at destination
+// only if the file at same path there has same size and same digest, whatever their modification timestamps are.
+// So, a file restored at destination with a different timestamp isn't an orphan, while a file with same size and
+// timestamp but different contents is. Since digests in HashModeFast are of samples of large files, whole files are
+// hashed in that mode. Hashing stops early (with ctx's error) if ctx is done.
+func FindOrphansByChecksum(ctx context.Context, sourceDirPath string, sourceFiles map[string]entity.FileMeta,
+	destinationDirPath string, destinationFiles map[string]entity.FileMeta, options SyncOptions,
+) ([]string, error) {
+	normalizer := options.PathNormalizer
+	destinationPaths := make(map[string]string, len(destinationFiles))
+	for destinationPath := range destinationFiles {
+		destinationPaths[normalizer.Destination(destinationPath)] = destinationPath
+	}
+	orphansAtSource := make([]string, 0, len(sourceFiles)/10)
+	// Files at source that have files of same size at same paths at destination (to their paths at destination):
+	sameSize := make(map[string]string, len(sourceFiles))
+	for sourcePath, sourceFileMeta := range sourceFiles {
+		destinationPath, existsAtDestination := destinationPaths[normalizer.Source(sourcePath)]
+		if !existsAtDestination || sourceFileMeta.Size != destinationFiles[destinationPath].Size {
+			orphansAtSource = append(orphansAtSource, sourcePath)
+		} else {
+			sameSize[sourcePath] = destinationPath
+		}
+	}
+	digestOptions := options.Digest
+	if digestOptions.HashMode == "" || digestOptions.HashMode == HashModeFast {
+		digestOptions = DigestOptions{HashMode: HashModeFull}
+	}
+	sourcePaths := make([]string, 0, len(sameSize))
+	for sourcePath := range sameSize {
+		sourcePaths = append(sourcePaths, sourcePath)
+	}
+	var mx sync.Mutex
+	err := forEachInParallel(ctx, sourcePaths, options.Threads, func(sourcePath string) error {
+		destinationPath := sameSize[sourcePath]
+		sourceDigest, _, sourceErr := getDigestCached(filepath.Join(sourceDirPath, sourcePath),
+			options.DigestCache, digestOptions)
+		destinationDigest, _, destinationErr := getDigestCached(filepath.Join(destinationDirPath, destinationPath),
+			options.DigestCache, digestOptions)
+		compareErr := sourceErr
+		if compareErr == nil {
+			compareErr = destinationErr
+		}
+		if compareErr != nil {
+			fmte.Warnf("couldn't compare \"%s\" with file at same path at destination (rsync will compare them): "+
+				"%+v\n", sourcePath, compareErr)
+		}
+		if compareErr != nil || sourceDigest != destinationDigest {
+			mx.Lock()
+			orphansAtSource = append(orphansAtSource, sourcePath)
+			mx.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphansAtSource, nil
+}
+
+// IndexProgress is progress of indexing of files in a directory, updated (atomically) as each file is indexed
+type IndexProgress struct {
+	// Bytes is total size of files hashed so far (it's the first field, so that it's 64-bit aligned for atomic
+	// access on 32-bit platforms)
+	Bytes int64
+	// SkippedBytes is total size of files indexed so far without being hashed (as their digests were served from
+	// cache, or as they couldn't be read), which hence needn't be waited for
+	SkippedBytes int64
+	// Files is number of files indexed so far (including the ones being hashed)
+	Files int32
+}
+
+// Load reads progress made so far
+func (p *IndexProgress) Load() IndexProgress {
+	return IndexProgress{Bytes: atomic.LoadInt64(&p.Bytes), SkippedBytes: atomic.LoadInt64(&p.SkippedBytes),
+		Files: atomic.LoadInt32(&p.Files)}
+}
+
+// buildIndex computes digests of given files (whose sizes are in files), in up to given number of goroutines at a
+// time (as many as there are CPUs, if it's not positive), stopping early (with ctx's error) if ctx is done. Files that
+// can't be hashed are warned about and left out, unless there are too many of them.
+func buildIndex(ctx context.Context, baseDirPath string, files map[string]entity.FileMeta, filesToScan []string,
+	parallelism int, progress *IndexProgress,
 	filesToDigests lib.SafeMap[string, entity.FileDigest], digestsToFiles lib.MultiMap[entity.FileDigest, string],
+	options SyncOptions,
 ) error {
-	errCount := 0
-	for _, relativePath := range filesToScan {
-		newValue := atomic.AddInt32(counter, 1)
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	var errCount int32
+	errCountTolerance := int32(indexBuildErrorCountTolerance * parallelism)
+	return forEachInParallel(ctx, filesToScan, parallelism, func(relativePath string) error {
+		newValue := atomic.AddInt32(&progress.Files, 1)
 		path := filepath.Join(baseDirPath, relativePath)
 		fmte.PrintfV("Evaluating file (#%d): %s\n", newValue, path)
-		digest, err := getDigest(path)
+		digest, contentType, isCached, err := lookUpDigest(path, options.DigestCache, options.Digest)
+		if err == nil && !isCached {
+			atomic.AddInt64(&progress.Bytes, files[relativePath].Size)
+		} else {
+			atomic.AddInt64(&progress.SkippedBytes, files[relativePath].Size)
+		}
 		if err != nil {
-			errCount++
-			fmte.PrintfErr("couldn't index file \"%s\" (skipping): %+v\n", path, err)
+			fmte.Warnf("couldn't index file \"%s\" (skipping): %+v\n", path, err)
+			if atomic.AddInt32(&errCount, 1) > errCountTolerance {
+				return fmt.Errorf("too many errors while building index")
+			}
+			return nil
 		}
-		if errCount > indexBuildErrorCountTolerance {
-			return fmt.Errorf("too many errors while building index")
+		if !isContentTypeAllowed(contentType, options) {
+			fmte.PrintfV("Skipping file of content type %s: %s\n", contentType, path)
+			return nil
+		}
+		if options.IgnoreExtension {
+			digest.FileExtension = ""
 		}
 		filesToDigests.Set(relativePath, digest)
 		digestsToFiles.Set(digest, relativePath)
-	}
-	return nil
+		return nil
+	})
 }
 
 // ComputeSyncActions identifies the diff between source and destination directories that
 // do not require actual file transfer. This is the core function of this tool.
-func ComputeSyncActions(sourceDirPath string, sourceFiles map[string]entity.FileMeta, orphansAtSource []string,
-	destinationDirPath string, destinationFiles map[string]entity.FileMeta, candidatesAtDestination []string,
-	sourceCounter *int32, destinationCounter *int32,
+// If ctx is done (e.g. on Ctrl-C) while files are being indexed, indexing stops and ctx's error is returned.
+func ComputeSyncActions(ctx context.Context, sourceDirPath string, sourceFiles map[string]entity.FileMeta,
+	orphansAtSource []string, destinationDirPath string, destinationFiles map[string]entity.FileMeta,
+	candidatesAtDestination []string, sourceProgress *IndexProgress, destinationProgress *IndexProgress,
+	options SyncOptions,
 ) (actions []action.SyncAction, savings int64, err error) {
 	orphanFilesToDigests := lib.NewSafeMap[string, entity.FileDigest]()
 	candidateFilesToDigests := lib.NewSafeMap[string, entity.FileDigest]()
 	orphanDigestsToFiles := lib.NewMultiMap[entity.FileDigest, string]()
 	candidateDigestsToFiles := lib.NewMultiMap[entity.FileDigest, string]()
-	var sourceIndexErrs, destinationIndexErrs []error
-	parallelismForSource, parallelismForDestination := getParallelism(runtime.NumCPU())
-	var wg sync.WaitGroup
-	wg.Add(parallelismForSource + parallelismForDestination)
-	for i := 0; i < parallelismForSource; i++ {
-		go func(index int) {
-			defer wg.Done()
-			low := index * len(orphansAtSource) / parallelismForSource
-			high := (index + 1) * len(orphansAtSource) / parallelismForSource
-			sourceIndexErr := buildIndex(sourceDirPath, orphansAtSource[low:high], sourceCounter,
-				orphanFilesToDigests, orphanDigestsToFiles,
-			)
-			if sourceIndexErr != nil {
-				sourceIndexErrs = append(sourceIndexErrs, sourceIndexErr)
-			}
-		}(i)
-	}
-	for i := 0; i < parallelismForDestination; i++ {
-		go func(index int) {
-			defer wg.Done()
-			low := index * len(candidatesAtDestination) / parallelismForDestination
-			high := (index + 1) * len(candidatesAtDestination) / parallelismForDestination
-			destinationIndexErr := buildIndex(destinationDirPath, candidatesAtDestination[low:high], destinationCounter,
-				candidateFilesToDigests, candidateDigestsToFiles,
-			)
-			if destinationIndexErr != nil {
-				destinationIndexErrs = append(destinationIndexErrs, destinationIndexErr)
-			}
-		}(i)
+	numThreads := runtime.NumCPU()
+	if options.Threads > 0 {
+		numThreads = options.Threads
 	}
+	parallelismForSource, parallelismForDestination := getParallelism(numThreads)
+	var sourceIndexErr, destinationIndexErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sourceIndexErr = buildIndex(ctx, sourceDirPath, sourceFiles, orphansAtSource, parallelismForSource,
+			sourceProgress, orphanFilesToDigests, orphanDigestsToFiles, options)
+	}()
+	go func() {
+		defer wg.Done()
+		destinationIndexErr = buildIndex(ctx, destinationDirPath, destinationFiles, candidatesAtDestination,
+			parallelismForDestination, destinationProgress, candidateFilesToDigests, candidateDigestsToFiles, options)
+	}()
 	wg.Wait()
-	if len(sourceIndexErrs) > 0 {
-		return nil, 0, fmte.Errors("error(s) while building index on source directory: ",
-			sourceIndexErrs)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, 0, ctxErr
 	}
-	if len(destinationIndexErrs) > 0 {
-		return nil, 0, fmte.Errors("error(s) while building index on destination directory: ",
-			destinationIndexErrs)
+	if sourceIndexErr != nil {
+		return nil, 0, fmt.Errorf("error while building index on source directory: %w", sourceIndexErr)
 	}
-	actions = make([]action.SyncAction, 0, orphanFilesToDigests.Len())
-	uniqueness := set.NewSetWithSize[string](orphanFilesToDigests.Len())
+	if destinationIndexErr != nil {
+		return nil, 0, fmt.Errorf("error while building index on destination directory: %w", destinationIndexErr)
+	}
+	existsAtSource := existsAtSourceFunc(sourceFiles, options.PathNormalizer)
+	duplicateMatches := matchDuplicatesBySimilarity(existsAtSource, sourceFiles, options.Repair, orphanFilesToDigests,
+		orphanDigestsToFiles, candidateDigestsToFiles)
+	matches := make(map[string]string, orphanFilesToDigests.Len())
 	for orphanAtSource, orphanDigest := range orphanFilesToDigests.Data {
+		var candidateAtDestination string
 		if len(orphanDigestsToFiles.Get(orphanDigest)) > 1 {
-			// many orphans at source have the same digest
-			continue
-		}
-		if !candidateDigestsToFiles.Exists(orphanDigest) {
+			// many orphans at source have the same digest (these are matched only if they're hard links to one file,
+			// or when repairing)
+			candidateAtDestination = duplicateMatches[orphanAtSource]
+		} else if !candidateDigestsToFiles.Exists(orphanDigest) {
 			// let rsync handle this
 			continue
-		}
-		matchesAtDestination := candidateDigestsToFiles.Get(orphanDigest)
-		var candidateAtDestination string
-		if len(matchesAtDestination) == 1 {
+		} else if matchesAtDestination := candidateDigestsToFiles.Get(orphanDigest); len(matchesAtDestination) == 1 {
 			candidateAtDestination = matchesAtDestination[0]
 		} else {
-			// If multiple files with same digest exist at destination,
-			// choose a random one that does *not* exist at source
+			// If multiple files with same digest exist at destination, choose the one most similar to the orphan
+			// among those that do *not* exist at source
+			notAtSource := make([]string, 0, len(matchesAtDestination))
 			for _, destinationPath := range matchesAtDestination {
-				if _, existsAtSource := sourceFiles[destinationPath]; !existsAtSource {
-					candidateAtDestination = destinationPath
-					break
+				if !existsAtSource(destinationPath) {
+					notAtSource = append(notAtSource, destinationPath)
 				}
 			}
+			candidateAtDestination = mostSimilarPath(orphanAtSource, notAtSource)
 		}
 		if candidateAtDestination == "" {
 			continue
 		}
-		if destinationFiles[candidateAtDestination].ModifiedTimestamp != sourceFiles[orphanAtSource].ModifiedTimestamp {
+		matches[orphanAtSource] = candidateAtDestination
+	}
+	if options.Verify {
+		var numDiffering, numFailed int
+		matches, numDiffering, numFailed = verifyMatches(sourceDirPath, destinationDirPath, matches)
+		fmte.Printf("Verification rejected %d out of %d matches (%d as their contents differ, %d as they couldn't be "+
+			"compared)\n", numDiffering+numFailed, numDiffering+numFailed+len(matches), numDiffering, numFailed)
+	}
+	// Timestamp of a file is propagated only if its contents are same, byte by byte, as of the matched file (else,
+	// rsync, which compares sizes and timestamps, would skip a file that has actually changed):
+	contentsDiffer := findContentsDiffering(sourceDirPath, sourceFiles, destinationDirPath, destinationFiles,
+		matches, options)
+	orphansWithMatches := make([]string, 0, len(matches))
+	for orphanAtSource := range matches {
+		orphansWithMatches = append(orphansWithMatches, orphanAtSource)
+	}
+	sort.Strings(orphansWithMatches)
+	actions = make([]action.SyncAction, 0, len(matches))
+	uniqueness := set.NewSetWithSize[string](len(matches))
+	// Directories renamed/moved as a whole are moved first, in a single action each (files inside them are then
+	// already at their new paths):
+	var directoryRenames []directoryRename
+	if !options.OnlyTimestamp {
+		directoryRenames = findDirectoryRenames(sourceDirPath, sourceFiles, destinationDirPath, destinationFiles,
+			matches)
+	}
+	isTakenAtDestination := takenAtDestinationFunc(destinationDirPath, destinationFiles, options.CaseInsensitiveFS)
+	// Timestamp propagated to a hard link at destination is propagated to all links to the same file:
+	timestampsOfInodes := map[entity.Inode]entity.FileMeta{}
+	movedDirectories := make([]string, 0, len(directoryRenames))
+	// Files at destination that are (or are moved) at paths of orphans they're matched with, by their digests (see
+	// computeDuplicateRemovals):
+	inPlace := make(map[entity.FileDigest]matchedFile)
+	for _, rename := range directoryRenames {
+		parentDir := filepath.Dir(filepath.Join(destinationDirPath, rename.to))
+		if !lib.IsReadableDirectory(parentDir) {
+			directoryAction := action.MakeDirectoryAction{
+				AbsoluteDirPath: parentDir,
+			}
+			if !uniqueness.Contains(directoryAction.Uniqueness()) {
+				actions = append(actions, directoryAction)
+				uniqueness.Add(directoryAction.Uniqueness())
+			}
+		}
+		actions = append(actions, action.MoveDirectoryAction{
+			BasePath:         destinationDirPath,
+			RelativeFromPath: rename.from,
+			RelativeToPath:   rename.to,
+		})
+		movedDirectories = append(movedDirectories, rename.to)
+	}
+	for _, orphanAtSource := range orphansWithMatches {
+		candidateAtDestination := matches[orphanAtSource]
+		pathAtDestination := candidateAtDestination
+		isMovedWithDirectory := isInsideAnyOf(movedDirectories, orphanAtSource)
+		// Transfer of the file is saved by any of the actions below, but it's counted once:
+		isSaved := isMovedWithDirectory
+		if isMovedWithDirectory {
+			pathAtDestination = orphanAtSource
+		}
+		isInPlace := isMovedWithDirectory || candidateAtDestination == orphanAtSource
+		isTimestampPropagated := !options.NoTimestamp &&
+			(!options.OnlyTimestamp || candidateAtDestination == orphanAtSource)
+		if isTimestampPropagated && !contentsDiffer.Contains(orphanAtSource) &&
+			!destinationFiles[candidateAtDestination].IsModifiedWithin(sourceFiles[orphanAtSource],
+				options.ModifyWindow) {
 			timestampAction := action.PropagateTimestampAction{
 				SourceBaseDirPath:           sourceDirPath,
 				DestinationBaseDirPath:      destinationDirPath,
 				SourceFileRelativePath:      orphanAtSource,
-				DestinationFileRelativePath: candidateAtDestination,
+				DestinationFileRelativePath: pathAtDestination,
 			}
-			if !uniqueness.Contains(timestampAction.Uniqueness()) {
+			inode := destinationFiles[candidateAtDestination].Inode
+			propagated, isInodePropagated := timestampsOfInodes[inode]
+			if isInodePropagated && propagated.IsModifiedAtSameTime(sourceFiles[orphanAtSource]) {
+				// it's already propagated, through another link
+				isSaved = true
+			} else if !uniqueness.Contains(timestampAction.Uniqueness()) {
 				actions = append(actions, timestampAction)
 				uniqueness.Add(timestampAction.Uniqueness())
-				savings += sourceFiles[orphanAtSource].Size
+				isSaved = true
+				if inode.IsKnown() {
+					timestampsOfInodes[inode] = sourceFiles[orphanAtSource]
+				}
 			}
 		}
-		if _, existsAtSource := sourceFiles[candidateAtDestination]; !existsAtSource &&
-			candidateAtDestination != orphanAtSource {
+		if !options.OnlyTimestamp && !isMovedWithDirectory && !existsAtSource(candidateAtDestination) &&
+			candidateAtDestination != orphanAtSource && !isTakenAtDestination(orphanAtSource, candidateAtDestination) {
 			parentDir := filepath.Dir(filepath.Join(destinationDirPath, orphanAtSource))
 			if !lib.IsReadableDirectory(parentDir) {
 				directoryAction := action.MakeDirectoryAction{
@@ -165,13 +436,250 @@ func ComputeSyncActions(sourceDirPath string, sourceFiles map[string]entity.File
 			if !uniqueness.Contains(moveFileAction.Uniqueness()) {
 				actions = append(actions, moveFileAction)
 				uniqueness.Add(moveFileAction.Uniqueness())
-				savings += sourceFiles[orphanAtSource].Size
+				isSaved = true
+				isInPlace = true
 			}
 		}
+		if isSaved {
+			savings += sourceFiles[orphanAtSource].Size
+		}
+		if digest := orphanFilesToDigests.Get(orphanAtSource); isInPlace && !contentsDiffer.Contains(orphanAtSource) {
+			if _, exists := inPlace[digest]; !exists {
+				inPlace[digest] = matchedFile{orphan: orphanAtSource, candidate: candidateAtDestination}
+			}
+		}
+		// Permissions are changed while the file is at its old path, as with timestamps (this is only when the file
+		// takes the orphan's place at destination, and not when some other file at source is at its path):
+		takesPlaceOfOrphan := isMovedWithDirectory || candidateAtDestination == orphanAtSource ||
+			!existsAtSource(candidateAtDestination)
+		if options.Permissions && takesPlaceOfOrphan &&
+			sourceFiles[orphanAtSource].Permissions != destinationFiles[candidateAtDestination].Permissions {
+			chmodAction := action.ChmodAction{
+				BasePath:     destinationDirPath,
+				RelativePath: pathAtDestination,
+				Mode:         sourceFiles[orphanAtSource].Permissions,
+			}
+			if !uniqueness.Contains(chmodAction.Uniqueness()) {
+				actions = append(actions, chmodAction)
+				uniqueness.Add(chmodAction.Uniqueness())
+			}
+		}
+		if takesPlaceOfOrphan {
+			chownAction := ownerChange(sourceFiles[orphanAtSource], destinationFiles[candidateAtDestination], options)
+			chownAction.BasePath, chownAction.RelativePath = destinationDirPath, pathAtDestination
+			if (chownAction.UID >= 0 || chownAction.GID >= 0) && !uniqueness.Contains(chownAction.Uniqueness()) {
+				actions = append(actions, chownAction)
+				uniqueness.Add(chownAction.Uniqueness())
+			}
+		}
+	}
+	if options.RemoveDuplicates && !options.OnlyTimestamp {
+		actions = append(actions, computeDuplicateRemovals(destinationDirPath, destinationFiles,
+			candidateFilesToDigests, matches, directoryRenames, inPlace, existsAtSource)...)
 	}
 	return
 }
 
+// ownerChange computes change of owner of a file at destination (to that of its counterpart at source) as per
+// options.Owner and options.Group, leaving out user and group that are same (or not known)
+func ownerChange(sourceFileMeta entity.FileMeta, destinationFileMeta entity.FileMeta, options SyncOptions,
+) action.ChownAction {
+	change := action.ChownAction{UID: -1, GID: -1}
+	if options.Owner && sourceFileMeta.UID >= 0 && destinationFileMeta.UID >= 0 &&
+		sourceFileMeta.UID != destinationFileMeta.UID {
+		change.UID = sourceFileMeta.UID
+	}
+	if options.Group && sourceFileMeta.GID >= 0 && destinationFileMeta.GID >= 0 &&
+		sourceFileMeta.GID != destinationFileMeta.GID {
+		change.GID = sourceFileMeta.GID
+	}
+	return change
+}
+
+// findContentsDiffering finds orphans at source whose timestamps differ from those of matched files at destination,
+// but whose contents do too (and hence, timestamps of which mustn't be propagated). Contents of files that couldn't be
+// compared are taken to differ. When matches are already verified, contents don't differ.
+func findContentsDiffering(sourceDirPath string, sourceFiles map[string]entity.FileMeta,
+	destinationDirPath string, destinationFiles map[string]entity.FileMeta, matches map[string]string,
+	options SyncOptions,
+) set.Set[string] {
+	contentsDiffer := set.NewThreadUnsafeSet[string]()
+	if options.Verify {
+		return contentsDiffer
+	}
+	timestampsDiffer := make(map[string]string, len(matches))
+	for orphanAtSource, candidateAtDestination := range matches {
+		sourceFileMeta, destinationFileMeta := sourceFiles[orphanAtSource], destinationFiles[candidateAtDestination]
+		// If sizes differ, rsync would copy the file anyway
+		if !sourceFileMeta.IsModifiedWithin(destinationFileMeta, options.ModifyWindow) &&
+			sourceFileMeta.Size == destinationFileMeta.Size {
+			timestampsDiffer[orphanAtSource] = candidateAtDestination
+		}
+	}
+	if len(timestampsDiffer) == 0 {
+		return contentsDiffer
+	}
+	same, numDiffering, numFailed := verifyMatches(sourceDirPath, destinationDirPath, timestampsDiffer)
+	for orphanAtSource := range timestampsDiffer {
+		if _, isSame := same[orphanAtSource]; !isSame {
+			contentsDiffer.Add(orphanAtSource)
+		}
+	}
+	if numDiffering > 0 {
+		fmte.Printf("Timestamps of %d files won't be propagated, as their contents differ (rsync will copy them)\n",
+			numDiffering)
+	}
+	if numFailed > 0 {
+		fmte.Printf("Timestamps of %d files won't be propagated, as their contents couldn't be compared\n", numFailed)
+	}
+	return contentsDiffer
+}
+
+// takenAtDestinationFunc creates a function that tells whether a path at destination is taken by a file other than the
+// one to be moved there, in the sense of a case-insensitive filesystem (on a case-sensitive one, it's never taken)
+func takenAtDestinationFunc(destinationDirPath string, destinationFiles map[string]entity.FileMeta, mode string,
+) func(destinationPath string, movedPath string) bool {
+	if !isCaseInsensitiveDestination(destinationDirPath, destinationFiles, mode) {
+		return func(string, string) bool {
+			return false
+		}
+	}
+	foldedPaths := make(map[string][]string, len(destinationFiles))
+	for destinationPath := range destinationFiles {
+		foldedPath := strings.ToLower(destinationPath)
+		foldedPaths[foldedPath] = append(foldedPaths[foldedPath], destinationPath)
+	}
+	return func(destinationPath string, movedPath string) bool {
+		for _, path := range foldedPaths[strings.ToLower(destinationPath)] {
+			if path != movedPath {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// existsAtSourceFunc creates a function that tells whether a path at destination exists at source
+func existsAtSourceFunc(sourceFiles map[string]entity.FileMeta, normalizer PathNormalizer,
+) func(destinationPath string) bool {
+	if normalizer.IsNoOp() {
+		return func(destinationPath string) bool {
+			_, exists := sourceFiles[destinationPath]
+			return exists
+		}
+	}
+	normalizedSourcePaths := set.NewThreadUnsafeSetWithSize[string](len(sourceFiles))
+	for sourcePath := range sourceFiles {
+		normalizedSourcePaths.Add(normalizer.Source(sourcePath))
+	}
+	return func(destinationPath string) bool {
+		return normalizedSourcePaths.Contains(normalizer.Destination(destinationPath))
+	}
+}
+
+// matchDuplicatesBySimilarity pairs orphans at source that share a digest with candidates at destination having the
+// same digest, preferring pairs with most similar paths. Candidates that exist at source (as some other file) are
+// never chosen. Unless repair is set, an orphan is paired only with a candidate whose path is related to its own (see
+// areRelatedPaths), e.g. when identical files are renamed in place, except when orphans are all hard links to one file
+// (so that hard links at destination are moved as a set).
+func matchDuplicatesBySimilarity(existsAtSource func(destinationPath string) bool,
+	sourceFiles map[string]entity.FileMeta, repair bool, orphanFilesToDigests lib.SafeMap[string, entity.FileDigest],
+	orphanDigestsToFiles lib.MultiMap[entity.FileDigest, string],
+	candidateDigestsToFiles lib.MultiMap[entity.FileDigest, string],
+) map[string]string {
+	matches := map[string]string{}
+	processedDigests := set.NewThreadUnsafeSet[entity.FileDigest]()
+	for _, digest := range orphanFilesToDigests.Data {
+		orphans := orphanDigestsToFiles.Get(digest)
+		if len(orphans) <= 1 || digest == (entity.FileDigest{}) || processedDigests.Contains(digest) {
+			continue
+		}
+		processedDigests.Add(digest)
+		orphansWithDigest := set.NewThreadUnsafeSet[string](orphans...)
+		var candidates []string
+		for _, candidate := range candidateDigestsToFiles.Get(digest) {
+			if !existsAtSource(candidate) || orphansWithDigest.Contains(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		onlyRelated := !repair && !areHardLinks(sourceFiles, orphans)
+		for orphan, candidate := range assignBySimilarity(orphans, candidates, onlyRelated) {
+			matches[orphan] = candidate
+		}
+	}
+	return matches
+}
+
+// areHardLinks tells whether files at given paths are all hard links to one file
+func areHardLinks(files map[string]entity.FileMeta, paths []string) bool {
+	for _, path := range paths[1:] {
+		if !files[path].IsHardLinkOf(files[paths[0]]) {
+			return false
+		}
+	}
+	return true
+}
+
+// areRelatedPaths tells whether there's anything in common between two relative file paths, other than content of
+// the files: same file name, same parent directory or some matching directories (see lib.PathSimilarity)
+func areRelatedPaths(path1, path2 string) bool {
+	return filepath.Dir(path1) == filepath.Dir(path2) || lib.PathSimilarity(path1, path2) > 0
+}
+
+// mostSimilarPath returns the path among candidates that's most similar to given path: with highest
+// lib.PathSimilarity and then with the least lib.EditDistance between file names (the one that sorts first of equally
+// similar ones, so that the choice doesn't depend on order of candidates, and empty if there are no candidates)
+func mostSimilarPath(path string, candidates []string) string {
+	mostSimilar, highestScore, leastDistance := "", -1, 0
+	name := filepath.Base(path)
+	for _, candidate := range candidates {
+		score := lib.PathSimilarity(path, candidate)
+		distance := lib.EditDistance(name, filepath.Base(candidate))
+		if score > highestScore || (score == highestScore && distance < leastDistance) ||
+			(score == highestScore && distance == leastDistance && candidate < mostSimilar) {
+			mostSimilar, highestScore, leastDistance = candidate, score, distance
+		}
+	}
+	return mostSimilar
+}
+
+// assignBySimilarity greedily assigns each path in 'from' to a distinct path in 'to', most similar pairs first (if
+// onlyRelated is set, paths that aren't related, as per areRelatedPaths, are never assigned to each other)
+func assignBySimilarity(from []string, to []string, onlyRelated bool) map[string]string {
+	type pair struct {
+		from, to string
+		score    int
+	}
+	pairs := make([]pair, 0, len(from)*len(to))
+	for _, f := range from {
+		for _, t := range to {
+			if onlyRelated && !areRelatedPaths(f, t) {
+				continue
+			}
+			pairs = append(pairs, pair{from: f, to: t, score: lib.PathSimilarity(f, t)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].score != pairs[j].score {
+			return pairs[i].score > pairs[j].score
+		}
+		if pairs[i].from != pairs[j].from {
+			return pairs[i].from < pairs[j].from
+		}
+		return pairs[i].to < pairs[j].to
+	})
+	assignments := make(map[string]string, len(from))
+	assigned := set.NewThreadUnsafeSet[string]()
+	for _, p := range pairs {
+		if _, done := assignments[p.from]; done || assigned.Contains(p.to) {
+			continue
+		}
+		assignments[p.from] = p.to
+		assigned.Add(p.to)
+	}
+	return assignments
+}
+
 func getParallelism(n int) (int, int) {
 	if n > 3 {
 		if n%2 == 0 {
@@ -183,20 +691,93 @@ func getParallelism(n int) (int, int) {
 	return 1, 1
 }
 
-func FindDirectoryResultToCsv(dirPath string, excludedFiles set.Set[string], file *os.File) error {
-	files, _, fErr := FindFilesFromDirectory(dirPath, excludedFiles)
-	if fErr != nil {
-		return fErr
+// FindUnmatchedOrphans finds orphans at source that none of the sync actions take care of
+// (i.e. files that rsync would have to transfer)
+func FindUnmatchedOrphans(orphansAtSource []string, actions []action.SyncAction) []string {
+	matched := set.NewThreadUnsafeSetWithSize[string](len(actions))
+	var movedDirectories []string
+	for _, a := range actions {
+		switch syncAction := a.(type) {
+		case action.MoveFileAction:
+			matched.Add(syncAction.RelativeToPath)
+		case action.MoveDirectoryAction:
+			movedDirectories = append(movedDirectories, syncAction.RelativeToPath)
+		case action.PropagateTimestampAction:
+			matched.Add(syncAction.SourceFileRelativePath)
+		case action.CopyFileAction:
+			matched.Add(syncAction.RelativeToPath)
+		}
+	}
+	unmatched := make([]string, 0, len(orphansAtSource))
+	for _, orphan := range orphansAtSource {
+		if !matched.Contains(orphan) && !isInsideAnyOf(movedDirectories, orphan) {
+			unmatched = append(unmatched, orphan)
+		}
+	}
+	return unmatched
+}
+
+// WithoutNanoseconds truncates modification timestamps of given files to seconds, in place (so that files that differ
+// only in sub-second parts of their timestamps are considered same, as by rsync by default)
+func WithoutNanoseconds(files map[string]entity.FileMeta) {
+	for path, fileMeta := range files {
+		files[path] = fileMeta.WithoutNanoseconds()
 	}
-	cw := csv.NewWriter(file)
-	for f, fileMeta := range files {
-		record := []string{f, strconv.FormatInt(fileMeta.Size, 10),
-			strconv.FormatInt(fileMeta.ModifiedTimestamp, 10)}
-		wErr := cw.Write(record)
-		if wErr != nil {
-			return fmt.Errorf("error while writing record %+v: %+v", record, wErr)
+}
+
+// TotalSize computes total size of given files
+func TotalSize(files map[string]entity.FileMeta, paths []string) (size int64) {
+	for _, path := range paths {
+		size += files[path].Size
+	}
+	return
+}
+
+// FindExtraneous finds files at destination that don't exist at source at same relative path (i.e. files that
+// `rsync --delete` would delete, unless sync actions move them away)
+func FindExtraneous(sourceFiles, destinationFiles map[string]entity.FileMeta) []string {
+	extraneous := make([]string, 0, len(destinationFiles)/10)
+	for destinationPath := range destinationFiles {
+		if _, existsAtSource := sourceFiles[destinationPath]; !existsAtSource {
+			extraneous = append(extraneous, destinationPath)
+		}
+	}
+	return extraneous
+}
+
+// SplitExtraneous splits extraneous files at destination (see FindExtraneous) into ones that sync actions move away
+// (as they are files renamed/moved at source) or remove (as they are stale duplicates) and ones that `rsync --delete`
+// would still delete
+func SplitExtraneous(extraneous []string, actions []action.SyncAction) (movedAway []string, deletable []string) {
+	moved := set.NewThreadUnsafeSetWithSize[string](len(actions))
+	var movedDirectories []string
+	for _, a := range actions {
+		switch syncAction := a.(type) {
+		case action.MoveFileAction:
+			moved.Add(syncAction.RelativeFromPath)
+		case action.RemoveFileAction:
+			moved.Add(syncAction.RelativePath)
+		case action.MoveDirectoryAction:
+			movedDirectories = append(movedDirectories, syncAction.RelativeFromPath)
+		}
+	}
+	movedAway, deletable = []string{}, []string{}
+	for _, path := range extraneous {
+		if moved.Contains(path) || isInsideAnyOf(movedDirectories, path) {
+			movedAway = append(movedAway, path)
+		} else {
+			deletable = append(deletable, path)
+		}
+	}
+	return movedAway, deletable
+}
+
+// isInsideAnyOf checks whether relative path is inside any of given directories
+func isInsideAnyOf(dirPaths []string, path string) bool {
+	for _, dirPath := range dirPaths {
+		if isSameOrInside(dirPath, path) {
+			return true
 		}
 	}
-	cw.Flush()
-	return nil
+	return false
 }
@@ -1,8 +1,19 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestGetParallelism(t *testing.T) {
@@ -15,3 +26,483 @@ func TestGetParallelism(t *testing.T) {
 		}
 	}
 }
+
+func writeTestFiles(t *testing.T, baseDirPath string, files map[string]string) {
+	modTime := time.Now().Add(-time.Hour)
+	for relativePath, content := range files {
+		path := filepath.Join(baseDirPath, relativePath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("couldn't create directory for %s: %+v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("couldn't write %s: %+v", path, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("couldn't change timestamp of %s: %+v", path, err)
+		}
+	}
+}
+
+func computeSyncActions(t *testing.T, sourceDirPath, destinationDirPath string, options SyncOptions,
+) []action.SyncAction {
+	actions, _ := computeSyncActionsAndSavings(t, sourceDirPath, destinationDirPath, options)
+	return actions
+}
+
+func computeSyncActionsAndSavings(t *testing.T, sourceDirPath, destinationDirPath string, options SyncOptions,
+) ([]action.SyncAction, int64) {
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	sourceFiles, _, sErr := FindFilesFromDirectory(context.Background(), sourceDirPath, noExclusions)
+	assert.NoError(t, sErr)
+	destinationFiles, _, dErr := FindFilesFromDirectory(context.Background(), destinationDirPath, noExclusions)
+	assert.NoError(t, dErr)
+	if !options.NanosecondPrecision {
+		WithoutNanoseconds(sourceFiles)
+		WithoutNanoseconds(destinationFiles)
+	}
+	candidates := make([]string, 0, len(destinationFiles))
+	for path := range destinationFiles {
+		candidates = append(candidates, path)
+	}
+	var sourceProgress, destinationProgress IndexProgress
+	orphans := FindOrphansWithin(sourceFiles, destinationFiles, options.PathNormalizer, options.ModifyWindow)
+	actions, savings, err := ComputeSyncActions(context.Background(), sourceDirPath, sourceFiles, orphans,
+		destinationDirPath, destinationFiles, candidates, &sourceProgress, &destinationProgress, options)
+	assert.NoError(t, err)
+	// Each file is either hashed or skipped (e.g. when its digest is served from cache):
+	assert.Equal(t, TotalSize(sourceFiles, orphans), sourceProgress.Bytes+sourceProgress.SkippedBytes)
+	assert.Equal(t, int32(len(orphans)), sourceProgress.Files)
+	assert.Equal(t, TotalSize(destinationFiles, candidates), destinationProgress.Bytes+destinationProgress.SkippedBytes)
+	assert.Equal(t, int32(len(candidates)), destinationProgress.Files)
+	return actions, savings
+}
+
+func TestComputeSyncActionsProgressWithCache(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"renamed.txt": "contents"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"original.txt": "contents"})
+	cache, err := LoadDigestCache(filepath.Join(t.TempDir(), "digests.cache"))
+	assert.NoError(t, err)
+	sourceFiles := map[string]entity.FileMeta{"renamed.txt": {Size: 8}}
+	destinationFiles := map[string]entity.FileMeta{"original.txt": {Size: 8}}
+	for i, expected := range []IndexProgress{{Bytes: 8, Files: 1}, {SkippedBytes: 8, Files: 1}} {
+		// Files are hashed the first time, and their digests are served from cache the second time:
+		var sourceProgress, destinationProgress IndexProgress
+		_, _, err = ComputeSyncActions(context.Background(), sourceDirPath, sourceFiles, []string{"renamed.txt"},
+			destinationDirPath, destinationFiles, []string{"original.txt"}, &sourceProgress, &destinationProgress,
+			SyncOptions{DigestCache: cache})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, sourceProgress, "run #%d", i+1)
+		assert.Equal(t, expected, destinationProgress, "run #%d", i+1)
+	}
+}
+
+func TestComputeSyncActionsRepair(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// A prior run left behind files with duplicate content, at paths unrelated to the ones at source:
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"new/x1.txt": "duplicate content",
+		"new/x2.txt": "duplicate content",
+		"new/y.txt":  "unique content",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"old/p1.txt": "duplicate content",
+		"old/p2.txt": "duplicate content",
+		"new/y.txt":  "unique content",
+	})
+	assert.Empty(t, computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	actions := computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{Repair: true})
+	assert.ElementsMatch(t, []action.SyncAction{
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "old/p1.txt",
+			RelativeToPath: "new/x1.txt"},
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "old/p2.txt",
+			RelativeToPath: "new/x2.txt"},
+	}, actions)
+}
+
+func TestComputeSyncActionsDuplicates(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// Three identical files renamed in place, and two identical files moved into another directory:
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"scans/page_1.txt":    "blank page",
+		"scans/page_2.txt":    "blank page",
+		"scans/page_3.txt":    "blank page",
+		"2021/trip/a.jpg":     "same photo",
+		"2021/trip/b.jpg":     "same photo",
+		"unrelated/new_c.txt": "other duplicate",
+		"unrelated/new_d.txt": "other duplicate",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"scans/scan_1.txt": "blank page",
+		"scans/scan_2.txt": "blank page",
+		"scans/scan_3.txt": "blank page",
+		"trip/a.jpg":       "same photo",
+		"trip/b.jpg":       "same photo",
+		"old/c.txt":        "other duplicate",
+		"old/d.txt":        "other duplicate",
+	})
+	actions := computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{})
+	moveFile := func(from, to string) action.SyncAction {
+		return action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: from, RelativeToPath: to}
+	}
+	assert.ElementsMatch(t, []action.SyncAction{
+		moveFile("scans/scan_1.txt", "scans/page_1.txt"),
+		moveFile("scans/scan_2.txt", "scans/page_2.txt"),
+		moveFile("scans/scan_3.txt", "scans/page_3.txt"),
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "2021")},
+		action.MoveDirectoryAction{BasePath: destinationDirPath, RelativeFromPath: "trip", RelativeToPath: "2021/trip"},
+	}, actions)
+}
+
+func TestAssignBySimilarity(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"2022/trip/a.jpg": "2021/trip/a.jpg",
+		"2022/trip/b.jpg": "2021/trip/b.jpg",
+	}, assignBySimilarity(
+		[]string{"2022/trip/a.jpg", "2022/trip/b.jpg"},
+		[]string{"2021/trip/b.jpg", "2021/trip/a.jpg", "2021/trip/c.jpg"},
+		false,
+	))
+	assert.Equal(t, map[string]string{"notes/a.txt": "notes/b.txt"}, assignBySimilarity(
+		[]string{"notes/a.txt", "x.txt"},
+		[]string{"misc/y.txt", "notes/b.txt"},
+		true,
+	))
+}
+
+func TestMostSimilarPath(t *testing.T) {
+	assert.Equal(t, "", mostSimilarPath("a.jpg", nil))
+	// Same file name weighs the most:
+	assert.Equal(t, "misc/a.jpg", mostSimilarPath("2021/trip/a.jpg", []string{"2021/trip/b.jpg", "misc/a.jpg"}))
+	// ...followed by matching directories:
+	assert.Equal(t, "2021/trip/b.jpg", mostSimilarPath("2021/trip/a.jpg", []string{"misc/b.jpg", "2021/trip/b.jpg"}))
+	// ...and then by how close file names are:
+	assert.Equal(t, "IMG_001.jpg", mostSimilarPath("IMG_0001.jpg", []string{"copy.jpg", "IMG_001.jpg", "IMG_1.jpg"}))
+	// Of equally similar ones, the one that sorts first is chosen, whatever the order of candidates:
+	assert.Equal(t, "x.jpg", mostSimilarPath("a.jpg", []string{"x.jpg", "y.jpg"}))
+	assert.Equal(t, "x.jpg", mostSimilarPath("a.jpg", []string{"y.jpg", "x.jpg"}))
+}
+
+func TestComputeSyncActionsAmbiguousCandidates(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// Many copies of a file at destination, of which only one was renamed at source:
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"album/cover_final.jpg": "cover",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"backup/copy_of_cover.jpg": "cover",
+		"album/cover.jpg":          "cover",
+		"other/image.jpg":          "cover",
+	})
+	assert.Equal(t, []action.SyncAction{action.MoveFileAction{BasePath: destinationDirPath,
+		RelativeFromPath: "album/cover.jpg", RelativeToPath: "album/cover_final.jpg"}},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+}
+
+func TestComputeSyncActionsContentType(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"renamed_image.txt": png, // image with an extension that lies
+		"renamed_text.jpg":  "this is plain text",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"image.txt": png,
+		"text.jpg":  "this is plain text",
+	})
+	imageMove := action.MoveFileAction{BasePath: destinationDirPath,
+		RelativeFromPath: "image.txt", RelativeToPath: "renamed_image.txt"}
+	textMove := action.MoveFileAction{BasePath: destinationDirPath,
+		RelativeFromPath: "text.jpg", RelativeToPath: "renamed_text.jpg"}
+	assert.ElementsMatch(t, []action.SyncAction{imageMove, textMove},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	assert.Equal(t, []action.SyncAction{imageMove},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{
+			IncludedContentTypes: set.NewSet[string]("image", "video"),
+		}))
+	assert.Equal(t, []action.SyncAction{textMove},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{
+			ExcludedContentTypes: set.NewSet[string]("image"),
+		}))
+}
+
+func TestComputeSyncActionsThreads(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	sourceFiles, destinationFiles := map[string]string{}, map[string]string{}
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("content of file #%d", i)
+		sourceFiles[fmt.Sprintf("renamed_%02d.txt", i)] = content
+		destinationFiles[fmt.Sprintf("%02d.txt", i)] = content
+	}
+	writeTestFiles(t, sourceDirPath, sourceFiles)
+	writeTestFiles(t, destinationDirPath, destinationFiles)
+	expected := computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{})
+	assert.Equal(t, 20, len(expected))
+	for _, threads := range []int{1, 2, 3, 16} {
+		assert.Equal(t, expected, computeSyncActions(t, sourceDirPath, destinationDirPath,
+			SyncOptions{Threads: threads}), "with %d threads", threads)
+	}
+}
+
+func TestComputeSyncActionsCanceled(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"renamed.txt": "content"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"original.txt": "content"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var sourceProgress, destinationProgress IndexProgress
+	actions, _, err := ComputeSyncActions(ctx, sourceDirPath, map[string]entity.FileMeta{"renamed.txt": {Size: 7}},
+		[]string{"renamed.txt"}, destinationDirPath, map[string]entity.FileMeta{"original.txt": {Size: 7}},
+		[]string{"original.txt"}, &sourceProgress, &destinationProgress, SyncOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, actions)
+	// No file is indexed once canceled:
+	assert.Equal(t, int32(0), sourceProgress.Files+destinationProgress.Files)
+}
+
+func TestComputeSyncActionsChangedContentSameSize(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// Sparse file, in which a single byte changed at source (at an offset that's not sampled while hashing):
+	const size = bytesutil.MEBI
+	createSparseFile(t, filepath.Join(sourceDirPath, "disk.img"), size, 100*bytesutil.KIBI, "\x01")
+	createSparseFile(t, filepath.Join(destinationDirPath, "disk.img"), size, 100*bytesutil.KIBI, "\x00")
+	sourceModTime, destinationModTime := time.Now().Add(-time.Hour), time.Now().Add(-2*time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(sourceDirPath, "disk.img"), sourceModTime, sourceModTime))
+	assert.NoError(t, os.Chtimes(filepath.Join(destinationDirPath, "disk.img"), destinationModTime,
+		destinationModTime))
+	digest1, _, err := getDigest(filepath.Join(sourceDirPath, "disk.img"), DigestOptions{})
+	assert.NoError(t, err)
+	digest2, _, err := getDigest(filepath.Join(destinationDirPath, "disk.img"), DigestOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, digest1, digest2) // i.e. digests can't tell the change
+	// Timestamp isn't propagated, so that rsync copies the file:
+	assert.Empty(t, computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	// When contents are same, it is:
+	copyContent, err := os.ReadFile(filepath.Join(sourceDirPath, "disk.img"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(destinationDirPath, "disk.img"), copyContent, 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(destinationDirPath, "disk.img"), destinationModTime,
+		destinationModTime))
+	assert.Equal(t, []action.SyncAction{action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath,
+		DestinationBaseDirPath: destinationDirPath, SourceFileRelativePath: "disk.img",
+		DestinationFileRelativePath: "disk.img"}},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+}
+
+func TestFindContentsDifferingUncompared(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDirPath, "a.txt"), []byte("a"), 0644))
+	sourceFiles := map[string]entity.FileMeta{"a.txt": {Size: 1, ModifiedTimestamp: 1000}}
+	// File at destination disappeared since it was scanned, so contents can't be compared:
+	destinationFiles := map[string]entity.FileMeta{"b.txt": {Size: 1, ModifiedTimestamp: 2000}}
+	contentsDiffer := findContentsDiffering(sourceDirPath, sourceFiles, destinationDirPath, destinationFiles,
+		map[string]string{"a.txt": "b.txt"}, SyncOptions{})
+	assert.True(t, contentsDiffer.Contains("a.txt"))
+}
+
+func TestComputeSyncActionsNanosecondPrecision(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"a.txt": "same"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"a.txt": "same"})
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(sourceDirPath, "a.txt"), modTime, modTime.Add(500*time.Millisecond)))
+	assert.NoError(t, os.Chtimes(filepath.Join(destinationDirPath, "a.txt"), modTime, modTime))
+	assert.Equal(t, []action.SyncAction{action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath,
+		DestinationBaseDirPath: destinationDirPath, SourceFileRelativePath: "a.txt",
+		DestinationFileRelativePath: "a.txt"}},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{NanosecondPrecision: true}))
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	sourceFiles, _, _ := FindFilesFromDirectory(context.Background(), sourceDirPath, noExclusions)
+	destinationFiles, _, _ := FindFilesFromDirectory(context.Background(), destinationDirPath, noExclusions)
+	assert.Equal(t, []string{"a.txt"}, FindOrphans(sourceFiles, destinationFiles))
+	WithoutNanoseconds(sourceFiles)
+	WithoutNanoseconds(destinationFiles)
+	assert.Empty(t, FindOrphans(sourceFiles, destinationFiles))
+}
+
+func TestFindOrphansByChecksum(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"restored.txt": "same", "changed.txt": "abc",
+		"resized.txt": "abc", "new.txt": "new"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"restored.txt": "same", "changed.txt": "xyz",
+		"resized.txt": "abcd"})
+	// As if restored from a backup that didn't preserve timestamps:
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(destinationDirPath, "restored.txt"), modTime, modTime))
+	noExclusions := set.NewThreadUnsafeSet[string]()
+	sourceFiles, _, _ := FindFilesFromDirectory(context.Background(), sourceDirPath, noExclusions)
+	destinationFiles, _, _ := FindFilesFromDirectory(context.Background(), destinationDirPath, noExclusions)
+	WithoutNanoseconds(sourceFiles)
+	WithoutNanoseconds(destinationFiles)
+	assert.ElementsMatch(t, []string{"restored.txt", "resized.txt", "new.txt"},
+		FindOrphans(sourceFiles, destinationFiles))
+	orphans, err := FindOrphansByChecksum(context.Background(), sourceDirPath, sourceFiles, destinationDirPath,
+		destinationFiles, SyncOptions{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"changed.txt", "resized.txt", "new.txt"}, orphans)
+}
+
+func TestComputeSyncActionsModifyWindow(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"same.txt": "same", "renamed.txt": "renamed"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"same.txt": "same", "original.txt": "renamed"})
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	// As if destination is on a FAT filesystem, which rounds timestamps to 2 seconds:
+	for path, skew := range map[string]time.Duration{
+		filepath.Join(sourceDirPath, "same.txt"):          time.Second,
+		filepath.Join(sourceDirPath, "renamed.txt"):       time.Second,
+		filepath.Join(destinationDirPath, "same.txt"):     0,
+		filepath.Join(destinationDirPath, "original.txt"): 0,
+	} {
+		assert.NoError(t, os.Chtimes(path, modTime, modTime.Add(skew)))
+	}
+	move := action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "original.txt",
+		RelativeToPath: "renamed.txt"}
+	timestamp := func(sourcePath, destinationPath string) action.SyncAction {
+		return action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath,
+			DestinationBaseDirPath: destinationDirPath, SourceFileRelativePath: sourcePath,
+			DestinationFileRelativePath: destinationPath}
+	}
+	assert.ElementsMatch(t, []action.SyncAction{timestamp("same.txt", "same.txt"),
+		timestamp("renamed.txt", "original.txt"), move},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	assert.Equal(t, []action.SyncAction{move},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{ModifyWindow: time.Second}))
+}
+
+func TestComputeSyncActionsTimestampModes(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"touched.txt": "touched", "renamed.txt": "renamed"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"touched.txt": "touched", "original.txt": "renamed"})
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, path := range []string{filepath.Join(sourceDirPath, "touched.txt"),
+		filepath.Join(sourceDirPath, "renamed.txt")} {
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	move := action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "original.txt",
+		RelativeToPath: "renamed.txt"}
+	timestamp := func(sourcePath, destinationPath string) action.SyncAction {
+		return action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath,
+			DestinationBaseDirPath: destinationDirPath, SourceFileRelativePath: sourcePath,
+			DestinationFileRelativePath: destinationPath}
+	}
+	assert.ElementsMatch(t, []action.SyncAction{timestamp("touched.txt", "touched.txt"),
+		timestamp("renamed.txt", "original.txt"), move},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	assert.Equal(t, []action.SyncAction{move},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{NoTimestamp: true}))
+	assert.Equal(t, []action.SyncAction{timestamp("touched.txt", "touched.txt")},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{OnlyTimestamp: true}))
+}
+
+func TestComputeSyncActionsHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links can't be recognized on this platform")
+	}
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{filepath.Join("x", "2.jpg"): "photo", "a.txt": "text"})
+	writeTestFiles(t, destinationDirPath, map[string]string{filepath.Join("x", "1.jpg"): "photo", "a.txt": "text"})
+	link := func(baseDirPath string, existingPath string, newPath string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(baseDirPath, newPath)), 0755))
+		assert.NoError(t, os.Link(filepath.Join(baseDirPath, existingPath), filepath.Join(baseDirPath, newPath)))
+	}
+	link(sourceDirPath, filepath.Join("x", "2.jpg"), filepath.Join("y", "2.jpg"))
+	link(destinationDirPath, filepath.Join("x", "1.jpg"), filepath.Join("y", "1.jpg"))
+	link(sourceDirPath, "a.txt", "b.txt")
+	link(destinationDirPath, "a.txt", "b.txt")
+	// Timestamp of the text file (and hence, of both links to it) changed at source:
+	modTime := time.Now()
+	assert.NoError(t, os.Chtimes(filepath.Join(sourceDirPath, "a.txt"), modTime, modTime))
+	// Links, though they have same contents, are matched as a set (and the timestamp is propagated just once):
+	move := func(from, to string) action.SyncAction {
+		return action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: from, RelativeToPath: to}
+	}
+	assert.ElementsMatch(t, []action.SyncAction{
+		move(filepath.Join("x", "1.jpg"), filepath.Join("x", "2.jpg")),
+		move(filepath.Join("y", "1.jpg"), filepath.Join("y", "2.jpg")),
+		action.PropagateTimestampAction{SourceBaseDirPath: sourceDirPath, DestinationBaseDirPath: destinationDirPath,
+			SourceFileRelativePath: "a.txt", DestinationFileRelativePath: "a.txt"},
+	}, computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+}
+
+func TestComputeSyncActionsPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions other than read-only can't be changed on Windows")
+	}
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"run.sh": "echo run", "notes.txt": "notes"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"old_run.sh": "echo run", "old_notes.txt": "notes"})
+	assert.NoError(t, os.Chmod(filepath.Join(sourceDirPath, "run.sh"), 0755))
+	moves := []action.SyncAction{
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "old_run.sh", RelativeToPath: "run.sh"},
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "old_notes.txt",
+			RelativeToPath: "notes.txt"},
+	}
+	assert.ElementsMatch(t, moves, computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	// Permissions are changed (only where they differ) before the file is moved:
+	assert.ElementsMatch(t, append(moves, action.ChmodAction{BasePath: destinationDirPath, RelativePath: "old_run.sh",
+		Mode: 0755}), computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{Permissions: true}))
+}
+
+func TestComputeSyncActionsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("owners of files can be changed only by root")
+	}
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	writeTestFiles(t, sourceDirPath, map[string]string{"new.txt": "text"})
+	writeTestFiles(t, destinationDirPath, map[string]string{"old.txt": "text"})
+	assert.NoError(t, os.Lchown(filepath.Join(destinationDirPath, "old.txt"), 12345, 23456))
+	move := action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "old.txt", RelativeToPath: "new.txt"}
+	assert.ElementsMatch(t, []action.SyncAction{move},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	assert.ElementsMatch(t, []action.SyncAction{move, action.ChownAction{BasePath: destinationDirPath,
+		RelativePath: "old.txt", UID: os.Getuid(), GID: -1}},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{Owner: true}))
+	assert.ElementsMatch(t, []action.SyncAction{move, action.ChownAction{BasePath: destinationDirPath,
+		RelativePath: "old.txt", UID: os.Getuid(), GID: os.Getgid()}},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{Owner: true, Group: true}))
+}
+
+func TestSplitExtraneous(t *testing.T) {
+	sourceFiles := map[string]entity.FileMeta{
+		"a.txt":                          {Size: 1},
+		filepath.Join("new", "b.txt"):    {Size: 2},
+		filepath.Join("photos", "c.jpg"): {Size: 3},
+	}
+	destinationFiles := map[string]entity.FileMeta{
+		"a.txt":                          {Size: 10},
+		filepath.Join("old", "b.txt"):    {Size: 2},
+		filepath.Join("pics", "c.jpg"):   {Size: 3},
+		filepath.Join("pics", "d.jpg"):   {Size: 4},
+		filepath.Join("trash", "e.txt"):  {Size: 5},
+		filepath.Join("photos", "f.jpg"): {Size: 6},
+	}
+	extraneous := FindExtraneous(sourceFiles, destinationFiles)
+	// a.txt exists at source (even though it differs), so rsync --delete wouldn't delete it:
+	assert.ElementsMatch(t, []string{filepath.Join("old", "b.txt"), filepath.Join("pics", "c.jpg"),
+		filepath.Join("pics", "d.jpg"), filepath.Join("trash", "e.txt"), filepath.Join("photos", "f.jpg")}, extraneous)
+	movedAway, deletable := SplitExtraneous(extraneous, []action.SyncAction{
+		action.MoveFileAction{BasePath: "/dst", RelativeFromPath: filepath.Join("old", "b.txt"),
+			RelativeToPath: filepath.Join("new", "b.txt")},
+		action.MoveDirectoryAction{BasePath: "/dst", RelativeFromPath: "pics", RelativeToPath: "photos"},
+	})
+	assert.ElementsMatch(t, []string{filepath.Join("old", "b.txt"), filepath.Join("pics", "c.jpg"),
+		filepath.Join("pics", "d.jpg")}, movedAway)
+	assert.ElementsMatch(t, []string{filepath.Join("trash", "e.txt"), filepath.Join("photos", "f.jpg")}, deletable)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// verifyMatches compares contents of each matched pair of files (orphan at source to candidate at destination) in
+// parallel, and returns only those pairs whose contents are same, along with numbers of pairs rejected because their
+// contents differ and because they couldn't be compared (which are warned about)
+func verifyMatches(sourceDirPath, destinationDirPath string, matches map[string]string) (
+	verified map[string]string, numDiffering int, numFailed int,
+) {
+	type match struct {
+		orphan, candidate string
+	}
+	matchesToVerify := make(chan match, len(matches))
+	for orphan, candidate := range matches {
+		matchesToVerify <- match{orphan, candidate}
+	}
+	close(matchesToVerify)
+	verified = make(map[string]string, len(matches))
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	parallelism := runtime.NumCPU()
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for m := range matchesToVerify {
+				same, cErr := lib.SameContent(filepath.Join(sourceDirPath, m.orphan),
+					filepath.Join(destinationDirPath, m.candidate))
+				mx.Lock()
+				if cErr != nil {
+					fmte.Warnf("couldn't compare \"%s\" with \"%s\" (skipping): %+v\n", m.orphan,
+						m.candidate, cErr)
+					numFailed++
+				} else if same {
+					verified[m.orphan] = m.candidate
+				} else {
+					fmte.PrintfV("Rejecting match of \"%s\" with \"%s\", as their contents differ\n", m.orphan,
+						m.candidate)
+					numDiffering++
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return verified, numDiffering, numFailed
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestComputeSyncActionsVerify(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	// Same size and same sampled bytes, but different content elsewhere:
+	content1 := make([]byte, 100*bytesutil.KIBI)
+	content2 := make([]byte, 100*bytesutil.KIBI)
+	content2[30*bytesutil.KIBI] = 1
+	writeTestFiles(t, sourceDirPath, map[string]string{
+		"renamed.bin": string(content1), "also_renamed.txt": "same content",
+	})
+	writeTestFiles(t, destinationDirPath, map[string]string{
+		"original.bin": string(content2), "original.txt": "same content",
+	})
+	textMove := action.MoveFileAction{BasePath: destinationDirPath,
+		RelativeFromPath: "original.txt", RelativeToPath: "also_renamed.txt"}
+	assert.ElementsMatch(t, []action.SyncAction{
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "original.bin",
+			RelativeToPath: "renamed.bin"},
+		textMove,
+	}, computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{}))
+	assert.Equal(t, []action.SyncAction{textMove},
+		computeSyncActions(t, sourceDirPath, destinationDirPath, SyncOptions{Verify: true}))
+}
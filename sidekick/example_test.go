@@ -0,0 +1,48 @@
+package sidekick_test
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/sidekick"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Example shows how rsync-sidekick can be embedded in a Go program: a file renamed at source is renamed at destination
+// too, so that rsync doesn't have to transfer it again.
+func Example() {
+	fmte.Off()
+	sourceDirPath, _ := os.MkdirTemp("", "source")
+	destinationDirPath, _ := os.MkdirTemp("", "destination")
+	defer os.RemoveAll(sourceDirPath)
+	defer os.RemoveAll(destinationDirPath)
+	modTime := time.Now().Add(-time.Hour)
+	for _, path := range []string{filepath.Join(sourceDirPath, "renamed.txt"),
+		filepath.Join(destinationDirPath, "original.txt")} {
+		_ = os.WriteFile(path, []byte("contents of a large file"), 0644)
+		_ = os.Chtimes(path, modTime, modTime)
+	}
+
+	opts := sidekick.Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath}
+	if err := opts.Validate(); err != nil {
+		fmt.Println("invalid options:", err)
+		return
+	}
+	actions, savings, err := sidekick.Plan(opts)
+	if err != nil {
+		fmt.Println("couldn't plan:", err)
+		return
+	}
+	fmt.Printf("%d action(s) save transfer of %d bytes\n", len(actions), savings.Bytes)
+	report, err := sidekick.Apply(actions, opts)
+	if err != nil {
+		fmt.Println("couldn't apply:", err)
+		return
+	}
+	_, statErr := os.Stat(filepath.Join(destinationDirPath, "renamed.txt"))
+	fmt.Printf("%d action(s) succeeded, file renamed at destination: %t\n", report.SuccessCount, statErr == nil)
+	// Output:
+	// 1 action(s) save transfer of 24 bytes
+	// 1 action(s) succeeded, file renamed at destination: true
+}
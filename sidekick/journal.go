@@ -0,0 +1,162 @@
+package sidekick
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"os"
+)
+
+// journalHeader is the first line of a journal: sync actions being applied, in the order they're performed
+type journalHeader struct {
+	SourceDirPath      string        `json:"source"`
+	DestinationDirPath string        `json:"destination"`
+	Actions            []action.Spec `json:"actions"`
+}
+
+// journalEntry is each subsequent line of a journal, recording that an action is being attempted or that it was
+// attempted (whatever its outcome)
+type journalEntry struct {
+	// Started, if set, is index (in journalHeader.Actions) of the action being attempted
+	Started *int `json:"started,omitempty"`
+	// Done, if set, is index of the action attempted
+	Done *int `json:"done,omitempty"`
+}
+
+// journal records progress of Apply in a file (see Options.JournalPath), one line of JSON at a time, so that actions
+// left unperformed by a run that didn't complete (e.g. due to a crash or a power loss) can be resumed (see Resume)
+type journal struct {
+	path string
+	file *os.File
+}
+
+// createJournal creates a journal at given path (replacing any that's there) for actions, which must be in the order
+// they're performed
+func createJournal(path string, sourceDirPath string, destinationDirPath string, actions []action.SyncAction,
+) (*journal, error) {
+	file, cErr := os.Create(path)
+	if cErr != nil {
+		return nil, fmt.Errorf("couldn't create journal \"%s\": %+v", path, cErr)
+	}
+	j := &journal{path: path, file: file}
+	if wErr := j.write(journalHeader{
+		SourceDirPath:      sourceDirPath,
+		DestinationDirPath: destinationDirPath,
+		Actions:            action.Specs(actions),
+	}); wErr != nil {
+		_ = file.Close()
+		return nil, wErr
+	}
+	return j, nil
+}
+
+// write appends a line to the journal and flushes it to disk (so that it survives a power loss)
+func (j *journal) write(line any) error {
+	if wErr := j.writeUnflushed(line); wErr != nil {
+		return wErr
+	}
+	return j.file.Sync()
+}
+
+// writeUnflushed appends a line to the journal, without waiting for it to reach the disk (so it survives the process
+// stopping abruptly, but not necessarily a power loss)
+func (j *journal) writeUnflushed(line any) error {
+	data, mErr := json.Marshal(line)
+	if mErr != nil {
+		return fmt.Errorf("couldn't convert journal entry to JSON: %+v", mErr)
+	}
+	if _, wErr := j.file.Write(append(data, '\n')); wErr != nil {
+		return fmt.Errorf("couldn't write to journal \"%s\": %+v", j.path, wErr)
+	}
+	return nil
+}
+
+// markStarted records that i-th action is being attempted, so that one left half-done by a run that stopped abruptly
+// is known to be (see action.Run.Interrupted). This isn't flushed to disk, as a record that's lost only makes such an
+// action fail safely (rather than be completed). Failure to record it is only warned about, for the same reason.
+func (j *journal) markStarted(i int) {
+	if wErr := j.writeUnflushed(journalEntry{Started: &i}); wErr != nil {
+		fmte.Warnf("%+v\n", wErr)
+	}
+}
+
+// markDone records that i-th action was attempted. Failure to record it is only warned about, as the action is
+// performed already (and would be recognized as such on resuming, see action.IsDone).
+func (j *journal) markDone(i int) {
+	if wErr := j.write(journalEntry{Done: &i}); wErr != nil {
+		fmte.Warnf("%+v\n", wErr)
+	}
+}
+
+// close closes the journal, and removes it if all actions were attempted (an incomplete journal is left to be resumed)
+func (j *journal) close(isComplete bool) {
+	_ = j.file.Close()
+	if !isComplete {
+		fmte.Printf("Actions that weren't performed are recorded in journal \"%s\" (they're resumed on next run)\n",
+			j.path)
+		return
+	}
+	if rErr := os.Remove(j.path); rErr != nil {
+		fmte.Warnf("couldn't remove journal \"%s\": %+v\n", j.path, rErr)
+	}
+}
+
+// loadJournal reads a journal left behind by a run that didn't complete, and re-creates actions that weren't attempted
+// in it (a journal that doesn't exist has none), along with the one that was being attempted when the run stopped, if
+// any (it's among the pending ones). Moves aside into temporary directory (see action.Settings.TempDirPath) are
+// re-created as long as they're into given one.
+func loadJournal(path string, tempDirPath string) (sourceDirPath string, destinationDirPath string,
+	pending []action.SyncAction, interrupted action.SyncAction, err error) {
+	file, oErr := os.Open(path)
+	if os.IsNotExist(oErr) {
+		return "", "", nil, nil, nil
+	} else if oErr != nil {
+		return "", "", nil, nil, fmt.Errorf("couldn't open journal \"%s\": %+v", path, oErr)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	// Header has all actions on a single line:
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	if !scanner.Scan() {
+		return "", "", nil, nil, fmt.Errorf("journal \"%s\" is empty: %+v", path, scanner.Err())
+	}
+	var header journalHeader
+	if uErr := json.Unmarshal(scanner.Bytes(), &header); uErr != nil {
+		return "", "", nil, nil, fmt.Errorf("couldn't parse journal \"%s\": %+v", path, uErr)
+	}
+	done := make([]bool, len(header.Actions))
+	started := -1
+	for scanner.Scan() {
+		var entry journalEntry
+		if uErr := json.Unmarshal(scanner.Bytes(), &entry); uErr != nil {
+			// Last line may be partly written, if the run was stopped abruptly while writing it
+			fmte.Warnf("ignoring unreadable line in journal \"%s\": %+v\n", path, uErr)
+			continue
+		}
+		if entry.Started != nil {
+			started = *entry.Started
+		}
+		if entry.Done != nil && *entry.Done >= 0 && *entry.Done < len(done) {
+			done[*entry.Done] = true
+		}
+	}
+	if sErr := scanner.Err(); sErr != nil {
+		return "", "", nil, nil, fmt.Errorf("couldn't read journal \"%s\": %+v", path, sErr)
+	}
+	for i, spec := range header.Actions {
+		if done[i] {
+			continue
+		}
+		a, sErr := action.FromSpec(spec, header.SourceDirPath, header.DestinationDirPath, tempDirPath)
+		if sErr != nil {
+			return "", "", nil, nil, fmt.Errorf("invalid action #%d in journal \"%s\": %+v", i+1, path, sErr)
+		}
+		pending = append(pending, a)
+		if i == started {
+			interrupted = a
+		}
+	}
+	return header.SourceDirPath, header.DestinationDirPath, pending, interrupted, nil
+}
@@ -0,0 +1,142 @@
+package sidekick
+
+import (
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"strings"
+	"time"
+)
+
+// Formats of progress printed while files are indexed
+const (
+	// ProgressFormatAuto is ProgressFormatBar when printing to a terminal and ProgressFormatLines otherwise
+	ProgressFormatAuto = "auto"
+	// ProgressFormatBar is a single line, updated in place
+	ProgressFormatBar = "bar"
+	// ProgressFormatLines is a new line every few seconds
+	ProgressFormatLines = "lines"
+	ProgressFormatNone  = "none"
+)
+
+// ProgressFormats are possible values of Options.ProgressFormat
+var ProgressFormats = []string{ProgressFormatAuto, ProgressFormatBar, ProgressFormatLines, ProgressFormatNone}
+
+const progressBarWidth = 30
+
+// resolveProgressFormat converts given progress format to one that can be shown: a bar is shown only on a terminal
+func resolveProgressFormat(progressFormat string, isTerminal bool) string {
+	if progressFormat == ProgressFormatLines || progressFormat == ProgressFormatNone {
+		return progressFormat
+	}
+	if isTerminal {
+		return ProgressFormatBar
+	}
+	return ProgressFormatLines
+}
+
+// reportProgress prints progress of indexing of files at source and destination (compared with what's expected to be
+// indexed), in given format, until done is closed
+func reportProgress(progressFormat string, source *service.IndexProgress, sourceExpected service.IndexProgress,
+	destination *service.IndexProgress, destinationExpected service.IndexProgress, done <-chan struct{}) {
+	switch resolveProgressFormat(progressFormat, fmte.IsTerminal()) {
+	case ProgressFormatBar:
+		showProgressBar(source, sourceExpected, destination, destinationExpected, done)
+	case ProgressFormatLines:
+		showProgressLines(source, sourceExpected, destination, destinationExpected, done)
+	}
+}
+
+func showProgressLines(source *service.IndexProgress, sourceExpected service.IndexProgress,
+	destination *service.IndexProgress, destinationExpected service.IndexProgress, done <-chan struct{}) {
+	start := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	for source.Load().Files < sourceExpected.Files || destination.Load().Files < destinationExpected.Files {
+		select {
+		case <-done:
+			return
+		case <-time.After(2 * time.Second):
+		}
+		sourceDone, destinationDone := source.Load(), destination.Load()
+		sourceToHash, destinationToHash := bytesToHash(sourceDone, sourceExpected),
+			bytesToHash(destinationDone, destinationExpected)
+		fmte.Printf("%.0f%% done at source and %.0f%% done at destination: %s\n",
+			100*fractionDone(sourceDone.Bytes, sourceToHash),
+			100*fractionDone(destinationDone.Bytes, destinationToHash),
+			bytesProgress(sourceDone.Bytes+destinationDone.Bytes, sourceToHash+destinationToHash, time.Since(start)))
+	}
+}
+
+func showProgressBar(source *service.IndexProgress, sourceExpected service.IndexProgress,
+	destination *service.IndexProgress, destinationExpected service.IndexProgress, done <-chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			fmte.Printf("%s\n", progressBarLine(source.Load(), sourceExpected, destination.Load(), destinationExpected,
+				time.Since(start)))
+			return
+		case <-ticker.C:
+			fmte.Printf("%s", progressBarLine(source.Load(), sourceExpected, destination.Load(), destinationExpected,
+				time.Since(start)))
+		}
+	}
+}
+
+// bytesToHash is the number of bytes expected to be hashed, leaving out those of files that were indexed without being
+// hashed (see service.IndexProgress.SkippedBytes)
+func bytesToHash(done service.IndexProgress, expected service.IndexProgress) int64 {
+	return expected.Bytes - done.SkippedBytes
+}
+
+// fractionDone is the fraction of expected bytes that are done (all of them, if none are expected)
+func fractionDone(done int64, expected int64) float64 {
+	if expected <= 0 {
+		return 1.0
+	}
+	return float64(done) / float64(expected)
+}
+
+// bytesProgress describes how many bytes are hashed out of those expected, along with throughput of hashing and time
+// it would take to hash the remaining ones at that rate, e.g.:
+//
+//	1.20 GiB/2.40 GiB (85.30 MiB/s, ETA 00:15)
+func bytesProgress(done int64, expected int64, elapsed time.Duration) string {
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(done) / elapsed.Seconds()
+	}
+	eta := "--:--"
+	if remaining := expected - done; remaining <= 0 {
+		eta = "00:00"
+	} else if throughput > 0 {
+		seconds := int64(float64(remaining) / throughput)
+		eta = fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+	}
+	return fmt.Sprintf("%s/%s (%s/s, ETA %s)", bytesutil.Format(done), bytesutil.Format(expected),
+		bytesutil.Format(int64(throughput)), eta)
+}
+
+// progressBarLine renders progress of indexing as a line that overwrites the previous one, e.g. (with a shorter bar):
+//
+//	[#####.....]  50% | 120/200 files at source, 30/100 at destination | 1.20 GiB/2.40 GiB (85.30 MiB/s, ETA 00:15)
+//
+// The bar, percentage and ETA are by bytes hashed rather than by files indexed, as sizes of files vary a lot.
+func progressBarLine(source service.IndexProgress, sourceExpected service.IndexProgress,
+	destination service.IndexProgress, destinationExpected service.IndexProgress, elapsed time.Duration) string {
+	bytesDone := source.Bytes + destination.Bytes
+	bytesExpected := bytesToHash(source, sourceExpected) + bytesToHash(destination, destinationExpected)
+	fraction := fractionDone(bytesDone, bytesExpected)
+	numFilled := int(fraction * progressBarWidth)
+	if numFilled > progressBarWidth {
+		numFilled = progressBarWidth
+	}
+	// Padded, so that a shorter line fully overwrites a longer one:
+	return fmt.Sprintf("\r[%s%s] %3.0f%% | %d/%d files at source, %d/%d at destination | %-50s",
+		strings.Repeat("#", numFilled), strings.Repeat(".", progressBarWidth-numFilled), 100*fraction,
+		source.Files, sourceExpected.Files, destination.Files, destinationExpected.Files,
+		bytesProgress(bytesDone, bytesExpected, elapsed))
+}
@@ -0,0 +1,39 @@
+package sidekick
+
+import (
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestResolveProgressFormat(t *testing.T) {
+	assert.Equal(t, ProgressFormatBar, resolveProgressFormat(ProgressFormatAuto, true))
+	assert.Equal(t, ProgressFormatLines, resolveProgressFormat(ProgressFormatAuto, false))
+	assert.Equal(t, ProgressFormatLines, resolveProgressFormat("", false))
+	assert.Equal(t, ProgressFormatBar, resolveProgressFormat(ProgressFormatBar, true))
+	// a bar would garble piped output:
+	assert.Equal(t, ProgressFormatLines, resolveProgressFormat(ProgressFormatBar, false))
+	assert.Equal(t, ProgressFormatNone, resolveProgressFormat(ProgressFormatNone, true))
+	assert.Equal(t, ProgressFormatLines, resolveProgressFormat(ProgressFormatLines, true))
+}
+
+func TestProgressBarLine(t *testing.T) {
+	assert.Equal(t,
+		"\r[#######.......................]  25% | 120/200 files at source, 30/100 at destination | "+
+			"768.00 KiB/3.00 MiB (192.00 KiB/s, ETA 00:12)     ",
+		progressBarLine(service.IndexProgress{Bytes: 512 * 1024, Files: 120},
+			service.IndexProgress{Bytes: 1024 * 1024, Files: 200}, service.IndexProgress{Bytes: 256 * 1024, Files: 30},
+			service.IndexProgress{Bytes: 2 * 1024 * 1024, Files: 100}, 4*time.Second))
+	assert.Equal(t,
+		"\r[##############################] 100% | 0/0 files at source, 0/0 at destination | "+
+			"0 B/0 B (0 B/s, ETA 00:00)                        ",
+		progressBarLine(service.IndexProgress{}, service.IndexProgress{}, service.IndexProgress{},
+			service.IndexProgress{}, 0))
+}
+
+func TestBytesProgress(t *testing.T) {
+	assert.Equal(t, "0 B/1.00 GiB (0 B/s, ETA --:--)", bytesProgress(0, 1<<30, time.Second))
+	assert.Equal(t, "100.00 MiB/1.00 GiB (50.00 MiB/s, ETA 00:18)", bytesProgress(100<<20, 1<<30, 2*time.Second))
+	assert.Equal(t, "1.00 GiB/10.00 GiB (1.00 MiB/s, ETA 153:36)", bytesProgress(1<<30, 10<<30, 1024*time.Second))
+}
@@ -0,0 +1,769 @@
+// Package sidekick is what rsync-sidekick does, as a library: Plan computes sync actions that propagate renames,
+// movements and timestamp changes of files at source to destination (so that rsync doesn't have to transfer them) and
+// Apply performs them.
+//
+// Progress is printed through package fmte (call fmte.Off to silence it).
+package sidekick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"github.com/m-manu/rsync-sidekick/service"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotConfirmed is why an action is skipped by Apply when it isn't confirmed (see Options.Confirm)
+var ErrNotConfirmed = errors.New("it wasn't confirmed")
+
+// numActionsShownInSummary is the number of actions shown at the beginning and at the end of a summarized action list
+const numActionsShownInSummary = 5
+
+// Options decide what Plan and Apply do
+type Options struct {
+	SourceDirPath      string
+	DestinationDirPath string
+	// Exclusions are names (or glob patterns) of files/directories to be left out while scanning (nil meaning none)
+	Exclusions set.Set[string]
+	// DryRun makes Apply only print the actions, guaranteeing nothing is written
+	DryRun bool
+	// Verbose, along with RunID, writes intermediate lists of files to files named after it (how much is printed is
+	// decided by level of fmte, see fmte.SetLevel)
+	Verbose bool
+	RunID   string
+	// SummaryThreshold is number of actions beyond which Apply prints only a few of them (0 meaning all are printed)
+	SummaryThreshold int
+	// CheckPreconditions makes Apply skip actions whose preconditions don't hold anymore (see
+	// action.CheckPreconditions)
+	CheckPreconditions bool
+	// RetryPolicy decides how Apply retries actions that fail due to transient errors
+	RetryPolicy action.RetryPolicy
+	// ProgressFormat is how progress of indexing of files is printed: one of ProgressFormats (empty meaning
+	// ProgressFormatAuto)
+	ProgressFormat string
+	// JournalPath, if set, is where Apply records progress of actions, so that actions left unperformed by a run that
+	// doesn't complete (e.g. due to a crash or a power loss) are performed by Resume later
+	JournalPath string
+	// Confirm, if set, is asked by Apply before performing each action (after its preconditions are checked): actions
+	// it doesn't confirm are skipped
+	Confirm func(a action.SyncAction) bool
+	// ByExtension, if positive, makes Plan print number and total size of files of each extension (top ByExtension of
+	// them, by total size) at source, at destination and among orphans at source, once they're found
+	ByExtension int
+	// ScanOnly makes Plan stop once orphans at source and candidates at destination are found, before any file is
+	// hashed: no actions are computed, and Stats only estimate what sync actions would save (see
+	// Stats.MaxSavingsBytes)
+	ScanOnly bool
+	// AllowNested makes Validate accept destination directory inside source directory (or the other way round): Plan
+	// leaves the inner one out of scanning of the outer one
+	AllowNested bool
+	// Context, if set, stops Plan and Apply early once it's done (e.g. on Ctrl-C or a timeout): Plan stops scanning
+	// and indexing of files and returns an error, while Apply finishes the action in progress and leaves the rest
+	// unperformed
+	Context context.Context
+	// SyncOptions decide how files are matched, e.g. how they are hashed (Digest.HashMode) and how many are hashed
+	// concurrently (Threads)
+	service.SyncOptions
+	// Settings decide how Apply performs actions, e.g. what a file move does when another file is in its way
+	// (ConflictPolicy) and where cycles of moves are broken through (TempDirPath, with names of files there prefixed
+	// by RunID unless TempPrefix is set)
+	action.Settings
+	// interrupted is the action an earlier run was performing when it stopped, as recorded in its journal (see Resume)
+	interrupted action.SyncAction
+}
+
+// actionSettings returns opts.Settings, with names of temporary files prefixed by opts.RunID (unless a prefix is set)
+func (opts Options) actionSettings() action.Settings {
+	settings := opts.Settings
+	if settings.TempPrefix == "" {
+		settings.TempPrefix = opts.RunID
+	}
+	return settings
+}
+
+// context returns opts.Context, or a context that's never done if it isn't set
+func (opts Options) context() context.Context {
+	if opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// Savings is what sync actions save in terms of transfer by rsync
+type Savings struct {
+	// Bytes is total size of files that rsync won't have to transfer, thanks to the sync actions
+	Bytes int64
+	// CopiedBytes is total size of files copied into destination from archive directory (see
+	// service.SyncOptions.ArchiveDirPath), which rsync won't have to transfer either
+	CopiedBytes int64
+	// NumCopied is number of orphans at source (not taken care of by other actions) that are copied from archive
+	// directory
+	NumCopied int
+	// ResidualBytes is total size of files at source that rsync will still have to transfer
+	ResidualBytes int64
+	// UnmatchedFiles are files at source (relative paths) that rsync will still have to transfer
+	UnmatchedFiles []string
+}
+
+// Stats are details of computation of sync actions by PlanWithStats
+type Stats struct {
+	Savings
+	NumSourceFiles      int
+	NumDestinationFiles int
+	// NumOrphans is number of files at source that don't have counterparts at destination
+	NumOrphans int
+	// NumCandidates is number of files at destination that may be counterparts of orphans at source
+	NumCandidates int
+	// OrphanBytes and CandidateBytes are total sizes of orphans at source and of candidates at destination
+	OrphanBytes    int64
+	CandidateBytes int64
+	// MaxSavingsBytes is total size of orphans at source that have at least one candidate at destination: an upper
+	// bound on what sync actions can save (it's set only with Options.ScanOnly, as Savings are known otherwise)
+	MaxSavingsBytes int64
+	// ElapsedSeconds are durations of phases of computation ("scan" and "index")
+	ElapsedSeconds map[string]float64
+	// DestinationFiles are files found at destination
+	DestinationFiles map[string]entity.FileMeta
+	// ExtraneousFiles are files at destination that don't exist at source (see service.FindExtraneous)
+	ExtraneousFiles []string
+}
+
+// Plan computes sync actions that make destination look like source, without transferring any file. Actions are
+// performed by Apply.
+func Plan(opts Options) ([]action.SyncAction, Savings, error) {
+	actions, stats, err := PlanWithStats(opts)
+	return actions, stats.Savings, err
+}
+
+// PlanWithStats is same as Plan, except that it also returns details of computation of sync actions (even if it fails)
+func PlanWithStats(opts Options) ([]action.SyncAction, Stats, error) {
+	if opts.Exclusions == nil {
+		opts.Exclusions = set.NewThreadUnsafeSet[string]()
+	}
+	stats := Stats{ElapsedSeconds: map[string]float64{}, Savings: Savings{UnmatchedFiles: []string{}}}
+	source, destination, err := scanDirectories(opts, &stats)
+	if err != nil {
+		return nil, stats, err
+	}
+	actions, stats, err := planFiles(opts, source.files, destination.files, stats)
+	if err != nil {
+		return nil, stats, err
+	}
+	if opts.ScanOnly {
+		return actions, stats, nil
+	}
+	if opts.Symlinks && !opts.OnlyTimestamp {
+		fmte.Printf("Identifying symbolic link renames/movements...\n")
+		symlinkActions := service.ComputeSymlinkActions(source.links, opts.DestinationDirPath, destination.links)
+		fmte.Printf("Found %d actions for symbolic links\n", len(symlinkActions))
+		actions = append(actions, symlinkActions...)
+	}
+	if opts.PruneEmptyDirs != "" {
+		_, nestedInDestination := nestedDirectories(opts.SourceDirPath, opts.DestinationDirPath)
+		removals, pruneErr := service.ComputeEmptyDirRemovals(opts.DestinationDirPath, opts.Exclusions,
+			nestedInDestination, opts.IgnoreRules, actions, opts.PruneEmptyDirs)
+		if pruneErr != nil {
+			return nil, stats, fmt.Errorf("error while finding empty directories at destination: %+v", pruneErr)
+		}
+		fmte.Printf("Found %d empty directories at destination to remove\n", len(removals))
+		actions = append(actions, removals...)
+	}
+	if opts.DirTimestamps {
+		fmte.Printf("Identifying directories whose timestamps differ...\n")
+		dirTimestampActions, dirsErr := planDirTimestamps(opts, actions)
+		if dirsErr != nil {
+			return nil, stats, dirsErr
+		}
+		fmte.Printf("Found %d directories to propagate timestamps of\n", len(dirTimestampActions))
+		actions = append(actions, dirTimestampActions...)
+	}
+	return actions, stats, nil
+}
+
+// planDirTimestamps finds directories at source and destination, and computes actions that propagate timestamps of
+// directories, once given actions are performed
+func planDirTimestamps(opts Options, actions []action.SyncAction) ([]action.SyncAction, error) {
+	nestedInSource, nestedInDestination := nestedDirectories(opts.SourceDirPath, opts.DestinationDirPath)
+	sourceDirs, sourceErr := service.FindDirsFromDirectory(opts.context(), opts.SourceDirPath, opts.Exclusions,
+		nestedInSource, opts.IgnoreRules)
+	if sourceErr != nil {
+		return nil, fmt.Errorf("error scanning source directory for directories: %+v", sourceErr)
+	}
+	destinationDirs, destinationErr := service.FindDirsFromDirectory(opts.context(), opts.DestinationDirPath,
+		opts.Exclusions, nestedInDestination, opts.IgnoreRules)
+	if destinationErr != nil {
+		return nil, fmt.Errorf("error scanning destination directory for directories: %+v", destinationErr)
+	}
+	return service.ComputeDirTimestampActions(opts.SourceDirPath, sourceDirs, opts.DestinationDirPath,
+		destinationDirs, actions, opts.SyncOptions), nil
+}
+
+// nestedDirectories computes directories to be excluded from scanning of source and of destination: if one directory
+// is nested inside the other, it's excluded from scanning of the other
+func nestedDirectories(sourceDirPath string, destinationDirPath string,
+) (nestedInSource set.Set[string], nestedInDestination set.Set[string]) {
+	nestedInSource, nestedInDestination = set.NewThreadUnsafeSet[string](), set.NewThreadUnsafeSet[string]()
+	if lib.IsInsideDirectory(sourceDirPath, destinationDirPath) {
+		nestedInSource.Add(destinationDirPath)
+	} else if lib.IsInsideDirectory(destinationDirPath, sourceDirPath) {
+		nestedInDestination.Add(sourceDirPath)
+	}
+	return
+}
+
+// directoryContents are regular files (with their total size) and symbolic links (with their targets, found only with
+// Options.Symlinks) in a directory
+type directoryContents struct {
+	files map[string]entity.FileMeta
+	size  int64
+	links map[string]string
+}
+
+// scanDirectories scans source and destination directories concurrently, while reporting progress (and how long it
+// took, in stats)
+func scanDirectories(opts Options, stats *Stats) (source directoryContents, destination directoryContents, err error) {
+	sourceDirPath, destinationDirPath := opts.SourceDirPath, opts.DestinationDirPath
+	fmte.Printf("Scanning source (%s) and destination (%s) directories...\n", sourceDirPath, destinationDirPath)
+	start := time.Now()
+	var sourceFilesErr, destinationFilesErr error
+	var wgDirScan sync.WaitGroup
+	wgDirScan.Add(2)
+	nestedInSource, nestedInDestination := nestedDirectories(sourceDirPath, destinationDirPath)
+	scan := func(dirPath string, nestedDirPaths set.Set[string]) (directoryContents, error) {
+		var contents directoryContents
+		var scanErr error
+		if opts.Symlinks && !opts.OnlyTimestamp {
+			contents.files, contents.size, contents.links, scanErr = service.FindFilesAndSymlinksFromDirectory(
+				opts.context(), dirPath, opts.Exclusions, nestedDirPaths, opts.IgnoreRules)
+		} else {
+			contents.files, contents.size, scanErr = service.FindFilesFromDirectoryExcludingDirs(opts.context(),
+				dirPath, opts.Exclusions, nestedDirPaths, opts.IgnoreRules)
+		}
+		return contents, scanErr
+	}
+	go func() {
+		defer wgDirScan.Done()
+		source, sourceFilesErr = scan(sourceDirPath, nestedInSource)
+	}()
+	go func() {
+		defer wgDirScan.Done()
+		destination, destinationFilesErr = scan(destinationDirPath, nestedInDestination)
+	}()
+	wgDirScan.Wait()
+	elapsed := time.Since(start)
+	stats.ElapsedSeconds["scan"] = elapsed.Seconds()
+	if ctxErr := opts.context().Err(); ctxErr != nil {
+		return source, destination, ctxErr
+	}
+	if sourceFilesErr != nil {
+		return source, destination, fmt.Errorf("error scanning source directory: %+v", sourceFilesErr)
+	}
+	if destinationFilesErr != nil {
+		return source, destination, fmt.Errorf("error scanning destination directory: %+v", destinationFilesErr)
+	}
+	fmte.Printf("Found %d files (total size %s) at source and %d files (total size %s) at destination in %.1fs\n",
+		len(source.files), bytesutil.Format(source.size), len(destination.files),
+		bytesutil.Format(destination.size), elapsed.Seconds())
+	return source, destination, nil
+}
+
+// planFiles computes sync actions for regular files found at source and destination, while reporting progress
+func planFiles(opts Options, sourceFiles, destinationFiles map[string]entity.FileMeta, stats Stats,
+) ([]action.SyncAction, Stats, error) {
+	sourceDirPath, destinationDirPath := opts.SourceDirPath, opts.DestinationDirPath
+	var start, end time.Time
+	if !opts.NanosecondPrecision {
+		service.WithoutNanoseconds(sourceFiles)
+		service.WithoutNanoseconds(destinationFiles)
+	}
+	stats.NumSourceFiles, stats.NumDestinationFiles = len(sourceFiles), len(destinationFiles)
+	stats.DestinationFiles = destinationFiles
+	stats.ExtraneousFiles = service.FindExtraneous(sourceFiles, destinationFiles)
+	if opts.ByExtension > 0 {
+		printStatsByExtension("source", sourceFiles, opts.ByExtension)
+		printStatsByExtension("destination", destinationFiles, opts.ByExtension)
+	}
+	fmte.Printf("Finding files at source that don't have counterparts at destination...\n")
+	var orphansAtSource []string
+	if opts.Checksum {
+		fmte.Printf("Comparing checksums of files at same paths at source and destination...\n")
+		var checksumErr error
+		orphansAtSource, checksumErr = service.FindOrphansByChecksum(opts.context(), sourceDirPath, sourceFiles,
+			destinationDirPath, destinationFiles, opts.SyncOptions)
+		if checksumErr != nil {
+			return nil, stats, fmt.Errorf("error while comparing checksums of files: %+v", checksumErr)
+		}
+	} else {
+		orphansAtSource = service.FindOrphansWithin(sourceFiles, destinationFiles, opts.PathNormalizer,
+			opts.ModifyWindow)
+	}
+	stats.NumOrphans = len(orphansAtSource)
+	allOrphansAtSource := orphansAtSource
+	stats.setUnmatchedFiles(sourceFiles, allOrphansAtSource)
+	if opts.ByExtension > 0 {
+		orphanFiles := make(map[string]entity.FileMeta, len(allOrphansAtSource))
+		for _, path := range allOrphansAtSource {
+			orphanFiles[path] = sourceFiles[path]
+		}
+		printStatsByExtension("source without counterparts at destination", orphanFiles, opts.ByExtension)
+	}
+	if opts.IncludedExtensions != nil && opts.IncludedExtensions.Cardinality() > 0 {
+		// Since candidates at destination are of same extensions as orphans, this excludes other candidates too
+		var numIgnored int
+		orphansAtSource, numIgnored = filterByExtension(orphansAtSource, opts.IncludedExtensions)
+		if numIgnored > 0 {
+			extensions := opts.IncludedExtensions.ToSlice()
+			sort.Strings(extensions)
+			fmte.Printf("Ignored %d files with extensions other than %s (rsync will transfer them)\n", numIgnored,
+				strings.Join(extensions, ", "))
+		}
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		// Since candidates at destination are of same sizes as orphans, this excludes candidates of other sizes too
+		var smaller, larger []string
+		orphansAtSource, smaller, larger = filterBySize(sourceFiles, orphansAtSource, opts.MinSize, opts.MaxSize)
+		if len(smaller) > 0 {
+			fmte.Printf("Ignored %d files below %s, of total size %s (rsync will transfer them)\n", len(smaller),
+				bytesutil.Format(opts.MinSize), bytesutil.Format(service.TotalSize(sourceFiles, smaller)))
+		}
+		if len(larger) > 0 {
+			fmte.Printf("Ignored %d files above %s, of total size %s (rsync will transfer them)\n", len(larger),
+				bytesutil.Format(opts.MaxSize), bytesutil.Format(service.TotalSize(sourceFiles, larger)))
+		}
+	}
+	stats.OrphanBytes = service.TotalSize(sourceFiles, orphansAtSource)
+	if len(orphansAtSource) == 0 {
+		fmte.Printf("All files at source directory have counterparts. So, no action needed 🙂!\n")
+		return []action.SyncAction{}, stats, nil
+	}
+	sort.Strings(orphansAtSource)
+	fmte.Printf("Found %d files (total size %s)\n", len(orphansAtSource), bytesutil.Format(stats.OrphanBytes))
+	if opts.Verbose {
+		lib.WriteSliceToFile(orphansAtSource, fmt.Sprintf("./info_%s_orphans_at_source.txt", opts.RunID))
+	}
+	fmte.Printf("Finding candidates at destination...\n")
+	candidatesAtDestination, candidatesFileExtAndSizeMap := findCandidatesAtDestination(sourceFiles, destinationFiles,
+		orphansAtSource, opts.IgnoreExtension)
+	stats.NumCandidates = len(candidatesAtDestination)
+	stats.CandidateBytes = service.TotalSize(destinationFiles, candidatesAtDestination)
+	if opts.ScanOnly {
+		stats.MaxSavingsBytes = service.TotalSize(sourceFiles, orphansWithCandidates(sourceFiles, orphansAtSource,
+			candidatesFileExtAndSizeMap, opts.IgnoreExtension))
+		fmte.Printf("Found %d candidates (total size %s). Sync actions can save at most %s of files transfer.\n",
+			len(candidatesAtDestination), bytesutil.Format(stats.CandidateBytes),
+			bytesutil.Format(stats.MaxSavingsBytes))
+		return []action.SyncAction{}, stats, nil
+	}
+	if len(candidatesAtDestination) == 0 {
+		fmte.Printf("No candidates found. Looks like all %d files are new. rsync will do the rest.\n",
+			len(orphansAtSource))
+		return planArchiveCopies(opts, sourceFiles, destinationFiles, orphansAtSource, allOrphansAtSource,
+			[]action.SyncAction{}, stats)
+	}
+	sort.Strings(candidatesAtDestination)
+	if opts.Verbose {
+		lib.WriteSliceToFile(candidatesAtDestination,
+			fmt.Sprintf("./info_%s_candidates_at_destination.txt", opts.RunID),
+		)
+	}
+	fmte.Printf("Found %d candidates.\n", len(candidatesAtDestination))
+	fmte.Printf("Identifying file renames/movements and timestamp changes...\n")
+	start = time.Now()
+	var actions []action.SyncAction
+	var savings int64
+	var syncErr error
+	var sourceProgress, destinationProgress service.IndexProgress
+	var wg sync.WaitGroup
+	wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		reportProgress(opts.ProgressFormat, &sourceProgress, service.IndexProgress{
+			Bytes: service.TotalSize(sourceFiles, orphansAtSource), Files: int32(len(orphansAtSource)),
+		}, &destinationProgress, service.IndexProgress{
+			Bytes: service.TotalSize(destinationFiles, candidatesAtDestination),
+			Files: int32(len(candidatesAtDestination)),
+		}, done)
+	}()
+	actions, savings, syncErr = service.ComputeSyncActions(opts.context(), sourceDirPath, sourceFiles, orphansAtSource,
+		destinationDirPath, destinationFiles, candidatesAtDestination, &sourceProgress, &destinationProgress,
+		opts.SyncOptions)
+	close(done)
+	wg.Wait()
+	end = time.Now()
+	stats.ElapsedSeconds["index"] = end.Sub(start).Seconds()
+	if syncErr != nil {
+		return nil, stats, fmt.Errorf("error while computing sync actions: %+v", syncErr)
+	}
+	fmte.Printf("Completed in %.1fs\n", end.Sub(start).Seconds())
+	if len(actions) == 0 {
+		fmte.Printf("No sync actions found. You may run rsync.\n")
+		return planArchiveCopies(opts, sourceFiles, destinationFiles, orphansAtSource, allOrphansAtSource,
+			[]action.SyncAction{}, stats)
+	}
+	fmte.Printf("Found %d actions that can save you %s of files transfer!\n",
+		len(actions), bytesutil.Format(savings))
+	stats.Bytes = savings
+	stats.setUnmatchedFiles(sourceFiles, service.FindUnmatchedOrphans(allOrphansAtSource, actions))
+	return planArchiveCopies(opts, sourceFiles, destinationFiles, orphansAtSource, allOrphansAtSource, actions, stats)
+}
+
+// planArchiveCopies adds actions that copy files from archive directory (if there's one) for orphans at source that
+// given actions don't take care of
+func planArchiveCopies(opts Options, sourceFiles, destinationFiles map[string]entity.FileMeta,
+	orphansAtSource []string, allOrphansAtSource []string, actions []action.SyncAction, stats Stats,
+) ([]action.SyncAction, Stats, error) {
+	archiveDirPath := opts.ArchiveDirPath
+	if archiveDirPath == "" || opts.OnlyTimestamp {
+		return actions, stats, nil
+	}
+	fmte.Printf("Scanning archive directory (%s)...\n", archiveDirPath)
+	excludedDirPaths := set.NewThreadUnsafeSet[string]()
+	for _, dirPath := range []string{opts.SourceDirPath, opts.DestinationDirPath} {
+		if lib.IsInsideDirectory(archiveDirPath, dirPath) {
+			excludedDirPaths.Add(dirPath)
+		}
+	}
+	archiveFiles, _, archiveErr := service.FindFilesFromDirectoryExcludingDirs(opts.context(), archiveDirPath,
+		opts.Exclusions, excludedDirPaths, opts.IgnoreRules)
+	if archiveErr != nil {
+		return nil, stats, fmt.Errorf("error scanning archive directory: %+v", archiveErr)
+	}
+	if !opts.NanosecondPrecision {
+		service.WithoutNanoseconds(archiveFiles)
+	}
+	orphansLeft := service.FindUnmatchedOrphans(orphansAtSource, actions)
+	candidatesInArchive, _ := findCandidatesAtDestination(sourceFiles, archiveFiles, orphansLeft, opts.IgnoreExtension)
+	sort.Strings(candidatesInArchive)
+	copyActions, copiedBytes, copyErr := service.ComputeArchiveCopies(opts.context(), opts.SourceDirPath, sourceFiles,
+		orphansLeft, archiveDirPath, archiveFiles, candidatesInArchive, opts.DestinationDirPath, destinationFiles,
+		actions, opts.SyncOptions)
+	if copyErr != nil {
+		return nil, stats, fmt.Errorf("error while computing copies from archive directory: %+v", copyErr)
+	}
+	actions = append(actions, copyActions...)
+	stats.CopiedBytes = copiedBytes
+	for _, a := range copyActions {
+		if _, isCopy := a.(action.CopyFileAction); isCopy {
+			stats.NumCopied++
+		}
+	}
+	stats.setUnmatchedFiles(sourceFiles, service.FindUnmatchedOrphans(allOrphansAtSource, actions))
+	fmte.Printf("%d out of %d orphans at source left to rsync can be copied from archive directory instead\n",
+		stats.NumCopied, len(orphansLeft))
+	fmte.Printf("Found %d actions that copy files from archive directory, saving %s of files transfer (rsync will"+
+		" still transfer %s)\n", len(copyActions), bytesutil.Format(copiedBytes),
+		bytesutil.Format(stats.ResidualBytes))
+	return actions, stats, nil
+}
+
+// setUnmatchedFiles records orphans at source that no sync action takes care of, along with their total size
+func (s *Savings) setUnmatchedFiles(sourceFiles map[string]entity.FileMeta, unmatchedFiles []string) {
+	s.UnmatchedFiles = unmatchedFiles
+	s.ResidualBytes = service.TotalSize(sourceFiles, unmatchedFiles)
+}
+
+// filterBySize removes files smaller than minSize and files larger than maxSize (unless it's 0) from given list of
+// paths, and returns the removed ones too
+func filterBySize(files map[string]entity.FileMeta, paths []string, minSize int64, maxSize int64,
+) (filtered []string, smaller []string, larger []string) {
+	filtered = make([]string, 0, len(paths))
+	for _, path := range paths {
+		if size := files[path].Size; size < minSize {
+			smaller = append(smaller, path)
+		} else if maxSize > 0 && size > maxSize {
+			larger = append(larger, path)
+		} else {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered, smaller, larger
+}
+
+// printStatsByExtension prints a table of number and total size of given files, by extension (top ones only)
+func printStatsByExtension(where string, files map[string]entity.FileMeta, top int) {
+	fmte.Printf("Files at %s by extension (top %d by total size):\n", where, top)
+	fmte.Printf("  %-12s %10s %12s\n", "extension", "files", "size")
+	for _, s := range service.StatsByExtension(files, top) {
+		ext := s.Extension
+		if ext == "" {
+			ext = "(none)"
+		}
+		fmte.Printf("  %-12s %10d %12s\n", ext, s.NumFiles, bytesutil.Format(s.Size))
+	}
+}
+
+// filterByExtension removes files with extensions other than given ones from given list of paths
+func filterByExtension(paths []string, extensions set.Set[string]) (filtered []string, numRemoved int) {
+	filtered = make([]string, 0, len(paths))
+	for _, path := range paths {
+		if extensions.Contains(lib.GetFileExt(path)) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered, len(paths) - len(filtered)
+}
+
+// findCandidatesAtDestination finds files at destination with same extensions (unless ignoreExtension is set) and sizes
+// as orphans at source, along with the extensions and sizes that they have
+func findCandidatesAtDestination(sourceFiles, destinationFiles map[string]entity.FileMeta, orphansAtSource []string,
+	ignoreExtension bool,
+) ([]string, set.Set[entity.FileExtAndSize]) {
+	extAndSizeOf := extAndSizeFunc(ignoreExtension)
+	orphansFileExtAndSizeMap := set.NewThreadUnsafeSetWithSize[entity.FileExtAndSize](len(orphansAtSource))
+	for _, path := range orphansAtSource {
+		orphansFileExtAndSizeMap.Add(extAndSizeOf(path, sourceFiles[path]))
+	}
+	candidatesAtDestination := make([]string, 0, len(orphansAtSource))
+	candidatesFileExtAndSizeMap := set.NewThreadUnsafeSet[entity.FileExtAndSize]()
+	for path, fileMeta := range destinationFiles {
+		key := extAndSizeOf(path, fileMeta)
+		if orphansFileExtAndSizeMap.Contains(key) {
+			candidatesAtDestination = append(candidatesAtDestination, path)
+			candidatesFileExtAndSizeMap.Add(key)
+		}
+	}
+	return candidatesAtDestination, candidatesFileExtAndSizeMap
+}
+
+// orphansWithCandidates finds orphans at source that have at least one candidate at destination, i.e. a file with same
+// extension (unless ignoreExtension is set) and size (extensions and sizes of candidates being as found by
+// findCandidatesAtDestination)
+func orphansWithCandidates(sourceFiles map[string]entity.FileMeta, orphansAtSource []string,
+	candidatesFileExtAndSizeMap set.Set[entity.FileExtAndSize], ignoreExtension bool,
+) []string {
+	extAndSizeOf := extAndSizeFunc(ignoreExtension)
+	matched := make([]string, 0, len(orphansAtSource))
+	for _, path := range orphansAtSource {
+		if candidatesFileExtAndSizeMap.Contains(extAndSizeOf(path, sourceFiles[path])) {
+			matched = append(matched, path)
+		}
+	}
+	return matched
+}
+
+// extAndSizeFunc creates a function that tells extension (empty, if ignoreExtension is set) and size of a file
+func extAndSizeFunc(ignoreExtension bool) func(path string, fileMeta entity.FileMeta) entity.FileExtAndSize {
+	return func(path string, fileMeta entity.FileMeta) entity.FileExtAndSize {
+		key := entity.FileExtAndSize{FileSize: fileMeta.Size}
+		if !ignoreExtension {
+			key.FileExtension = lib.GetFileExt(path)
+		}
+		return key
+	}
+}
+
+// Apply performs sync actions at destination, in dependency order (or, if opts.DryRun is set, only prints them).
+// Actions failing due to transient errors are retried as per opts.RetryPolicy, and if opts.CheckPreconditions is set,
+// actions whose preconditions don't hold are skipped with a warning (as are actions that aren't permitted, see
+// action.ErrNotPermitted). Outcomes of actions are in the report: an error is returned only when actions can't be
+// applied at all, or when opts.Context is done before all of them are (in which case the report is marked
+// interrupted).
+func Apply(actions []action.SyncAction, opts Options) (action.Report, error) {
+	if !lib.IsReadableDirectory(opts.DestinationDirPath) {
+		return action.NewReport(0), fmt.Errorf("destination path \"%s\" is not a readable directory",
+			opts.DestinationDirPath)
+	}
+	if opts.DryRun {
+		return auditActions(actions, opts.DestinationDirPath, opts.actionSettings()), nil
+	}
+	report, err := performActions(opts.context(), actions, opts)
+	if err != nil {
+		return report, err
+	}
+	if report.Interrupted {
+		return report, opts.context().Err()
+	}
+	return report, nil
+}
+
+// Resume performs sync actions left unperformed by an earlier Apply (with same opts.JournalPath) that didn't complete,
+// e.g. due to a crash, if there was one and accept (given source and destination recorded in the journal, and number
+// of such actions) returns no error: actions that seem to have been performed already (see action.IsDone) are left
+// out and the rest are performed as by Apply, with their preconditions checked (a file move the earlier run was
+// interrupted midway through is completed, see action.Run.Interrupted). It also tells whether they were.
+func Resume(opts Options, accept func(sourceDirPath string, destinationDirPath string, numPending int) error,
+) (action.Report, bool, error) {
+	sourceDirPath, destinationDirPath, pending, interrupted, err := loadJournal(opts.JournalPath, opts.TempDirPath)
+	if err != nil || destinationDirPath == "" {
+		return action.NewReport(0), false, err
+	}
+	if aErr := accept(sourceDirPath, destinationDirPath, len(pending)); aErr != nil {
+		return action.NewReport(0), false, aErr
+	}
+	fmte.Printf("Resuming %d actions left unperformed in journal \"%s\" by an earlier run...\n", len(pending),
+		opts.JournalPath)
+	remaining := make([]action.SyncAction, 0, len(pending))
+	for _, a := range pending {
+		if !action.IsDone(a) {
+			remaining = append(remaining, a)
+		}
+	}
+	if len(remaining) < len(pending) {
+		fmte.Printf("%d of them were performed already\n", len(pending)-len(remaining))
+	}
+	opts.SourceDirPath, opts.DestinationDirPath = sourceDirPath, destinationDirPath
+	opts.CheckPreconditions = true
+	opts.interrupted = interrupted
+	report, aErr := Apply(remaining, opts)
+	return report, true, aErr
+}
+
+// auditActions prints sync actions that would have been performed, without performing any of them
+func auditActions(actions []action.SyncAction, destinationDirPath string, settings action.Settings) action.Report {
+	actions = action.SortByDependencies(actions, settings)
+	fmte.Printf("Audit mode: following %d actions would be performed (nothing was changed):\n", len(actions))
+	report := action.NewReport(len(actions))
+	for i, syncAction := range actions {
+		fmte.Println(strings.Replace(
+			fmt.Sprintf("%4d/%d %s", i+1, len(actions), syncAction),
+			destinationDirPath+"/", "", -1,
+		))
+		report.CountsByType[action.TypeName(syncAction)]++
+	}
+	if len(actions) > 0 {
+		fmte.Printf("Actions by type: %s\n", report)
+	}
+	return report
+}
+
+// performActions performs sync actions, in dependency order. If opts.CheckPreconditions is set, actions whose
+// preconditions don't hold (see action.CheckPreconditions) are skipped with a warning, and so are actions that
+// opts.Confirm (if set) doesn't confirm and actions that aren't permitted (see action.ErrNotPermitted). Actions are
+// performed as per opts.Settings, and those failing due to transient errors are retried as per opts.RetryPolicy. Once
+// ctx is done, no more actions are performed (the one in progress is finished, though). If opts.JournalPath is set,
+// progress is recorded there, and an error is returned only if the journal can't be created.
+func performActions(ctx context.Context, actions []action.SyncAction, opts Options) (action.Report, error) {
+	destinationDirPath, summaryThreshold := opts.DestinationDirPath, opts.SummaryThreshold
+	checkPreconditions, retryPolicy := opts.CheckPreconditions, opts.RetryPolicy
+	fmte.Printf("Applying sync actions at destination...\n")
+	run := action.NewRun(opts.actionSettings())
+	run.Interrupted = opts.interrupted
+	// Actions are performed in an order such that each one's preconditions hold (e.g. directory exists):
+	actions = action.SortByDependencies(actions, run.Settings)
+	report := action.NewReport(len(actions))
+	var j *journal
+	if opts.JournalPath != "" {
+		var jErr error
+		j, jErr = createJournal(opts.JournalPath, opts.SourceDirPath, destinationDirPath, actions)
+		if jErr != nil {
+			return report, jErr
+		}
+		defer func() {
+			j.close(!report.Interrupted)
+		}()
+	}
+	start := time.Now()
+	for i, syncAction := range actions {
+		if ctx.Err() != nil {
+			report.Interrupted = true
+			report.TempPaths = action.TempPathsOf(actions[i:])
+			break
+		}
+		shown := isActionShown(i, len(actions), summaryThreshold)
+		if i == numActionsShownInSummary && !shown {
+			fmte.Printf("     ... %d more actions (run with --verbose to see all of them)\n",
+				len(actions)-2*numActionsShownInSummary)
+		}
+		line := strings.Replace(
+			fmt.Sprintf("%4d/%d %s: ", i+1, len(actions), syncAction),
+			destinationDirPath+"/", "", -1,
+		)
+		if checkPreconditions {
+			if pErr := action.CheckPreconditions(syncAction, run); pErr != nil {
+				report.Skip(syncAction, pErr)
+				// skips are always shown
+				fmte.Printf("%sskipped, as %+v\n", line, pErr)
+				if j != nil {
+					j.markDone(i)
+				}
+				continue
+			}
+		}
+		if opts.Confirm != nil && !opts.Confirm(syncAction) {
+			report.Skip(syncAction, ErrNotConfirmed)
+			fmte.Printf("%sskipped, as %+v\n", line, ErrNotConfirmed)
+			if j != nil {
+				j.markDone(i)
+			}
+			continue
+		}
+		if shown {
+			fmte.Println(line)
+		} else {
+			fmte.PrintfV("%s\n", line)
+		}
+		actionStart := time.Now()
+		if j != nil {
+			j.markStarted(i)
+		}
+		numRetries, aErr := action.PerformWithRetries(ctx, syncAction, run, retryPolicy)
+		if j != nil {
+			j.markDone(i)
+		}
+		if errors.Is(aErr, action.ErrNotPermitted) {
+			report.Skip(syncAction, aErr)
+			// skips are always shown
+			if shown {
+				fmte.Printf("skipped\n")
+			}
+			fmte.Warnf("skipped %s, as %+v\n", syncAction, aErr)
+			continue
+		}
+		report.Add(syncAction, aErr, time.Since(actionStart))
+		done := "done"
+		if aErr == nil && numRetries > 0 {
+			report.SucceededAfterRetry++
+			done = fmt.Sprintf("done (after %d retries)", numRetries)
+		}
+		if aErr == nil && shown {
+			fmte.Printf("%s\n", done)
+		} else if aErr == nil {
+			fmte.PrintfV("%s\n", done)
+		} else if shown {
+			fmte.Printf("failed due to: %+v\n", aErr)
+		} else {
+			// failures are always shown
+			fmte.Printf("%sfailed due to: %+v\n", line, aErr)
+		}
+	}
+	report.Elapsed = time.Since(start)
+	report.TrashedFiles = run.TrashedFiles()
+	if report.Interrupted {
+		fmte.Printf("Sync interrupted after %.1fs: %d out of %d actions succeeded (%d weren't attempted)\n",
+			report.Elapsed.Seconds(), report.SuccessCount, len(actions),
+			len(actions)-len(report.Results)-len(report.Skipped))
+		if len(report.TempPaths) > 0 {
+			fmte.Warnf("%d files are left at temporary paths, by file moves that weren't attempted:\n%s\n",
+				len(report.TempPaths), strings.Join(report.TempPaths, "\n"))
+		}
+		return report, nil
+	}
+	fmte.Printf("Sync completed in %.1fs: %d out of %d actions succeeded\n",
+		report.Elapsed.Seconds(), report.SuccessCount, len(actions))
+	if report.SucceededAfterRetry > 0 {
+		fmte.Printf("%d actions succeeded only after being retried\n", report.SucceededAfterRetry)
+	}
+	if len(report.Skipped) > 0 {
+		fmte.Printf("%d actions were skipped (see above)\n", len(report.Skipped))
+	}
+	return report, nil
+}
+
+// isActionShown tells whether i-th action among numActions is to be printed while applying. When there are more than
+// summaryThreshold actions, only the first few and the last few are printed (a summaryThreshold of 0 prints all).
+func isActionShown(i int, numActions int, summaryThreshold int) bool {
+	if summaryThreshold <= 0 || numActions <= summaryThreshold {
+		return true
+	}
+	return i < numActionsShownInSummary || i >= numActions-numActionsShownInSummary
+}
@@ -0,0 +1,404 @@
+package sidekick
+
+import (
+	"context"
+	"errors"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func copyFile(t *testing.T, srcPath string, dstPath string) {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatalf("couldn't read file %s: %+v", srcPath, err)
+	}
+	if err = os.WriteFile(dstPath, data, 0644); err != nil {
+		t.Fatalf("couldn't write file %s: %+v", dstPath, err)
+	}
+}
+
+func TestApplyReport(t *testing.T) {
+	fmte.Off()
+	baseDir := t.TempDir()
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "b.txt"))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "c.txt"))
+	actions := []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(baseDir, "dir")},
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "dir/a.txt"},
+		// fails, because target already exists:
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "b.txt", RelativeToPath: "c.txt"},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(report.Results))
+	assert.Equal(t, 2, report.SuccessCount)
+	assert.Equal(t, 1, report.FailureCount())
+	assert.Equal(t, actions[2], report.Failures[0].Action)
+	assert.Error(t, report.Failures[0].Err)
+	assert.Equal(t, map[string]int{"MakeDirectoryAction": 1, "MoveFileAction": 2}, report.CountsByType)
+	assert.Equal(t, "MakeDirectoryAction: 1, MoveFileAction: 2", report.String())
+	assert.FileExists(t, filepath.Join(baseDir, "dir/a.txt"))
+	assert.FileExists(t, filepath.Join(baseDir, "b.txt"))
+}
+
+func TestApplyInDependencyOrder(t *testing.T) {
+	fmte.Off()
+	baseDir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(baseDir, "photos"), 0755))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "photos", "1.txt"))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(baseDir, "photos", "2.txt"))
+	// "1.txt" was renamed to "2.txt" and "2.txt" was moved to a new folder (in that order, neither would succeed):
+	actions := []action.SyncAction{
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "photos/1.txt", RelativeToPath: "photos/2.txt"},
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "photos/2.txt", RelativeToPath: "archive/2.txt"},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(baseDir, "archive")},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.FailureCount())
+	assert.Equal(t, 3, report.SuccessCount)
+	assert.NoFileExists(t, filepath.Join(baseDir, "photos", "1.txt"))
+	assert.FileExists(t, filepath.Join(baseDir, "photos", "2.txt"))
+	assert.FileExists(t, filepath.Join(baseDir, "archive", "2.txt"))
+}
+
+func TestApplyConfirm(t *testing.T) {
+	fmte.Off()
+	baseDir := t.TempDir()
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "b.txt"))
+	actions := []action.SyncAction{
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "a2.txt"},
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "b.txt", RelativeToPath: "b2.txt"},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir, Confirm: func(a action.SyncAction) bool {
+		return a == actions[1]
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, []action.Result{{Action: actions[0], Err: ErrNotConfirmed}}, report.Skipped)
+	assert.FileExists(t, filepath.Join(baseDir, "a.txt"))
+	assert.FileExists(t, filepath.Join(baseDir, "b2.txt"))
+}
+
+func TestApplyConflictPolicy(t *testing.T) {
+	fmte.Off()
+	trashingDir, overwritingDir, trashDir := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, baseDir := range []string{trashingDir, overwritingDir} {
+		copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+		copyFile(t, filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(baseDir, "b.txt"))
+	}
+	move := func(baseDir string) []action.SyncAction {
+		return []action.SyncAction{
+			action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "b.txt"},
+		}
+	}
+	// Runs applied concurrently don't share their settings:
+	var trashingReport, overwritingReport action.Report
+	var trashingErr, overwritingErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		trashingReport, trashingErr = Apply(move(trashingDir), Options{DestinationDirPath: trashingDir,
+			Settings: action.Settings{ConflictPolicy: action.ConflictTrash, TrashDirPath: trashDir}})
+	}()
+	go func() {
+		defer wg.Done()
+		overwritingReport, overwritingErr = Apply(move(overwritingDir), Options{DestinationDirPath: overwritingDir,
+			Settings: action.Settings{ConflictPolicy: action.ConflictOverwrite}})
+	}()
+	wg.Wait()
+	assert.NoError(t, trashingErr)
+	assert.Equal(t, 1, trashingReport.SuccessCount)
+	assert.Equal(t, []string{filepath.Join(trashingDir, "b.txt")}, trashingReport.TrashedFiles)
+	assert.FileExists(t, filepath.Join(trashDir, "b.txt"))
+	assert.NoError(t, overwritingErr)
+	assert.Equal(t, 1, overwritingReport.SuccessCount)
+	assert.Empty(t, overwritingReport.TrashedFiles)
+	assert.NoFileExists(t, filepath.Join(overwritingDir, "a.txt"))
+}
+
+func TestApplyNotPermitted(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		t.Skip("lack of privilege to change owners of files can't be had as root or on Windows")
+	}
+	fmte.Off()
+	baseDir := t.TempDir()
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "b.txt"))
+	actions := []action.SyncAction{
+		action.ChownAction{BasePath: baseDir, RelativePath: "a.txt", UID: 0, GID: -1},
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "b.txt", RelativeToPath: "b2.txt"},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir})
+	assert.NoError(t, err)
+	// Lack of privilege to change owner is neither a success nor a failure:
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, 0, report.FailureCount())
+	assert.Len(t, report.Skipped, 1)
+	assert.Equal(t, actions[0], report.Skipped[0].Action)
+	assert.ErrorIs(t, report.Skipped[0].Err, action.ErrNotPermitted)
+}
+
+func TestInterrupted(t *testing.T) {
+	fmte.Off()
+	baseDir := t.TempDir()
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Once interrupted, planning stops with an error:
+	_, _, planErr := Plan(Options{SourceDirPath: baseDir, DestinationDirPath: t.TempDir(), Context: ctx})
+	assert.ErrorIs(t, planErr, context.Canceled)
+	// ...and so does applying, without performing any more actions:
+	actions := []action.SyncAction{
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(baseDir, "dir")},
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "dir/a.txt"},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir, Context: ctx})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, report.Interrupted)
+	assert.Equal(t, 0, len(report.Results))
+	assert.FileExists(t, filepath.Join(baseDir, "a.txt"))
+	assert.NoDirExists(t, filepath.Join(baseDir, "dir"))
+}
+
+func TestIsActionShown(t *testing.T) {
+	// Small plans are shown in full:
+	for i := 0; i < 20; i++ {
+		assert.True(t, isActionShown(i, 20, 20))
+		assert.True(t, isActionShown(i, 20, 0))
+	}
+	// Large plans are summarized:
+	var shown []int
+	for i := 0; i < 21; i++ {
+		if isActionShown(i, 21, 20) {
+			shown = append(shown, i)
+		}
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 16, 17, 18, 19, 20}, shown)
+}
+
+func TestApplyDryRun(t *testing.T) {
+	fmte.Off()
+	baseDir := t.TempDir()
+	copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(baseDir, "a.txt"))
+	actions := []action.SyncAction{
+		action.MoveFileAction{BasePath: baseDir, RelativeFromPath: "a.txt", RelativeToPath: "b.txt"},
+	}
+	report, err := Apply(actions, Options{DestinationDirPath: baseDir, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"MoveFileAction": 1}, report.CountsByType)
+	assert.Equal(t, 0, report.SuccessCount)
+	assert.FileExists(t, filepath.Join(baseDir, "a.txt"))
+	_, err = Apply(actions, Options{DestinationDirPath: filepath.Join(baseDir, "non_existent")})
+	assert.Error(t, err)
+}
+
+func TestPlanIncludedExtensions(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"photo.jpg", "notes.txt", "small.jpg"} {
+		contents := []byte("contents of " + name + strings.Repeat(".", 100))
+		if name == "small.jpg" {
+			contents = contents[:10]
+		}
+		for _, path := range []string{filepath.Join(sourceDirPath, "renamed_"+name),
+			filepath.Join(destinationDirPath, name)} {
+			assert.NoError(t, os.WriteFile(path, contents, 0644))
+			assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		}
+	}
+	actions, _, err := Plan(Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath,
+		SyncOptions: service.SyncOptions{IncludedExtensions: set.NewSet[string](".jpg"), MinSize: 50}})
+	assert.NoError(t, err)
+	// Neither a file with other extension, nor a small one, is matched:
+	assert.Equal(t, []action.SyncAction{
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "photo.jpg",
+			RelativeToPath: "renamed_photo.jpg"},
+	}, actions)
+}
+
+func TestPlanArchiveCopies(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath, archiveDirPath := t.TempDir(), t.TempDir(), t.TempDir()
+	for name, contents := range map[string]string{"in_archive.txt": "an older file", "new.txt": "a new file"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(sourceDirPath, name), []byte(contents), 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(archiveDirPath, "old.txt"), []byte("an older file"), 0644))
+	actions, stats, err := PlanWithStats(Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath,
+		SyncOptions: service.SyncOptions{ArchiveDirPath: archiveDirPath, NoTimestamp: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{
+		action.CopyFileAction{FromPath: filepath.Join(archiveDirPath, "old.txt"), BasePath: destinationDirPath,
+			RelativeToPath: "in_archive.txt"},
+	}, actions)
+	assert.Equal(t, 1, stats.NumCopied)
+	assert.Equal(t, int64(len("an older file")), stats.CopiedBytes)
+	assert.Equal(t, []string{"new.txt"}, stats.UnmatchedFiles)
+}
+
+func TestPlanIgnoreExtension(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	contents := []byte("contents of a photo" + strings.Repeat(".", 100))
+	for _, path := range []string{filepath.Join(sourceDirPath, "photo.jpg"),
+		filepath.Join(destinationDirPath, "photo.jpeg")} {
+		assert.NoError(t, os.WriteFile(path, contents, 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	// A file whose extension was changed is matched only when extensions are ignored:
+	actions, _, err := Plan(Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath})
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	actions, _, err = Plan(Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath,
+		SyncOptions: service.SyncOptions{IgnoreExtension: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, []action.SyncAction{
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "photo.jpeg",
+			RelativeToPath: "photo.jpg"},
+	}, actions)
+}
+
+func TestPlanScanOnly(t *testing.T) {
+	fmte.Off()
+	sourceDirPath, destinationDirPath := t.TempDir(), t.TempDir()
+	for path, contents := range map[string]string{
+		filepath.Join(sourceDirPath, "renamed.jpg"):     strings.Repeat("a", 100),
+		filepath.Join(sourceDirPath, "new.txt"):         strings.Repeat("b", 50),
+		filepath.Join(destinationDirPath, "other.jpg"):  strings.Repeat("c", 100),
+		filepath.Join(destinationDirPath, "unknown.md"): strings.Repeat("d", 20),
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+	// A candidate with different contents counts towards savings too, as files aren't hashed:
+	actions, stats, err := PlanWithStats(Options{SourceDirPath: sourceDirPath, DestinationDirPath: destinationDirPath,
+		ScanOnly: true, SyncOptions: service.SyncOptions{NoTimestamp: true}})
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	assert.Equal(t, 2, stats.NumOrphans)
+	assert.Equal(t, 1, stats.NumCandidates)
+	assert.Equal(t, int64(150), stats.OrphanBytes)
+	assert.Equal(t, int64(100), stats.CandidateBytes)
+	assert.Equal(t, int64(100), stats.MaxSavingsBytes)
+	assert.NotContains(t, stats.ElapsedSeconds, "index")
+}
+
+func TestFilterBySize(t *testing.T) {
+	files := map[string]entity.FileMeta{"a": {Size: 10}, "b": {Size: 100}, "c": {Size: 1000}, "d": {Size: 10000}}
+	filtered, smaller, larger := filterBySize(files, []string{"a", "b", "c", "d"}, 100, 1000)
+	assert.Equal(t, []string{"b", "c"}, filtered)
+	assert.Equal(t, []string{"a"}, smaller)
+	assert.Equal(t, []string{"d"}, larger)
+	// Maximum size of 0 means there's no limit:
+	filtered, smaller, larger = filterBySize(files, []string{"a", "b", "c", "d"}, 0, 0)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, filtered)
+	assert.Empty(t, smaller)
+	assert.Empty(t, larger)
+}
+
+func TestFilterByExtension(t *testing.T) {
+	filtered, numRemoved := filterByExtension([]string{"a/b.JPG", "c.heic", "d.txt", "e"},
+		set.NewSet[string](".jpg", ".heic"))
+	assert.Equal(t, []string{"a/b.JPG", "c.heic"}, filtered)
+	assert.Equal(t, 2, numRemoved)
+}
+
+func TestResume(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, name))
+	}
+	move := func(from, to string) action.SyncAction {
+		return action.MoveFileAction{BasePath: destinationDir, RelativeFromPath: from, RelativeToPath: to}
+	}
+	actions := []action.SyncAction{move("a.txt", "x.txt"), move("b.txt", "y.txt"), move("c.txt", "z.txt")}
+	// As if a run recorded the first action, performed the second one without recording it, and then crashed:
+	j, err := createJournal(journalPath, sourceDir, destinationDir, actions)
+	assert.NoError(t, err)
+	assert.NoError(t, actions[0].Perform(nil))
+	j.markDone(0)
+	assert.NoError(t, actions[1].Perform(nil))
+	j.close(false)
+	assert.FileExists(t, journalPath)
+
+	accept := func(sourceDirPath string, destinationDirPath string, numPending int) error {
+		assert.Equal(t, sourceDir, sourceDirPath)
+		assert.Equal(t, destinationDir, destinationDirPath)
+		assert.Equal(t, 2, numPending)
+		return nil
+	}
+	// Nothing is performed unless it's accepted:
+	_, isResumed, err := Resume(Options{JournalPath: journalPath},
+		func(string, string, int) error { return errors.New("not accepted") })
+	assert.Error(t, err)
+	assert.False(t, isResumed)
+	assert.NoFileExists(t, filepath.Join(destinationDir, "z.txt"))
+
+	report, isResumed, err := Resume(Options{JournalPath: journalPath}, accept)
+	assert.NoError(t, err)
+	assert.True(t, isResumed)
+	// ...only the third action is left to be performed:
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, 0, report.FailureCount())
+	for _, name := range []string{"x.txt", "y.txt", "z.txt"} {
+		assert.FileExists(t, filepath.Join(destinationDir, name))
+	}
+	assert.NoFileExists(t, journalPath)
+	// There's nothing to resume once the journal is complete:
+	_, isResumed, err = Resume(Options{JournalPath: journalPath}, accept)
+	assert.NoError(t, err)
+	assert.False(t, isResumed)
+}
+
+func TestResumeInterrupted(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir := t.TempDir(), t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		copyFile(t, filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, name))
+	}
+	move := func(from, to string) action.SyncAction {
+		return action.MoveFileAction{BasePath: destinationDir, RelativeFromPath: from, RelativeToPath: to}
+	}
+	actions := []action.SyncAction{move("a.txt", "x.txt"), move("b.txt", "y.txt")}
+	// As if a run crashed midway through the first move (having linked the file at its new path), while the second
+	// move's paths are links to the same file for another reason:
+	for _, pair := range [][2]string{{"a.txt", "x.txt"}, {"b.txt", "y.txt"}} {
+		if err := os.Link(filepath.Join(destinationDir, pair[0]), filepath.Join(destinationDir, pair[1])); err != nil {
+			t.Skipf("hard links aren't supported here: %+v", err)
+		}
+	}
+	j, err := createJournal(journalPath, sourceDir, destinationDir, actions)
+	assert.NoError(t, err)
+	j.markStarted(0)
+	j.close(false)
+
+	report, isResumed, err := Resume(Options{JournalPath: journalPath}, func(string, string, int) error { return nil })
+	assert.NoError(t, err)
+	assert.True(t, isResumed)
+	// Only the move that was interrupted is completed:
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Len(t, report.Skipped, 1)
+	assert.Equal(t, actions[1], report.Skipped[0].Action)
+	assert.NoFileExists(t, filepath.Join(destinationDir, "a.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "x.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "b.txt"))
+	assert.FileExists(t, filepath.Join(destinationDir, "y.txt"))
+}
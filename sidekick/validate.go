@@ -0,0 +1,254 @@
+package sidekick
+
+import (
+	"errors"
+	"fmt"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/lib"
+	"github.com/m-manu/rsync-sidekick/service"
+	"os"
+	"strings"
+)
+
+// ErrSameDirectory is why Validate refuses source and destination that are the same directory
+var ErrSameDirectory = errors.New("source and destination are the same directory")
+
+// ErrNestedDirectories is why Validate refuses source and destination directories one of which is inside the other
+// (unless Options.AllowNested is set)
+var ErrNestedDirectories = errors.New("source and destination directories are nested")
+
+// OptionError is what Validate returns for an option that's invalid, by itself or along with other options
+type OptionError struct {
+	// Option is name of the field of Options (or of service.SyncOptions or action.Settings, embedded in it) that's
+	// invalid, e.g. "MinSize" or "Digest.HashMode"
+	Option string
+	Err    error
+}
+
+func (e OptionError) Error() string {
+	return fmt.Sprintf("invalid option %s: %v", e.Option, e.Err)
+}
+
+func (e OptionError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks options before they're passed to Plan or Apply (neither of which does this): source and
+// destination must be readable directories that aren't the same (nor nested, unless AllowNested is set), values of
+// options must be among the valid ones (or within their ranges) and directories that files are moved into (see
+// action.Settings) must be on the same filesystem as destination. The first problem found is returned, as an
+// OptionError.
+func (opts Options) Validate() error {
+	if err := validateDirectories(opts); err != nil {
+		return err
+	}
+	if err := validateSyncOptions(opts.SyncOptions, opts.SourceDirPath, opts.DestinationDirPath); err != nil {
+		return err
+	}
+	if err := validateSettings(opts.Settings, opts.SourceDirPath, opts.DestinationDirPath); err != nil {
+		return err
+	}
+	if opts.ProgressFormat != "" && !isOneOf(opts.ProgressFormat, ProgressFormats) {
+		return OptionError{"ProgressFormat", notOneOf("progress format", opts.ProgressFormat, ProgressFormats)}
+	}
+	if opts.RetryPolicy.Retries < 0 || opts.RetryPolicy.Delay < 0 {
+		return OptionError{"RetryPolicy", errors.New("number of retries and delay between them can't be negative")}
+	}
+	if opts.ByExtension < 0 {
+		return OptionError{"ByExtension", errors.New("number of extensions reported can't be negative")}
+	}
+	if opts.ScanOnly && opts.Checksum {
+		return OptionError{"ScanOnly", errors.New("a scan (which hashes no file) can't be done along with comparison " +
+			"of files by checksum")}
+	}
+	return nil
+}
+
+// validateDirectories checks source and destination directories (see Validate)
+func validateDirectories(opts Options) error {
+	if !lib.IsReadableDirectory(opts.SourceDirPath) {
+		return OptionError{"SourceDirPath", fmt.Errorf("source path \"%s\" is not a readable directory",
+			opts.SourceDirPath)}
+	}
+	if !lib.IsReadableDirectory(opts.DestinationDirPath) {
+		return OptionError{"DestinationDirPath", fmt.Errorf("destination path \"%s\" is not a readable directory",
+			opts.DestinationDirPath)}
+	}
+	if isSameDirectory(opts.SourceDirPath, opts.DestinationDirPath) {
+		return OptionError{"DestinationDirPath", fmt.Errorf("%w (\"%s\" and \"%s\")", ErrSameDirectory,
+			opts.SourceDirPath, opts.DestinationDirPath)}
+	}
+	if nestingErr := checkNotNested(opts.SourceDirPath, opts.DestinationDirPath); nestingErr != nil &&
+		!opts.AllowNested {
+		return OptionError{"DestinationDirPath", fmt.Errorf("%w: %v", ErrNestedDirectories, nestingErr)}
+	}
+	return nil
+}
+
+// validateSyncOptions checks options that decide how files are matched (see Validate)
+func validateSyncOptions(options service.SyncOptions, sourceDirPath, destinationDirPath string) error {
+	for _, contentTypes := range []struct {
+		option string
+		values set.Set[string]
+	}{
+		{"IncludedContentTypes", options.IncludedContentTypes},
+		{"ExcludedContentTypes", options.ExcludedContentTypes},
+	} {
+		if contentTypes.values == nil {
+			continue
+		}
+		for _, contentType := range contentTypes.values.ToSlice() {
+			if !isOneOf(contentType, service.ContentTypes) {
+				return OptionError{contentTypes.option, notOneOf("content type", contentType, service.ContentTypes)}
+			}
+		}
+	}
+	if options.MinSize < 0 {
+		return OptionError{"MinSize", errors.New("minimum size can't be negative")}
+	}
+	if options.MaxSize < 0 || (options.MaxSize > 0 && options.MaxSize < options.MinSize) {
+		return OptionError{"MaxSize", errors.New("maximum size can't be negative, nor less than minimum size")}
+	}
+	if options.IncludedExtensions != nil {
+		for _, ext := range options.IncludedExtensions.ToSlice() {
+			if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext[1:], `./\`) || ext != strings.ToLower(ext) {
+				return OptionError{"IncludedExtensions", fmt.Errorf("\"%s\" isn't a file extension (in lower case, "+
+					"with leading dot, as in \".jpg\")", ext)}
+			}
+		}
+	}
+	if options.Digest.HashMode != "" && !isOneOf(options.Digest.HashMode, service.HashModes) {
+		return OptionError{"Digest.HashMode", notOneOf("hash mode", options.Digest.HashMode, service.HashModes)}
+	}
+	if options.Threads < 0 {
+		return OptionError{"Threads", errors.New("number of threads can't be negative")}
+	}
+	if options.CaseInsensitiveFS != "" && !isOneOf(options.CaseInsensitiveFS, service.CaseInsensitiveFSModes) {
+		return OptionError{"CaseInsensitiveFS", notOneOf("case-insensitivity of filesystem", options.CaseInsensitiveFS,
+			service.CaseInsensitiveFSModes)}
+	}
+	if options.ArchiveDirPath != "" {
+		if !lib.IsReadableDirectory(options.ArchiveDirPath) {
+			return OptionError{"ArchiveDirPath", fmt.Errorf("archive path \"%s\" is not a readable directory",
+				options.ArchiveDirPath)}
+		}
+		if isSameDirectory(options.ArchiveDirPath, sourceDirPath) ||
+			isSameDirectory(options.ArchiveDirPath, destinationDirPath) {
+			return OptionError{"ArchiveDirPath", fmt.Errorf("archive directory \"%s\" can't be same as source or "+
+				"destination directory", options.ArchiveDirPath)}
+		}
+	}
+	if options.NoTimestamp && options.OnlyTimestamp {
+		return OptionError{"OnlyTimestamp", errors.New("propagation of only timestamps and of no timestamps can't " +
+			"both be asked for")}
+	}
+	if options.PruneEmptyDirs != "" && !isOneOf(options.PruneEmptyDirs, service.PruneEmptyDirsModes) {
+		return OptionError{"PruneEmptyDirs", notOneOf("pruning of empty directories", options.PruneEmptyDirs,
+			service.PruneEmptyDirsModes)}
+	}
+	if options.ModifyWindow < 0 {
+		return OptionError{"ModifyWindow", errors.New("modify window can't be negative")}
+	}
+	return nil
+}
+
+// validateSettings checks settings that decide how actions are performed (see Validate)
+func validateSettings(settings action.Settings, sourceDirPath, destinationDirPath string) error {
+	if settings.ConflictPolicy != "" && !isOneOf(settings.ConflictPolicy, action.ConflictPolicies) {
+		return OptionError{"ConflictPolicy", notOneOf("conflict policy", settings.ConflictPolicy,
+			action.ConflictPolicies)}
+	}
+	if (settings.ConflictPolicy == action.ConflictTrash) != (settings.TrashDirPath != "") {
+		return OptionError{"TrashDirPath", fmt.Errorf("trash directory is needed with conflict policy \"%s\", and "+
+			"only with it", action.ConflictTrash)}
+	}
+	for _, workDir := range []struct{ option, name, path string }{
+		{"TrashDirPath", "trash", settings.TrashDirPath},
+		{"TempDirPath", "temporary", settings.TempDirPath},
+	} {
+		if workDir.path == "" {
+			continue
+		}
+		if !lib.IsReadableDirectory(workDir.path) {
+			return OptionError{workDir.option, fmt.Errorf("%s path \"%s\" is not a readable directory", workDir.name,
+				workDir.path)}
+		}
+		if err := checkWorkDir(workDir.name, workDir.path, sourceDirPath, destinationDirPath); err != nil {
+			return OptionError{workDir.option, err}
+		}
+	}
+	if settings.CopyBandwidthLimit < 0 {
+		return OptionError{"CopyBandwidthLimit", errors.New("bandwidth limit can't be negative")}
+	}
+	return nil
+}
+
+func isOneOf(value string, values []string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func notOneOf(name, value string, values []string) error {
+	return fmt.Errorf("%s \"%s\" isn't one of: %s", name, value, strings.Join(values, ", "))
+}
+
+// isSameDirectory checks whether the two paths are of the same directory, including when they're spelt differently
+// though symbolic links are resolved (e.g. in different case, on a case-insensitive file system, or through a bind
+// mount)
+func isSameDirectory(dirPath1, dirPath2 string) bool {
+	if dirPath1 == dirPath2 {
+		return true
+	}
+	info1, err1 := os.Stat(dirPath1)
+	info2, err2 := os.Stat(dirPath2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
+
+// checkNotNested returns an error if either of source and destination directories is inside the other
+func checkNotNested(sourceDirPath, destinationDirPath string) error {
+	if lib.IsInsideDirectory(sourceDirPath, destinationDirPath) {
+		return fmt.Errorf("destination directory \"%s\" is inside source directory \"%s\"",
+			destinationDirPath, sourceDirPath)
+	}
+	if lib.IsInsideDirectory(destinationDirPath, sourceDirPath) {
+		return fmt.Errorf("source directory \"%s\" is inside destination directory \"%s\"",
+			sourceDirPath, destinationDirPath)
+	}
+	return nil
+}
+
+// checkWorkDir returns an error if given directory that files are moved into (temporary directory or trash directory,
+// see action.Settings) is inside source or destination directory, or isn't on the same filesystem as destination
+// directory (moves into it and out of it wouldn't be atomic renames then, if possible at all). Where filesystems of
+// directories can't be told, this is only warned about.
+func checkWorkDir(name, workDirPath, sourceDirPath, destinationDirPath string) error {
+	for _, dirPath := range []string{sourceDirPath, destinationDirPath} {
+		if workDirPath == dirPath || lib.IsInsideDirectory(dirPath, workDirPath) {
+			return fmt.Errorf("%s directory \"%s\" can't be inside source or destination directory", name, workDirPath)
+		}
+	}
+	workDirInfo, workDirErr := os.Stat(workDirPath)
+	if workDirErr != nil {
+		return workDirErr
+	}
+	destinationInfo, destinationErr := os.Stat(destinationDirPath)
+	if destinationErr != nil {
+		return destinationErr
+	}
+	workDirDevice, isWorkDirDeviceKnown := lib.DeviceOf(workDirInfo)
+	destinationDevice, isDestinationDeviceKnown := lib.DeviceOf(destinationInfo)
+	if !isWorkDirDeviceKnown || !isDestinationDeviceKnown {
+		fmte.Warnf("couldn't tell whether %s directory \"%s\" is on the same filesystem as destination directory "+
+			"\"%s\" (moves into it fail if it isn't)\n", name, workDirPath, destinationDirPath)
+	} else if workDirDevice != destinationDevice {
+		return fmt.Errorf("%s directory \"%s\" isn't on the same filesystem as destination directory \"%s\"", name,
+			workDirPath, destinationDirPath)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package sidekick
+
+import (
+	"errors"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	sourceDir, destinationDir, otherDir := t.TempDir(), t.TempDir(), t.TempDir()
+	valid := Options{SourceDirPath: sourceDir, DestinationDirPath: destinationDir}
+	assert.NoError(t, valid.Validate())
+	invalidOption := func(opts Options) string {
+		var optionErr OptionError
+		if !errors.As(opts.Validate(), &optionErr) {
+			return ""
+		}
+		return optionErr.Option
+	}
+	with := func(change func(opts *Options)) Options {
+		opts := valid
+		change(&opts)
+		return opts
+	}
+	assert.Equal(t, "SourceDirPath", invalidOption(with(func(opts *Options) {
+		opts.SourceDirPath = filepath.Join(sourceDir, "non_existent")
+	})))
+	assert.Equal(t, "DestinationDirPath", invalidOption(with(func(opts *Options) {
+		opts.DestinationDirPath = ""
+	})))
+	assert.ErrorIs(t, with(func(opts *Options) { opts.DestinationDirPath = sourceDir }).Validate(), ErrSameDirectory)
+	nestedDir := filepath.Join(sourceDir, "backup")
+	assert.NoError(t, os.Mkdir(nestedDir, 0755))
+	nested := with(func(opts *Options) { opts.DestinationDirPath = nestedDir })
+	assert.ErrorIs(t, nested.Validate(), ErrNestedDirectories)
+	nested.AllowNested = true
+	assert.NoError(t, nested.Validate())
+	assert.Equal(t, "Digest.HashMode", invalidOption(with(func(opts *Options) { opts.Digest.HashMode = "md5" })))
+	assert.NoError(t, with(func(opts *Options) { opts.Digest.HashMode = service.HashModeFull }).Validate())
+	assert.Equal(t, "ExcludedContentTypes", invalidOption(with(func(opts *Options) {
+		opts.ExcludedContentTypes = set.NewSet[string]("video", "movie")
+	})))
+	assert.Equal(t, "MaxSize", invalidOption(with(func(opts *Options) { opts.MinSize, opts.MaxSize = 100, 10 })))
+	assert.NoError(t, with(func(opts *Options) { opts.MinSize, opts.MaxSize = 100, 0 }).Validate())
+	assert.Equal(t, "IncludedExtensions", invalidOption(with(func(opts *Options) {
+		opts.IncludedExtensions = set.NewSet[string](".jpg", "png")
+	})))
+	assert.NoError(t, with(func(opts *Options) { opts.IncludedExtensions = set.NewSet[string](".jpg") }).Validate())
+	assert.Equal(t, "Threads", invalidOption(with(func(opts *Options) { opts.Threads = -1 })))
+	assert.Equal(t, "ModifyWindow", invalidOption(with(func(opts *Options) { opts.ModifyWindow = -time.Second })))
+	assert.Equal(t, "OnlyTimestamp", invalidOption(with(func(opts *Options) {
+		opts.NoTimestamp, opts.OnlyTimestamp = true, true
+	})))
+	assert.Equal(t, "ArchiveDirPath", invalidOption(with(func(opts *Options) { opts.ArchiveDirPath = sourceDir })))
+	assert.NoError(t, with(func(opts *Options) { opts.ArchiveDirPath = otherDir }).Validate())
+	assert.Equal(t, "ScanOnly", invalidOption(with(func(opts *Options) { opts.ScanOnly, opts.Checksum = true, true })))
+	assert.Equal(t, "RetryPolicy", invalidOption(with(func(opts *Options) { opts.RetryPolicy.Retries = -1 })))
+	assert.Equal(t, "ConflictPolicy", invalidOption(with(func(opts *Options) { opts.ConflictPolicy = "rename" })))
+	// Trash directory is needed with ConflictTrash, and only with it:
+	assert.Equal(t, "TrashDirPath", invalidOption(with(func(opts *Options) {
+		opts.ConflictPolicy = action.ConflictTrash
+	})))
+	assert.Equal(t, "TrashDirPath", invalidOption(with(func(opts *Options) { opts.TrashDirPath = otherDir })))
+	assert.NoError(t, with(func(opts *Options) {
+		opts.ConflictPolicy, opts.TrashDirPath = action.ConflictTrash, otherDir
+	}).Validate())
+	assert.Equal(t, "TempDirPath", invalidOption(with(func(opts *Options) {
+		opts.TempDirPath = filepath.Join(destinationDir, "tmp")
+	})))
+	assert.Equal(t, "CopyBandwidthLimit", invalidOption(with(func(opts *Options) { opts.CopyBandwidthLimit = -1 })))
+}
+
+func TestIsSameDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links can't be created on this platform without special privileges")
+	}
+	baseDir := t.TempDir()
+	realDir, otherDir := filepath.Join(baseDir, "real"), filepath.Join(baseDir, "other")
+	assert.NoError(t, os.Mkdir(realDir, 0755))
+	assert.NoError(t, os.Mkdir(otherDir, 0755))
+	linkToDir := filepath.Join(baseDir, "link")
+	assert.NoError(t, os.Symlink(realDir, linkToDir))
+	assert.True(t, isSameDirectory(realDir, realDir))
+	// Even without resolving the symbolic link:
+	assert.True(t, isSameDirectory(realDir, linkToDir))
+	assert.False(t, isSameDirectory(realDir, otherDir))
+	assert.False(t, isSameDirectory(realDir, filepath.Join(baseDir, "non_existent")))
+}
+
+func TestCheckNotNested(t *testing.T) {
+	assert.NoError(t, checkNotNested("/data/photos", "/backup/photos"))
+	assert.NoError(t, checkNotNested("/data/photos", "/data/photos_backup"))
+	assert.Error(t, checkNotNested("/data", "/data/backup"))
+	assert.Error(t, checkNotNested("/data/backup/photos", "/data/backup"))
+}
+
+func TestCheckWorkDir(t *testing.T) {
+	sourceDir, destinationDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+	assert.NoError(t, checkWorkDir("temporary", tmpDir, sourceDir, destinationDir))
+	assert.Error(t, checkWorkDir("temporary", destinationDir, sourceDir, destinationDir))
+	insideDestination := filepath.Join(destinationDir, "tmp")
+	assert.NoError(t, os.Mkdir(insideDestination, 0755))
+	assert.Error(t, checkWorkDir("temporary", insideDestination, sourceDir, destinationDir))
+	assert.Error(t, checkWorkDir("temporary", filepath.Join(sourceDir, "tmp"), sourceDir, destinationDir))
+	if runtime.GOOS == "linux" {
+		// A different filesystem:
+		assert.Error(t, checkWorkDir("trash", "/proc", sourceDir, destinationDir))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/bytesutil"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/m-manu/rsync-sidekick/sidekick"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runSummary is a summary of a run of this tool, meant for automated pipelines (see --summary-json)
+type runSummary struct {
+	SourceDirPath          string         `json:"source"`
+	DestinationDirPath     string         `json:"destination"`
+	Mode                   string         `json:"mode"`
+	NumSourceFiles         int            `json:"source_files"`
+	NumDestFiles           int            `json:"destination_files"`
+	NumOrphans             int            `json:"orphans_at_source"`
+	NumCandidates          int            `json:"candidates_at_destination"`
+	NumActions             int            `json:"actions"`
+	ActionCountsByType     map[string]int `json:"action_counts_by_type"`
+	NumSucceeded           int            `json:"actions_succeeded"`
+	NumFailed              int            `json:"actions_failed"`
+	NumSkipped             int            `json:"actions_skipped"`
+	NumSucceededAfterRetry int            `json:"actions_succeeded_after_retry"`
+	BytesSaved             int64          `json:"bytes_saved"`
+	BytesCopiedLocally     int64          `json:"bytes_copied_locally"`
+	NumCopiedLocally       int            `json:"files_copied_locally"`
+	ResidualBytes          int64          `json:"residual_bytes"`
+	// OrphanBytes and CandidateBytes are total sizes of orphans at source and of candidates at destination
+	OrphanBytes    int64 `json:"orphan_bytes"`
+	CandidateBytes int64 `json:"candidate_bytes"`
+	// MaxBytesSaved is an upper bound on bytes saved, estimated without computing sync actions (see --scan-only)
+	MaxBytesSaved int64 `json:"max_bytes_saved,omitempty"`
+	// BwLimit is the rate (in bytes per second) beyond which files were not copied, if limited (see --bwlimit)
+	BwLimit        int64              `json:"bwlimit_bytes_per_second,omitempty"`
+	NumUnmatched   int                `json:"unmatched_orphans"`
+	NumExtraneous  int                `json:"extraneous_at_destination"`
+	ElapsedSeconds map[string]float64 `json:"elapsed_seconds"`
+	Errors         []string           `json:"errors"`
+	// Interrupted tells whether the run was stopped midway (e.g. on Ctrl-C)
+	Interrupted bool `json:"interrupted,omitempty"`
+	// TrashedFiles are files at destination moved into trash directory, being in the way of file moves (see --conflict)
+	TrashedFiles []string `json:"trashed_files,omitempty"`
+	// TempFiles are files at destination left at temporary paths, as the run was interrupted before moving them back
+	TempFiles []string `json:"temp_files,omitempty"`
+	// Pairs are summaries of each pair of directories, when many are synced in a run (see --pair)
+	Pairs []runSummary `json:"pairs,omitempty"`
+	// unmatchedOrphans are orphans at source that no sync action takes care of (i.e. files rsync would transfer)
+	unmatchedOrphans []string
+	// extraneousFiles are files at destination that don't exist at source (see service.FindExtraneous)
+	extraneousFiles []string
+	// destinationFiles are files found at destination (nil if destination wasn't scanned, e.g. when applying a plan)
+	destinationFiles map[string]entity.FileMeta
+}
+
+// Modes of a run, as reported in runSummary
+const (
+	modeApply  = "apply"
+	modeScript = "script"
+	modeAudit  = "audit"
+	// modeSavePlan is when sync actions are saved to a file (see --save-plan)
+	modeSavePlan = "save-plan"
+	// modeScanOnly is when directories are only scanned, and no sync actions are computed (see --scan-only)
+	modeScanOnly = "scan-only"
+)
+
+func newRunSummary(sourceDirPath, destinationDirPath string) runSummary {
+	return runSummary{
+		SourceDirPath:      sourceDirPath,
+		DestinationDirPath: destinationDirPath,
+		ActionCountsByType: map[string]int{},
+		ElapsedSeconds:     map[string]float64{},
+		Errors:             []string{},
+	}
+}
+
+// setStats records details of computation of sync actions
+func (s *runSummary) setStats(stats sidekick.Stats) {
+	s.NumSourceFiles, s.NumDestFiles = stats.NumSourceFiles, stats.NumDestinationFiles
+	s.NumOrphans, s.NumCandidates = stats.NumOrphans, stats.NumCandidates
+	s.OrphanBytes, s.CandidateBytes, s.MaxBytesSaved = stats.OrphanBytes, stats.CandidateBytes, stats.MaxSavingsBytes
+	for phase, elapsed := range stats.ElapsedSeconds {
+		s.ElapsedSeconds[phase] = elapsed
+	}
+	s.BytesSaved, s.ResidualBytes = stats.Bytes, stats.ResidualBytes
+	s.BytesCopiedLocally, s.NumCopiedLocally = stats.CopiedBytes, stats.NumCopied
+	s.unmatchedOrphans = stats.UnmatchedFiles
+	s.NumUnmatched = len(stats.UnmatchedFiles)
+	s.destinationFiles = stats.DestinationFiles
+	s.extraneousFiles = stats.ExtraneousFiles
+	s.NumExtraneous = len(stats.ExtraneousFiles)
+}
+
+// combineSummaries sums up summaries of many pairs of directories synced in a run
+func combineSummaries(summaries []runSummary) runSummary {
+	total := newRunSummary("", "")
+	total.Pairs = summaries
+	for _, s := range summaries {
+		if total.Mode == "" {
+			total.Mode = s.Mode
+		}
+		if total.BwLimit == 0 {
+			total.BwLimit = s.BwLimit
+		}
+		total.NumSourceFiles += s.NumSourceFiles
+		total.NumDestFiles += s.NumDestFiles
+		total.NumOrphans += s.NumOrphans
+		total.NumCandidates += s.NumCandidates
+		total.OrphanBytes += s.OrphanBytes
+		total.CandidateBytes += s.CandidateBytes
+		total.MaxBytesSaved += s.MaxBytesSaved
+		total.NumActions += s.NumActions
+		for actionType, count := range s.ActionCountsByType {
+			total.ActionCountsByType[actionType] += count
+		}
+		total.NumSucceeded += s.NumSucceeded
+		total.NumFailed += s.NumFailed
+		total.NumSkipped += s.NumSkipped
+		total.NumSucceededAfterRetry += s.NumSucceededAfterRetry
+		total.Interrupted = total.Interrupted || s.Interrupted
+		total.BytesSaved += s.BytesSaved
+		total.BytesCopiedLocally += s.BytesCopiedLocally
+		total.NumCopiedLocally += s.NumCopiedLocally
+		total.ResidualBytes += s.ResidualBytes
+		total.TrashedFiles = append(total.TrashedFiles, s.TrashedFiles...)
+		total.TempFiles = append(total.TempFiles, s.TempFiles...)
+		total.NumUnmatched += s.NumUnmatched
+		total.NumExtraneous += s.NumExtraneous
+		for phase, elapsed := range s.ElapsedSeconds {
+			total.ElapsedSeconds[phase] += elapsed
+		}
+	}
+	return total
+}
+
+// reportUnmatchedOrphans prints count and total size of orphans at source that no sync action takes care of and, if
+// reportPath is set, writes the full list of them to a file at that path
+func reportUnmatchedOrphans(summary runSummary, reportPath string) error {
+	fmte.Printf("%d files (total size %s) at source have no counterparts at destination: rsync will transfer them\n",
+		summary.NumUnmatched, bytesutil.Format(summary.ResidualBytes))
+	if reportPath == "" {
+		return nil
+	}
+	unmatchedOrphans := make([]string, len(summary.unmatchedOrphans))
+	copy(unmatchedOrphans, summary.unmatchedOrphans)
+	sort.Strings(unmatchedOrphans)
+	var sb strings.Builder
+	for _, path := range unmatchedOrphans {
+		sb.WriteString(path)
+		sb.WriteString("\n")
+	}
+	if wErr := os.WriteFile(reportPath, []byte(sb.String()), 0644); wErr != nil {
+		return fmt.Errorf("couldn't write list of unmatched files to file '%s': %+v", reportPath, wErr)
+	}
+	fmte.Printf("List of these files is in \"%s\"\n", reportPath)
+	return nil
+}
+
+// reportExtraneous prints counts of files at destination that don't exist at source: ones that sync actions move away
+// and ones that `rsync --delete` would delete. If listed is set, these files are also printed, and if reportPath is
+// set, they are written to a file at that path (one per line, after their category and a tab).
+func reportExtraneous(summary runSummary, actions []action.SyncAction, listed bool, reportPath string) error {
+	movedAway, deletable := service.SplitExtraneous(summary.extraneousFiles, actions)
+	sort.Strings(movedAway)
+	sort.Strings(deletable)
+	fmte.Printf("%d files at destination don't exist at source: %d of them are moved away by sync actions and "+
+		"rsync --delete would delete %d (total size %s)\n", len(summary.extraneousFiles), len(movedAway),
+		len(deletable), bytesutil.Format(service.TotalSize(summary.destinationFiles, deletable)))
+	if listed {
+		for _, path := range deletable {
+			fmte.Printf("  %s: %s\n", extraneousDeletable, path)
+		}
+		for _, path := range movedAway {
+			fmte.Printf("  %s: %s\n", extraneousMovedAway, path)
+		}
+	}
+	if reportPath == "" {
+		return nil
+	}
+	var sb strings.Builder
+	for _, category := range []struct {
+		name  string
+		paths []string
+	}{{extraneousDeletable, deletable}, {extraneousMovedAway, movedAway}} {
+		for _, path := range category.paths {
+			sb.WriteString(category.name)
+			sb.WriteString("\t")
+			sb.WriteString(path)
+			sb.WriteString("\n")
+		}
+	}
+	if wErr := os.WriteFile(reportPath, []byte(sb.String()), 0644); wErr != nil {
+		return fmt.Errorf("couldn't write list of extraneous files to file '%s': %+v", reportPath, wErr)
+	}
+	fmte.Printf("List of these files is in \"%s\"\n", reportPath)
+	return nil
+}
+
+// Categories of extraneous files at destination, as in output of reportExtraneous
+const (
+	extraneousDeletable = "delete"
+	extraneousMovedAway = "moved"
+)
+
+func writeSummaryJSON(summary runSummary, path string) error {
+	data, mErr := json.MarshalIndent(summary, "", "  ")
+	if mErr != nil {
+		return fmt.Errorf("couldn't convert summary to JSON: %+v", mErr)
+	}
+	if wErr := os.WriteFile(path, append(data, '\n'), 0644); wErr != nil {
+		return fmt.Errorf("couldn't write summary to file '%s': %+v", path, wErr)
+	}
+	return nil
+}
+
+// statsEntry is a key and a value, as written by writeStats
+type statsEntry struct {
+	key   string
+	value string
+}
+
+// statsEntries are discrete counts of a run, in a fixed order (their keys must never change, as scripts depend on them)
+func statsEntries(summary runSummary) []statsEntry {
+	counts := summary.ActionCountsByType
+	numMoves := counts["MoveFileAction"] + counts["MoveDirectoryAction"] + counts["SymlinkMoveAction"]
+	var elapsedSeconds float64
+	for _, elapsed := range summary.ElapsedSeconds {
+		elapsedSeconds += elapsed
+	}
+	return []statsEntry{
+		{"files_scanned_source", strconv.Itoa(summary.NumSourceFiles)},
+		{"files_scanned_dest", strconv.Itoa(summary.NumDestFiles)},
+		{"orphans", strconv.Itoa(summary.NumOrphans)},
+		{"candidates", strconv.Itoa(summary.NumCandidates)},
+		{"moves", strconv.Itoa(numMoves)},
+		{"timestamp_updates", strconv.Itoa(counts["PropagateTimestampAction"])},
+		{"mkdirs", strconv.Itoa(counts["MakeDirectoryAction"])},
+		{"copies", strconv.Itoa(counts["CopyFileAction"])},
+		{"bytes_saved", strconv.FormatInt(summary.BytesSaved+summary.BytesCopiedLocally, 10)},
+		{"elapsed_seconds", strconv.FormatFloat(elapsedSeconds, 'f', 3, 64)},
+	}
+}
+
+// writeStats writes discrete counts of a run (see --stats) as "key=value" lines or, in outputFormatJSON, as a JSON
+// object on a single line
+func writeStats(w io.Writer, summary runSummary, outputFormat string) error {
+	entries := statsEntries(summary)
+	var sb strings.Builder
+	if outputFormat == outputFormatJSON {
+		sb.WriteString("{")
+		for i, entry := range entries {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			// Values are all numbers, so they're written as they are:
+			sb.WriteString(strconv.Quote(entry.key) + ":" + entry.value)
+		}
+		sb.WriteString("}\n")
+	} else {
+		for _, entry := range entries {
+			sb.WriteString(entry.key + "=" + entry.value + "\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
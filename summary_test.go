@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"github.com/m-manu/rsync-sidekick/service"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func readSummaryJSON(t *testing.T, path string) runSummary {
+	data, err := os.ReadFile(path)
+	stopIfError(t, err)
+	var summary runSummary
+	stopIfError(t, json.Unmarshal(data, &summary))
+	return summary
+}
+
+func TestSummaryJSON(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "original.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(sourceDir, "new.go"))
+	newFileInfo, statErr := os.Stat(filepath.Join(sourceDir, "new.go"))
+	stopIfError(t, statErr)
+	versionFileInfo, statErr := os.Stat(filepath.Join(sourceDir, "renamed.txt"))
+	stopIfError(t, statErr)
+	summaryPath := filepath.Join(outDir, "summary.json")
+	// Script generation:
+	returnedSummary, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir,
+		runOptions{
+			outputScriptPath: filepath.Join(outDir, "script.sh"),
+			summaryJSONPath:  summaryPath,
+		})
+	assert.NoError(t, err)
+	summary := readSummaryJSON(t, summaryPath)
+	assert.Equal(t, summary.NumActions, returnedSummary.NumActions)
+	assert.Equal(t, modeScript, summary.Mode)
+	assert.Equal(t, 1, summary.NumActions)
+	assert.Equal(t, 0, summary.NumSucceeded)
+	// Applying actions:
+	_, err = rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		summaryJSONPath: summaryPath,
+	})
+	assert.NoError(t, err)
+	summary = readSummaryJSON(t, summaryPath)
+	assert.Equal(t, modeApply, summary.Mode)
+	assert.Equal(t, sourceDir, summary.SourceDirPath)
+	assert.Equal(t, destinationDir, summary.DestinationDirPath)
+	assert.Equal(t, 2, summary.NumSourceFiles)
+	assert.Equal(t, 1, summary.NumDestFiles)
+	assert.Equal(t, 2, summary.NumOrphans)
+	assert.Equal(t, 1, summary.NumActions)
+	assert.Equal(t, map[string]int{"MoveFileAction": 1}, summary.ActionCountsByType)
+	assert.Equal(t, 1, summary.NumSucceeded)
+	assert.Equal(t, 0, summary.NumFailed)
+	assert.Equal(t, versionFileInfo.Size(), summary.BytesSaved)
+	assert.Equal(t, newFileInfo.Size(), summary.ResidualBytes)
+	assert.Contains(t, summary.ElapsedSeconds, "scan")
+	assert.Contains(t, summary.ElapsedSeconds, "index")
+	assert.Contains(t, summary.ElapsedSeconds, "apply")
+	assert.Empty(t, summary.Errors)
+}
+
+func TestScanOnly(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "original.txt"))
+	versionFileInfo, statErr := os.Stat(filepath.Join(sourceDir, "renamed.txt"))
+	stopIfError(t, statErr)
+	summaryPath := filepath.Join(outDir, "summary.json")
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		scanOnly:        true,
+		summaryJSONPath: summaryPath,
+	})
+	assert.NoError(t, err)
+	summary := readSummaryJSON(t, summaryPath)
+	assert.Equal(t, modeScanOnly, summary.Mode)
+	assert.Equal(t, 1, summary.NumOrphans)
+	assert.Equal(t, 1, summary.NumCandidates)
+	assert.Equal(t, 0, summary.NumActions)
+	assert.Equal(t, versionFileInfo.Size(), summary.MaxBytesSaved)
+	// Nothing is written:
+	assert.FileExists(t, filepath.Join(destinationDir, "original.txt"))
+	assert.NoFileExists(t, filepath.Join(destinationDir, "renamed.txt"))
+}
+
+func TestUnmatchedReport(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(sourceDir, "renamed.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(destinationDir, "original.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/pipe.go"), filepath.Join(sourceDir, "new.go"))
+	// Ignored due to --min-size, and hence transferred by rsync:
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(sourceDir, "small_renamed.txt"))
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "small.txt"))
+	reportPath, summaryPath := filepath.Join(outDir, "unmatched.txt"), filepath.Join(outDir, "summary.json")
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		audit:               true,
+		syncOptions:         service.SyncOptions{MinSize: 1024},
+		unmatchedReportPath: reportPath,
+		summaryJSONPath:     summaryPath,
+	})
+	stopIfError(t, err)
+	report, err := os.ReadFile(reportPath)
+	stopIfError(t, err)
+	assert.Equal(t, "new.go\nsmall_renamed.txt\n", string(report))
+	summary := readSummaryJSON(t, summaryPath)
+	assert.Equal(t, 2, summary.NumUnmatched)
+	pipeInfo, err := os.Stat(filepath.Join(sourceDir, "new.go"))
+	stopIfError(t, err)
+	versionInfo, err := os.Stat(filepath.Join(sourceDir, "small_renamed.txt"))
+	stopIfError(t, err)
+	assert.Equal(t, pipeInfo.Size()+versionInfo.Size(), summary.ResidualBytes)
+}
+
+func TestExtraneousReport(t *testing.T) {
+	fmte.Off()
+	sourceDir, destinationDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(sourceDir, "renamed.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/io.go"), filepath.Join(destinationDir, "original.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/pipe.go"), filepath.Join(sourceDir, "same.go"))
+	copyFile(filepath.Join(runtime.GOROOT(), "src/io/pipe.go"), filepath.Join(destinationDir, "same.go"))
+	// Deleted at source:
+	copyFile(filepath.Join(runtime.GOROOT(), "VERSION"), filepath.Join(destinationDir, "deleted.txt"))
+	reportPath, summaryPath := filepath.Join(outDir, "extraneous.txt"), filepath.Join(outDir, "summary.json")
+	_, err := rsyncSidekick(context.Background(), runID, sourceDir, exclusionsForTests, destinationDir, runOptions{
+		audit:                true,
+		reportExtraneous:     true,
+		extraneousReportPath: reportPath,
+		summaryJSONPath:      summaryPath,
+	})
+	stopIfError(t, err)
+	report, err := os.ReadFile(reportPath)
+	stopIfError(t, err)
+	assert.Equal(t, "delete\tdeleted.txt\nmoved\toriginal.go\n", string(report))
+	assert.Equal(t, 2, readSummaryJSON(t, summaryPath).NumExtraneous)
+	// Nothing is changed, as this is an audit:
+	assert.FileExists(t, filepath.Join(destinationDir, "original.go"))
+}
+
+func TestWriteStats(t *testing.T) {
+	summary := newRunSummary("/s", "/d")
+	summary.NumSourceFiles, summary.NumDestFiles, summary.NumOrphans, summary.NumCandidates = 10, 9, 3, 4
+	summary.ActionCountsByType = map[string]int{"MoveFileAction": 2, "MoveDirectoryAction": 1,
+		"PropagateTimestampAction": 1, "MakeDirectoryAction": 1}
+	summary.BytesSaved, summary.BytesCopiedLocally = 1000, 24
+	summary.ElapsedSeconds = map[string]float64{"scan": 1.5, "index": 0.25}
+	var text, jsonText bytes.Buffer
+	stopIfError(t, writeStats(&text, summary, outputFormatText))
+	assert.Equal(t, "files_scanned_source=10\nfiles_scanned_dest=9\norphans=3\ncandidates=4\nmoves=3\n"+
+		"timestamp_updates=1\nmkdirs=1\ncopies=0\nbytes_saved=1024\nelapsed_seconds=1.750\n", text.String())
+	stopIfError(t, writeStats(&jsonText, summary, outputFormatJSON))
+	var stats map[string]float64
+	stopIfError(t, json.Unmarshal(jsonText.Bytes(), &stats))
+	assert.Equal(t, map[string]float64{"files_scanned_source": 10, "files_scanned_dest": 9, "orphans": 3,
+		"candidates": 4, "moves": 3, "timestamp_updates": 1, "mkdirs": 1, "copies": 0, "bytes_saved": 1024,
+		"elapsed_seconds": 1.75}, stats)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/m-manu/rsync-sidekick/fmte"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Markers of lines in output of treeDiff
+const (
+	treeDiffRemoved = "-"
+	treeDiffAdded   = "+"
+	treeDiffTouched = "~"
+)
+
+// treeDiff computes a diff-like view of relative paths at destination before and after the sync actions are performed
+// (without performing them): paths that go away, paths that come up (directories end with a path separator) and paths
+// whose timestamps (or permissions, or owners) are touched. Lines are sorted by path.
+func treeDiff(destinationFiles map[string]entity.FileMeta, actions []action.SyncAction, destinationDirPath string,
+) []string {
+	before := set.NewThreadUnsafeSetWithSize[string](len(destinationFiles))
+	for relativePath := range destinationFiles {
+		before.Add(relativePath)
+	}
+	after := before.Clone()
+	touched := set.NewThreadUnsafeSet[string]()
+	move := func(from string, to string) {
+		after.Remove(from)
+		after.Add(to)
+	}
+	// Where cycles of moves are broken through doesn't matter, as what's moved aside is moved back:
+	for _, a := range action.SortByDependencies(actions, action.Settings{}) {
+		switch syncAction := a.(type) {
+		case action.MoveFileAction:
+			move(syncAction.RelativeFromPath, syncAction.RelativeToPath)
+		case action.SymlinkMoveAction:
+			// Symbolic links aren't among files scanned at destination
+			if !after.Contains(syncAction.RelativeFromPath) {
+				before.Add(syncAction.RelativeFromPath)
+				after.Add(syncAction.RelativeFromPath)
+			}
+			move(syncAction.RelativeFromPath, syncAction.RelativeToPath)
+		case action.MoveDirectoryAction:
+			prefix := syncAction.RelativeFromPath + string(filepath.Separator)
+			for _, relativePath := range after.ToSlice() {
+				if strings.HasPrefix(relativePath, prefix) {
+					move(relativePath, syncAction.RelativeToPath+string(filepath.Separator)+
+						strings.TrimPrefix(relativePath, prefix))
+				}
+			}
+		case action.CopyFileAction:
+			after.Add(syncAction.RelativeToPath)
+		case action.RemoveFileAction:
+			after.Remove(syncAction.RelativePath)
+		case action.PropagateTimestampAction:
+			touched.Add(syncAction.DestinationFileRelativePath)
+		case action.ChmodAction:
+			touched.Add(syncAction.RelativePath)
+		case action.ChownAction:
+			touched.Add(syncAction.RelativePath)
+		case action.MakeDirectoryAction:
+			if relativePath, err := filepath.Rel(destinationDirPath, syncAction.AbsoluteDirPath); err == nil {
+				after.Add(relativePath + string(filepath.Separator))
+			}
+		case action.RemoveDirectoryAction:
+			if relativePath, err := filepath.Rel(destinationDirPath, syncAction.AbsoluteDirPath); err == nil {
+				before.Add(relativePath + string(filepath.Separator))
+				after.Remove(relativePath + string(filepath.Separator))
+			}
+		}
+	}
+	changedPaths := before.SymmetricDifference(after).Union(touched.Intersect(before).Intersect(after)).ToSlice()
+	sort.Strings(changedPaths)
+	lines := make([]string, 0, len(changedPaths))
+	for _, relativePath := range changedPaths {
+		if !after.Contains(relativePath) {
+			lines = append(lines, treeDiffRemoved+" "+relativePath)
+		} else if !before.Contains(relativePath) {
+			lines = append(lines, treeDiffAdded+" "+relativePath)
+		} else {
+			lines = append(lines, treeDiffTouched+" "+relativePath)
+		}
+	}
+	return lines
+}
+
+// printTreeDiff prints output of treeDiff, along with counts of paths by marker
+func printTreeDiff(destinationFiles map[string]entity.FileMeta, actions []action.SyncAction,
+	destinationDirPath string,
+) {
+	lines := treeDiff(destinationFiles, actions, destinationDirPath)
+	fmte.Printf("Destination tree before and after (%s: goes away, %s: comes up, %s: timestamp/permissions/owner "+
+		"are touched):\n",
+		treeDiffRemoved, treeDiffAdded, treeDiffTouched)
+	fmte.Printf("--- %s (before)\n+++ %s (after)\n", destinationDirPath, destinationDirPath)
+	counts := map[string]int{}
+	for _, line := range lines {
+		fmte.Println(line)
+		counts[line[:1]]++
+	}
+	fmte.Printf("%d paths go away, %d paths come up and %d paths are touched\n", counts[treeDiffRemoved],
+		counts[treeDiffAdded], counts[treeDiffTouched])
+}
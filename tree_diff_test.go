@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/m-manu/rsync-sidekick/action"
+	"github.com/m-manu/rsync-sidekick/entity"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeDiff(t *testing.T) {
+	const destinationDirPath = "/backup"
+	destinationFiles := map[string]entity.FileMeta{
+		"a.txt":                           {Size: 10},
+		"unchanged.txt":                   {Size: 20},
+		"touched.txt":                     {Size: 30},
+		filepath.Join("old", "b.txt"):     {Size: 40},
+		filepath.Join("photos", "c.jpg"):  {Size: 50},
+		filepath.Join("photos", "d.jpg"):  {Size: 60},
+		filepath.Join("archive", "e.txt"): {Size: 70},
+	}
+	actions := []action.SyncAction{
+		action.PropagateTimestampAction{
+			SourceBaseDirPath:           "/data",
+			DestinationBaseDirPath:      destinationDirPath,
+			SourceFileRelativePath:      "touched.txt",
+			DestinationFileRelativePath: "touched.txt",
+		},
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: filepath.Join("old", "b.txt"),
+			RelativeToPath: filepath.Join("new", "b.txt")},
+		action.MakeDirectoryAction{AbsoluteDirPath: filepath.Join(destinationDirPath, "new")},
+		action.MoveDirectoryAction{BasePath: destinationDirPath, RelativeFromPath: "photos",
+			RelativeToPath: "pictures"},
+		action.MoveFileAction{BasePath: destinationDirPath, RelativeFromPath: "a.txt",
+			RelativeToPath: "renamed.txt"},
+		action.SymlinkMoveAction{BasePath: destinationDirPath, RelativeFromPath: "latest",
+			RelativeToPath: "current"},
+	}
+	assert.Equal(t, []string{
+		"- a.txt",
+		"+ current",
+		"- latest",
+		"+ new" + string(filepath.Separator),
+		"+ " + filepath.Join("new", "b.txt"),
+		"- " + filepath.Join("old", "b.txt"),
+		"- " + filepath.Join("photos", "c.jpg"),
+		"- " + filepath.Join("photos", "d.jpg"),
+		"+ " + filepath.Join("pictures", "c.jpg"),
+		"+ " + filepath.Join("pictures", "d.jpg"),
+		"+ renamed.txt",
+		"~ touched.txt",
+	}, treeDiff(destinationFiles, actions, destinationDirPath))
+	assert.Empty(t, treeDiff(destinationFiles, nil, destinationDirPath))
+}